@@ -0,0 +1,268 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+// DefaultUnhealthyThreshold is the number of consecutive 5xx responses
+// after which an upstream is reported unhealthy.
+const DefaultUnhealthyThreshold = 5
+
+type routerStats struct {
+	requests int64
+	inFlight int64
+	noMatch  int64
+	rejected int64
+	draining int32
+}
+
+type upstreamStats struct {
+	requests    int64
+	inFlight    int64
+	failures    int64
+	consecutive int64
+	// lastFailure is the time of the last 5xx response in UnixNano
+	lastFailure int64
+	draining    int32
+	// requestBytes and responseBytes count the bodies of the requests
+	requestBytes  int64
+	responseBytes int64
+}
+
+func (s *upstreamStats) isDraining() bool {
+	return atomic.LoadInt32(&s.draining) == 1
+}
+
+func (s *upstreamStats) begin() {
+	atomic.AddInt64(&s.requests, 1)
+	atomic.AddInt64(&s.inFlight, 1)
+}
+
+func (s *upstreamStats) transferred(t Transfer) {
+	atomic.AddInt64(&s.requestBytes, t.RequestBytes)
+	atomic.AddInt64(&s.responseBytes, t.ResponseBytes)
+}
+
+func (s *upstreamStats) end(statusCode int) {
+	atomic.AddInt64(&s.inFlight, -1)
+	if statusCode < consts.StatusInternalServerError {
+		s.succeed()
+		return
+	}
+	s.fail()
+}
+
+func (s *upstreamStats) succeed() {
+	atomic.StoreInt64(&s.consecutive, 0)
+}
+
+func (s *upstreamStats) fail() {
+	atomic.AddInt64(&s.failures, 1)
+	atomic.AddInt64(&s.consecutive, 1)
+	atomic.StoreInt64(&s.lastFailure, time.Now().UnixNano())
+}
+
+func (s *upstreamStats) isHealthy() bool {
+	return atomic.LoadInt64(&s.consecutive) < DefaultUnhealthyThreshold
+}
+
+// snapshot returns the stats of target.
+func (s *upstreamStats) snapshot(target string) UpstreamStats {
+	us := UpstreamStats{
+		Target:              target,
+		Requests:            atomic.LoadInt64(&s.requests),
+		InFlight:            atomic.LoadInt64(&s.inFlight),
+		Failures:            atomic.LoadInt64(&s.failures),
+		ConsecutiveFailures: atomic.LoadInt64(&s.consecutive),
+		RequestBytes:        atomic.LoadInt64(&s.requestBytes),
+		ResponseBytes:       atomic.LoadInt64(&s.responseBytes),
+	}
+	if t := atomic.LoadInt64(&s.lastFailure); t != 0 {
+		us.LastFailure = time.Unix(0, t)
+	}
+	us.Healthy = us.ConsecutiveFailures < DefaultUnhealthyThreshold
+	us.Draining = s.isDraining()
+	return us
+}
+
+// RouterStats are the request counters of a Router.
+type RouterStats struct {
+	// Requests is the number of requests forwarded to a route.
+	Requests int64 `json:"requests"`
+	InFlight int64 `json:"in_flight"`
+	// NoMatch is the number of requests matching no route.
+	NoMatch int64 `json:"no_match"`
+	// Rejected is the number of requests rejected while draining, the
+	// Router or every upstream the request could go to.
+	Rejected int64 `json:"rejected"`
+	Draining bool  `json:"draining"`
+	Routes   int   `json:"routes"`
+}
+
+// UpstreamStats are the counters and passive health of a route target.
+type UpstreamStats struct {
+	Target   string `json:"target"`
+	Requests int64  `json:"requests"`
+	InFlight int64  `json:"in_flight"`
+	// Failures counts 5xx responses, including those of the proxy when
+	// the target could not be reached.
+	Failures            int64     `json:"failures"`
+	ConsecutiveFailures int64     `json:"consecutive_failures"`
+	LastFailure         time.Time `json:"last_failure"`
+	// Healthy is false after DefaultUnhealthyThreshold consecutive failures.
+	Healthy bool `json:"healthy"`
+	// Draining is set between DrainUpstream and ResumeUpstream.
+	Draining bool `json:"draining"`
+	// RequestBytes and ResponseBytes are the body bytes read from and
+	// written to clients, including streamed bodies.
+	RequestBytes  int64 `json:"request_bytes"`
+	ResponseBytes int64 `json:"response_bytes"`
+}
+
+// Stats returns the request counters of rt.
+func (rt *Router) Stats() RouterStats {
+	return RouterStats{
+		Requests: atomic.LoadInt64(&rt.stats.requests),
+		InFlight: atomic.LoadInt64(&rt.stats.inFlight),
+		NoMatch:  atomic.LoadInt64(&rt.stats.noMatch),
+		Rejected: atomic.LoadInt64(&rt.stats.rejected),
+		Draining: rt.Draining(),
+		Routes:   len(rt.loadTable().routes),
+	}
+}
+
+// Upstreams returns the stats of the targets of the current routes,
+// ordered by target.
+func (rt *Router) Upstreams() []UpstreamStats {
+	upstreams := rt.loadTable().upstreams
+	stats := make([]UpstreamStats, 0, len(upstreams))
+	for target, s := range upstreams {
+		stats = append(stats, s.snapshot(target))
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Target < stats[j].Target })
+	return stats
+}
+
+// Drain makes rt reject new requests with 503 Service Unavailable and
+// "Connection: close", e.g. before a shutdown, while requests in flight
+// complete. Stats().InFlight tells when they are done.
+func (rt *Router) Drain() {
+	atomic.StoreInt32(&rt.stats.draining, 1)
+}
+
+// Resume makes rt accept requests again after Drain.
+func (rt *Router) Resume() {
+	atomic.StoreInt32(&rt.stats.draining, 0)
+}
+
+// Draining reports whether rt rejects requests, see Drain.
+func (rt *Router) Draining() bool {
+	return atomic.LoadInt32(&rt.stats.draining) == 1
+}
+
+// DrainUpstream stops sending new requests to target, e.g. before
+// deploying it, while requests in flight and tunnelled connections
+// complete. UpstreamStats.InFlight tells when they are done. Requests
+// go to the next matching route instead, as if the routes of target
+// did not exist, and are rejected like by Drain if there is none.
+// The state is kept across table updates. DrainUpstream reports
+// whether target is the Target of a current route.
+func (rt *Router) DrainUpstream(target string) bool {
+	return rt.setUpstreamDraining(target, 1)
+}
+
+// ResumeUpstream sends requests to target again after DrainUpstream.
+func (rt *Router) ResumeUpstream(target string) bool {
+	return rt.setUpstreamDraining(target, 0)
+}
+
+func (rt *Router) setUpstreamDraining(target string, draining int32) bool {
+	s, ok := rt.loadTable().upstreams[target]
+	if ok {
+		atomic.StoreInt32(&s.draining, draining)
+	}
+	return ok
+}
+
+// RegisterAdmin registers admin endpoints of rt, preferably on a separate
+// server only reachable by operators:
+//
+//	admin := server.New(server.WithHostPorts("127.0.0.1:9901"))
+//	rt.RegisterAdmin(admin)
+//	go admin.Spin()
+//
+// The endpoints are
+//
+//	GET    /routes     the current routes, as in a routes file
+//	GET    /upstreams  counters and health of each target, see Upstreams
+//	GET    /stats      request counters, see Stats
+//	GET    /ready      200, or 503 while draining, for load balancer checks
+//	POST   /drain      reject new requests, see Drain
+//	DELETE /drain      accept requests again
+//	POST   /upstreams/drain?target=...  drain a target, see DrainUpstream
+//	DELETE /upstreams/drain?target=...  resume a target
+//
+// Draining an unknown target answers 404 Not Found.
+func (rt *Router) RegisterAdmin(r route.IRoutes) {
+	r.GET("/routes", func(ctx context.Context, c *app.RequestContext) {
+		routes := rt.Routes()
+		rc := RoutesConfig{Routes: make([]RouteConfig, 0, len(routes))}
+		for _, route := range routes {
+			rc.Routes = append(rc.Routes, route.Config())
+		}
+		c.JSON(consts.StatusOK, rc)
+	})
+	r.GET("/upstreams", func(ctx context.Context, c *app.RequestContext) {
+		c.JSON(consts.StatusOK, rt.Upstreams())
+	})
+	r.GET("/stats", func(ctx context.Context, c *app.RequestContext) {
+		c.JSON(consts.StatusOK, rt.Stats())
+	})
+	r.GET("/ready", func(ctx context.Context, c *app.RequestContext) {
+		if rt.Draining() {
+			c.String(consts.StatusServiceUnavailable, "draining")
+			return
+		}
+		c.String(consts.StatusOK, "ready")
+	})
+	r.POST("/drain", func(ctx context.Context, c *app.RequestContext) {
+		rt.Drain()
+		c.JSON(consts.StatusOK, rt.Stats())
+	})
+	r.DELETE("/drain", func(ctx context.Context, c *app.RequestContext) {
+		rt.Resume()
+		c.JSON(consts.StatusOK, rt.Stats())
+	})
+	upstreamDrain := func(set func(target string) bool) app.HandlerFunc {
+		return func(ctx context.Context, c *app.RequestContext) {
+			if !set(c.Query("target")) {
+				c.String(consts.StatusNotFound, "unknown target")
+				return
+			}
+			c.JSON(consts.StatusOK, rt.Upstreams())
+		}
+	}
+	r.POST("/upstreams/drain", upstreamDrain(rt.DrainUpstream))
+	r.DELETE("/upstreams/drain", upstreamDrain(rt.ResumeUpstream))
+}
@@ -0,0 +1,169 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/client"
+	"github.com/cloudwego/hertz/pkg/app/server"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestRouterAdmin(t *testing.T) {
+	backend := server.New(server.WithHostPorts("127.0.0.1:10038"))
+	backend.GET("/ok", func(cc context.Context, ctx *app.RequestContext) {
+		ctx.String(200, "ok")
+	})
+	backend.GET("/fail", func(cc context.Context, ctx *app.RequestContext) {
+		ctx.String(500, "fail")
+	})
+	go backend.Spin()
+
+	rt, err := NewRouter([]Route{
+		{Path: "/ok", Target: "http://127.0.0.1:10038"},
+		{Path: "/fail", Target: "http://127.0.0.1:10038/"},
+		{Path: "/down", Target: "http://127.0.0.1:10009", Timeout: time.Second},
+	})
+	assert.Nil(t, err)
+	r := server.New(server.WithHostPorts("127.0.0.1:10039"))
+	r.Use(rt.ServeHTTP)
+	go r.Spin()
+	admin := server.New(server.WithHostPorts("127.0.0.1:10040"))
+	rt.RegisterAdmin(admin.Group("/admin"))
+	go admin.Spin()
+	time.Sleep(time.Second)
+
+	cli, _ := client.NewClient()
+	do := func(method, uri string) *protocol.Response {
+		req, resp := protocol.AcquireRequest(), &protocol.Response{}
+		defer protocol.ReleaseRequest(req)
+		req.SetMethod(method)
+		req.SetRequestURI(uri)
+		assert.Nil(t, cli.Do(context.Background(), req, resp))
+		return resp
+	}
+
+	assert.DeepEqual(t, 200, do("GET", "http://127.0.0.1:10039/ok").StatusCode())
+	for i := 0; i < DefaultUnhealthyThreshold; i++ {
+		assert.DeepEqual(t, 500, do("GET", "http://127.0.0.1:10039/fail").StatusCode())
+	}
+	assert.DeepEqual(t, 502, do("GET", "http://127.0.0.1:10039/down").StatusCode())
+	assert.DeepEqual(t, 404, do("GET", "http://127.0.0.1:10039/none").StatusCode())
+
+	var upstreams []UpstreamStats
+	assert.Nil(t, json.Unmarshal(do("GET", "http://127.0.0.1:10040/admin/upstreams").Body(), &upstreams))
+	assert.DeepEqual(t, 3, len(upstreams))
+	assert.DeepEqual(t, "http://127.0.0.1:10009", upstreams[0].Target)
+	assert.DeepEqual(t, int64(1), upstreams[0].Failures)
+	assert.True(t, upstreams[0].Healthy)
+	assert.DeepEqual(t, "http://127.0.0.1:10038", upstreams[1].Target)
+	assert.DeepEqual(t, int64(1), upstreams[1].Requests)
+	assert.DeepEqual(t, int64(0), upstreams[1].Failures)
+	assert.DeepEqual(t, int64(2), upstreams[1].ResponseBytes)
+	assert.DeepEqual(t, "http://127.0.0.1:10038/", upstreams[2].Target)
+	assert.DeepEqual(t, int64(DefaultUnhealthyThreshold), upstreams[2].ConsecutiveFailures)
+	assert.False(t, upstreams[2].Healthy)
+	assert.False(t, upstreams[2].LastFailure.IsZero())
+
+	var routes RoutesConfig
+	assert.Nil(t, json.Unmarshal(do("GET", "http://127.0.0.1:10040/admin/routes").Body(), &routes))
+	assert.DeepEqual(t, 3, len(routes.Routes))
+	assert.DeepEqual(t, "/down", routes.Routes[2].Path)
+	assert.DeepEqual(t, Duration(time.Second), routes.Routes[2].Timeout)
+
+	var stats RouterStats
+	assert.Nil(t, json.Unmarshal(do("GET", "http://127.0.0.1:10040/admin/stats").Body(), &stats))
+	assert.DeepEqual(t, RouterStats{Requests: 2 + DefaultUnhealthyThreshold, NoMatch: 1, Routes: 3}, stats)
+
+	// draining
+	assert.DeepEqual(t, 200, do("GET", "http://127.0.0.1:10040/admin/ready").StatusCode())
+	assert.DeepEqual(t, 200, do("POST", "http://127.0.0.1:10040/admin/drain").StatusCode())
+	assert.True(t, rt.Draining())
+	assert.DeepEqual(t, 503, do("GET", "http://127.0.0.1:10040/admin/ready").StatusCode())
+	resp := do("GET", "http://127.0.0.1:10039/ok")
+	assert.DeepEqual(t, 503, resp.StatusCode())
+	assert.True(t, resp.Header.ConnectionClose())
+	assert.DeepEqual(t, 200, do("DELETE", "http://127.0.0.1:10040/admin/drain").StatusCode())
+	assert.DeepEqual(t, 200, do("GET", "http://127.0.0.1:10039/ok").StatusCode())
+	assert.DeepEqual(t, int64(1), rt.Stats().Rejected)
+
+	// stats survive table updates
+	assert.Nil(t, rt.AddRoute(Route{Path: "/ok2", Target: "http://127.0.0.1:10038"}))
+	for _, us := range rt.Upstreams() {
+		if us.Target == "http://127.0.0.1:10038" {
+			assert.DeepEqual(t, int64(2), us.Requests)
+		}
+	}
+}
+
+func TestRouterDrainUpstream(t *testing.T) {
+	backend := server.New(server.WithHostPorts("127.0.0.1:10041"))
+	backend.Any("/*path", func(cc context.Context, ctx *app.RequestContext) {
+		ctx.String(200, string(ctx.Request.URI().Path()))
+	})
+	go backend.Spin()
+
+	rt, err := NewRouter([]Route{
+		{Path: "/api/", Target: "http://127.0.0.1:10041/blue"},
+		{Path: "/", Target: "http://127.0.0.1:10041/green"},
+	})
+	assert.Nil(t, err)
+	r := server.New(server.WithHostPorts("127.0.0.1:10042"))
+	r.Use(rt.ServeHTTP)
+	go r.Spin()
+	admin := server.New(server.WithHostPorts("127.0.0.1:10043"))
+	rt.RegisterAdmin(admin)
+	go admin.Spin()
+	time.Sleep(time.Second)
+
+	cli, _ := client.NewClient()
+	do := func(method, uri string) *protocol.Response {
+		req, resp := protocol.AcquireRequest(), &protocol.Response{}
+		defer protocol.ReleaseRequest(req)
+		req.SetMethod(method)
+		req.SetRequestURI(uri)
+		assert.Nil(t, cli.Do(context.Background(), req, resp))
+		return resp
+	}
+
+	assert.DeepEqual(t, "/blue/api/x", string(do("GET", "http://127.0.0.1:10042/api/x").Body()))
+
+	// the next matching route takes over
+	assert.DeepEqual(t, 200, do("POST", "http://127.0.0.1:10043/upstreams/drain?target=http://127.0.0.1:10041/blue").StatusCode())
+	assert.DeepEqual(t, "/green/api/x", string(do("GET", "http://127.0.0.1:10042/api/x").Body()))
+	assert.True(t, rt.Upstreams()[0].Draining)
+
+	// draining survives table updates
+	assert.Nil(t, rt.AddRoute(Route{Path: "/other", Target: "http://127.0.0.1:10041/green"}))
+	assert.DeepEqual(t, "/green/api/x", string(do("GET", "http://127.0.0.1:10042/api/x").Body()))
+
+	// no route left
+	assert.True(t, rt.DrainUpstream("http://127.0.0.1:10041/green"))
+	resp := do("GET", "http://127.0.0.1:10042/api/x")
+	assert.DeepEqual(t, 503, resp.StatusCode())
+	assert.True(t, resp.Header.ConnectionClose())
+	assert.DeepEqual(t, int64(1), rt.Stats().Rejected)
+
+	assert.DeepEqual(t, 200, do("DELETE", "http://127.0.0.1:10043/upstreams/drain?target=http://127.0.0.1:10041/blue").StatusCode())
+	assert.DeepEqual(t, "/blue/api/x", string(do("GET", "http://127.0.0.1:10042/api/x").Body()))
+	assert.DeepEqual(t, 404, do("POST", "http://127.0.0.1:10043/upstreams/drain?target=http://unknown").StatusCode())
+	assert.False(t, rt.ResumeUpstream("http://unknown"))
+}
@@ -0,0 +1,133 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// APIVersion is a version of the API of APIVersions.
+type APIVersion struct {
+	// Name is the version as path segment and header value, e.g. "v1".
+	Name string `json:"name" yaml:"name"`
+	// Target is the backend of the version.
+	Target string `json:"target" yaml:"target"`
+}
+
+// APIVersions routes the versions of an API to their backends, by the path
+// segment below Prefix, e.g. "/api/v1/users", or, for requests without one,
+// by the value of Header, e.g. "X-API-Version: v1", which is translated to
+// that path segment, else to the Default version. For example
+//
+//	routes, err := reverseproxy.APIVersions{
+//		Prefix:   "/api/",
+//		Header:   "X-API-Version",
+//		Default:  "v2",
+//		Versions: []reverseproxy.APIVersion{{Name: "v1", Target: "http://legacy:8080"}, {Name: "v2", Target: "http://api:8080"}},
+//	}.Routes()
+//
+// forwards "/api/v1/users" to the legacy backend and "/api/users" to
+// "http://api:8080/api/v2/users". In a routes file, they are listed under
+// "apis", see RoutesConfig.
+type APIVersions struct {
+	// Name names the routes of each version Name/version, e.g. "orders/v1",
+	// if set, see Route.Name.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Host restricts the routes to a host, see Route.Host.
+	Host string `json:"host,omitempty" yaml:"host,omitempty"`
+	// Prefix is the path of the API, which the version follows, "/" by
+	// default. It must start and end with "/".
+	Prefix string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+	// Header chooses the version of requests without one in the path, if set.
+	Header string `json:"header,omitempty" yaml:"header,omitempty"`
+	// Default is the version of requests with neither, which are not routed
+	// if empty.
+	Default string `json:"default,omitempty" yaml:"default,omitempty"`
+	// StripVersion forwards paths without version segment, e.g.
+	// "/api/v1/users" as "/api/users", for backends serving one version.
+	StripVersion bool         `json:"strip_version,omitempty" yaml:"strip_version,omitempty"`
+	Versions     []APIVersion `json:"versions" yaml:"versions"`
+}
+
+// Routes returns the routes of the versions for a Router.
+func (a APIVersions) Routes() ([]Route, error) {
+	prefix := a.Prefix
+	if prefix == "" {
+		prefix = "/"
+	}
+	if !strings.HasPrefix(prefix, "/") || !strings.HasSuffix(prefix, "/") {
+		return nil, fmt.Errorf("reverseproxy: API prefix %q must start and end with /", prefix)
+	}
+	if len(a.Versions) == 0 {
+		return nil, fmt.Errorf("reverseproxy: API %q needs versions", prefix)
+	}
+	routes := make([]Route, 0, 2*len(a.Versions)+1)
+	seen := make(map[string]bool, len(a.Versions))
+	for _, v := range a.Versions {
+		if v.Name == "" || strings.ContainsAny(v.Name, "/?#") {
+			return nil, fmt.Errorf("reverseproxy: API %q: invalid version %q", prefix, v.Name)
+		}
+		if seen[v.Name] {
+			return nil, fmt.Errorf("reverseproxy: API %q: duplicate version %q", prefix, v.Name)
+		}
+		seen[v.Name] = true
+		route := a.route(v, prefix+v.Name+"/")
+		if a.StripVersion {
+			route.StripPrefix = true
+			route.AddPrefix = strings.TrimSuffix(prefix, "/")
+		}
+		routes = append(routes, route)
+		if a.Header != "" {
+			route = a.unversionedRoute(v, prefix)
+			route.Headers = map[string]string{a.Header: v.Name}
+			routes = append(routes, route)
+		}
+	}
+	if a.Default != "" {
+		if !seen[a.Default] {
+			return nil, fmt.Errorf("reverseproxy: API %q: unknown default version %q", prefix, a.Default)
+		}
+		for _, v := range a.Versions {
+			if v.Name == a.Default {
+				routes = append(routes, a.unversionedRoute(v, prefix))
+			}
+		}
+	}
+	return routes, nil
+}
+
+func (a APIVersions) route(v APIVersion, path string) Route {
+	route := Route{Host: a.Host, Path: path, Target: v.Target}
+	if a.Name != "" {
+		route.Name = a.Name + "/" + v.Name
+	}
+	return route
+}
+
+// unversionedRoute is the route of paths below prefix without version
+// which go to v, inserting its version segment unless StripVersion.
+func (a APIVersions) unversionedRoute(v APIVersion, prefix string) Route {
+	route := a.route(v, prefix)
+	switch {
+	case a.StripVersion:
+	case prefix == "/":
+		route.AddPrefix = "/" + v.Name
+	default:
+		route.StripPrefix = true
+		route.AddPrefix = prefix + v.Name
+	}
+	return route
+}
@@ -0,0 +1,132 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/client"
+	"github.com/cloudwego/hertz/pkg/app/server"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestAPIVersions(t *testing.T) {
+	backend := server.New(server.WithHostPorts("127.0.0.1:10066"))
+	backend.GET("/*path", func(cc context.Context, ctx *app.RequestContext) {
+		ctx.String(200, string(ctx.Request.URI().Path()))
+	})
+	go backend.Spin()
+
+	routes, err := APIVersions{
+		Prefix:  "/api/",
+		Header:  "X-API-Version",
+		Default: "v2",
+		Versions: []APIVersion{
+			{Name: "v1", Target: "http://127.0.0.1:10066/legacy"},
+			{Name: "v2", Target: "http://127.0.0.1:10066/new"},
+		},
+	}.Routes()
+	assert.Nil(t, err)
+	rt, err := NewRouter(routes)
+	assert.Nil(t, err)
+	rt.SetNoMatchStatus(404)
+	r := server.New(server.WithHostPorts("127.0.0.1:10067"))
+	r.Use(rt.ServeHTTP)
+	go r.Spin()
+	time.Sleep(time.Second)
+
+	cli, _ := client.NewClient()
+	for _, tt := range []struct {
+		path, version string
+		want          string
+	}{
+		{"/api/v1/users", "", "/legacy/api/v1/users"},
+		{"/api/v2/users", "v1", "/new/api/v2/users"},
+		{"/api/users", "v1", "/legacy/api/v1/users"},
+		{"/api/users", "", "/new/api/v2/users"},
+		{"/api/users", "v3", "/new/api/v2/users"},
+	} {
+		req, resp := protocol.AcquireRequest(), protocol.AcquireResponse()
+		req.SetRequestURI("http://127.0.0.1:10067" + tt.path)
+		if tt.version != "" {
+			req.Header.Set("X-API-Version", tt.version)
+		}
+		assert.Nil(t, cli.Do(context.Background(), req, resp))
+		assert.DeepEqual(t, tt.want, string(resp.Body()))
+	}
+	status, _, err := cli.Get(context.Background(), nil, "http://127.0.0.1:10067/other")
+	assert.Nil(t, err)
+	assert.DeepEqual(t, 404, status)
+}
+
+func TestAPIVersionsStripVersion(t *testing.T) {
+	routes, err := APIVersions{
+		Name:         "orders",
+		Header:       "Accept-Version",
+		StripVersion: true,
+		Versions:     []APIVersion{{Name: "v1", Target: "http://legacy"}},
+	}.Routes()
+	assert.Nil(t, err)
+	assert.DeepEqual(t, []Route{
+		{Name: "orders/v1", Path: "/v1/", Target: "http://legacy", StripPrefix: true},
+		{Name: "orders/v1", Path: "/", Target: "http://legacy", Headers: map[string]string{"Accept-Version": "v1"}},
+	}, routes)
+
+	routes, err = APIVersions{Versions: []APIVersion{{Name: "v1", Target: "http://legacy"}}, Default: "v1"}.Routes()
+	assert.Nil(t, err)
+	assert.DeepEqual(t, Route{Path: "/", Target: "http://legacy", AddPrefix: "/v1"}, routes[1])
+
+	for _, a := range []APIVersions{
+		{},
+		{Prefix: "/api", Versions: []APIVersion{{Name: "v1", Target: "http://a"}}},
+		{Versions: []APIVersion{{Name: "v/1", Target: "http://a"}}},
+		{Versions: []APIVersion{{Name: "v1", Target: "http://a"}, {Name: "v1", Target: "http://b"}}},
+		{Versions: []APIVersion{{Name: "v1", Target: "http://a"}}, Default: "v2"},
+	} {
+		_, err = a.Routes()
+		assert.NotNil(t, err)
+	}
+}
+
+func TestLoadRoutesAPIs(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "routes.yaml")
+	assert.Nil(t, ioutil.WriteFile(file, []byte(`
+routes:
+  - path: /health
+    target: http://health:8080
+apis:
+  - prefix: /orders/
+    default: v2
+    versions:
+      - {name: v1, target: "http://orders-legacy:8080"}
+      - {name: v2, target: "http://orders:8080"}
+`), 0o644))
+	routes, err := LoadRoutes(file)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, []Route{
+		{Path: "/health", Target: "http://health:8080"},
+		{Path: "/orders/v1/", Target: "http://orders-legacy:8080"},
+		{Path: "/orders/v2/", Target: "http://orders:8080"},
+		{Path: "/orders/", Target: "http://orders:8080", StripPrefix: true, AddPrefix: "/orders/v2"},
+	}, routes)
+	_, err = NewRouter(routes)
+	assert.Nil(t, err)
+}
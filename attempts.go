@@ -0,0 +1,55 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"strconv"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// Headers set by SetAttemptHeaders.
+const (
+	// HeaderProxyAttempt is the number of the backend call of a forwarded
+	// request, 1 for the first one.
+	HeaderProxyAttempt = "X-Proxy-Attempt"
+	// HeaderProxyUpstream is the scheme and host of the backend of a
+	// response.
+	HeaderProxyUpstream = "X-Proxy-Upstream"
+	// HeaderProxyRetryCount is the number of backend calls of a response
+	// after the first one.
+	HeaderProxyRetryCount = "X-Proxy-Retry-Count"
+)
+
+// SetAttemptHeaders makes the proxy tell backends the attempt of each call
+// in X-Proxy-Attempt and clients the backend and the number of retries of
+// each response in X-Proxy-Upstream and X-Proxy-Retry-Count, so that the
+// retries can be observed while debugging. Responses to requests which did
+// not reach the backend call, e.g. preflights, are not annotated.
+func (r *ReverseProxy) SetAttemptHeaders(enabled bool) {
+	r.attemptHeaders = enabled
+}
+
+// annotateResponse sets the headers of SetAttemptHeaders on the response
+// once the backend was called.
+func annotateResponse(c *app.RequestContext) {
+	attempts, ok := c.Value(ContextKeyAttempts).(int)
+	if !ok {
+		return
+	}
+	uri := c.Request.URI()
+	c.Response.Header.Set(HeaderProxyUpstream, string(uri.Scheme())+"://"+string(uri.Host()))
+	c.Response.Header.Set(HeaderProxyRetryCount, strconv.Itoa(attempts-1))
+}
@@ -0,0 +1,66 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"syscall"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestAttemptHeaders(t *testing.T) {
+	var seen []string
+	failures := 0
+	proxy, err := NewReverseProxy("http://backend:8080", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		seen = append(seen, string(req.Header.Peek(HeaderProxyAttempt)))
+		if len(seen) <= failures {
+			return syscall.ECONNREFUSED
+		}
+		return nil
+	})))
+	assert.Nil(t, err)
+	proxy.SetRetries(2)
+
+	do := func() *app.RequestContext {
+		seen = nil
+		ctx := app.NewContext(0)
+		ctx.Request.SetRequestURI("http://localhost/items")
+		ctx.Request.Header.Set(HeaderProxyAttempt, "7")
+		proxy.ServeHTTP(context.Background(), ctx)
+		return ctx
+	}
+
+	// disabled by default
+	ctx := do()
+	assert.DeepEqual(t, "", string(ctx.Response.Header.Peek(HeaderProxyUpstream)))
+
+	proxy.SetAttemptHeaders(true)
+	failures = 2
+	ctx = do()
+	assert.DeepEqual(t, 200, ctx.Response.StatusCode())
+	assert.DeepEqual(t, []string{"1", "2", "3"}, seen)
+	assert.DeepEqual(t, "http://backend:8080", string(ctx.Response.Header.Peek(HeaderProxyUpstream)))
+	assert.DeepEqual(t, "2", string(ctx.Response.Header.Peek(HeaderProxyRetryCount)))
+
+	// error responses are annotated too
+	failures = 3
+	ctx = do()
+	assert.DeepEqual(t, 502, ctx.Response.StatusCode())
+	assert.DeepEqual(t, "2", string(ctx.Response.Header.Peek(HeaderProxyRetryCount)))
+}
@@ -0,0 +1,61 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// Balancer spreads the requests of a ReverseProxy across several targets,
+// see SetBalancer.
+type Balancer interface {
+	// Pick returns the target of the request of c, "" to use Target.
+	Pick(ctx context.Context, c *app.RequestContext) string
+	// Done is called once the response to a request sent to a picked
+	// target was handed to the server, with its status code, which is
+	// that of the error response if the backend call failed, and the time
+	// since Pick.
+	Done(target string, statusCode int, latency time.Duration)
+}
+
+// SetBalancer sets b to choose the target of each request which neither
+// SetTargetFunc nor ContextKeyTarget chose one for. Like these, the target
+// is honored by the director of NewSingleHostReverseProxy only.
+func (r *ReverseProxy) SetBalancer(b Balancer) {
+	r.balancer = b
+}
+
+// validateTargets checks that targets are valid and distinct.
+func validateTargets(targets []string) error {
+	if len(targets) == 0 {
+		return errors.New("reverseproxy: balancer needs targets")
+	}
+	seen := make(map[string]bool, len(targets))
+	for _, target := range targets {
+		if _, err := parseTarget(target); err != nil {
+			return err
+		}
+		if seen[target] {
+			return fmt.Errorf("reverseproxy: duplicate balancer target %q", target)
+		}
+		seen[target] = true
+	}
+	return nil
+}
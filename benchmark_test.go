@@ -0,0 +1,177 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/client"
+	"github.com/cloudwego/hertz/pkg/app/server"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/gorilla/websocket"
+	hzws "github.com/hertz-contrib/websocket"
+)
+
+// The benchmarks proxy from 127.0.0.1:10037 to a backend on 127.0.0.1:10036.
+// Streamed bodies and websockets are copied with buffers of the sizes in
+// benchBufferSizes, served under "/b<size>", to compare SetBufferPool settings:
+//
+//	go test -tags stdjson -run '^$' -bench 'Proxy(Stream|WebsocketEcho)' -benchmem
+var benchBufferSizes = []int{4 * 1024, DefaultCopyBufferSize, 256 * 1024}
+
+var benchOnce sync.Once
+
+// repeatReader yields n bytes of 'x'.
+type repeatReader struct{ n int }
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, io.EOF
+	}
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	for i := range p {
+		p[i] = 'x'
+	}
+	r.n -= len(p)
+	return len(p), nil
+}
+
+type nopTransformer struct{ io.Writer }
+
+func (nopTransformer) Flush() error { return nil }
+func (nopTransformer) Close() error { return nil }
+
+// copyTransformer passes bodies through unchanged, so that streamed bodies
+// are copied by the proxy.
+func copyTransformer(_ *protocol.Response, dst io.Writer) (Transformer, error) {
+	return nopTransformer{dst}, nil
+}
+
+func startBenchServers() {
+	benchOnce.Do(func() {
+		backend := server.New(server.WithHostPorts("127.0.0.1:10036"))
+		backend.NoHijackConnPool = true
+		backend.GET("/json", func(cc context.Context, ctx *app.RequestContext) {
+			ctx.Data(200, "application/json", []byte(`{"id":1,"name":"hertz","tags":["proxy","bench"]}`))
+		})
+		backend.GET("/bytes/:n", func(cc context.Context, ctx *app.RequestContext) {
+			n, _ := strconv.Atoi(ctx.Param("n"))
+			ctx.SetBodyStream(&repeatReader{n: n}, n)
+		})
+		upgrader := &hzws.HertzUpgrader{}
+		backend.GET("/ws", func(cc context.Context, ctx *app.RequestContext) {
+			_ = upgrader.Upgrade(ctx, func(conn *hzws.Conn) {
+				for {
+					mt, msg, err := conn.ReadMessage()
+					if err != nil || conn.WriteMessage(mt, msg) != nil {
+						return
+					}
+				}
+			})
+		})
+		go backend.Spin()
+
+		h := server.New(server.WithHostPorts("127.0.0.1:10037"))
+		h.NoHijackConnPool = true
+		proxy, _ := NewSingleHostReverseProxy("http://127.0.0.1:10036")
+		h.GET("/json", proxy.ServeHTTP)
+		for _, size := range benchBufferSizes {
+			prefix := "/b" + strconv.Itoa(size)
+			p, _ := NewSingleHostReverseProxy("http://127.0.0.1:10036", client.WithResponseBodyStream(true))
+			p.SetStripPrefix(prefix)
+			p.SetBufferPool(NewBufferPool(size))
+			p.SetResponseTransformers(copyTransformer)
+			h.GET(prefix+"/*path", p.ServeHTTP)
+		}
+		go h.Spin()
+		time.Sleep(time.Second)
+	})
+}
+
+func benchGet(b *testing.B, cli *client.Client, uri string, size int) {
+	req, resp := protocol.AcquireRequest(), protocol.AcquireResponse()
+	defer protocol.ReleaseRequest(req)
+	defer protocol.ReleaseResponse(resp)
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req.Reset()
+		resp.Reset()
+		req.SetRequestURI(uri)
+		if err := cli.Do(context.Background(), req, resp); err != nil {
+			b.Fatal(err)
+		}
+		n, err := io.Copy(ioutil.Discard, resp.BodyStream())
+		if err != nil || resp.StatusCode() != 200 || (size > 0 && int(n) != size) {
+			b.Fatalf("status %d, %d bytes: %v", resp.StatusCode(), n, err)
+		}
+	}
+}
+
+func BenchmarkProxySmallJSON(b *testing.B) {
+	startBenchServers()
+	cli, _ := client.NewClient(client.WithResponseBodyStream(true))
+	benchGet(b, cli, "http://127.0.0.1:10037/json", 0)
+}
+
+func BenchmarkProxyStream(b *testing.B) {
+	startBenchServers()
+	cli, _ := client.NewClient(client.WithResponseBodyStream(true))
+	for _, n := range []int{1 << 20, 100 << 20} {
+		for _, size := range benchBufferSizes {
+			n, size := n, size
+			b.Run(strconv.Itoa(n>>20)+"MB/buffer="+strconv.Itoa(size>>10)+"KB", func(b *testing.B) {
+				benchGet(b, cli, "http://127.0.0.1:10037/b"+strconv.Itoa(size)+"/bytes/"+strconv.Itoa(n), n)
+			})
+		}
+	}
+}
+
+func BenchmarkProxyWebsocketEcho(b *testing.B) {
+	startBenchServers()
+	msg := []byte(strings.Repeat("x", 1024))
+	for _, size := range benchBufferSizes {
+		size := size
+		b.Run("buffer="+strconv.Itoa(size>>10)+"KB", func(b *testing.B) {
+			conn, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:10037/b"+strconv.Itoa(size)+"/ws", nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer conn.Close()
+			b.SetBytes(int64(len(msg)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err = conn.WriteMessage(websocket.BinaryMessage, msg); err != nil {
+					b.Fatal(err)
+				}
+				if _, _, err = conn.ReadMessage(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrNoRollback is returned by Rollback if the target was never switched.
+var ErrNoRollback = errors.New("reverseproxy: no previous target to roll back to")
+
+// switchMu serializes SwitchTarget, Reload and Rollback, which are rare.
+var switchMu sync.Mutex
+
+// liveProxy is the proxy serving new requests in place of the proxy it is
+// stored in, and the one it replaced. Either may be that proxy itself.
+type liveProxy struct {
+	proxy, previous *ReverseProxy
+}
+
+// SwitchTarget atomically forwards new requests to target, e.g. from the
+// blue to the green deployment, validated like SetTarget. Requests in
+// flight complete against the previous target. Unlike assigning Target,
+// it is safe while serving. Rollback switches back.
+func (r *ReverseProxy) SwitchTarget(target string) error {
+	switchMu.Lock()
+	defer switchMu.Unlock()
+	cur := r.current()
+	c := cur.Clone()
+	if err := c.SetTarget(target); err != nil {
+		return err
+	}
+	r.live.Store(&liveProxy{proxy: c, previous: cur})
+	return nil
+}
+
+// Rollback atomically undoes the last SwitchTarget or Reload: new requests
+// are served with the target and settings from before, while requests in
+// flight complete. Calling it again undoes the rollback. ErrNoRollback is
+// returned if there is nothing to undo.
+func (r *ReverseProxy) Rollback() error {
+	switchMu.Lock()
+	defer switchMu.Unlock()
+	lp, _ := r.live.Load().(*liveProxy)
+	if lp == nil {
+		return ErrNoRollback
+	}
+	r.live.Store(&liveProxy{proxy: lp.previous, previous: lp.proxy})
+	return nil
+}
+
+// ActiveTarget returns the target new requests are forwarded to, which
+// differs from Target after SwitchTarget or Reload.
+func (r *ReverseProxy) ActiveTarget() string {
+	return r.current().Target
+}
+
+// current returns the proxy serving new requests.
+func (r *ReverseProxy) current() *ReverseProxy {
+	if lp, _ := r.live.Load().(*liveProxy); lp != nil {
+		return lp.proxy
+	}
+	return r
+}
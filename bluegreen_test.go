@@ -0,0 +1,79 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestSwitchTarget(t *testing.T) {
+	var mu sync.Mutex
+	var called []string
+	started, release := make(chan struct{}), make(chan struct{})
+	proxy, err := NewReverseProxy("http://blue", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		if string(req.URI().Path()) == "/slow" {
+			close(started)
+			<-release
+		}
+		mu.Lock()
+		called = append(called, string(req.URI().FullURI()))
+		mu.Unlock()
+		return nil
+	})))
+	assert.Nil(t, err)
+	serve := func(uri string) {
+		ctx := app.NewContext(0)
+		ctx.Request.SetRequestURI(uri)
+		proxy.ServeHTTP(context.Background(), ctx)
+	}
+
+	assert.DeepEqual(t, ErrNoRollback, proxy.Rollback())
+
+	// a request in flight completes against the old target
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serve("http://localhost/slow")
+	}()
+	<-started
+	assert.Nil(t, proxy.SwitchTarget("http://green"))
+	assert.DeepEqual(t, "http://green", proxy.ActiveTarget())
+	assert.DeepEqual(t, "http://blue", proxy.Target)
+	serve("http://localhost/a")
+	close(release)
+	<-done
+
+	assert.Nil(t, proxy.Rollback())
+	assert.DeepEqual(t, "http://blue", proxy.ActiveTarget())
+	serve("http://localhost/b")
+	assert.Nil(t, proxy.Rollback())
+	serve("http://localhost/c")
+	assert.DeepEqual(t, []string{"http://green/a", "http://blue/slow", "http://blue/b", "http://green/c"}, called)
+
+	assert.NotNil(t, proxy.SwitchTarget("green:8080"))
+	assert.DeepEqual(t, "http://green", proxy.ActiveTarget())
+
+	// Reload can be rolled back, too
+	assert.Nil(t, proxy.Reload(ProxyConfig{Target: "http://reloaded"}))
+	assert.DeepEqual(t, "http://reloaded", proxy.ActiveTarget())
+	assert.Nil(t, proxy.Rollback())
+	assert.DeepEqual(t, "http://green", proxy.ActiveTarget())
+}
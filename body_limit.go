@@ -0,0 +1,142 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"errors"
+	"io"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+// ErrRequestBodyTooLarge is returned by the request body stream once it
+// exceeds the size set by SetMaxRequestBodySize.
+var ErrRequestBodyTooLarge = errors.New("reverseproxy: request body too large")
+
+// SetMaxRequestBodySize rejects requests with a body larger than n bytes
+// with 413 Request Entity Too Large, independently of the limit of the
+// server, e.g. for a backend accepting smaller uploads than others.
+// Requests declaring a larger Content-Length are rejected before the
+// backend is called. Streamed bodies without Content-Length are cut off
+// after n bytes, which aborts the backend call. 0 means no limit.
+func (r *ReverseProxy) SetMaxRequestBodySize(n int) {
+	r.maxRequestBodySize = n
+}
+
+// SetDropRequestBody drops the body of requests with one of methods, e.g.
+// "GET", "HEAD" and "DELETE", before forwarding them, for backends
+// rejecting such requests with a body. No methods keep all bodies, the
+// default.
+func (r *ReverseProxy) SetDropRequestBody(methods ...string) {
+	r.dropBodyMethods = append([]string(nil), methods...)
+}
+
+// dropRequestBody removes the body of the request if its method is set by
+// SetDropRequestBody. It returns the dropped body stream, which must be
+// given back to the request after the backend call so that the server
+// skips the rest of it.
+func (r *ReverseProxy) dropRequestBody(c *app.RequestContext) io.Reader {
+	if len(r.dropBodyMethods) == 0 {
+		return nil
+	}
+	req := &c.Request
+	method := b2s(req.Header.Method())
+	for _, m := range r.dropBodyMethods {
+		if m != method {
+			continue
+		}
+		var stream io.Reader
+		if req.IsBodyStream() {
+			stream = req.BodyStream()
+			req.ConstructBodyStream(req.BodyBuffer(), nil)
+		}
+		req.ResetBody()
+		req.Header.DelBytes([]byte(consts.HeaderContentLength))
+		return stream
+	}
+	return nil
+}
+
+// limitRequestBody rejects the request if its body is known to exceed the
+// limit, and limits its body stream otherwise. It reports whether the
+// request was rejected.
+func (r *ReverseProxy) limitRequestBody(c *app.RequestContext) (*limitedBody, bool) {
+	n := r.maxRequestBodySize
+	if n <= 0 {
+		return nil, false
+	}
+	req := &c.Request
+	if !req.IsBodyStream() {
+		if len(req.Body()) > n {
+			rejectRequestBody(c)
+			return nil, true
+		}
+		return nil, false
+	}
+	if req.Header.ContentLength() > n {
+		rejectRequestBody(c)
+		return nil, true
+	}
+	if req.Header.ContentLength() >= 0 {
+		return nil, false
+	}
+	lb := &limitedBody{src: req.BodyStream(), remaining: n}
+	req.ConstructBodyStream(req.BodyBuffer(), lb)
+	return lb, false
+}
+
+func rejectRequestBody(c *app.RequestContext) {
+	// the rest of a streamed body is not read
+	if c.Request.IsBodyStream() {
+		c.Response.Header.SetConnectionClose(true)
+	}
+	c.Response.Header.SetStatusCode(consts.StatusRequestEntityTooLarge)
+}
+
+// limitedBody fails with ErrRequestBodyTooLarge after remaining bytes.
+type limitedBody struct {
+	src       io.Reader
+	remaining int
+	exceeded  bool
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, ErrRequestBodyTooLarge
+	}
+	// read one byte more to tell a body of exactly the limit from a larger one
+	if len(p) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.src.Read(p)
+	if l.remaining -= n; l.remaining < 0 {
+		l.exceeded = true
+		return 0, ErrRequestBodyTooLarge
+	}
+	return n, err
+}
+
+func (l *limitedBody) Close() error {
+	if c, ok := l.src.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// tooLarge reports whether the body stream exceeded its limit.
+func (l *limitedBody) tooLarge() bool {
+	return l != nil && l.exceeded
+}
@@ -0,0 +1,118 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/client"
+	"github.com/cloudwego/hertz/pkg/app/server"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestMaxRequestBodySize(t *testing.T) {
+	var received []string
+	proxy, err := NewReverseProxy("http://backend", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		if !req.IsBodyStream() {
+			received = append(received, string(req.Body()))
+			return nil
+		}
+		body, err := ioutil.ReadAll(req.BodyStream())
+		if err != nil {
+			return err
+		}
+		received = append(received, string(body))
+		return nil
+	})))
+	assert.Nil(t, err)
+	proxy.SetMaxRequestBodySize(5)
+
+	for _, tt := range []struct {
+		body   string
+		stream bool
+		size   int
+		code   int
+		close  bool
+	}{
+		{body: "12345", code: 200},
+		{body: "123456", code: 413},
+		{body: "123456", stream: true, size: 6, code: 413, close: true},
+		{body: "12345", stream: true, size: -1, code: 200},
+		{body: "123456", stream: true, size: -1, code: 413, close: true},
+	} {
+		received = nil
+		ctx := app.NewContext(0)
+		ctx.Request.SetMethod("POST")
+		ctx.Request.SetRequestURI("http://localhost/upload")
+		if tt.stream {
+			ctx.Request.SetBodyStream(strings.NewReader(tt.body), tt.size)
+		} else {
+			ctx.Request.SetBodyString(tt.body)
+		}
+		proxy.ServeHTTP(context.Background(), ctx)
+		assert.DeepEqual(t, tt.code, ctx.Response.StatusCode())
+		assert.DeepEqual(t, tt.close, ctx.Response.Header.ConnectionClose())
+		if tt.code == 200 {
+			assert.DeepEqual(t, []string{tt.body}, received)
+		} else if tt.size >= 0 {
+			// rejected before the backend call
+			assert.DeepEqual(t, 0, len(received))
+		}
+	}
+}
+
+func TestDropRequestBody(t *testing.T) {
+	backend := server.New(server.WithHostPorts("127.0.0.1:10049"))
+	backend.Any("/echo", func(c context.Context, ctx *app.RequestContext) {
+		ctx.String(200, "%s %q %q", ctx.Method(), ctx.Request.Body(), ctx.Request.Header.Peek("Content-Length"))
+	})
+	go backend.Spin()
+
+	proxy, err := NewSingleHostReverseProxy("http://127.0.0.1:10049")
+	assert.Nil(t, err)
+	proxy.SetDropRequestBody("GET", "DELETE")
+	front := server.New(server.WithHostPorts("127.0.0.1:10050"), server.WithStreamBody(true))
+	front.Any("/echo", proxy.ServeHTTP)
+	go front.Spin()
+	time.Sleep(time.Second)
+
+	cli, _ := client.NewClient()
+	for _, tt := range []struct {
+		method string
+		want   string
+	}{
+		{method: "GET", want: `GET "" ""`},
+		{method: "DELETE", want: `DELETE "" "0"`},
+		{method: "POST", want: `POST "stray" "5"`},
+		// the connection is reused after a dropped body
+		{method: "GET", want: `GET "" ""`},
+	} {
+		req, resp := protocol.AcquireRequest(), protocol.AcquireResponse()
+		req.SetMethod(tt.method)
+		req.SetRequestURI("http://127.0.0.1:10050/echo")
+		req.SetBodyString("stray")
+		assert.Nil(t, cli.Do(context.Background(), req, resp))
+		assert.DeepEqual(t, 200, resp.StatusCode())
+		assert.DeepEqual(t, tt.want, string(resp.Body()))
+		protocol.ReleaseRequest(req)
+		protocol.ReleaseResponse(resp)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"io"
+	"sync"
+)
+
+// DefaultCopyBufferSize is the size of the buffers copying streamed bodies
+// and upgraded connections, unless SetBufferPool is used.
+const DefaultCopyBufferSize = 32 * 1024
+
+// BufferPool provides the buffers copying streamed bodies through response
+// transformers and the raw streams of upgraded connections and tunnels.
+type BufferPool interface {
+	Get() []byte
+	Put([]byte)
+}
+
+type syncBufferPool struct {
+	size int
+	pool sync.Pool
+}
+
+// NewBufferPool returns a BufferPool of buffers of size bytes. Larger
+// buffers need fewer reads and writes for big bodies at the cost of memory
+// per concurrent copy.
+func NewBufferPool(size int) BufferPool {
+	if size <= 0 {
+		size = DefaultCopyBufferSize
+	}
+	p := &syncBufferPool{size: size}
+	p.pool.New = func() interface{} {
+		buf := make([]byte, size)
+		return &buf
+	}
+	return p
+}
+
+func (p *syncBufferPool) Get() []byte {
+	return *p.pool.Get().(*[]byte)
+}
+
+func (p *syncBufferPool) Put(buf []byte) {
+	if cap(buf) < p.size {
+		return
+	}
+	buf = buf[:p.size]
+	p.pool.Put(&buf)
+}
+
+var defaultBufferPool = NewBufferPool(DefaultCopyBufferSize)
+
+// SetBufferPool sets the pool of copy buffers, e.g. NewBufferPool(256 * 1024)
+// for large downloads. The pool may be shared by several proxies.
+func (r *ReverseProxy) SetBufferPool(p BufferPool) {
+	r.bufferPool = p
+}
+
+// BufferPool returns the pool of copy buffers, see SetBufferPool.
+func (r *ReverseProxy) BufferPool() BufferPool {
+	if r.bufferPool == nil {
+		return defaultBufferPool
+	}
+	return r.bufferPool
+}
+
+// copyBuffer is io.Copy with a buffer of the pool of r.
+func (r *ReverseProxy) copyBuffer(dst io.Writer, src io.Reader) (int64, error) {
+	p := r.BufferPool()
+	buf := p.Get()
+	defer p.Put(buf)
+	return io.CopyBuffer(dst, src, buf)
+}
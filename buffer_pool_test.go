@@ -0,0 +1,52 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+)
+
+type countingBufferPool struct {
+	BufferPool
+	gets int
+}
+
+func (p *countingBufferPool) Get() []byte {
+	p.gets++
+	return p.BufferPool.Get()
+}
+
+func TestBufferPool(t *testing.T) {
+	p := NewBufferPool(1024)
+	buf := p.Get()
+	assert.DeepEqual(t, 1024, len(buf))
+	p.Put(buf[:10])
+	assert.DeepEqual(t, 1024, len(p.Get()))
+	assert.DeepEqual(t, DefaultCopyBufferSize, len(NewBufferPool(0).Get()))
+
+	proxy := &ReverseProxy{}
+	assert.DeepEqual(t, defaultBufferPool, proxy.BufferPool())
+	cp := &countingBufferPool{BufferPool: NewBufferPool(16)}
+	proxy.SetBufferPool(cp)
+	var dst bytes.Buffer
+	n, err := proxy.copyBuffer(&dst, strings.NewReader(strings.Repeat("x", 100)))
+	assert.Nil(t, err)
+	assert.DeepEqual(t, int64(100), n)
+	assert.DeepEqual(t, 1, cp.gets)
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"github.com/bytedance/gopkg/lang/fastrand"
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// Canary sends requests of a route to a canary target instead of the
+// stable Target of the route. A request goes to the canary if it carries
+// one of the Headers or Cookies, otherwise with a probability of Percent.
+// All other settings of the route apply to the canary, too.
+type Canary struct {
+	// Target is interpreted like Route.Target.
+	Target string `json:"target" yaml:"target"`
+
+	// Percent of the requests, from 0 to 100, see Router.SetCanaryPercent.
+	Percent int `json:"percent,omitempty" yaml:"percent,omitempty"`
+
+	// Headers and Cookies select the canary for requests carrying one of
+	// these header values or cookies, e.g. {"X-Canary": "1"}. An empty
+	// value only requires presence.
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Cookies map[string]string `json:"cookies,omitempty" yaml:"cookies,omitempty"`
+}
+
+// selects reports whether the request goes to the canary.
+func (cn *Canary) selects(c *app.RequestContext) bool {
+	for k, v := range cn.Headers {
+		if got := c.Request.Header.Peek(k); got != nil && (v == "" || b2s(got) == v) {
+			return true
+		}
+	}
+	for k, v := range cn.Cookies {
+		if got := c.Request.Header.Cookie(k); got != nil && (v == "" || b2s(got) == v) {
+			return true
+		}
+	}
+	return cn.Percent > 0 && fastrand.Intn(100) < cn.Percent
+}
+
+// useCanary reports whether the canary of r serves the request.
+func (r *compiledRoute) useCanary(c *app.RequestContext) bool {
+	return r.canary != nil && !r.canary.stats.isDraining() && r.Canary.selects(c)
+}
+
+// SetCanaryPercent changes the Canary.Percent of the routes for host and
+// path with a canary, e.g. to shift traffic step by step from 5 to 100,
+// and returns how many were changed. Other routes are kept, see ReplaceTable.
+func (rt *Router) SetCanaryPercent(host, path string, percent int) (int, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	routes, n := rt.Routes(), 0
+	for i, route := range routes {
+		if route.Host == host && route.Path == path && route.Canary != nil {
+			canary := *route.Canary
+			canary.Percent = percent
+			routes[i].Canary = &canary
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return n, rt.store(routes)
+}
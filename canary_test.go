@@ -0,0 +1,94 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/client"
+	"github.com/cloudwego/hertz/pkg/app/server"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestRouterCanary(t *testing.T) {
+	backend := server.New(server.WithHostPorts("127.0.0.1:10044"))
+	backend.Any("/*path", func(cc context.Context, ctx *app.RequestContext) {
+		ctx.String(200, string(ctx.Request.URI().Path()))
+	})
+	go backend.Spin()
+
+	rt, err := NewRouter([]Route{{
+		Path:   "/api/",
+		Target: "http://127.0.0.1:10044/stable",
+		Canary: &Canary{
+			Target:  "http://127.0.0.1:10044/canary",
+			Headers: map[string]string{"X-Canary": "1"},
+			Cookies: map[string]string{"canary": ""},
+		},
+	}})
+	assert.Nil(t, err)
+	r := server.New(server.WithHostPorts("127.0.0.1:10045"))
+	r.Use(rt.ServeHTTP)
+	go r.Spin()
+	time.Sleep(time.Second)
+
+	cli, _ := client.NewClient()
+	get := func(header ...string) string {
+		req, resp := protocol.AcquireRequest(), protocol.AcquireResponse()
+		defer func() {
+			protocol.ReleaseRequest(req)
+			protocol.ReleaseResponse(resp)
+		}()
+		req.SetRequestURI("http://127.0.0.1:10045/api/x")
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		assert.Nil(t, cli.Do(context.Background(), req, resp))
+		return string(resp.Body())
+	}
+
+	assert.DeepEqual(t, "/stable/api/x", get())
+	assert.DeepEqual(t, "/stable/api/x", get("X-Canary", "0"))
+	assert.DeepEqual(t, "/canary/api/x", get("X-Canary", "1"))
+	assert.DeepEqual(t, "/canary/api/x", get("Cookie", "canary=yes"))
+
+	n, err := rt.SetCanaryPercent("", "/api/", 50)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, 1, n)
+	assert.DeepEqual(t, 50, rt.Routes()[0].Canary.Percent)
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		seen[get()] = true
+	}
+	assert.True(t, seen["/stable/api/x"])
+	assert.True(t, seen["/canary/api/x"])
+
+	// a draining canary gets no traffic
+	_, err = rt.SetCanaryPercent("", "/api/", 100)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, "/canary/api/x", get())
+	assert.True(t, rt.DrainUpstream("http://127.0.0.1:10044/canary"))
+	assert.DeepEqual(t, "/stable/api/x", get("X-Canary", "1"))
+
+	_, err = rt.SetCanaryPercent("", "/api/", 101)
+	assert.NotNil(t, err)
+	n, err = rt.SetCanaryPercent("", "/other", 10)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, 0, n)
+}
@@ -0,0 +1,66 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"io"
+	"mime"
+
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/transform"
+)
+
+type charsetTransformer struct {
+	*transform.Writer
+}
+
+func (c *charsetTransformer) Flush() error { return nil }
+
+// CharsetToUTF8 returns a TransformerFactory which converts bodies declared
+// in a legacy charset (e.g. "gbk", "shift_jis", "iso-8859-1") to UTF-8 and
+// updates the charset in Content-Type. If charsets is empty, every charset
+// known to the WHATWG encoding index is converted, otherwise only the listed ones.
+//
+// Encoded (e.g. gzip) bodies are skipped, so place it after GzipDecoder.
+func CharsetToUTF8(charsets ...string) TransformerFactory {
+	allowed := make(map[string]bool, len(charsets))
+	for _, cs := range charsets {
+		if enc, err := htmlindex.Get(cs); err == nil {
+			name, _ := htmlindex.Name(enc)
+			allowed[name] = true
+		}
+	}
+	return func(resp *protocol.Response, dst io.Writer) (Transformer, error) {
+		if len(resp.Header.Peek("Content-Encoding")) > 0 {
+			return nil, nil
+		}
+		mediaType, params, err := mime.ParseMediaType(string(resp.Header.ContentType()))
+		if err != nil || params["charset"] == "" {
+			return nil, nil
+		}
+		enc, err := htmlindex.Get(params["charset"])
+		if err != nil {
+			return nil, nil
+		}
+		name, _ := htmlindex.Name(enc)
+		if name == "utf-8" || (len(allowed) > 0 && !allowed[name]) {
+			return nil, nil
+		}
+		params["charset"] = "utf-8"
+		resp.Header.SetContentType(mime.FormatMediaType(mediaType, params))
+		return &charsetTransformer{Writer: transform.NewWriter(dst, enc.NewDecoder())}, nil
+	}
+}
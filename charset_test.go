@@ -0,0 +1,55 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func TestCharsetToUTF8(t *testing.T) {
+	gbk, err := simplifiedchinese.GBK.NewEncoder().Bytes([]byte("你好, hertz"))
+	assert.Nil(t, err)
+
+	proxy, _ := NewSingleHostReverseProxy("http://127.0.0.1:9990/proxy")
+	proxy.SetResponseTransformers(CharsetToUTF8())
+
+	resp := protocol.AcquireResponse()
+	resp.Header.SetContentType("text/html; charset=GBK")
+	resp.SetBodyStream(bytes.NewReader(gbk), len(gbk))
+	assert.Nil(t, proxy.transformResponse(resp))
+	assert.DeepEqual(t, "text/html; charset=utf-8", string(resp.Header.ContentType()))
+	assert.DeepEqual(t, "你好, hertz", string(resp.Body()))
+
+	// charsets outside the allowlist are left alone
+	proxy.SetResponseTransformers(CharsetToUTF8("shift_jis"))
+	resp = protocol.AcquireResponse()
+	resp.Header.SetContentType("text/plain; charset=gbk")
+	resp.SetBody(gbk)
+	assert.Nil(t, proxy.transformResponse(resp))
+	assert.DeepEqual(t, "text/plain; charset=gbk", string(resp.Header.ContentType()))
+	assert.DeepEqual(t, gbk, resp.Body())
+
+	proxy.SetResponseTransformers(CharsetToUTF8("iso-8859-1"))
+	resp = protocol.AcquireResponse()
+	resp.Header.SetContentType("text/plain; charset=ISO-8859-1")
+	resp.SetBody([]byte{'c', 'a', 'f', 0xe9})
+	assert.Nil(t, proxy.transformResponse(resp))
+	assert.DeepEqual(t, "café", string(resp.Body()))
+}
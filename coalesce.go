@@ -0,0 +1,140 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+// DefaultCoalesceKey is the key function of SetCoalescing for requests
+// whose response can be shared: GET and HEAD requests without credentials
+// and without "Cache-Control: no-cache". Their key is the method, the URI
+// and the Accept and Accept-Encoding headers.
+func DefaultCoalesceKey(req *protocol.Request) string {
+	method := req.Header.Method()
+	if !bytes.Equal(method, s2b(consts.MethodGet)) && !bytes.Equal(method, s2b(consts.MethodHead)) {
+		return ""
+	}
+	if req.Header.Peek("Authorization") != nil || req.Header.Peek("Cookie") != nil ||
+		bytes.Contains(req.Header.Peek("Cache-Control"), s2b("no-cache")) {
+		return ""
+	}
+	var b bytes.Buffer
+	b.Write(method)
+	b.WriteByte(' ')
+	b.Write(req.URI().FullURI())
+	b.WriteByte(0)
+	b.Write(req.Header.Peek("Accept"))
+	b.WriteByte(0)
+	b.Write(req.Header.Peek("Accept-Encoding"))
+	return b.String()
+}
+
+// SetCoalescing makes requests with the same key wait for the backend
+// call of the request in flight with that key, if any, instead of calling
+// the backend themselves, and share its response, e.g. to protect the
+// backend from a stampede when a popular cached resource expires. key
+// returns "" for requests which must not be coalesced, see
+// DefaultCoalesceKey. It is called after the director. nil disables
+// coalescing.
+//
+// Responses setting cookies or marked "Cache-Control: private" or
+// "no-store" are not shared, the waiting requests call the backend
+// themselves then. The body of coalesced responses is read into memory,
+// so this is not suited for streaming responses like event streams.
+func (r *ReverseProxy) SetCoalescing(key func(req *protocol.Request) string) {
+	r.coalesceKey = key
+	if key != nil && r.coalescer == nil {
+		r.coalescer = &coalescer{calls: make(map[string]*coalescedCall)}
+	}
+}
+
+// coalescer tracks the backend calls in flight by key.
+type coalescer struct {
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+type coalescedCall struct {
+	done     chan struct{}
+	attempts int
+	err      error
+	// shared is whether resp may be copied to the waiting requests
+	shared bool
+	// mu serializes copies of resp, which are not read-only
+	mu   sync.Mutex
+	resp protocol.Response
+}
+
+// do calls the backend with fn unless a call with key is in flight, and
+// copies the response of that call into resp otherwise.
+func (g *coalescer) do(ctx context.Context, key string, resp *protocol.Response, fn func() (int, error)) (int, error) {
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return 1, ctx.Err()
+		}
+		if call.err != nil {
+			return call.attempts, call.err
+		}
+		if !call.shared {
+			return fn()
+		}
+		call.mu.Lock()
+		call.resp.CopyTo(resp)
+		call.mu.Unlock()
+		return call.attempts, nil
+	}
+	call := &coalescedCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	attempts, err := fn()
+	if err == nil {
+		// the body stream can only be read once
+		if _, err = resp.BodyE(); err == nil && isShareable(resp) {
+			resp.CopyTo(&call.resp)
+			call.shared = true
+		}
+	}
+	call.attempts, call.err = attempts, err
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	close(call.done)
+	return attempts, err
+}
+
+// isShareable reports whether resp holds nothing private to the client of
+// the request, so that it can be copied to other clients.
+func isShareable(resp *protocol.Response) bool {
+	cookies := false
+	resp.Header.VisitAllCookie(func(key, value []byte) {
+		cookies = true
+	})
+	if cookies {
+		return false
+	}
+	cc := bytes.ToLower(resp.Header.Peek("Cache-Control"))
+	return !bytes.Contains(cc, s2b("private")) && !bytes.Contains(cc, s2b("no-store"))
+}
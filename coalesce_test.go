@@ -0,0 +1,141 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestCoalescing(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	proxy, err := NewReverseProxy("http://backend", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		n := atomic.AddInt32(&calls, 1)
+		<-release
+		resp.Header.Set("X-Call", string(rune('0'+n)))
+		resp.SetBodyString("popular " + string(req.URI().Path()))
+		return nil
+	})))
+	assert.Nil(t, err)
+	proxy.SetCoalescing(DefaultCoalesceKey)
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 10)
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx := app.NewContext(0)
+			ctx.Request.SetRequestURI("http://localhost/item")
+			proxy.ServeHTTP(context.Background(), ctx)
+			bodies[i] = string(ctx.Response.Body()) + " " + ctx.Response.Header.Get("X-Call")
+		}(i)
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.DeepEqual(t, int32(1), atomic.LoadInt32(&calls))
+	for _, body := range bodies {
+		assert.DeepEqual(t, "popular /item 1", body)
+	}
+
+	// later requests call the backend again
+	ctx := app.NewContext(0)
+	ctx.Request.SetRequestURI("http://localhost/item")
+	proxy.ServeHTTP(context.Background(), ctx)
+	assert.DeepEqual(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestCoalescingPrivateResponses(t *testing.T) {
+	for _, private := range []func(resp *protocol.Response){
+		func(resp *protocol.Response) {
+			cookie := protocol.AcquireCookie()
+			defer protocol.ReleaseCookie(cookie)
+			cookie.SetKey("session")
+			cookie.SetValue("secret")
+			resp.Header.SetCookie(cookie)
+		},
+		func(resp *protocol.Response) { resp.Header.Set("Cache-Control", "Private, max-age=60") },
+		func(resp *protocol.Response) { resp.Header.Set("Cache-Control", "no-store") },
+	} {
+		var calls int32
+		release := make(chan struct{})
+		proxy, err := NewReverseProxy("http://backend", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				<-release
+				private(resp)
+				resp.SetBodyString("first")
+				return nil
+			}
+			resp.SetBodyString("own")
+			return nil
+		})))
+		assert.Nil(t, err)
+		proxy.SetCoalescing(DefaultCoalesceKey)
+
+		var wg sync.WaitGroup
+		bodies := make([]string, 5)
+		for i := range bodies {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				ctx := app.NewContext(0)
+				ctx.Request.SetRequestURI("http://localhost/me")
+				proxy.ServeHTTP(context.Background(), ctx)
+				bodies[i] = string(ctx.Response.Body())
+			}(i)
+		}
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		// the waiting requests called the backend themselves
+		assert.DeepEqual(t, int32(5), atomic.LoadInt32(&calls))
+		first := 0
+		for _, body := range bodies {
+			if body == "first" {
+				first++
+			}
+		}
+		assert.DeepEqual(t, 1, first)
+	}
+}
+
+func TestDefaultCoalesceKey(t *testing.T) {
+	key := func(method string, header ...string) string {
+		req := protocol.AcquireRequest()
+		defer protocol.ReleaseRequest(req)
+		req.SetMethod(method)
+		req.SetRequestURI("http://backend/a?b=c")
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		return DefaultCoalesceKey(req)
+	}
+	assert.DeepEqual(t, "GET http://backend/a?b=c\x00\x00", key("GET"))
+	assert.NotEqual(t, key("GET"), key("HEAD"))
+	assert.NotEqual(t, key("GET"), key("GET", "Accept-Encoding", "gzip"))
+	assert.DeepEqual(t, "", key("POST"))
+	assert.DeepEqual(t, "", key("GET", "Authorization", "Bearer x"))
+	assert.DeepEqual(t, "", key("GET", "Cookie", "session=1"))
+	assert.DeepEqual(t, "", key("GET", "Cache-Control", "no-cache"))
+}
@@ -0,0 +1,30 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build reverseproxy_safe
+// +build reverseproxy_safe
+
+package reverseproxy
+
+// b2s converts byte slice to a string, copying it since the
+// reverseproxy_safe build tag is set.
+func b2s(b []byte) string {
+	return string(b)
+}
+
+// s2b converts string to a byte slice, copying it since the
+// reverseproxy_safe build tag is set.
+func s2b(s string) []byte {
+	return []byte(s)
+}
@@ -0,0 +1,163 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+// CookieRewrite translates the cookies of a backend bound to its internal
+// hostnames into cookies of the proxy, see SetCookieRewrite.
+type CookieRewrite struct {
+	// Domains maps the Domain attribute of backend cookies, compared
+	// case-insensitively and without a leading dot, to the one given to
+	// clients, e.g. {"app.internal": "example.com"}. An empty value removes
+	// the attribute, binding the cookie to the host of the proxy.
+	Domains map[string]string
+	// Paths replaces the longest matching prefix of Path attributes, e.g.
+	// {"/": "/app/"}.
+	Paths map[string]string
+	// Names renames backend cookies for clients, e.g.
+	// {"JSESSIONID": "app_session"}. Cookies of clients are renamed back.
+	Names map[string]string
+	// Encode translates the value of a backend cookie into the one given to
+	// clients, e.g. an opaque token of the proxy mapped to the backend
+	// session; an error fails the response with 502. Decode translates the
+	// values sent by clients back; cookies it fails for are not forwarded.
+	// name is the name of the cookie at the backend.
+	Encode func(ctx context.Context, c *app.RequestContext, name, value string) (string, error)
+	Decode func(ctx context.Context, c *app.RequestContext, name, value string) (string, error)
+}
+
+// SetCookieRewrite rewrites the Cookie header of requests and the
+// Set-Cookie headers of responses as set by cr, so that the proxy can
+// front backends whose session and auth cookies are bound to internal
+// hostnames.
+func (r *ReverseProxy) SetCookieRewrite(cr CookieRewrite) {
+	r.cookieNames = nil
+	if len(cr.Names) > 0 {
+		cr.Names, r.cookieNames = copyStringMap(cr.Names), make(map[string]string, len(cr.Names))
+		for backend, client := range cr.Names {
+			r.cookieNames[client] = backend
+		}
+	}
+	r.cookieRewrite = &cr
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// rewriteRequestCookies translates the cookies of the client for the
+// backend.
+func (r *ReverseProxy) rewriteRequestCookies(c context.Context, ctx *app.RequestContext) {
+	cr := r.cookieRewrite
+	if cr == nil || len(cr.Names) == 0 && cr.Decode == nil {
+		return
+	}
+	h := &ctx.Request.Header
+	var cookies [][2]string
+	h.VisitAllCookie(func(key, value []byte) {
+		cookies = append(cookies, [2]string{string(key), string(value)})
+	})
+	if len(cookies) == 0 {
+		return
+	}
+	h.DelAllCookies()
+	for _, kv := range cookies {
+		name, value := kv[0], kv[1]
+		if backend, ok := r.cookieNames[name]; ok {
+			name = backend
+		}
+		if cr.Decode != nil {
+			var err error
+			if value, err = cr.Decode(c, ctx, name, value); err != nil {
+				r.log().Debugf(c, "HERTZ: Dropping cookie %s: %v", name, err)
+				continue
+			}
+		}
+		h.SetCookie(name, value)
+	}
+}
+
+// rewriteResponseCookies translates the cookies set by the backend for the
+// client.
+func (r *ReverseProxy) rewriteResponseCookies(c context.Context, ctx *app.RequestContext) error {
+	cr := r.cookieRewrite
+	if cr == nil {
+		return nil
+	}
+	h := &ctx.Response.Header
+	var cookies []*protocol.Cookie
+	defer func() {
+		for _, cookie := range cookies {
+			protocol.ReleaseCookie(cookie)
+		}
+	}()
+	h.VisitAllCookie(func(_, value []byte) {
+		cookie := protocol.AcquireCookie()
+		if cookie.ParseBytes(value) == nil {
+			cookies = append(cookies, cookie)
+		} else {
+			protocol.ReleaseCookie(cookie)
+		}
+	})
+	if len(cookies) == 0 {
+		return nil
+	}
+	h.DelAllCookies()
+	for _, cookie := range cookies {
+		name := string(cookie.Key())
+		if client, ok := cr.Names[name]; ok {
+			cookie.SetKey(client)
+		}
+		if cr.Encode != nil && len(cookie.Value()) > 0 {
+			value, err := cr.Encode(c, ctx, name, string(cookie.Value()))
+			if err != nil {
+				return err
+			}
+			cookie.SetValue(value)
+		}
+		if domain := string(cookie.Domain()); domain != "" {
+			for from, to := range cr.Domains {
+				if strings.EqualFold(strings.TrimPrefix(domain, "."), strings.TrimPrefix(from, ".")) {
+					cookie.SetDomain(to)
+					break
+				}
+			}
+		}
+		if path := string(cookie.Path()); path != "" {
+			var longest string
+			for from := range cr.Paths {
+				if strings.HasPrefix(path, from) && len(from) >= len(longest) {
+					longest = from
+				}
+			}
+			if _, ok := cr.Paths[longest]; ok {
+				cookie.SetPath(cr.Paths[longest] + path[len(longest):])
+			}
+		}
+		h.SetCookie(cookie)
+	}
+	return nil
+}
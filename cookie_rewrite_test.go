@@ -0,0 +1,103 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestCookieRewrite(t *testing.T) {
+	var received []string
+	proxy, err := NewReverseProxy("http://app.internal", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		received = nil
+		req.Header.VisitAllCookie(func(key, value []byte) {
+			received = append(received, string(key)+"="+string(value))
+		})
+		resp.Header.Add("Set-Cookie", "JSESSIONID=backend2; Domain=.APP.internal; Path=/; HttpOnly")
+		resp.Header.Add("Set-Cookie", "lang=en; Domain=static.internal; Path=/docs/v1")
+		resp.Header.Add("Set-Cookie", "admin=; Path=/admin")
+		if string(req.URI().Path()) == "/fail" {
+			resp.Header.Add("Set-Cookie", "JSESSIONID=backend3")
+		}
+		return nil
+	})))
+	assert.Nil(t, err)
+	// proxy-scoped tokens of backend sessions
+	tokens := map[string]string{"token1": "backend1", "token2": "backend2"}
+	proxy.SetCookieRewrite(CookieRewrite{
+		Domains: map[string]string{"app.internal": "example.com", "static.internal": ""},
+		Paths:   map[string]string{"/": "/app/", "/docs/": "/app/documentation/"},
+		Names:   map[string]string{"JSESSIONID": "app_session"},
+		Encode: func(ctx context.Context, c *app.RequestContext, name, value string) (string, error) {
+			if name != "JSESSIONID" {
+				return value, nil
+			}
+			for token, session := range tokens {
+				if session == value {
+					return token, nil
+				}
+			}
+			return "", errors.New("unknown session")
+		},
+		Decode: func(ctx context.Context, c *app.RequestContext, name, value string) (string, error) {
+			if name != "JSESSIONID" {
+				return value, nil
+			}
+			if session, ok := tokens[value]; ok {
+				return session, nil
+			}
+			return "", errors.New("unknown token")
+		},
+	})
+
+	ctx := app.NewContext(0)
+	ctx.Request.SetRequestURI("http://example.com/")
+	ctx.Request.Header.Set("Cookie", "app_session=token1; theme=dark")
+	proxy.ServeHTTP(context.Background(), ctx)
+	assert.DeepEqual(t, 200, ctx.Response.StatusCode())
+	sort.Strings(received)
+	assert.DeepEqual(t, []string{"JSESSIONID=backend1", "theme=dark"}, received)
+	var cookies []string
+	ctx.Response.Header.VisitAllCookie(func(_, value []byte) {
+		cookies = append(cookies, string(value))
+	})
+	sort.Strings(cookies)
+	assert.DeepEqual(t, []string{
+		"admin=; path=/app/admin",
+		"app_session=token2; domain=example.com; path=/app/; HttpOnly",
+		"lang=en; path=/app/documentation/v1",
+	}, cookies)
+
+	// unknown tokens are not forwarded
+	ctx = app.NewContext(0)
+	ctx.Request.SetRequestURI("http://example.com/")
+	ctx.Request.Header.Set("Cookie", "app_session=forged; theme=dark")
+	proxy.ServeHTTP(context.Background(), ctx)
+	assert.DeepEqual(t, []string{"theme=dark"}, received)
+
+	ctx = app.NewContext(0)
+	ctx.Request.SetRequestURI("http://example.com/fail")
+	proxy.ServeHTTP(context.Background(), ctx)
+	assert.DeepEqual(t, 502, ctx.Response.StatusCode())
+	assert.False(t, strings.Contains(string(ctx.Response.Header.Header()), "backend"))
+}
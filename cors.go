@@ -0,0 +1,243 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+// CORSOptions configures the answers to CORS preflight requests and the
+// CORS headers of proxied responses, see ReverseProxy.SetCORSPreflight and
+// ReverseProxy.SetCORSHeaders.
+type CORSOptions struct {
+	// AllowOrigins lists the allowed origins, e.g. "https://example.com".
+	// "*" allows any origin.
+	AllowOrigins []string
+	// AllowMethods lists the allowed methods, GET, HEAD and POST if empty.
+	AllowMethods []string
+	// AllowHeaders lists the allowed request headers. "*" allows any.
+	AllowHeaders []string
+	// AllowCredentials allows requests with cookies or authorization. The
+	// origin is then sent back instead of "*".
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight answer, 0 omits
+	// Access-Control-Max-Age.
+	MaxAge time.Duration
+	// ExposeHeaders lists the response headers scripts may read besides
+	// the CORS-safelisted ones.
+	ExposeHeaders []string
+}
+
+// corsPolicy is CORSOptions prepared for matching requests.
+type corsPolicy struct {
+	anyOrigin   bool
+	origins     map[string]struct{}
+	methods     map[string]struct{}
+	methodList  string
+	anyHeader   bool
+	headers     map[string]struct{}
+	credentials bool
+	maxAge      string
+	expose      string
+}
+
+func newCORSPolicy(opts CORSOptions) *corsPolicy {
+	p := &corsPolicy{
+		origins:     make(map[string]struct{}, len(opts.AllowOrigins)),
+		methods:     make(map[string]struct{}, len(opts.AllowMethods)),
+		headers:     make(map[string]struct{}, len(opts.AllowHeaders)),
+		credentials: opts.AllowCredentials,
+	}
+	for _, o := range opts.AllowOrigins {
+		if o == "*" {
+			p.anyOrigin = true
+		}
+		p.origins[strings.ToLower(o)] = struct{}{}
+	}
+	methods := opts.AllowMethods
+	if len(methods) == 0 {
+		methods = []string{consts.MethodGet, consts.MethodHead, consts.MethodPost}
+	}
+	for _, m := range methods {
+		p.methods[strings.ToUpper(m)] = struct{}{}
+	}
+	p.methodList = strings.ToUpper(strings.Join(methods, ", "))
+	for _, h := range opts.AllowHeaders {
+		if h == "*" {
+			p.anyHeader = true
+		}
+		p.headers[strings.ToLower(h)] = struct{}{}
+	}
+	p.expose = strings.Join(opts.ExposeHeaders, ", ")
+	if opts.MaxAge > 0 {
+		p.maxAge = strconv.FormatInt(int64(opts.MaxAge/time.Second), 10)
+	}
+	return p
+}
+
+// allowsOrigin reports whether origin may access the backend.
+func (p *corsPolicy) allowsOrigin(origin []byte) bool {
+	if p.anyOrigin {
+		return true
+	}
+	_, ok := p.origins[strings.ToLower(string(origin))]
+	return ok
+}
+
+// allowsHeaders reports whether all headers of the comma-separated list
+// requested by a preflight request are allowed.
+func (p *corsPolicy) allowsHeaders(list []byte) bool {
+	if p.anyHeader {
+		return true
+	}
+	for len(list) > 0 {
+		var h []byte
+		h, list = nextToken(list)
+		if len(h) == 0 {
+			continue
+		}
+		if _, ok := p.headers[strings.ToLower(string(h))]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// setAllowOrigin sets Access-Control-Allow-Origin for the allowed origin,
+// adding Origin to Vary unless any origin gets the same answer.
+func (p *corsPolicy) setAllowOrigin(c *app.RequestContext, origin []byte) {
+	h := &c.Response.Header
+	if p.anyOrigin && !p.credentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	h.SetBytesV("Access-Control-Allow-Origin", origin)
+	addVary(c, "Origin")
+	if p.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// addVary adds name to the Vary header of the response unless present.
+func addVary(c *app.RequestContext, name string) {
+	h := &c.Response.Header
+	vary := h.Peek("Vary")
+	for v := vary; len(v) > 0; {
+		var token []byte
+		token, v = nextToken(v)
+		if string(token) == "*" || strings.EqualFold(string(token), name) {
+			return
+		}
+	}
+	if len(vary) == 0 {
+		h.Set("Vary", name)
+		return
+	}
+	h.Set("Vary", string(vary)+", "+name)
+}
+
+// SetCORSPreflight answers CORS preflight requests, OPTIONS requests with
+// Origin and Access-Control-Request-Method headers, at the proxy instead of
+// forwarding them: 204 No Content with the Access-Control-Allow-* headers
+// if the origin, method and headers are allowed by opts, 403 Forbidden
+// otherwise. Other OPTIONS requests are forwarded.
+func (r *ReverseProxy) SetCORSPreflight(opts CORSOptions) {
+	r.corsPreflight = newCORSPolicy(opts)
+}
+
+// servePreflight answers the request if it is a CORS preflight request
+// and reports whether it did.
+func (r *ReverseProxy) servePreflight(c *app.RequestContext) bool {
+	p := r.corsPreflight
+	if p == nil || !c.Request.Header.IsOptions() {
+		return false
+	}
+	origin := c.Request.Header.Peek("Origin")
+	method := c.Request.Header.Peek("Access-Control-Request-Method")
+	if len(origin) == 0 || len(method) == 0 {
+		return false
+	}
+	h := &c.Response.Header
+	addVary(c, "Access-Control-Request-Method")
+	addVary(c, "Access-Control-Request-Headers")
+	requested := c.Request.Header.Peek("Access-Control-Request-Headers")
+	_, methodAllowed := p.methods[string(method)]
+	if !p.allowsOrigin(origin) || !methodAllowed || !p.allowsHeaders(requested) {
+		addVary(c, "Origin")
+		h.SetStatusCode(consts.StatusForbidden)
+		return true
+	}
+	p.setAllowOrigin(c, origin)
+	h.Set("Access-Control-Allow-Methods", p.methodList)
+	if len(requested) > 0 {
+		h.SetBytesV("Access-Control-Allow-Headers", requested)
+	}
+	if p.maxAge != "" {
+		h.Set("Access-Control-Max-Age", p.maxAge)
+	}
+	h.SetStatusCode(consts.StatusNoContent)
+	return true
+}
+
+// SetCORSHeaders sets the CORS headers of proxied responses from opts,
+// replacing the Access-Control-Allow-* headers of the backend: requests
+// from an allowed origin get Access-Control-Allow-Origin and, as
+// configured, Access-Control-Allow-Credentials and
+// Access-Control-Expose-Headers, others get none. Vary includes Origin
+// unless the answer is the same for all origins. Preflight requests are
+// answered by SetCORSPreflight.
+func (r *ReverseProxy) SetCORSHeaders(opts CORSOptions) {
+	r.corsHeaders = newCORSPolicy(opts)
+}
+
+// corsResponseHeaders are the CORS headers of the backend replaced by
+// SetCORSHeaders.
+var corsResponseHeaders = []string{
+	"Access-Control-Allow-Origin",
+	"Access-Control-Allow-Credentials",
+	"Access-Control-Allow-Methods",
+	"Access-Control-Allow-Headers",
+	"Access-Control-Max-Age",
+	"Access-Control-Expose-Headers",
+}
+
+// applyCORSHeaders sets the CORS headers of the response as configured by
+// SetCORSHeaders.
+func (r *ReverseProxy) applyCORSHeaders(c *app.RequestContext) {
+	p := r.corsHeaders
+	if p == nil {
+		return
+	}
+	h := &c.Response.Header
+	for _, name := range corsResponseHeaders {
+		h.Del(name)
+	}
+	origin := c.Request.Header.Peek("Origin")
+	if len(origin) == 0 || !p.allowsOrigin(origin) {
+		if !p.anyOrigin || p.credentials {
+			addVary(c, "Origin")
+		}
+		return
+	}
+	p.setAllowOrigin(c, origin)
+	if p.expose != "" {
+		h.Set("Access-Control-Expose-Headers", p.expose)
+	}
+}
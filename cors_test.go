@@ -0,0 +1,137 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestCORSPreflight(t *testing.T) {
+	var calls int
+	proxy, err := NewReverseProxy("http://backend", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		calls++
+		return nil
+	})))
+	assert.Nil(t, err)
+	proxy.SetCORSPreflight(CORSOptions{
+		AllowOrigins:     []string{"https://app.example.com"},
+		AllowMethods:     []string{"GET", "PUT"},
+		AllowHeaders:     []string{"Content-Type", "X-Token"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+
+	preflight := func(origin, method, headers string) *app.RequestContext {
+		ctx := app.NewContext(0)
+		ctx.Request.SetMethod("OPTIONS")
+		ctx.Request.SetRequestURI("http://localhost/items")
+		if origin != "" {
+			ctx.Request.Header.Set("Origin", origin)
+		}
+		if method != "" {
+			ctx.Request.Header.Set("Access-Control-Request-Method", method)
+		}
+		if headers != "" {
+			ctx.Request.Header.Set("Access-Control-Request-Headers", headers)
+		}
+		proxy.ServeHTTP(context.Background(), ctx)
+		return ctx
+	}
+
+	ctx := preflight("https://app.example.com", "PUT", "content-type, x-token")
+	assert.DeepEqual(t, 204, ctx.Response.StatusCode())
+	h := &ctx.Response.Header
+	assert.DeepEqual(t, "https://app.example.com", string(h.Peek("Access-Control-Allow-Origin")))
+	assert.DeepEqual(t, "GET, PUT", string(h.Peek("Access-Control-Allow-Methods")))
+	assert.DeepEqual(t, "content-type, x-token", string(h.Peek("Access-Control-Allow-Headers")))
+	assert.DeepEqual(t, "true", string(h.Peek("Access-Control-Allow-Credentials")))
+	assert.DeepEqual(t, "600", string(h.Peek("Access-Control-Max-Age")))
+	assert.DeepEqual(t, "Access-Control-Request-Method, Access-Control-Request-Headers, Origin", string(h.Peek("Vary")))
+	assert.DeepEqual(t, 0, calls)
+
+	for _, tt := range [][3]string{
+		{"https://evil.example.com", "PUT", ""},
+		{"https://app.example.com", "DELETE", ""},
+		{"https://app.example.com", "GET", "X-Other"},
+	} {
+		ctx = preflight(tt[0], tt[1], tt[2])
+		assert.DeepEqual(t, 403, ctx.Response.StatusCode())
+		assert.DeepEqual(t, "", string(ctx.Response.Header.Peek("Access-Control-Allow-Origin")))
+	}
+	assert.DeepEqual(t, 0, calls)
+
+	// plain OPTIONS requests reach the backend
+	preflight("", "", "")
+	preflight("https://app.example.com", "", "")
+	assert.DeepEqual(t, 2, calls)
+
+	proxy.SetCORSPreflight(CORSOptions{AllowOrigins: []string{"*"}, AllowHeaders: []string{"*"}})
+	ctx = preflight("https://any.example.com", "POST", "X-Anything")
+	assert.DeepEqual(t, 204, ctx.Response.StatusCode())
+	assert.DeepEqual(t, "*", string(ctx.Response.Header.Peek("Access-Control-Allow-Origin")))
+	assert.DeepEqual(t, "X-Anything", string(ctx.Response.Header.Peek("Access-Control-Allow-Headers")))
+	assert.DeepEqual(t, "GET, HEAD, POST", string(ctx.Response.Header.Peek("Access-Control-Allow-Methods")))
+}
+
+func TestCORSHeaders(t *testing.T) {
+	proxy, err := NewReverseProxy("http://backend", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		resp.Header.Set("Access-Control-Allow-Origin", "*")
+		resp.Header.Set("Vary", "Accept-Encoding")
+		resp.SetBodyString("ok")
+		return nil
+	})))
+	assert.Nil(t, err)
+	proxy.SetCORSHeaders(CORSOptions{
+		AllowOrigins:     []string{"https://app.example.com"},
+		AllowCredentials: true,
+		ExposeHeaders:    []string{"X-Request-Id", "X-Total"},
+	})
+
+	get := func(origin string) *protocol.ResponseHeader {
+		ctx := app.NewContext(0)
+		ctx.Request.SetRequestURI("http://localhost/items")
+		if origin != "" {
+			ctx.Request.Header.Set("Origin", origin)
+		}
+		proxy.ServeHTTP(context.Background(), ctx)
+		assert.DeepEqual(t, "ok", string(ctx.Response.Body()))
+		return &ctx.Response.Header
+	}
+
+	h := get("https://app.example.com")
+	assert.DeepEqual(t, "https://app.example.com", string(h.Peek("Access-Control-Allow-Origin")))
+	assert.DeepEqual(t, "true", string(h.Peek("Access-Control-Allow-Credentials")))
+	assert.DeepEqual(t, "X-Request-Id, X-Total", string(h.Peek("Access-Control-Expose-Headers")))
+	assert.DeepEqual(t, "Accept-Encoding, Origin", string(h.Peek("Vary")))
+
+	for _, origin := range []string{"https://evil.example.com", ""} {
+		h = get(origin)
+		assert.DeepEqual(t, "", string(h.Peek("Access-Control-Allow-Origin")))
+		assert.DeepEqual(t, "", string(h.Peek("Access-Control-Expose-Headers")))
+		assert.DeepEqual(t, "Accept-Encoding, Origin", string(h.Peek("Vary")))
+	}
+
+	proxy.SetCORSHeaders(CORSOptions{AllowOrigins: []string{"*"}})
+	h = get("https://any.example.com")
+	assert.DeepEqual(t, "*", string(h.Peek("Access-Control-Allow-Origin")))
+	assert.DeepEqual(t, "", string(h.Peek("Access-Control-Allow-Credentials")))
+	assert.DeepEqual(t, "Accept-Encoding", string(h.Peek("Vary")))
+}
@@ -0,0 +1,169 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// Defaults of DNSCacheOptions.
+const (
+	DefaultDNSCacheTTL    = 30 * time.Second
+	DefaultDNSNegativeTTL = 5 * time.Second
+)
+
+// dnsLookupTimeout bounds lookups shared by concurrent callers, which do
+// not use the context of any of them.
+const dnsLookupTimeout = 10 * time.Second
+
+// TTLResolver is a Resolver which also reports how long its answers may be
+// cached, e.g. one querying DNS servers directly. CachingResolver uses the
+// TTL if its resolver implements it.
+type TTLResolver interface {
+	Resolver
+	LookupHostTTL(ctx context.Context, host string) (addrs []string, ttl time.Duration, err error)
+}
+
+// DNSCacheOptions configures a CachingResolver.
+type DNSCacheOptions struct {
+	// TTL is how long answers of resolvers which are not a TTLResolver are
+	// cached, DefaultDNSCacheTTL if 0.
+	TTL time.Duration
+	// MinTTL and MaxTTL clamp the TTL of answers, if not 0, e.g. to keep
+	// a TTL of 0 from causing a lookup per request.
+	MinTTL time.Duration
+	MaxTTL time.Duration
+	// NegativeTTL is how long failed lookups are cached,
+	// DefaultDNSNegativeTTL if 0; negative values disable it.
+	NegativeTTL time.Duration
+}
+
+// CachingResolver caches the answers of a Resolver, so that backend hosts
+// are not resolved for each connection. Concurrent lookups of a host share
+// one query.
+type CachingResolver struct {
+	resolver Resolver
+	opts     DNSCacheOptions
+
+	mu      sync.Mutex
+	entries map[string]*dnsEntry
+}
+
+type dnsEntry struct {
+	// ready is closed once addrs and err are set
+	ready   chan struct{}
+	addrs   []string
+	err     error
+	expires time.Time
+}
+
+// NewCachingResolver returns a CachingResolver of res, net.DefaultResolver
+// if nil.
+func NewCachingResolver(res Resolver, opts DNSCacheOptions) *CachingResolver {
+	if res == nil {
+		res = net.DefaultResolver
+	}
+	if opts.TTL == 0 {
+		opts.TTL = DefaultDNSCacheTTL
+	}
+	if opts.NegativeTTL == 0 {
+		opts.NegativeTTL = DefaultDNSNegativeTTL
+	}
+	return &CachingResolver{resolver: res, opts: opts, entries: make(map[string]*dnsEntry)}
+}
+
+func (c *CachingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	c.mu.Lock()
+	e, ok := c.entries[host]
+	if !ok || e.done() && !time.Now().Before(e.expires) {
+		e = &dnsEntry{ready: make(chan struct{})}
+		c.entries[host] = e
+		go c.lookup(host, e)
+	}
+	c.mu.Unlock()
+	select {
+	case <-e.ready:
+		return e.addrs, e.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (e *dnsEntry) done() bool {
+	select {
+	case <-e.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// lookup resolves host into e.
+func (c *CachingResolver) lookup(host string, e *dnsEntry) {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsLookupTimeout)
+	defer cancel()
+	ttl := c.opts.TTL
+	if tr, ok := c.resolver.(TTLResolver); ok {
+		e.addrs, ttl, e.err = tr.LookupHostTTL(ctx, host)
+	} else {
+		e.addrs, e.err = c.resolver.LookupHost(ctx, host)
+	}
+	if e.err != nil {
+		ttl = c.opts.NegativeTTL
+	} else {
+		if ttl < c.opts.MinTTL {
+			ttl = c.opts.MinTTL
+		}
+		if c.opts.MaxTTL > 0 && ttl > c.opts.MaxTTL {
+			ttl = c.opts.MaxTTL
+		}
+	}
+	e.expires = time.Now().Add(ttl)
+	close(e.ready)
+}
+
+// Flush drops the cached answers for hosts, or all of them if none are
+// given, e.g. after backends moved.
+func (c *CachingResolver) Flush(hosts ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(hosts) == 0 {
+		c.entries = make(map[string]*dnsEntry)
+		return
+	}
+	for _, host := range hosts {
+		delete(c.entries, host)
+	}
+}
+
+// WithDNSCache caches the resolutions of backend hosts as set by opts,
+// wrapping the resolver of WithResolver, or the system one, in a
+// CachingResolver. FlushDNS drops the cached answers.
+func WithDNSCache(opts DNSCacheOptions) ProxyOption {
+	return func(o *ProxyOptions) {
+		o.DNSCache = &opts
+	}
+}
+
+// FlushDNS drops the cached resolutions of hosts, or all of them if none
+// are given, if r resolves hosts with a CachingResolver.
+func (r *ReverseProxy) FlushDNS(hosts ...string) {
+	if c, ok := r.resolver.(*CachingResolver); ok {
+		c.Flush(hosts...)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+)
+
+// countingResolver answers "ok.test" after delay and counts its lookups.
+type countingResolver struct {
+	delay   time.Duration
+	lookups int32
+}
+
+func (r *countingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	atomic.AddInt32(&r.lookups, 1)
+	time.Sleep(r.delay)
+	if host != "ok.test" {
+		return nil, errors.New("no such host")
+	}
+	return []string{"192.0.2.1"}, nil
+}
+
+func (r *countingResolver) count() int {
+	return int(atomic.LoadInt32(&r.lookups))
+}
+
+// ttlResolver reports ttl with its answers.
+type ttlResolver struct {
+	countingResolver
+	ttl time.Duration
+}
+
+func (r *ttlResolver) LookupHostTTL(ctx context.Context, host string) ([]string, time.Duration, error) {
+	addrs, err := r.LookupHost(ctx, host)
+	return addrs, r.ttl, err
+}
+
+func TestCachingResolver(t *testing.T) {
+	ctx := context.Background()
+	res := &countingResolver{}
+	c := NewCachingResolver(res, DNSCacheOptions{TTL: 30 * time.Millisecond, NegativeTTL: 30 * time.Millisecond})
+	for i := 0; i < 3; i++ {
+		addrs, err := c.LookupHost(ctx, "ok.test")
+		assert.Nil(t, err)
+		assert.DeepEqual(t, []string{"192.0.2.1"}, addrs)
+		_, err = c.LookupHost(ctx, "missing.test")
+		assert.NotNil(t, err)
+	}
+	assert.DeepEqual(t, 2, res.count())
+	time.Sleep(40 * time.Millisecond)
+	c.LookupHost(ctx, "ok.test")      //nolint:errcheck
+	c.LookupHost(ctx, "missing.test") //nolint:errcheck
+	assert.DeepEqual(t, 4, res.count())
+
+	c.Flush("ok.test")
+	c.LookupHost(ctx, "ok.test")      //nolint:errcheck
+	c.LookupHost(ctx, "missing.test") //nolint:errcheck
+	assert.DeepEqual(t, 5, res.count())
+	c.Flush()
+	c.LookupHost(ctx, "ok.test") //nolint:errcheck
+	assert.DeepEqual(t, 6, res.count())
+
+	// failures are not cached with a negative NegativeTTL
+	res = &countingResolver{}
+	c = NewCachingResolver(res, DNSCacheOptions{NegativeTTL: -1})
+	c.LookupHost(ctx, "missing.test") //nolint:errcheck
+	c.LookupHost(ctx, "missing.test") //nolint:errcheck
+	assert.DeepEqual(t, 2, res.count())
+
+	// concurrent lookups share one query, waiting within their context
+	res = &countingResolver{delay: 20 * time.Millisecond}
+	c = NewCachingResolver(res, DNSCacheOptions{})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			addrs, err := c.LookupHost(ctx, "ok.test")
+			assert.Nil(t, err)
+			assert.DeepEqual(t, 1, len(addrs))
+		}()
+	}
+	wg.Wait()
+	assert.DeepEqual(t, 1, res.count())
+	c.Flush()
+	short, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	_, err := c.LookupHost(short, "ok.test")
+	assert.DeepEqual(t, context.DeadlineExceeded, err)
+}
+
+func TestCachingResolverTTL(t *testing.T) {
+	ctx := context.Background()
+	// a TTL of 0 is raised to MinTTL
+	res := &ttlResolver{}
+	c := NewCachingResolver(res, DNSCacheOptions{MinTTL: time.Minute})
+	c.LookupHost(ctx, "ok.test") //nolint:errcheck
+	c.LookupHost(ctx, "ok.test") //nolint:errcheck
+	assert.DeepEqual(t, 1, res.count())
+
+	res = &ttlResolver{ttl: time.Hour}
+	c = NewCachingResolver(res, DNSCacheOptions{MaxTTL: 10 * time.Millisecond})
+	c.LookupHost(ctx, "ok.test") //nolint:errcheck
+	time.Sleep(20 * time.Millisecond)
+	c.LookupHost(ctx, "ok.test") //nolint:errcheck
+	assert.DeepEqual(t, 2, res.count())
+}
+
+func TestWithDNSCache(t *testing.T) {
+	res := &countingResolver{}
+	proxy, err := NewReverseProxy("http://ok.test", WithResolver(res), WithDNSCache(DNSCacheOptions{}))
+	assert.Nil(t, err)
+	proxy.resolver.LookupHost(context.Background(), "ok.test") //nolint:errcheck
+	proxy.resolver.LookupHost(context.Background(), "ok.test") //nolint:errcheck
+	assert.DeepEqual(t, 1, res.count())
+	proxy.FlushDNS()
+	proxy.resolver.LookupHost(context.Background(), "ok.test") //nolint:errcheck
+	assert.DeepEqual(t, 2, res.count())
+}
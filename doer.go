@@ -0,0 +1,56 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+// Doer sends requests to the backend, e.g. a *client.Client, a mock in
+// tests or a wrapper adding instrumentation.
+type Doer interface {
+	Do(ctx context.Context, req *protocol.Request, resp *protocol.Response) error
+}
+
+// DoerFunc adapts a function to Doer.
+type DoerFunc func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error
+
+func (f DoerFunc) Do(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+	return f(ctx, req, resp)
+}
+
+// The optional methods of a Doer used by the client behaviors, see
+// SetClientBehavior. *client.Client implements all of them.
+type (
+	deadlineDoer interface {
+		DoDeadline(ctx context.Context, req *protocol.Request, resp *protocol.Response, deadline time.Time) error
+	}
+	timeoutDoer interface {
+		DoTimeout(ctx context.Context, req *protocol.Request, resp *protocol.Response, timeout time.Duration) error
+	}
+	redirectsDoer interface {
+		DoRedirects(ctx context.Context, req *protocol.Request, resp *protocol.Response, maxRedirectsCount int) error
+	}
+)
+
+// doWithTimeout is the fallback of Doers without DoTimeout and DoDeadline.
+func doWithTimeout(ctx context.Context, d Doer, req *protocol.Request, resp *protocol.Response, timeout time.Duration) error {
+	req.SetOptions(config.WithRequestTimeout(timeout))
+	return d.Do(ctx, req, resp)
+}
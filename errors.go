@@ -0,0 +1,272 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	errs "github.com/cloudwego/hertz/pkg/common/errors"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+// ErrBackendUnavailable is returned, possibly wrapped, by clients or
+// middleware refusing to call a backend known to be unavailable, e.g. a
+// circuit breaker. Such errors are classified as ErrorKindUnavailable.
+var ErrBackendUnavailable = errors.New("reverseproxy: backend unavailable")
+
+// ErrClientAbort is passed to the error handler, possibly wrapping the error
+// of the backend call, when the request failed because the client went
+// away, e.g. it hung up while the backend was called. Like
+// http.ErrAbortHandler it marks failures nobody waits for, which need not be
+// reported as backend errors. ProxyErrors of it have ErrorKindClientAbort.
+var ErrClientAbort = errors.New("reverseproxy: client went away")
+
+// StatusClientClosedRequest is the status code requests aborted by the
+// client are answered with, as logged by nginx.
+const StatusClientClosedRequest = 499
+
+// ErrorKind classifies a ProxyError.
+type ErrorKind int
+
+const (
+	// ErrorKindBackend means the backend call failed, e.g. the
+	// connection was closed before the response was read.
+	ErrorKindBackend ErrorKind = iota
+	// ErrorKindTimeout means the backend did not answer in time.
+	ErrorKindTimeout
+	// ErrorKindConnect means no connection to the backend could be
+	// established, e.g. it refused the connection.
+	ErrorKindConnect
+	// ErrorKindResponse means the response of the backend was rejected
+	// by ModifyResponse or could not be transformed.
+	ErrorKindResponse
+	// ErrorKindTarget means the function set by SetTargetFunc failed, the
+	// backend was not called.
+	ErrorKindTarget
+	// ErrorKindUnavailable means the backend was not called because it is
+	// known to be unavailable, e.g. a circuit breaker returned
+	// ErrBackendUnavailable or no connection of the pool became free.
+	ErrorKindUnavailable
+	// ErrorKindClientAbort means the client went away before the response
+	// was ready, see ErrClientAbort.
+	ErrorKindClientAbort
+	// ErrorKindHeaderTimeout means the backend did not start answering in
+	// time, see ResponseHeaderTimeoutError.
+	ErrorKindHeaderTimeout
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorKindTimeout:
+		return "timeout"
+	case ErrorKindConnect:
+		return "connect"
+	case ErrorKindResponse:
+		return "response"
+	case ErrorKindTarget:
+		return "target"
+	case ErrorKindUnavailable:
+		return "unavailable"
+	case ErrorKindClientAbort:
+		return "client_abort"
+	case ErrorKindHeaderTimeout:
+		return "header_timeout"
+	default:
+		return "backend"
+	}
+}
+
+// ProxyError is the error given to the handler set by SetProxyErrorHandler.
+type ProxyError struct {
+	Kind ErrorKind
+	Err  error
+	// Target is the URI of the backend request.
+	Target string
+	// Attempts is the number of calls made to the backend, see SetRetries.
+	Attempts int
+
+	// status is the status code set by SetErrorStatusCodes for Kind
+	status int
+}
+
+func (e *ProxyError) Error() string {
+	return fmt.Sprintf("reverseproxy: %s error for %s after %d attempt(s): %v", e.Kind, e.Target, e.Attempts, e.Err)
+}
+
+func (e *ProxyError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode is the status code to answer the error with: 504 for
+// timeouts, 503 if the backend is unavailable, 499 if the client went away
+// and 502 otherwise, unless changed by SetErrorStatusCodes.
+func (e *ProxyError) StatusCode() int {
+	if e.status != 0 {
+		return e.status
+	}
+	return defaultErrorStatus(e.Kind)
+}
+
+func defaultErrorStatus(kind ErrorKind) int {
+	switch kind {
+	case ErrorKindTimeout, ErrorKindHeaderTimeout:
+		return consts.StatusGatewayTimeout
+	case ErrorKindUnavailable:
+		return consts.StatusServiceUnavailable
+	case ErrorKindClientAbort:
+		return StatusClientClosedRequest
+	default:
+		return consts.StatusBadGateway
+	}
+}
+
+// SetErrorStatusCodes changes the status codes errors of the given kinds
+// are answered with by the default error handler and ProxyError.StatusCode,
+// e.g. {ErrorKindConnect: 503}. Other kinds keep their default.
+func (r *ReverseProxy) SetErrorStatusCodes(codes map[ErrorKind]int) {
+	r.errorStatus = make(map[ErrorKind]int, len(codes))
+	for kind, code := range codes {
+		r.errorStatus[kind] = code
+	}
+}
+
+// errorStatusCode returns the status code errors of kind are answered with.
+func (r *ReverseProxy) errorStatusCode(kind ErrorKind) int {
+	if code, ok := r.errorStatus[kind]; ok {
+		return code
+	}
+	return defaultErrorStatus(kind)
+}
+
+// clientAbortError returns the error passed to the error handler when the
+// client went away during the backend call, which failed with err if not nil.
+func clientAbortError(err error) error {
+	if err == nil || errors.Is(err, ErrClientAbort) {
+		return ErrClientAbort
+	}
+	return &clientAbort{err: err}
+}
+
+// clientAbort is ErrClientAbort wrapping the error of the backend call.
+type clientAbort struct {
+	err error
+}
+
+func (e *clientAbort) Error() string {
+	return ErrClientAbort.Error() + ": " + e.err.Error()
+}
+
+func (e *clientAbort) Unwrap() error {
+	return e.err
+}
+
+func (e *clientAbort) Is(target error) bool {
+	return target == ErrClientAbort
+}
+
+// classifyError returns the kind of an error of the backend call.
+func classifyError(err error) ErrorKind {
+	var netErr net.Error
+	var opErr *net.OpError
+	var headerErr *ResponseHeaderTimeoutError
+	switch {
+	case errors.Is(err, ErrClientAbort):
+		return ErrorKindClientAbort
+	case errors.As(err, &headerErr):
+		return ErrorKindHeaderTimeout
+	case errors.Is(err, ErrBackendUnavailable), errors.Is(err, errs.ErrNoFreeConns):
+		return ErrorKindUnavailable
+	case errors.Is(err, errs.ErrTimeout), errors.Is(err, errs.ErrDialTimeout), errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, errs.ErrReadTimeout), errors.Is(err, errs.ErrWriteTimeout),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorKindTimeout
+	case errors.Is(err, syscall.ECONNREFUSED), errors.As(err, &opErr) && opErr.Op == "dial":
+		return ErrorKindConnect
+	default:
+		return ErrorKindBackend
+	}
+}
+
+// SetProxyErrorHandler sets a handler receiving errors as ProxyError,
+// e.g. to answer with err.StatusCode(). It takes precedence over the
+// handler set by SetErrorHandler.
+func (r *ReverseProxy) SetProxyErrorHandler(eh func(ctx context.Context, c *app.RequestContext, err *ProxyError)) {
+	r.proxyErrorHandler = eh
+}
+
+// handleError passes err to the error handler, or answers with the status
+// code of its kind if there is none. Errors of the backend call are
+// classified if kind is ErrorKindBackend.
+func (r *ReverseProxy) handleError(ctx context.Context, c *app.RequestContext, kind ErrorKind, err error, attempts int) {
+	if kind == ErrorKindBackend {
+		kind = classifyError(err)
+	}
+	switch {
+	case r.proxyErrorHandler != nil:
+		r.proxyErrorHandler(ctx, c, &ProxyError{
+			Kind:     kind,
+			Err:      err,
+			Target:   string(c.Request.URI().FullURI()),
+			Attempts: attempts,
+			status:   r.errorStatusCode(kind),
+		})
+	case r.errorHandler != nil:
+		r.errorHandler(c, err)
+	default:
+		c.Response.Header.SetStatusCode(r.errorStatusCode(kind))
+	}
+}
+
+// isRetryable reports whether req may be sent again after err.
+func isRetryable(req *protocol.Request, err error) bool {
+	if !canResend(req) {
+		return false
+	}
+	kind := classifyError(err)
+	return kind == ErrorKindConnect || kind == ErrorKindTimeout || kind == ErrorKindHeaderTimeout
+}
+
+// canResend reports whether req is idempotent and can be sent again.
+func canResend(req *protocol.Request) bool {
+	if req.IsBodyStream() {
+		return false
+	}
+	switch string(req.Header.Method()) {
+	case consts.MethodGet, consts.MethodHead, consts.MethodOptions, consts.MethodTrace, consts.MethodPut, consts.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// isStaleConnError reports whether err means that the backend closed the
+// connection before answering, typically a kept-alive connection it had
+// closed while idle in the pool.
+func isStaleConnError(err error) bool {
+	return errors.Is(err, errs.ErrConnectionClosed) || errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		// the hertz client replaces io.EOF before the first response byte
+		// by an unexported error wrapping none of the above, so only its
+		// message identifies it
+		strings.Contains(err.Error(), "closed connection before returning the first response byte")
+}
@@ -0,0 +1,266 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/client"
+	"github.com/cloudwego/hertz/pkg/app/server"
+	errs "github.com/cloudwego/hertz/pkg/common/errors"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestProxyErrorHandler(t *testing.T) {
+	r := server.New(server.WithHostPorts("127.0.0.1:10033"))
+	r.GET("/backend/slow", func(cc context.Context, ctx *app.RequestContext) {
+		time.Sleep(300 * time.Millisecond)
+	})
+	r.GET("/backend/ok", func(cc context.Context, ctx *app.RequestContext) {})
+
+	errc := make(chan *ProxyError, 1)
+	handler := func(ctx context.Context, c *app.RequestContext, err *ProxyError) {
+		errc <- err
+		c.AbortWithStatus(err.StatusCode())
+	}
+	slow, _ := NewSingleHostReverseProxy("http://127.0.0.1:10033/backend")
+	slow.SetClientBehavior(ClientDoTimeout(100 * time.Millisecond))
+	slow.SetProxyErrorHandler(handler)
+	down, _ := NewSingleHostReverseProxy("http://127.0.0.1:10035")
+	down.SetProxyErrorHandler(handler)
+	rejected, _ := NewSingleHostReverseProxy("http://127.0.0.1:10033/backend")
+	rejected.SetModifyResponse(func(resp *protocol.Response) error {
+		return errors.New("rejected")
+	})
+	rejected.SetProxyErrorHandler(handler)
+	r.GET("/slow", slow.ServeHTTP)
+	r.GET("/down", down.ServeHTTP)
+	r.GET("/ok", rejected.ServeHTTP)
+	go r.Spin()
+	defer r.Shutdown(context.TODO())
+	time.Sleep(time.Second)
+
+	cli, _ := client.NewClient()
+	for _, tt := range []struct {
+		path   string
+		kind   ErrorKind
+		target string
+		status int
+	}{
+		{"/slow", ErrorKindTimeout, "http://127.0.0.1:10033/backend/slow", http.StatusGatewayTimeout},
+		{"/down", ErrorKindConnect, "http://127.0.0.1:10035/down", http.StatusBadGateway},
+		{"/ok", ErrorKindResponse, "http://127.0.0.1:10033/backend/ok", http.StatusBadGateway},
+	} {
+		status, _, err := cli.Get(context.Background(), nil, "http://127.0.0.1:10033"+tt.path)
+		assert.Nil(t, err)
+		assert.DeepEqual(t, tt.status, status)
+		var got *ProxyError
+		select {
+		case got = <-errc:
+		default:
+		}
+		assert.NotNil(t, got)
+		assert.DeepEqual(t, tt.kind, got.Kind)
+		assert.DeepEqual(t, tt.target, got.Target)
+		assert.DeepEqual(t, 1, got.Attempts)
+	}
+}
+
+func TestResendOnStaleConnection(t *testing.T) {
+	for _, tt := range []struct {
+		method   string
+		err      error
+		attempts int
+		status   int
+	}{
+		{"GET", errs.ErrConnectionClosed, 2, 200},
+		{"PUT", syscall.ECONNRESET, 2, 200},
+		{"POST", errs.ErrConnectionClosed, 1, 502},
+		{"GET", errors.New("bad response"), 1, 502},
+	} {
+		calls := 0
+		proxy, err := NewReverseProxy("http://backend", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+			if calls++; calls == 1 {
+				return tt.err
+			}
+			return nil
+		})))
+		assert.Nil(t, err)
+		ctx := app.NewContext(0)
+		ctx.Request.SetMethod(tt.method)
+		ctx.Request.SetRequestURI("http://localhost/a")
+		proxy.ServeHTTP(context.Background(), ctx)
+		assert.DeepEqual(t, tt.status, ctx.Response.StatusCode())
+		assert.DeepEqual(t, tt.attempts, ctx.Value(ContextKeyAttempts))
+	}
+}
+
+func TestResendOnClosedKeepAlive(t *testing.T) {
+	// the backend answers one request per connection without
+	// "Connection: close" and then closes it, like an idle timeout
+	ln, err := net.Listen("tcp", "127.0.0.1:10048")
+	assert.Nil(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				for {
+					line, err := br.ReadString('\n')
+					if err != nil || line == "\r\n" {
+						break
+					}
+				}
+				conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"))
+				time.Sleep(10 * time.Millisecond)
+			}()
+		}
+	}()
+
+	proxy, err := NewSingleHostReverseProxy("http://127.0.0.1:10048")
+	assert.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		ctx := app.NewContext(0)
+		ctx.Request.SetRequestURI("http://localhost/a")
+		proxy.ServeHTTP(context.Background(), ctx)
+		assert.DeepEqual(t, 200, ctx.Response.StatusCode())
+		assert.DeepEqual(t, "ok", string(ctx.Response.Body()))
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestResendOnConnectionClosedBeforeResponse(t *testing.T) {
+	// the first connection reads the request and is closed without an
+	// answer, like a pooled connection the backend closed while idle
+	ln, err := net.Listen("tcp", "127.0.0.1:10070")
+	assert.Nil(t, err)
+	defer ln.Close()
+	go func() {
+		for accepted := 0; ; accepted++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(first bool) {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				for {
+					line, err := br.ReadString('\n')
+					if err != nil || line == "\r\n" {
+						break
+					}
+				}
+				if !first {
+					conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"))
+				}
+			}(accepted == 0)
+		}
+	}()
+
+	proxy, err := NewSingleHostReverseProxy("http://127.0.0.1:10070")
+	assert.Nil(t, err)
+	ctx := app.NewContext(0)
+	ctx.Request.SetRequestURI("http://localhost/a")
+	proxy.ServeHTTP(context.Background(), ctx)
+	assert.DeepEqual(t, 200, ctx.Response.StatusCode())
+	assert.DeepEqual(t, "ok", string(ctx.Response.Body()))
+	assert.DeepEqual(t, 2, ctx.Value(ContextKeyAttempts))
+}
+
+func TestErrorStatusCodes(t *testing.T) {
+	var backendErr error
+	proxy, err := NewReverseProxy("http://backend", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		return backendErr
+	})))
+	assert.Nil(t, err)
+
+	serve := func() int {
+		ctx := app.NewContext(0)
+		ctx.Request.SetRequestURI("http://localhost/items")
+		proxy.ServeHTTP(context.Background(), ctx)
+		return ctx.Response.StatusCode()
+	}
+	for _, tt := range []struct {
+		err    error
+		status int
+	}{
+		{errs.ErrTimeout, http.StatusGatewayTimeout},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout},
+		{syscall.ECONNREFUSED, http.StatusBadGateway},
+		{errors.New("malformed response"), http.StatusBadGateway},
+		{fmt.Errorf("breaker open: %w", ErrBackendUnavailable), http.StatusServiceUnavailable},
+		{errs.ErrNoFreeConns, http.StatusServiceUnavailable},
+	} {
+		backendErr = tt.err
+		assert.DeepEqual(t, tt.status, serve())
+	}
+
+	proxy.SetErrorStatusCodes(map[ErrorKind]int{ErrorKindConnect: http.StatusServiceUnavailable})
+	backendErr = syscall.ECONNREFUSED
+	assert.DeepEqual(t, http.StatusServiceUnavailable, serve())
+	backendErr = errs.ErrTimeout
+	assert.DeepEqual(t, http.StatusGatewayTimeout, serve())
+
+	var got int
+	proxy.SetProxyErrorHandler(func(ctx context.Context, c *app.RequestContext, err *ProxyError) {
+		got = err.StatusCode()
+	})
+	backendErr = syscall.ECONNREFUSED
+	serve()
+	assert.DeepEqual(t, http.StatusServiceUnavailable, got)
+}
+
+func TestClientAbortError(t *testing.T) {
+	proxy, err := NewReverseProxy("http://backend", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		return ctx.Err()
+	})))
+	assert.Nil(t, err)
+	var got error
+	proxy.SetErrorHandler(func(c *app.RequestContext, err error) {
+		got = err
+	})
+
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+	ctx := app.NewContext(0)
+	ctx.Request.SetRequestURI("http://localhost/items")
+	proxy.ServeHTTP(c, ctx)
+	assert.True(t, errors.Is(got, ErrClientAbort))
+	assert.True(t, errors.Is(got, context.Canceled))
+
+	proxy.SetErrorHandler(nil)
+	ctx = app.NewContext(0)
+	ctx.Request.SetRequestURI("http://localhost/items")
+	proxy.ServeHTTP(c, ctx)
+	assert.DeepEqual(t, StatusClientClosedRequest, ctx.Response.StatusCode())
+
+	assert.DeepEqual(t, ErrClientAbort, clientAbortError(nil))
+	assert.DeepEqual(t, ErrorKindClientAbort, classifyError(clientAbortError(errors.New("reset"))))
+}
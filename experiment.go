@@ -0,0 +1,124 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"fmt"
+
+	"github.com/bytedance/gopkg/lang/fastrand"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+// DefaultExperimentCookie is the cookie of an Experiment without Cookie.
+const DefaultExperimentCookie = "hertz_variant"
+
+// ContextKeyVariant is the name of the Variant a request was forwarded to,
+// a string stored in the app.RequestContext, e.g. for access logs.
+const ContextKeyVariant = "reverseproxy.variant"
+
+// Experiment splits the clients of a route between variant backends for
+// A/B tests. A client is assigned a variant at random in proportion to
+// the weights and keeps it through a cookie holding the variant name.
+// Clients whose variant no longer exists or is draining are reassigned.
+// All other settings of the route apply to the variants, too.
+type Experiment struct {
+	// Cookie is the name of the cookie, DefaultExperimentCookie if empty.
+	Cookie string `json:"cookie,omitempty" yaml:"cookie,omitempty"`
+	// MaxAge of the cookie in seconds, 0 for a session cookie.
+	MaxAge   int       `json:"max_age,omitempty" yaml:"max_age,omitempty"`
+	Variants []Variant `json:"variants" yaml:"variants"`
+}
+
+// Variant is a bucket of an Experiment.
+type Variant struct {
+	Name string `json:"name" yaml:"name"`
+	// Target is interpreted like Route.Target, empty means the Target
+	// of the route.
+	Target string `json:"target,omitempty" yaml:"target,omitempty"`
+	// Weight is the share of new clients assigned to the variant relative
+	// to the other variants. With 0 it only keeps its current clients.
+	Weight int `json:"weight" yaml:"weight"`
+}
+
+func (e *Experiment) cookie() string {
+	if e.Cookie == "" {
+		return DefaultExperimentCookie
+	}
+	return e.Cookie
+}
+
+func (e *Experiment) validate(path string) error {
+	names, total := make(map[string]bool, len(e.Variants)), 0
+	for _, v := range e.Variants {
+		if v.Name == "" || names[v.Name] {
+			return fmt.Errorf("reverseproxy: route %q: variant names must be unique and not empty", path)
+		}
+		if v.Weight < 0 {
+			return fmt.Errorf("reverseproxy: route %q: variant %q: negative weight", path, v.Name)
+		}
+		names[v.Name] = true
+		total += v.Weight
+	}
+	if total == 0 {
+		return fmt.Errorf("reverseproxy: route %q: experiment needs a variant with weight", path)
+	}
+	return nil
+}
+
+// variant returns the variant of the request and whether the client is
+// newly assigned to it, or nil if every variant is draining.
+func (r *compiledRoute) variant(c *app.RequestContext) (*compiledRoute, bool) {
+	if name := c.Request.Header.Cookie(r.Experiment.cookie()); name != nil {
+		for _, v := range r.variants {
+			if v.variantName == b2s(name) && !v.stats.isDraining() {
+				return v, false
+			}
+		}
+	}
+	total := 0
+	for _, v := range r.variants {
+		if !v.stats.isDraining() {
+			total += v.variantWeight
+		}
+	}
+	if total == 0 {
+		return nil, false
+	}
+	n := fastrand.Intn(total)
+	for _, v := range r.variants {
+		if v.stats.isDraining() {
+			continue
+		}
+		if n -= v.variantWeight; n < 0 {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// setVariantCookie assigns the client to the variant r.
+func (r *compiledRoute) setVariantCookie(c *app.RequestContext) {
+	cookie := protocol.AcquireCookie()
+	defer protocol.ReleaseCookie(cookie)
+	cookie.SetKey(r.Experiment.cookie())
+	cookie.SetValue(r.variantName)
+	cookie.SetPath("/")
+	cookie.SetHTTPOnly(true)
+	if r.Experiment.MaxAge > 0 {
+		cookie.SetMaxAge(r.Experiment.MaxAge)
+	}
+	c.Response.Header.SetCookie(cookie)
+}
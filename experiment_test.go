@@ -0,0 +1,119 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/client"
+	"github.com/cloudwego/hertz/pkg/app/server"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestRouterExperiment(t *testing.T) {
+	backend := server.New(server.WithHostPorts("127.0.0.1:10046"))
+	backend.Any("/*path", func(cc context.Context, ctx *app.RequestContext) {
+		ctx.String(200, string(ctx.Request.URI().Path()))
+	})
+	go backend.Spin()
+
+	rt, err := NewRouter([]Route{{
+		Path:   "/shop/",
+		Target: "http://127.0.0.1:10046/a",
+		Experiment: &Experiment{
+			MaxAge: 3600,
+			Variants: []Variant{
+				{Name: "a", Weight: 1},
+				{Name: "b", Target: "http://127.0.0.1:10046/b", Weight: 1},
+			},
+		},
+	}})
+	assert.Nil(t, err)
+	r := server.New(server.WithHostPorts("127.0.0.1:10047"))
+	variants := make(chan interface{}, 1)
+	r.Use(func(ctx context.Context, c *app.RequestContext) {
+		c.Next(ctx)
+		variant, _ := c.Get(ContextKeyVariant)
+		variants <- variant
+	}, rt.ServeHTTP)
+	go r.Spin()
+	time.Sleep(time.Second)
+
+	cli, _ := client.NewClient()
+	var variant interface{}
+	get := func(cookie string) (body string, setCookie *protocol.Cookie) {
+		req, resp := protocol.AcquireRequest(), protocol.AcquireResponse()
+		defer func() {
+			protocol.ReleaseRequest(req)
+			protocol.ReleaseResponse(resp)
+		}()
+		req.SetRequestURI("http://127.0.0.1:10047/shop/cart")
+		if cookie != "" {
+			req.Header.SetCookie(DefaultExperimentCookie, cookie)
+		}
+		assert.Nil(t, cli.Do(context.Background(), req, resp))
+		// the middleware is done before the response is written
+		variant = <-variants
+		setCookie = &protocol.Cookie{}
+		setCookie.SetKey(DefaultExperimentCookie)
+		if !resp.Header.Cookie(setCookie) {
+			setCookie = nil
+		}
+		return string(resp.Body()), setCookie
+	}
+
+	// new clients are assigned a variant
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		body, cookie := get("")
+		assert.NotNil(t, cookie)
+		assert.DeepEqual(t, "/"+string(cookie.Value())+"/shop/cart", body)
+		assert.DeepEqual(t, 3600, cookie.MaxAge())
+		assert.DeepEqual(t, string(cookie.Value()), variant)
+		seen[string(cookie.Value())] = true
+	}
+	assert.DeepEqual(t, 2, len(seen))
+
+	// assigned clients stick to their variant
+	for i := 0; i < 10; i++ {
+		body, cookie := get("b")
+		assert.DeepEqual(t, "/b/shop/cart", body)
+		assert.Nil(t, cookie)
+	}
+
+	// clients of a draining variant are reassigned
+	assert.True(t, rt.DrainUpstream("http://127.0.0.1:10046/b"))
+	body, cookie := get("b")
+	assert.DeepEqual(t, "/a/shop/cart", body)
+	assert.DeepEqual(t, "a", string(cookie.Value()))
+
+	for _, e := range []*Experiment{
+		{},
+		{Variants: []Variant{{Name: "a"}}},
+		{Variants: []Variant{{Name: "a", Weight: 1}, {Name: "a", Weight: 1}}},
+		{Variants: []Variant{{Name: "a", Weight: -1}, {Name: "b", Weight: 2}}},
+	} {
+		assert.NotNil(t, rt.ReplaceTable([]Route{{Path: "/", Target: "http://a", Experiment: e}}))
+	}
+	assert.NotNil(t, rt.ReplaceTable([]Route{{
+		Path: "/", Target: "http://a",
+		Canary:     &Canary{Target: "http://b"},
+		Experiment: &Experiment{Variants: []Variant{{Name: "a", Weight: 1}}},
+	}}))
+}
@@ -0,0 +1,242 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+// FanOutBackend is a backend of a FanOutProxy.
+type FanOutBackend struct {
+	// Name identifies the backend in the results.
+	Name string
+	// Proxy forwards the request to the backend.
+	Proxy *ReverseProxy
+}
+
+// FanOutResult is the outcome of calling one backend of a FanOutProxy.
+type FanOutResult struct {
+	// Name is the name of the backend.
+	Name string
+	// Response is the response of the backend, or the error response of
+	// its proxy, e.g. 502. It is nil if Err is set.
+	Response *protocol.Response
+	// Err is context.DeadlineExceeded if the backend did not answer within
+	// the timeout, context.Canceled if the quorum was reached or the
+	// client went away first, or the error reading the response body.
+	Err error
+	// Latency is the time until the backend answered.
+	Latency time.Duration
+}
+
+// FanOutAggregator composes the response to the client in c.Response from
+// the results, which are in the order of the backends.
+type FanOutAggregator func(ctx context.Context, c *app.RequestContext, results []*FanOutResult)
+
+// FanOutProxy forwards each request to all of its backends concurrently
+// and answers with the response composed of theirs by an aggregator, e.g.
+// for search or aggregation gateways. The request body is buffered to be
+// sent to every backend; upgrade requests are answered with 501.
+type FanOutProxy struct {
+	backends  []FanOutBackend
+	aggregate FanOutAggregator
+	// timeout and quorum are set by SetTimeout and SetQuorum
+	timeout time.Duration
+	quorum  int
+}
+
+// NewFanOutProxy returns a FanOutProxy calling backends and answering with
+// aggregate, e.g. FanOutMergeJSON or FanOutFastest.
+func NewFanOutProxy(aggregate FanOutAggregator, backends ...FanOutBackend) (*FanOutProxy, error) {
+	if aggregate == nil {
+		return nil, errors.New("reverseproxy: fan-out needs an aggregator")
+	}
+	if len(backends) == 0 {
+		return nil, errors.New("reverseproxy: fan-out needs backends")
+	}
+	for _, b := range backends {
+		if b.Proxy == nil {
+			return nil, fmt.Errorf("reverseproxy: fan-out backend %q has no proxy", b.Name)
+		}
+	}
+	return &FanOutProxy{
+		backends:  append([]FanOutBackend(nil), backends...),
+		aggregate: aggregate,
+	}, nil
+}
+
+// SetTimeout limits waiting for the backends; those which did not answer
+// in time are aggregated with Err context.DeadlineExceeded. 0, the
+// default, waits for all of them.
+func (f *FanOutProxy) SetTimeout(timeout time.Duration) {
+	f.timeout = timeout
+}
+
+// SetQuorum stops waiting for the backends once n of them answered below
+// 500, e.g. 1 to answer with the fastest one. 0, the default, waits for
+// all of them.
+func (f *FanOutProxy) SetQuorum(n int) {
+	f.quorum = n
+}
+
+// fanOutCall is a result of the backend at index i.
+type fanOutCall struct {
+	i      int
+	result *FanOutResult
+}
+
+func (f *FanOutProxy) ServeHTTP(ctx context.Context, c *app.RequestContext) {
+	if upgradeType(&c.Request.Header) != "" {
+		c.Response.Header.SetStatusCode(consts.StatusNotImplemented)
+		return
+	}
+	if _, err := c.Request.BodyE(); err != nil {
+		c.Response.Header.SetStatusCode(consts.StatusBadRequest)
+		return
+	}
+
+	var callCtx context.Context
+	var cancel context.CancelFunc
+	if f.timeout > 0 {
+		callCtx, cancel = context.WithTimeout(ctx, f.timeout)
+	} else {
+		callCtx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+	// buffered so that calls which are no longer waited for finish
+	calls := make(chan fanOutCall, len(f.backends))
+	start := time.Now()
+	for i, b := range f.backends {
+		bc := c.Copy()
+		bc.Response.Reset()
+		go func(i int, b FanOutBackend, bc *app.RequestContext) {
+			b.Proxy.ServeHTTP(callCtx, bc)
+			result := &FanOutResult{Name: b.Name, Response: &bc.Response, Latency: time.Since(start)}
+			if _, err := bc.Response.BodyE(); err != nil {
+				result.Response, result.Err = nil, err
+			}
+			calls <- fanOutCall{i: i, result: result}
+		}(i, b, bc)
+	}
+
+	results := make([]*FanOutResult, len(f.backends))
+	answered := 0
+wait:
+	for range f.backends {
+		select {
+		case call := <-calls:
+			results[call.i] = call.result
+			if call.result.Response != nil && call.result.Response.StatusCode() < consts.StatusInternalServerError {
+				answered++
+			}
+			if f.quorum > 0 && answered >= f.quorum {
+				break wait
+			}
+		case <-callCtx.Done():
+			break wait
+		}
+	}
+	cancel()
+	for i, result := range results {
+		if result == nil {
+			results[i] = &FanOutResult{Name: f.backends[i].Name, Err: callCtx.Err(), Latency: time.Since(start)}
+		}
+	}
+	f.aggregate(ctx, c, results)
+}
+
+// FanOutFastest answers with the response of the backend which answered
+// first below 500, else with the first response, else with 504.
+func FanOutFastest(ctx context.Context, c *app.RequestContext, results []*FanOutResult) {
+	var fastest *FanOutResult
+	for _, result := range results {
+		if result.Response == nil {
+			continue
+		}
+		if fastest == nil || fanOutFailed(fastest) && !fanOutFailed(result) ||
+			fanOutFailed(fastest) == fanOutFailed(result) && result.Latency < fastest.Latency {
+			fastest = result
+		}
+	}
+	if fastest == nil {
+		c.Response.Header.SetStatusCode(consts.StatusGatewayTimeout)
+		return
+	}
+	fastest.Response.CopyTo(&c.Response)
+}
+
+func fanOutFailed(result *FanOutResult) bool {
+	return result.Response.StatusCode() >= consts.StatusInternalServerError
+}
+
+// FanOutMergeJSON answers with the JSON bodies of the 2xx responses merged,
+// either the members of objects, later backends overriding earlier ones,
+// or the elements of arrays. Other responses are left out. If no backend
+// answered with 2xx, or the bodies are not all objects or all arrays, it
+// answers with 502.
+func FanOutMergeJSON(ctx context.Context, c *app.RequestContext, results []*FanOutResult) {
+	var object map[string]json.RawMessage
+	var array []json.RawMessage
+	for _, result := range results {
+		if result.Response == nil || result.Response.StatusCode()/100 != 2 {
+			continue
+		}
+		body := bytes.TrimSpace(result.Response.Body())
+		var err error
+		switch {
+		case len(body) > 0 && body[0] == '{' && array == nil:
+			if object == nil {
+				object = make(map[string]json.RawMessage)
+			}
+			err = json.Unmarshal(body, &object)
+		case len(body) > 0 && body[0] == '[' && object == nil:
+			var elements []json.RawMessage
+			err = json.Unmarshal(body, &elements)
+			array = append(array, elements...)
+			if array == nil {
+				array = []json.RawMessage{}
+			}
+		default:
+			err = errors.New("not a JSON object or array")
+		}
+		if err != nil {
+			c.Response.Header.SetStatusCode(consts.StatusBadGateway)
+			return
+		}
+	}
+	var merged interface{} = object
+	if array != nil {
+		merged = array
+	} else if object == nil {
+		c.Response.Header.SetStatusCode(consts.StatusBadGateway)
+		return
+	}
+	body, err := json.Marshal(merged)
+	if err != nil {
+		c.Response.Header.SetStatusCode(consts.StatusBadGateway)
+		return
+	}
+	c.Response.Header.SetContentTypeBytes([]byte(consts.MIMEApplicationJSONUTF8))
+	c.Response.SetBody(body)
+}
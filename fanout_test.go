@@ -0,0 +1,117 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func fanOutBackend(t *testing.T, name string, delay time.Duration, body string, err error) FanOutBackend {
+	proxy, perr := NewReverseProxy("http://"+name, WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		time.Sleep(delay)
+		if string(req.Body()) != "search" {
+			resp.SetStatusCode(400)
+			return nil
+		}
+		resp.SetBodyString(body)
+		return err
+	})))
+	assert.Nil(t, perr)
+	return FanOutBackend{Name: name, Proxy: proxy}
+}
+
+func TestFanOutProxy(t *testing.T) {
+	serve := func(f *FanOutProxy) *app.RequestContext {
+		ctx := app.NewContext(0)
+		ctx.Request.SetMethod("POST")
+		ctx.Request.SetRequestURI("http://localhost/search")
+		ctx.Request.SetBodyStream(bytes.NewReader([]byte("search")), -1)
+		f.ServeHTTP(context.Background(), ctx)
+		return ctx
+	}
+	fast := fanOutBackend(t, "fast", 0, `{"a": 1, "b": 1}`, nil)
+	slow := fanOutBackend(t, "slow", 100*time.Millisecond, `{"b": 2}`, nil)
+	down := fanOutBackend(t, "down", 0, "", errors.New("connection refused"))
+
+	var results []*FanOutResult
+	f, err := NewFanOutProxy(func(ctx context.Context, c *app.RequestContext, r []*FanOutResult) {
+		results = r
+		FanOutMergeJSON(ctx, c, r)
+	}, fast, slow, down)
+	assert.Nil(t, err)
+	ctx := serve(f)
+	assert.DeepEqual(t, 200, ctx.Response.StatusCode())
+	assert.DeepEqual(t, `{"a":1,"b":2}`, string(ctx.Response.Body()))
+	assert.DeepEqual(t, 3, len(results))
+	assert.DeepEqual(t, "down", results[2].Name)
+	assert.DeepEqual(t, 502, results[2].Response.StatusCode())
+
+	f.SetTimeout(50 * time.Millisecond)
+	ctx = serve(f)
+	assert.DeepEqual(t, `{"a":1,"b":1}`, string(ctx.Response.Body()))
+	assert.DeepEqual(t, context.DeadlineExceeded, results[1].Err)
+	assert.Nil(t, results[1].Response)
+
+	f, err = NewFanOutProxy(FanOutFastest, down, slow, fast)
+	assert.Nil(t, err)
+	f.SetQuorum(1)
+	start := time.Now()
+	ctx = serve(f)
+	assert.True(t, time.Since(start) < 100*time.Millisecond)
+	assert.DeepEqual(t, `{"a": 1, "b": 1}`, string(ctx.Response.Body()))
+
+	f, err = NewFanOutProxy(FanOutFastest, down)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, 502, serve(f).Response.StatusCode())
+
+	_, err = NewFanOutProxy(FanOutFastest)
+	assert.NotNil(t, err)
+	_, err = NewFanOutProxy(FanOutFastest, FanOutBackend{Name: "none"})
+	assert.NotNil(t, err)
+}
+
+func TestFanOutMergeJSON(t *testing.T) {
+	result := func(code int, body string) *FanOutResult {
+		resp := &protocol.Response{}
+		resp.SetStatusCode(code)
+		resp.SetBodyString(body)
+		return &FanOutResult{Response: resp}
+	}
+	for _, tt := range []struct {
+		results []*FanOutResult
+		code    int
+		want    string
+	}{
+		{[]*FanOutResult{result(200, `[1]`), result(200, ` [2, 3]`), result(404, `{}`)}, 200, `[1,2,3]`},
+		{[]*FanOutResult{result(200, `[]`), {Err: context.Canceled}}, 200, `[]`},
+		{[]*FanOutResult{result(200, `{"a": {"x": 1}}`), result(200, `{"a": {"y": 2}}`)}, 200, `{"a":{"y":2}}`},
+		{[]*FanOutResult{result(200, `{}`), result(200, `[]`)}, 502, ``},
+		{[]*FanOutResult{result(200, `"text"`)}, 502, ``},
+		{[]*FanOutResult{result(500, `{}`)}, 502, ``},
+	} {
+		ctx := app.NewContext(0)
+		FanOutMergeJSON(context.Background(), ctx, tt.results)
+		assert.DeepEqual(t, tt.code, ctx.Response.StatusCode())
+		assert.DeepEqual(t, tt.want, string(ctx.Response.Body()))
+	}
+}
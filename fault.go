@@ -0,0 +1,89 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"time"
+
+	"github.com/bytedance/gopkg/lang/fastrand"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+// Faults are injected into requests before they are forwarded, see
+// SetFaults. Percentages are of all requests, from 0 to 100, and are drawn
+// independently of each other.
+type Faults struct {
+	// DelayPercent of the requests are delayed by Delay.
+	DelayPercent float64
+	Delay        time.Duration
+	// AbortPercent of the requests are answered with AbortStatus, 503 by
+	// default, without calling the backend.
+	AbortPercent float64
+	AbortStatus  int
+	// DropPercent of the requests get their connection closed without a
+	// response.
+	DropPercent float64
+}
+
+// SetFaults injects faults into the requests of r to test the resilience
+// of its clients, nil stops injecting them. It is safe to call while
+// serving, e.g. from an admin endpoint.
+func (r *ReverseProxy) SetFaults(f *Faults) {
+	r.faults.Store(f)
+}
+
+// injectFaults applies the faults set by SetFaults to the request. It
+// reports whether the request was answered.
+func (r *ReverseProxy) injectFaults(c context.Context, ctx *app.RequestContext) bool {
+	f, _ := r.faults.Load().(*Faults)
+	if f == nil {
+		return false
+	}
+	if f.Delay > 0 && hit(f.DelayPercent) {
+		r.log().Debugf(c, "HERTZ: Injecting a delay of %v", f.Delay)
+		timer := time.NewTimer(f.Delay)
+		select {
+		case <-timer.C:
+		case <-c.Done():
+			timer.Stop()
+		}
+	}
+	if hit(f.DropPercent) {
+		r.log().Debugf(c, "HERTZ: Injecting a dropped connection")
+		ctx.Response.Header.SetConnectionClose(true)
+		if conn := ctx.GetConn(); conn != nil {
+			conn.Close()
+		}
+		ctx.Abort()
+		return true
+	}
+	if hit(f.AbortPercent) {
+		status := f.AbortStatus
+		if status == 0 {
+			status = consts.StatusServiceUnavailable
+		}
+		r.log().Debugf(c, "HERTZ: Injecting a %d response", status)
+		ctx.AbortWithStatus(status)
+		return true
+	}
+	return false
+}
+
+// hit reports whether a request falls into percent.
+func hit(percent float64) bool {
+	return percent > 0 && fastrand.Float64()*100 < percent
+}
@@ -0,0 +1,102 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/client"
+	"github.com/cloudwego/hertz/pkg/app/server"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestFaults(t *testing.T) {
+	calls := 0
+	proxy, err := NewReverseProxy("http://backend", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		calls++
+		return nil
+	})))
+	assert.Nil(t, err)
+
+	do := func() (*app.RequestContext, time.Duration) {
+		calls = 0
+		ctx := app.NewContext(0)
+		ctx.Request.SetRequestURI("http://localhost/")
+		start := time.Now()
+		proxy.ServeHTTP(context.Background(), ctx)
+		return ctx, time.Since(start)
+	}
+
+	proxy.SetFaults(&Faults{AbortPercent: 100})
+	ctx, _ := do()
+	assert.DeepEqual(t, 503, ctx.Response.StatusCode())
+	assert.DeepEqual(t, 0, calls)
+
+	proxy.SetFaults(&Faults{AbortPercent: 100, AbortStatus: 500})
+	ctx, _ = do()
+	assert.DeepEqual(t, 500, ctx.Response.StatusCode())
+
+	proxy.SetFaults(&Faults{DropPercent: 100})
+	ctx, _ = do()
+	assert.True(t, ctx.IsAborted())
+	assert.True(t, ctx.Response.Header.ConnectionClose())
+	assert.DeepEqual(t, 0, calls)
+
+	proxy.SetFaults(&Faults{DelayPercent: 100, Delay: 50 * time.Millisecond})
+	ctx, elapsed := do()
+	assert.DeepEqual(t, 200, ctx.Response.StatusCode())
+	assert.DeepEqual(t, 1, calls)
+	assert.True(t, elapsed >= 50*time.Millisecond)
+
+	// percentages below 100 hit some requests
+	proxy.SetFaults(&Faults{AbortPercent: 50})
+	aborted := 0
+	for i := 0; i < 200; i++ {
+		if ctx, _ = do(); ctx.Response.StatusCode() == 503 {
+			aborted++
+		}
+	}
+	assert.True(t, aborted > 50 && aborted < 150)
+
+	proxy.SetFaults(nil)
+	ctx, elapsed = do()
+	assert.DeepEqual(t, 200, ctx.Response.StatusCode())
+	assert.True(t, elapsed < 50*time.Millisecond)
+}
+
+func TestFaultsDropConnection(t *testing.T) {
+	proxy, err := NewReverseProxy("http://backend", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		return nil
+	})))
+	assert.Nil(t, err)
+	proxy.SetFaults(&Faults{DropPercent: 100})
+	h := server.New(server.WithHostPorts("127.0.0.1:10063"))
+	h.Any("/*path", proxy.ServeHTTP)
+	go h.Spin()
+	time.Sleep(time.Second)
+
+	cli, _ := client.NewClient()
+	_, _, err = cli.Get(context.Background(), nil, "http://127.0.0.1:10063/")
+	assert.NotNil(t, err)
+
+	proxy.SetFaults(nil)
+	status, _, err := cli.Get(context.Background(), nil, "http://127.0.0.1:10063/")
+	assert.Nil(t, err)
+	assert.DeepEqual(t, 200, status)
+}
@@ -0,0 +1,118 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/client"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/network"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+// ForwardProxy is a middleware serving as forward (egress) proxy: requests
+// with an absolute URI, e.g. "GET http://example.com/ HTTP/1.1", are sent
+// to that URI and CONNECT requests open a tunnel to the requested host.
+// Other requests are passed on to the next handler.
+//
+// The embedded ReverseProxy forwards the absolute-URI requests, so its
+// setters customize them, e.g. SetModifyResponse.
+type ForwardProxy struct {
+	*ReverseProxy
+
+	// dialTimeout limits establishing CONNECT tunnels
+	dialTimeout time.Duration
+}
+
+// NewForwardProxy returns a ForwardProxy. The config.ClientOption are used
+// to build the client for absolute-URI requests.
+func NewForwardProxy(options ...config.ClientOption) (*ForwardProxy, error) {
+	c, err := client.NewClient(options...)
+	if err != nil {
+		return nil, err
+	}
+	return &ForwardProxy{
+		ReverseProxy: &ReverseProxy{
+			client: c,
+			director: func(req *protocol.Request) {
+				req.Header.SetHostBytes(req.URI().Host())
+			},
+		},
+		dialTimeout: 10 * time.Second,
+	}, nil
+}
+
+// SetDialTimeout sets the timeout for connecting to the destination of
+// CONNECT requests, 10s by default.
+func (f *ForwardProxy) SetDialTimeout(timeout time.Duration) {
+	f.dialTimeout = timeout
+}
+
+func (f *ForwardProxy) ServeHTTP(ctx context.Context, c *app.RequestContext) {
+	switch {
+	case c.Request.Header.IsConnect():
+		f.connect(ctx, c)
+	case isAbsoluteURI(c.Request.Header.RequestURI()):
+		f.ReverseProxy.ServeHTTP(ctx, c)
+	default:
+		c.Next(ctx)
+		return
+	}
+	c.Abort()
+}
+
+// connect dials the destination of a CONNECT request and, once the
+// response is written, copies data between the client and it.
+func (f *ForwardProxy) connect(ctx context.Context, c *app.RequestContext) {
+	dst, err := net.DialTimeout("tcp", string(c.Request.Header.RequestURI()), f.dialTimeout)
+	if err != nil {
+		f.log().Errorf(ctx, "HERTZ: CONNECT %s failed: %v", c.Request.Header.RequestURI(), err)
+		f.handleError(ctx, c, ErrorKindBackend, err, 1)
+		return
+	}
+	// the hijack handler is not called for "Connection: close"
+	c.Request.Header.ResetConnectionClose()
+	c.Response.Header.ResetConnectionClose()
+	c.SetStatusCode(200)
+	c.Hijack(func(conn network.Conn) {
+		f.tunnel(conn, dst)
+	})
+}
+
+// tunnel copies between a and b until either side is done, then closes
+// both to end the other direction.
+func (r *ReverseProxy) tunnel(a network.Conn, b net.Conn) {
+	done := make(chan struct{}, 2)
+	cp := func(dst io.Writer, src io.Reader) {
+		_, _ = r.copyBuffer(dst, src)
+		done <- struct{}{}
+	}
+	go cp(b, a)
+	go cp(a, b)
+	<-done
+	_ = b.Close()
+	_ = a.Close()
+	<-done
+}
+
+func isAbsoluteURI(uri []byte) bool {
+	return bytes.HasPrefix(uri, []byte("http://")) || bytes.HasPrefix(uri, []byte("https://"))
+}
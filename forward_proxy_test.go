@@ -0,0 +1,90 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/client"
+	"github.com/cloudwego/hertz/pkg/app/server"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestForwardProxy(t *testing.T) {
+	backend := server.New(server.WithHostPorts("127.0.0.1:10024"))
+	backend.GET("/hello", func(cc context.Context, ctx *app.RequestContext) {
+		ctx.String(200, "hello "+string(ctx.Request.Host()))
+	})
+	go backend.Spin()
+
+	fp, err := NewForwardProxy()
+	assert.Nil(t, err)
+	r := server.New(server.WithHostPorts("127.0.0.1:10025"))
+	r.Use(fp.ServeHTTP)
+	r.GET("/local", func(cc context.Context, ctx *app.RequestContext) {
+		ctx.String(200, "local")
+	})
+	go r.Spin()
+	time.Sleep(time.Second)
+
+	// absolute-URI request
+	cli, _ := client.NewClient()
+	cli.SetProxy(protocol.ProxyURI(protocol.ParseURI("http://127.0.0.1:10025")))
+	status, body, err := cli.Get(context.Background(), nil, "http://127.0.0.1:10024/hello")
+	assert.Nil(t, err)
+	assert.DeepEqual(t, 200, status)
+	assert.DeepEqual(t, "hello 127.0.0.1:10024", string(body))
+
+	// other requests are passed on
+	cli, _ = client.NewClient()
+	_, body, err = cli.Get(context.Background(), nil, "http://127.0.0.1:10025/local")
+	assert.Nil(t, err)
+	assert.DeepEqual(t, "local", string(body))
+
+	// CONNECT tunnel
+	conn, err := net.Dial("tcp", "127.0.0.1:10025")
+	assert.Nil(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("CONNECT 127.0.0.1:10024 HTTP/1.1\r\nHost: 127.0.0.1:10024\r\n\r\n"))
+	assert.Nil(t, err)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	assert.Nil(t, err)
+	assert.DeepEqual(t, 200, resp.StatusCode)
+	_, err = conn.Write([]byte("GET /hello HTTP/1.1\r\nHost: tunnel\r\n\r\n"))
+	assert.Nil(t, err)
+	resp, err = http.ReadResponse(br, nil)
+	assert.Nil(t, err)
+	b, _ := ioutil.ReadAll(resp.Body)
+	assert.DeepEqual(t, "hello tunnel", string(b))
+
+	// unreachable CONNECT destination
+	conn2, err := net.Dial("tcp", "127.0.0.1:10025")
+	assert.Nil(t, err)
+	defer conn2.Close()
+	_, err = conn2.Write([]byte("CONNECT 127.0.0.1:10026 HTTP/1.1\r\nHost: 127.0.0.1:10026\r\n\r\n"))
+	assert.Nil(t, err)
+	resp, err = http.ReadResponse(bufio.NewReader(conn2), &http.Request{Method: http.MethodConnect})
+	assert.Nil(t, err)
+	assert.DeepEqual(t, http.StatusBadGateway, resp.StatusCode)
+}
@@ -7,4 +7,6 @@ require (
 	github.com/cloudwego/hertz v0.6.5
 	github.com/gorilla/websocket v1.5.1
 	github.com/hertz-contrib/websocket v0.0.1
+	golang.org/x/text v0.13.0
+	gopkg.in/yaml.v3 v3.0.1
 )
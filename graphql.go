@@ -0,0 +1,658 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+// ContextKeyGraphQLOperation is the *GraphQLOperation of a request, see
+// SetGraphQL.
+const ContextKeyGraphQLOperation = "reverseproxy.graphql_operation"
+
+var (
+	// ErrMalformedGraphQL is the error of requests whose GraphQL operation
+	// could not be parsed.
+	ErrMalformedGraphQL = errors.New("reverseproxy: malformed GraphQL request")
+	// ErrGraphQLLimit is the error of operations exceeding the limits of
+	// GraphQLOptions.
+	ErrGraphQLLimit = errors.New("reverseproxy: GraphQL operation exceeds a limit")
+)
+
+// GraphQLOperation is the operation of a GraphQL request.
+type GraphQLOperation struct {
+	// Type is "query", "mutation" or "subscription", empty for requests
+	// without a document, e.g. persisted queries.
+	Type string
+	// Name is the name of the operation, empty for anonymous operations.
+	Name string
+	// Depth is the deepest nesting of selection sets, fragments included,
+	// 1 for "{ a }".
+	Depth int
+	// Fields is the number of selected fields with fragments expanded, a
+	// measure of the complexity of the operation.
+	Fields int
+}
+
+// GraphQLOptions configure SetGraphQL.
+type GraphQLOptions struct {
+	// MaxDepth and MaxFields reject operations over Depth and Fields with
+	// 400 Bad Request, 0 means no limit.
+	MaxDepth  int
+	MaxFields int
+	// MaxBodySize limits the request bodies which are read to parse the
+	// operation, 1 MiB by default. Larger ones are answered with 413.
+	MaxBodySize int
+	// Allow rejects operations with an error, answered with 403 Forbidden
+	// or the status of an error with a StatusCode() int method.
+	Allow func(ctx context.Context, c *app.RequestContext, op *GraphQLOperation) error
+	// Target returns the backend of an operation, e.g. the primary for
+	// mutations and a replica for queries, "" for the default target. It
+	// is set as ContextKeyTarget.
+	Target func(ctx context.Context, c *app.RequestContext, op *GraphQLOperation) string
+}
+
+// DefaultGraphQLMaxBodySize is the MaxBodySize of GraphQLOptions unless set.
+const DefaultGraphQLMaxBodySize = 1 << 20
+
+// SetGraphQL parses the GraphQL operation of requests, GET requests with a
+// query parameter and POST requests of type application/json or
+// application/graphql, so that they can be limited, rejected or routed by
+// operation. The operation is stored under ContextKeyGraphQLOperation.
+// Batches are checked operation by operation and routed by their first
+// mutation, or their first operation. POST requests of other types are
+// answered with 415 Unsupported Media Type, other methods pass unchecked.
+func (r *ReverseProxy) SetGraphQL(opts GraphQLOptions) {
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = DefaultGraphQLMaxBodySize
+	}
+	r.graphQL = &opts
+}
+
+// graphQLParams are the parameters of a GraphQL request.
+type graphQLParams struct {
+	Query         string `json:"query"`
+	OperationName string `json:"operationName"`
+}
+
+// checkGraphQL checks the GraphQL operations of the request. It returns
+// the original body stream if it was read, which must be given back after
+// the backend call, and reports whether the request was answered.
+func (r *ReverseProxy) checkGraphQL(c context.Context, ctx *app.RequestContext) (io.Reader, bool) {
+	opts := r.graphQL
+	if opts == nil {
+		return nil, false
+	}
+	req := &ctx.Request
+	var batch []graphQLParams
+	var stream io.Reader
+	switch b2s(req.Header.Method()) {
+	case consts.MethodGet:
+		batch = []graphQLParams{{
+			Query:         string(req.URI().QueryArgs().Peek("query")),
+			OperationName: string(req.URI().QueryArgs().Peek("operationName")),
+		}}
+	case consts.MethodPost:
+		mediaType, _, _ := mime.ParseMediaType(b2s(req.Header.ContentType()))
+		if mediaType != "application/json" && mediaType != "application/graphql" {
+			rejectGraphQL(c, ctx, r.log(), consts.StatusUnsupportedMediaType,
+				fmt.Errorf("%w: unsupported content type %q", ErrMalformedGraphQL, mediaType))
+			return nil, true
+		}
+		var body []byte
+		if req.IsBodyStream() {
+			stream = req.BodyStream()
+			var err error
+			body, err = io.ReadAll(io.LimitReader(stream, int64(opts.MaxBodySize)+1))
+			if err != nil {
+				rejectGraphQL(c, ctx, r.log(), consts.StatusBadRequest, fmt.Errorf("%w: %v", ErrMalformedGraphQL, err))
+				ctx.Response.Header.SetConnectionClose(true)
+				return stream, true
+			}
+			req.ConstructBodyStream(req.BodyBuffer(), bytes.NewReader(body))
+		} else {
+			body = req.Body()
+		}
+		if len(body) > opts.MaxBodySize {
+			rejectGraphQL(c, ctx, r.log(), consts.StatusRequestEntityTooLarge, ErrRequestBodyTooLarge)
+			if stream != nil {
+				ctx.Response.Header.SetConnectionClose(true)
+			}
+			return stream, true
+		}
+		if mediaType == "application/graphql" {
+			batch = []graphQLParams{{
+				Query:         string(body),
+				OperationName: string(req.URI().QueryArgs().Peek("operationName")),
+			}}
+		} else if err := decodeGraphQLParams(body, &batch); err != nil {
+			rejectGraphQL(c, ctx, r.log(), consts.StatusBadRequest, err)
+			return stream, true
+		}
+	default:
+		return nil, false
+	}
+
+	var routed *GraphQLOperation
+	for _, params := range batch {
+		op, err := r.checkGraphQLOperation(c, ctx, params)
+		if err != nil {
+			status := consts.StatusBadRequest
+			var serr interface{ StatusCode() int }
+			if errors.As(err, &serr) && serr.StatusCode() > 0 {
+				status = serr.StatusCode()
+			}
+			rejectGraphQL(c, ctx, r.log(), status, err)
+			return stream, true
+		}
+		if routed == nil || routed.Type != "mutation" && op.Type == "mutation" {
+			routed = op
+		}
+	}
+	ctx.Set(ContextKeyGraphQLOperation, routed)
+	if opts.Target != nil {
+		if target := opts.Target(c, ctx, routed); target != "" {
+			ctx.Set(ContextKeyTarget, target)
+		}
+	}
+	return stream, false
+}
+
+// checkGraphQLOperation parses and checks an operation of the request.
+func (r *ReverseProxy) checkGraphQLOperation(c context.Context, ctx *app.RequestContext, params graphQLParams) (*GraphQLOperation, error) {
+	op := &GraphQLOperation{Name: params.OperationName}
+	if params.Query != "" {
+		var err error
+		if op, err = ParseGraphQL(params.Query, params.OperationName); err != nil {
+			return nil, err
+		}
+	}
+	opts := r.graphQL
+	if opts.MaxDepth > 0 && op.Depth > opts.MaxDepth {
+		return nil, fmt.Errorf("%w: depth %d over %d", ErrGraphQLLimit, op.Depth, opts.MaxDepth)
+	}
+	if opts.MaxFields > 0 && op.Fields > opts.MaxFields {
+		return nil, fmt.Errorf("%w: %d fields over %d", ErrGraphQLLimit, op.Fields, opts.MaxFields)
+	}
+	if opts.Allow != nil {
+		if err := opts.Allow(c, ctx, op); err != nil {
+			return nil, &graphQLDenied{err: err}
+		}
+	}
+	return op, nil
+}
+
+// decodeGraphQLParams decodes a JSON request or batch of requests.
+func decodeGraphQLParams(body []byte, batch *[]graphQLParams) error {
+	body = bytes.TrimSpace(body)
+	var err error
+	if len(body) > 0 && body[0] == '[' {
+		err = json.Unmarshal(body, batch)
+	} else {
+		var params graphQLParams
+		err = json.Unmarshal(body, &params)
+		*batch = []graphQLParams{params}
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedGraphQL, err)
+	}
+	if len(*batch) == 0 {
+		return fmt.Errorf("%w: empty batch", ErrMalformedGraphQL)
+	}
+	return nil
+}
+
+// graphQLDenied is an error of GraphQLOptions.Allow.
+type graphQLDenied struct {
+	err error
+}
+
+func (e *graphQLDenied) Error() string {
+	return e.err.Error()
+}
+
+func (e *graphQLDenied) Unwrap() error {
+	return e.err
+}
+
+func (e *graphQLDenied) StatusCode() int {
+	if s, ok := e.err.(interface{ StatusCode() int }); ok && s.StatusCode() > 0 {
+		return s.StatusCode()
+	}
+	return consts.StatusForbidden
+}
+
+type graphQLErrorResponse struct {
+	Errors []graphQLError `json:"errors"`
+}
+
+type graphQLError struct {
+	Message string `json:"message"`
+}
+
+// rejectGraphQL answers the request with a GraphQL error response.
+func rejectGraphQL(c context.Context, ctx *app.RequestContext, log Logger, status int, err error) {
+	log.Warnf(c, "HERTZ: GraphQL request rejected: %v", err)
+	ctx.JSON(status, graphQLErrorResponse{Errors: []graphQLError{{Message: err.Error()}}})
+}
+
+// ParseGraphQL parses the GraphQL document query and returns its operation
+// named operationName, which may be empty for documents with a single
+// operation.
+func ParseGraphQL(query, operationName string) (*GraphQLOperation, error) {
+	toks, err := lexGraphQL(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &gqlParser{toks: toks}
+	ops, frags, err := p.document()
+	if err != nil {
+		return nil, err
+	}
+	var def *gqlDefinition
+	switch {
+	case operationName != "":
+		for _, o := range ops {
+			if o.name == operationName {
+				def = o
+				break
+			}
+		}
+		if def == nil {
+			return nil, fmt.Errorf("%w: unknown operation %q", ErrMalformedGraphQL, operationName)
+		}
+	case len(ops) == 1:
+		def = ops[0]
+	case len(ops) == 0:
+		return nil, fmt.Errorf("%w: no operation", ErrMalformedGraphQL)
+	default:
+		return nil, fmt.Errorf("%w: operationName required", ErrMalformedGraphQL)
+	}
+	m := &gqlMeasure{frags: frags, measured: make(map[string][2]int), visiting: make(map[string]bool)}
+	depth, fields, err := m.set(def.sels)
+	if err != nil {
+		return nil, err
+	}
+	return &GraphQLOperation{Type: def.opType, Name: def.name, Depth: depth, Fields: fields}, nil
+}
+
+const (
+	gqlName byte = iota + 1
+	gqlPunct
+	gqlValue
+)
+
+type gqlToken struct {
+	kind byte
+	val  string
+}
+
+func (t gqlToken) is(punct string) bool {
+	return t.kind == gqlPunct && t.val == punct
+}
+
+// lexGraphQL splits src into names, punctuators and values, dropping
+// white space, commas and comments.
+func lexGraphQL(src string) ([]gqlToken, error) {
+	var toks []gqlToken
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case strings.HasPrefix(src[i:], "\ufeff"):
+			i += len("\ufeff")
+		case c == '#':
+			for i < len(src) && src[i] != '\n' && src[i] != '\r' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "..."):
+			toks = append(toks, gqlToken{gqlPunct, "..."})
+			i += 3
+		case strings.IndexByte("!$&()=:@[]{}|", c) >= 0:
+			toks = append(toks, gqlToken{gqlPunct, src[i : i+1]})
+			i++
+		case strings.HasPrefix(src[i:], `"""`):
+			j := i + 3
+			for ; ; j++ {
+				if j >= len(src) {
+					return nil, fmt.Errorf("%w: unterminated string", ErrMalformedGraphQL)
+				}
+				if strings.HasPrefix(src[j:], `\"""`) {
+					j += 3
+				} else if strings.HasPrefix(src[j:], `"""`) {
+					break
+				}
+			}
+			toks = append(toks, gqlToken{gqlValue, src[i : j+3]})
+			i = j + 3
+		case c == '"':
+			j := i + 1
+			for ; ; j++ {
+				if j >= len(src) || src[j] == '\n' || src[j] == '\r' {
+					return nil, fmt.Errorf("%w: unterminated string", ErrMalformedGraphQL)
+				}
+				if src[j] == '\\' {
+					j++
+				} else if src[j] == '"' {
+					break
+				}
+			}
+			toks = append(toks, gqlToken{gqlValue, src[i : j+1]})
+			i = j + 1
+		case c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+			j := i + 1
+			for j < len(src) && (src[j] == '_' || 'a' <= src[j] && src[j] <= 'z' || 'A' <= src[j] && src[j] <= 'Z' || '0' <= src[j] && src[j] <= '9') {
+				j++
+			}
+			toks = append(toks, gqlToken{gqlName, src[i:j]})
+			i = j
+		case c == '-' || '0' <= c && c <= '9':
+			j := i + 1
+			for j < len(src) && strings.IndexByte("0123456789.eE+-", src[j]) >= 0 {
+				j++
+			}
+			toks = append(toks, gqlToken{gqlValue, src[i:j]})
+			i = j
+		default:
+			return nil, fmt.Errorf("%w: unexpected character %q", ErrMalformedGraphQL, c)
+		}
+	}
+	return toks, nil
+}
+
+// gqlDefinition is an operation or fragment definition.
+type gqlDefinition struct {
+	opType string
+	name   string
+	sels   []gqlSelection
+}
+
+// gqlSelection is a field, a fragment spread or an inline fragment.
+type gqlSelection struct {
+	// spread is the name of a spread fragment
+	spread string
+	inline bool
+	// sub is the selection set of a field or inline fragment
+	sub []gqlSelection
+}
+
+// maxGraphQLNesting bounds the nesting of selection sets while parsing.
+const maxGraphQLNesting = 1000
+
+type gqlParser struct {
+	toks []gqlToken
+	pos  int
+}
+
+func (p *gqlParser) peek() gqlToken {
+	if p.pos >= len(p.toks) {
+		return gqlToken{}
+	}
+	return p.toks[p.pos]
+}
+
+func (p *gqlParser) next() gqlToken {
+	t := p.peek()
+	if p.pos < len(p.toks) {
+		p.pos++
+	}
+	return t
+}
+
+func (p *gqlParser) unexpected(t gqlToken) error {
+	if t.kind == 0 {
+		return fmt.Errorf("%w: unexpected end of document", ErrMalformedGraphQL)
+	}
+	return fmt.Errorf("%w: unexpected %q", ErrMalformedGraphQL, t.val)
+}
+
+// document parses the operations and fragments of the document.
+func (p *gqlParser) document() ([]*gqlDefinition, map[string]*gqlDefinition, error) {
+	var ops []*gqlDefinition
+	frags := make(map[string]*gqlDefinition)
+	for p.pos < len(p.toks) {
+		t := p.peek()
+		def := &gqlDefinition{opType: "query"}
+		switch {
+		case t.is("{"):
+		case t.kind == gqlName && (t.val == "query" || t.val == "mutation" || t.val == "subscription"):
+			p.next()
+			def.opType = t.val
+			if p.peek().kind == gqlName {
+				def.name = p.next().val
+			}
+		case t.kind == gqlName && t.val == "fragment":
+			p.next()
+			name := p.next()
+			if name.kind != gqlName || name.val == "on" {
+				return nil, nil, p.unexpected(name)
+			}
+			if on := p.next(); on.kind != gqlName || on.val != "on" {
+				return nil, nil, p.unexpected(on)
+			}
+			if typ := p.next(); typ.kind != gqlName {
+				return nil, nil, p.unexpected(typ)
+			}
+			def.opType, def.name = "", name.val
+		default:
+			return nil, nil, p.unexpected(t)
+		}
+		// skip variable definitions and directives
+		for !p.peek().is("{") {
+			switch t := p.peek(); {
+			case t.kind == 0:
+				return nil, nil, p.unexpected(t)
+			case t.is("("):
+				if err := p.skipParens(); err != nil {
+					return nil, nil, err
+				}
+			default:
+				p.next()
+			}
+		}
+		sels, err := p.selectionSet(1)
+		if err != nil {
+			return nil, nil, err
+		}
+		def.sels = sels
+		if def.opType == "" {
+			if frags[def.name] != nil {
+				return nil, nil, fmt.Errorf("%w: duplicate fragment %q", ErrMalformedGraphQL, def.name)
+			}
+			frags[def.name] = def
+		} else {
+			ops = append(ops, def)
+		}
+	}
+	return ops, frags, nil
+}
+
+// selectionSet parses the selection set starting at the current "{".
+func (p *gqlParser) selectionSet(level int) ([]gqlSelection, error) {
+	if level > maxGraphQLNesting {
+		return nil, fmt.Errorf("%w: selection sets nested too deeply", ErrMalformedGraphQL)
+	}
+	p.next()
+	var sels []gqlSelection
+	for {
+		t := p.next()
+		switch {
+		case t.is("}"):
+			if len(sels) == 0 {
+				return nil, fmt.Errorf("%w: empty selection set", ErrMalformedGraphQL)
+			}
+			return sels, nil
+		case t.is("..."):
+			if n := p.peek(); n.kind == gqlName && n.val != "on" {
+				p.next()
+				if err := p.skipDirectives(); err != nil {
+					return nil, err
+				}
+				sels = append(sels, gqlSelection{spread: n.val})
+				continue
+			}
+			if p.peek().kind == gqlName {
+				p.next()
+				if typ := p.next(); typ.kind != gqlName {
+					return nil, p.unexpected(typ)
+				}
+			}
+			if err := p.skipDirectives(); err != nil {
+				return nil, err
+			}
+			if !p.peek().is("{") {
+				return nil, p.unexpected(p.peek())
+			}
+			sub, err := p.selectionSet(level + 1)
+			if err != nil {
+				return nil, err
+			}
+			sels = append(sels, gqlSelection{inline: true, sub: sub})
+		case t.kind == gqlName:
+			if p.peek().is(":") {
+				p.next()
+				if name := p.next(); name.kind != gqlName {
+					return nil, p.unexpected(name)
+				}
+			}
+			if p.peek().is("(") {
+				if err := p.skipParens(); err != nil {
+					return nil, err
+				}
+			}
+			if err := p.skipDirectives(); err != nil {
+				return nil, err
+			}
+			var sel gqlSelection
+			if p.peek().is("{") {
+				sub, err := p.selectionSet(level + 1)
+				if err != nil {
+					return nil, err
+				}
+				sel.sub = sub
+			}
+			sels = append(sels, sel)
+		default:
+			return nil, p.unexpected(t)
+		}
+	}
+}
+
+// skipParens skips the arguments or variable definitions starting at the
+// current "(".
+func (p *gqlParser) skipParens() error {
+	depth := 0
+	for {
+		t := p.next()
+		switch {
+		case t.kind == 0:
+			return p.unexpected(t)
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			if depth--; depth == 0 {
+				return nil
+			}
+		}
+	}
+}
+
+func (p *gqlParser) skipDirectives() error {
+	for p.peek().is("@") {
+		p.next()
+		if name := p.next(); name.kind != gqlName {
+			return p.unexpected(name)
+		}
+		if p.peek().is("(") {
+			if err := p.skipParens(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// gqlMeasure measures selection sets, expanding each fragment once.
+type gqlMeasure struct {
+	frags map[string]*gqlDefinition
+	// measured are the depth and fields of the fragments measured so far
+	measured map[string][2]int
+	visiting map[string]bool
+}
+
+// set returns the depth and the number of fields of sels.
+func (m *gqlMeasure) set(sels []gqlSelection) (depth, fields int, err error) {
+	for _, s := range sels {
+		d, f := 1, 1
+		switch {
+		case s.spread != "":
+			d, f, err = m.fragment(s.spread)
+		case s.inline:
+			d, f, err = m.set(s.sub)
+		case s.sub != nil:
+			d, f, err = m.set(s.sub)
+			d, f = d+1, addFields(f, 1)
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		if d > depth {
+			depth = d
+		}
+		fields = addFields(fields, f)
+	}
+	return depth, fields, nil
+}
+
+func (m *gqlMeasure) fragment(name string) (depth, fields int, err error) {
+	if v, ok := m.measured[name]; ok {
+		return v[0], v[1], nil
+	}
+	def := m.frags[name]
+	if def == nil {
+		return 0, 0, fmt.Errorf("%w: unknown fragment %q", ErrMalformedGraphQL, name)
+	}
+	if m.visiting[name] {
+		return 0, 0, fmt.Errorf("%w: fragment %q spreads itself", ErrMalformedGraphQL, name)
+	}
+	m.visiting[name] = true
+	depth, fields, err = m.set(def.sels)
+	m.visiting[name] = false
+	if err == nil {
+		m.measured[name] = [2]int{depth, fields}
+	}
+	return depth, fields, err
+}
+
+// addFields adds field counts, saturating instead of overflowing on
+// documents spreading fragments many times.
+func addFields(a, b int) int {
+	if a > math.MaxInt32-b {
+		return math.MaxInt32
+	}
+	return a + b
+}
@@ -0,0 +1,174 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestParseGraphQL(t *testing.T) {
+	for _, tt := range []struct {
+		query, name string
+		want        GraphQLOperation
+	}{
+		{"{ a }", "", GraphQLOperation{Type: "query", Depth: 1, Fields: 1}},
+		{"query Me { me { name friends { name } } }", "", GraphQLOperation{Type: "query", Name: "Me", Depth: 3, Fields: 4}},
+		{`mutation Add($in: Input = {tags: ["{"]}) @log { add(input: $in) { id @include(if: true) } }`, "",
+			GraphQLOperation{Type: "mutation", Name: "Add", Depth: 2, Fields: 2}},
+		{`# comment {
+		  query { u: user(id: "}") { ...F ... on User { x: email } ... @skip(if: false) { id } } }
+		  fragment F on User { friends { ...G } }
+		  fragment G on User { name, id }`, "",
+			GraphQLOperation{Type: "query", Depth: 3, Fields: 6}},
+		{`query A { a } subscription B { b { c } }`, "B", GraphQLOperation{Type: "subscription", Name: "B", Depth: 2, Fields: 2}},
+		{`{ a(text: """block "quoted" \""" }""") }`, "", GraphQLOperation{Type: "query", Depth: 1, Fields: 1}},
+	} {
+		op, err := ParseGraphQL(tt.query, tt.name)
+		assert.Nil(t, err)
+		assert.DeepEqual(t, tt.want, *op)
+	}
+
+	for _, query := range []string{
+		"",
+		"{ }",
+		"{ a",
+		`{ a(b: "c) }`,
+		"query A { a } query B { b }",
+		"{ ...F }",
+		"{ ...F } fragment F on T { ...F }",
+		"type Query { a: Int }",
+		"{ a % }",
+	} {
+		_, err := ParseGraphQL(query, "")
+		assert.True(t, errors.Is(err, ErrMalformedGraphQL))
+	}
+	_, err := ParseGraphQL("query A { a }", "B")
+	assert.True(t, errors.Is(err, ErrMalformedGraphQL))
+
+	// fragments spread many times are measured once
+	bomb := "{ ...F0 } fragment F40 on T { a b }"
+	for i := 39; i >= 0; i-- {
+		next := "F" + strconv.Itoa(i+1)
+		bomb += " fragment F" + strconv.Itoa(i) + " on T { ..." + next + " ..." + next + " }"
+	}
+	op, err := ParseGraphQL(bomb, "")
+	assert.Nil(t, err)
+	assert.DeepEqual(t, 1, op.Depth)
+	assert.True(t, op.Fields > 1<<30)
+}
+
+type notYours struct{}
+
+func (notYours) Error() string   { return "not yours" }
+func (notYours) StatusCode() int { return 401 }
+
+func TestSetGraphQL(t *testing.T) {
+	var called []string
+	proxy, err := NewReverseProxy("http://replica", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		body := req.Body()
+		if req.IsBodyStream() {
+			body, _ = ioutil.ReadAll(req.BodyStream())
+		}
+		called = append(called, string(req.Host())+" "+string(body))
+		return nil
+	})))
+	assert.Nil(t, err)
+	var seen *GraphQLOperation
+	proxy.SetGraphQL(GraphQLOptions{
+		MaxDepth:    3,
+		MaxFields:   10,
+		MaxBodySize: 200,
+		Allow: func(ctx context.Context, c *app.RequestContext, op *GraphQLOperation) error {
+			seen = op
+			if op.Name == "Admin" {
+				return notYours{}
+			}
+			if op.Type == "subscription" {
+				return errors.New("no subscriptions")
+			}
+			return nil
+		},
+		Target: func(ctx context.Context, c *app.RequestContext, op *GraphQLOperation) string {
+			if op.Type == "mutation" {
+				return "http://primary"
+			}
+			return ""
+		},
+	})
+
+	for _, tt := range []struct {
+		name        string
+		method      string
+		contentType string
+		uri         string
+		body        string
+		stream      bool
+		code        int
+		backend     string
+	}{
+		{name: "query", method: "POST", contentType: "application/json", body: `{"query": "query Q { a }"}`, code: 200, backend: "replica"},
+		{name: "mutation", method: "POST", contentType: "application/json; charset=utf-8", body: `{"query": "mutation M { add { id } }"}`, code: 200, backend: "primary"},
+		{name: "streamed mutation", method: "POST", contentType: "application/json", body: `{"query": "mutation M { add { id } }"}`, stream: true, code: 200, backend: "primary"},
+		{name: "batch", method: "POST", contentType: "application/json", body: `[{"query": "{ a }"}, {"query": "mutation { b }"}]`, code: 200, backend: "primary"},
+		{name: "graphql body", method: "POST", contentType: "application/graphql", uri: "?operationName=B", body: `query A { a } mutation B { b }`, code: 200, backend: "primary"},
+		{name: "get", method: "GET", uri: "?query=%7B%20a%20%7D", code: 200, backend: "replica"},
+		{name: "persisted query", method: "POST", contentType: "application/json", body: `{"operationName": "Q", "extensions": {}}`, code: 200, backend: "replica"},
+		{name: "too deep", method: "POST", contentType: "application/json", body: `{"query": "{ a { b { c { d } } } }"}`, code: 400},
+		{name: "too many fields", method: "POST", contentType: "application/json", body: `{"query": "{ a b c d e f g h i j k }"}`, code: 400},
+		{name: "malformed", method: "POST", contentType: "application/json", body: `{"query": "{ a "}`, code: 400},
+		{name: "not json", method: "POST", contentType: "application/json", body: `query`, code: 400},
+		{name: "denied", method: "POST", contentType: "application/json", body: `{"query": "subscription { a }"}`, code: 403},
+		{name: "denied with status", method: "POST", contentType: "application/json", body: `[{"query": "{ a }"}, {"query": "query Admin { a }"}]`, code: 401},
+		{name: "too large", method: "POST", contentType: "application/json", body: `{"query": "{ a }", "x": "` + strings.Repeat("x", 200) + `"}`, stream: true, code: 413},
+		{name: "form", method: "POST", contentType: "application/x-www-form-urlencoded", body: `query=%7B%20a%20%7D`, code: 415},
+		{name: "other methods", method: "PUT", body: `anything`, code: 200, backend: "replica"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			called, seen = nil, nil
+			ctx := app.NewContext(0)
+			ctx.Request.SetMethod(tt.method)
+			ctx.Request.SetRequestURI("http://localhost/graphql" + tt.uri)
+			ctx.Request.Header.SetContentTypeBytes([]byte(tt.contentType))
+			if tt.stream {
+				ctx.Request.SetBodyStream(bytes.NewReader([]byte(tt.body)), -1)
+			} else {
+				ctx.Request.SetBodyString(tt.body)
+			}
+			proxy.ServeHTTP(context.Background(), ctx)
+			assert.DeepEqual(t, tt.code, ctx.Response.StatusCode())
+			if tt.code != 200 {
+				assert.DeepEqual(t, 0, len(called))
+				assert.True(t, bytes.HasPrefix(ctx.Response.Body(), []byte(`{"errors":[{"message":`)))
+				return
+			}
+			assert.DeepEqual(t, []string{tt.backend + " " + tt.body}, called)
+			if tt.method == "PUT" {
+				assert.Nil(t, seen)
+			} else {
+				assert.NotNil(t, ctx.Value(ContextKeyGraphQLOperation))
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+// ErrMalformedGRPCWebText is the error of grpc-web-text request bodies
+// which are not valid base64.
+var ErrMalformedGRPCWebText = errors.New("reverseproxy: malformed grpc-web-text body")
+
+// SetGRPCWeb translates gRPC-Web requests of browsers, with a Content-Type
+// of application/grpc-web or application/grpc-web-text, to native gRPC
+// toward the backend and the responses back, moving the trailers into the
+// body, so that no separate gRPC-Web proxy is needed. The backend must be
+// called over HTTP/2, see SetClientFactory. Browsers calling another
+// origin need CORS headers exposing grpc-status and grpc-message, see
+// SetCORSHeaders.
+func (r *ReverseProxy) SetGRPCWeb(enabled bool) {
+	r.grpcWeb = enabled
+}
+
+// grpcWebCall is a gRPC-Web request translated to gRPC.
+type grpcWebCall struct {
+	// text is set for application/grpc-web-text, whose bodies are base64
+	text bool
+}
+
+const (
+	contentTypeGRPC        = "application/grpc"
+	contentTypeGRPCWeb     = "application/grpc-web"
+	contentTypeGRPCWebText = "application/grpc-web-text"
+)
+
+// translateGRPCWebRequest turns a gRPC-Web request into a gRPC one. It
+// returns the call, nil for other requests, and the original body stream
+// if it was replaced, which must be given back after the backend call.
+func (r *ReverseProxy) translateGRPCWebRequest(req *protocol.Request) (*grpcWebCall, io.Reader, error) {
+	if !r.grpcWeb {
+		return nil, nil, nil
+	}
+	contentType := b2s(req.Header.ContentType())
+	call := &grpcWebCall{}
+	var format string
+	switch {
+	case strings.HasPrefix(contentType, contentTypeGRPCWebText):
+		call.text, format = true, contentType[len(contentTypeGRPCWebText):]
+	case strings.HasPrefix(contentType, contentTypeGRPCWeb):
+		format = contentType[len(contentTypeGRPCWeb):]
+	default:
+		return nil, nil, nil
+	}
+	if !isGRPCFormat(format) {
+		return nil, nil, nil
+	}
+	req.Header.SetContentTypeBytes(append([]byte(contentTypeGRPC), format...))
+	req.Header.Set("Te", "trailers")
+	req.Header.DelBytes(s2b("X-Grpc-Web"))
+	if !call.text {
+		return call, nil, nil
+	}
+	if req.IsBodyStream() {
+		stream := req.BodyStream()
+		req.ConstructBodyStream(req.BodyBuffer(), &grpcWebTextDecoder{src: stream})
+		req.Header.SetContentLength(-1)
+		return call, stream, nil
+	}
+	body := req.Body()
+	if len(body)%4 != 0 {
+		return call, nil, ErrMalformedGRPCWebText
+	}
+	decoded, err := decodeGRPCWebText(make([]byte, 0, len(body)/4*3), body)
+	if err != nil {
+		return call, nil, err
+	}
+	req.SetBody(decoded)
+	return call, nil, nil
+}
+
+// isGRPCFormat reports whether the rest of a gRPC content type after
+// "application/grpc" etc. is a format or parameters, e.g. "+proto".
+func isGRPCFormat(s string) bool {
+	return s == "" || s[0] == '+' || s[0] == ';'
+}
+
+// translateResponse turns the gRPC response of the backend into a
+// gRPC-Web one whose trailers are the last frame of the body.
+func (w *grpcWebCall) translateResponse(resp *protocol.Response) {
+	contentType := b2s(resp.Header.ContentType())
+	if !strings.HasPrefix(contentType, contentTypeGRPC) || !isGRPCFormat(contentType[len(contentTypeGRPC):]) {
+		return
+	}
+	webType := contentTypeGRPCWeb
+	if w.text {
+		webType = contentTypeGRPCWebText
+	}
+	resp.Header.SetContentTypeBytes(append([]byte(webType), contentType[len(contentTypeGRPC):]...))
+	if !resp.IsBodyStream() {
+		body := append(resp.Body(), grpcWebTrailerFrame(resp.Header.Trailer())...)
+		if w.text {
+			body = encodeGRPCWebText(nil, body)
+		}
+		resp.SetBody(body)
+		return
+	}
+	resp.SetBodyStreamNoReset(&grpcWebBody{src: resp.BodyStream(), resp: resp, text: w.text}, -1)
+}
+
+// grpcWebTrailerFrame returns the gRPC-Web frame of trailers, empty if
+// there are none, and removes them from the response.
+func grpcWebTrailerFrame(t *protocol.Trailer) []byte {
+	if t.Empty() {
+		return nil
+	}
+	frame := make([]byte, 5, 64)
+	t.VisitAll(func(k, v []byte) {
+		frame = append(frame, bytes.ToLower(k)...)
+		frame = append(frame, ": "...)
+		frame = append(frame, v...)
+		frame = append(frame, "\r\n"...)
+	})
+	frame[0] = 0x80
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(frame)-5))
+	t.Reset()
+	return frame
+}
+
+// grpcWebBody passes a streamed gRPC response body, followed by the
+// trailers which are known once it was read.
+type grpcWebBody struct {
+	src  io.Reader
+	resp *protocol.Response
+	text bool
+	buf  []byte
+	out  []byte
+	eof  bool
+}
+
+func (b *grpcWebBody) Read(p []byte) (int, error) {
+	for len(b.out) == 0 {
+		if b.eof {
+			return 0, io.EOF
+		}
+		if b.buf == nil {
+			b.buf = make([]byte, 32*1024)
+		}
+		n, err := b.src.Read(b.buf)
+		chunk := b.buf[:n]
+		if err == io.EOF {
+			chunk = append(chunk, grpcWebTrailerFrame(b.resp.Header.Trailer())...)
+			b.eof = true
+		} else if err != nil {
+			return 0, err
+		}
+		if b.text {
+			b.out = encodeGRPCWebText(b.out[:0], chunk)
+		} else {
+			b.out = chunk
+		}
+	}
+	n := copy(p, b.out)
+	b.out = b.out[n:]
+	return n, nil
+}
+
+func (b *grpcWebBody) Close() error {
+	if c, ok := b.src.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// encodeGRPCWebText appends the padded base64 of src to dst. Padded chunks
+// may be concatenated in grpc-web-text bodies.
+func encodeGRPCWebText(dst, src []byte) []byte {
+	if len(src) == 0 {
+		return dst
+	}
+	n := len(dst)
+	dst = append(dst, make([]byte, base64.StdEncoding.EncodedLen(len(src)))...)
+	base64.StdEncoding.Encode(dst[n:], src)
+	return dst
+}
+
+// decodeGRPCWebText appends the decoded base64 of src, a concatenation of
+// padded chunks whose length is a multiple of 4, to dst.
+func decodeGRPCWebText(dst, src []byte) ([]byte, error) {
+	for len(src) > 0 {
+		// decode up to the end of the next padded group
+		end := len(src)
+		if i := bytes.IndexByte(src, '='); i >= 0 {
+			end = i/4*4 + 4
+		}
+		if end > len(src) {
+			return nil, ErrMalformedGRPCWebText
+		}
+		n := len(dst)
+		dst = append(dst, make([]byte, end/4*3)...)
+		m, err := base64.StdEncoding.Decode(dst[n:], src[:end])
+		if err != nil {
+			return nil, ErrMalformedGRPCWebText
+		}
+		dst, src = dst[:n+m], src[end:]
+	}
+	return dst, nil
+}
+
+// grpcWebTextDecoder decodes a streamed grpc-web-text body.
+type grpcWebTextDecoder struct {
+	src io.Reader
+	buf []byte
+	// in holds base64 of an incomplete group
+	in  []byte
+	out []byte
+	err error
+}
+
+func (d *grpcWebTextDecoder) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.buf == nil {
+			d.buf = make([]byte, 4*1024)
+		}
+		n, err := d.src.Read(d.buf)
+		d.in = append(d.in, d.buf[:n]...)
+		whole := len(d.in) / 4 * 4
+		out, derr := decodeGRPCWebText(d.out[:0], d.in[:whole])
+		if derr != nil {
+			d.err = derr
+			return 0, derr
+		}
+		d.out, d.in = out, append(d.in[:0], d.in[whole:]...)
+		if err == io.EOF && len(d.in) > 0 {
+			err = ErrMalformedGRPCWebText
+		}
+		d.err = err
+	}
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+func (d *grpcWebTextDecoder) Close() error {
+	if c, ok := d.src.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
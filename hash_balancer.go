@@ -0,0 +1,349 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// HashPolicy is the consistent hashing strategy of a HashBalancer.
+type HashPolicy int
+
+const (
+	// HashRing places each target at many points of a hash ring, keys go
+	// to the target of the next point. Adding or removing a target moves
+	// only the keys of its points.
+	HashRing HashPolicy = iota
+	// HashMaglev looks keys up in a Maglev table, which spreads them more
+	// evenly than a ring, also across large upstream sets, with slightly
+	// more keys moving on membership changes.
+	HashMaglev
+)
+
+// Defaults of HashBalancerOptions.
+const (
+	DefaultRingReplicas = 160
+	// DefaultMaglevTableSize is a prime well above 100 times the targets
+	// of large upstream sets.
+	DefaultMaglevTableSize = 65537
+)
+
+// HashBalancerOptions configures a HashBalancer.
+type HashBalancerOptions struct {
+	// Policy is the hashing strategy, HashRing by default.
+	Policy HashPolicy
+	// Key returns the value hashed to a target, e.g. HeaderKey("X-User-ID"),
+	// so that requests with the same key go to the same target. Requests
+	// without a key are balanced round robin.
+	Key func(ctx context.Context, c *app.RequestContext) string
+	// RingReplicas is the number of points per target of HashRing,
+	// DefaultRingReplicas if 0.
+	RingReplicas int
+	// MaglevTableSize is the size of the table of HashMaglev, which must be
+	// a prime larger than the number of targets, DefaultMaglevTableSize if
+	// 0.
+	MaglevTableSize int
+	// LoadFactor bounds the requests in flight of each target to
+	// LoadFactor times the average, rounded up, if larger than 1, e.g.
+	// 1.25. Requests whose target is full go to the next target of the
+	// ring or table which is not, so that hot keys spill over instead of
+	// overloading one backend ("Consistent Hashing with Bounded Loads").
+	LoadFactor float64
+}
+
+// HashBalancer is a Balancer sending requests with the same key to the
+// same target, e.g. for the caches of backends, with few keys moving when
+// targets are added or removed.
+type HashBalancer struct {
+	opts  HashBalancerOptions
+	state atomic.Value // *hashState
+	next  uint32
+	// inFlight counts the requests of all targets with a LoadFactor
+	inFlight int64
+	// mu serializes SetTargets
+	mu sync.Mutex
+}
+
+// hashState are the targets of a HashBalancer.
+type hashState struct {
+	table hashTable
+	// loads count the requests in flight of the targets with a LoadFactor,
+	// kept across SetTargets
+	loads map[string]*int64
+}
+
+// hashTable maps hashes of keys to targets.
+type hashTable interface {
+	lookup(h uint64) string
+	// walk calls f with the targets in the order they are preferred for h
+	// until it returns true.
+	walk(h uint64, f func(target string) bool)
+	all() []string
+}
+
+// NewHashBalancer returns a HashBalancer of targets.
+func NewHashBalancer(targets []string, opts HashBalancerOptions) (*HashBalancer, error) {
+	if opts.Key == nil {
+		return nil, errors.New("reverseproxy: hash balancer needs a key")
+	}
+	if opts.LoadFactor != 0 && opts.LoadFactor <= 1 {
+		return nil, errors.New("reverseproxy: hash balancer load factor must be larger than 1")
+	}
+	if opts.RingReplicas <= 0 {
+		opts.RingReplicas = DefaultRingReplicas
+	}
+	if opts.MaglevTableSize <= 0 {
+		opts.MaglevTableSize = DefaultMaglevTableSize
+	}
+	b := &HashBalancer{opts: opts}
+	if err := b.SetTargets(targets); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// SetTargets replaces the targets of b, e.g. when instances come and go.
+// It is safe while serving.
+func (b *HashBalancer) SetTargets(targets []string) error {
+	if err := validateTargets(targets); err != nil {
+		return err
+	}
+	targets = append([]string(nil), targets...)
+	state := &hashState{}
+	switch b.opts.Policy {
+	case HashMaglev:
+		if !isPrime(b.opts.MaglevTableSize) || b.opts.MaglevTableSize <= len(targets) {
+			return errors.New("reverseproxy: Maglev table size must be a prime larger than the number of targets")
+		}
+		state.table = newMaglevTable(targets, b.opts.MaglevTableSize)
+	default:
+		state.table = newHashRing(targets, b.opts.RingReplicas)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.opts.LoadFactor > 0 {
+		var prev map[string]*int64
+		if old, _ := b.state.Load().(*hashState); old != nil {
+			prev = old.loads
+		}
+		state.loads = make(map[string]*int64, len(targets))
+		for _, target := range targets {
+			n := prev[target]
+			if n == nil {
+				n = new(int64)
+			}
+			state.loads[target] = n
+		}
+	}
+	b.state.Store(state)
+	return nil
+}
+
+func (b *HashBalancer) Pick(ctx context.Context, c *app.RequestContext) string {
+	state := b.state.Load().(*hashState)
+	all := state.table.all()
+	key := b.opts.Key(ctx, c)
+	if state.loads == nil {
+		if key == "" {
+			return all[(atomic.AddUint32(&b.next, 1)-1)%uint32(len(all))]
+		}
+		return state.table.lookup(mix64(hashString(key)))
+	}
+
+	capacity := int64(math.Ceil(b.opts.LoadFactor * float64(atomic.LoadInt64(&b.inFlight)+1) / float64(len(all))))
+	var picked, first string
+	fits := func(target string) bool {
+		if first == "" {
+			first = target
+		}
+		if atomic.LoadInt64(state.loads[target]) < capacity {
+			picked = target
+			return true
+		}
+		return false
+	}
+	if key == "" {
+		start := atomic.AddUint32(&b.next, 1) - 1
+		for i := range all {
+			if fits(all[(start+uint32(i))%uint32(len(all))]) {
+				break
+			}
+		}
+	} else {
+		state.table.walk(mix64(hashString(key)), fits)
+	}
+	if picked == "" {
+		// all full due to concurrent picks
+		picked = first
+	}
+	atomic.AddInt64(state.loads[picked], 1)
+	atomic.AddInt64(&b.inFlight, 1)
+	return picked
+}
+
+func (b *HashBalancer) Done(target string, statusCode int, latency time.Duration) {
+	if b.opts.LoadFactor <= 0 {
+		return
+	}
+	atomic.AddInt64(&b.inFlight, -1)
+	if n := b.state.Load().(*hashState).loads[target]; n != nil {
+		atomic.AddInt64(n, -1)
+	}
+}
+
+// mix64 is the finalizer of SplitMix64, spreading the bits of FNV hashes
+// of similar strings, e.g. "backend-1" and "backend-2".
+func mix64(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
+
+// hashRing is the ring of HashRing.
+type hashRing struct {
+	targets []string
+	// points are sorted by hash
+	points []ringPoint
+}
+
+type ringPoint struct {
+	hash   uint64
+	target int
+}
+
+func newHashRing(targets []string, replicas int) *hashRing {
+	r := &hashRing{targets: targets, points: make([]ringPoint, 0, len(targets)*replicas)}
+	for i, target := range targets {
+		for j := 0; j < replicas; j++ {
+			h := mix64(hashString(target + "#" + strconv.Itoa(j)))
+			r.points = append(r.points, ringPoint{hash: h, target: i})
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i].hash < r.points[j].hash })
+	return r
+}
+
+func (r *hashRing) lookup(h uint64) string {
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.targets[r.points[i].target]
+}
+
+func (r *hashRing) walk(h uint64, f func(target string) bool) {
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= h })
+	seen := make([]bool, len(r.targets))
+	for n, left := 0, len(r.targets); n < len(r.points) && left > 0; n++ {
+		p := r.points[(i+n)%len(r.points)]
+		if seen[p.target] {
+			continue
+		}
+		if f(r.targets[p.target]) {
+			return
+		}
+		seen[p.target] = true
+		left--
+	}
+}
+
+func (r *hashRing) all() []string {
+	return r.targets
+}
+
+// maglevTable is the lookup table of HashMaglev, see "Maglev: A Fast and
+// Reliable Software Network Load Balancer", section 3.4.
+type maglevTable struct {
+	targets []string
+	entries []int32
+}
+
+func newMaglevTable(targets []string, size int) *maglevTable {
+	m := uint64(size)
+	offsets := make([]uint64, len(targets))
+	skips := make([]uint64, len(targets))
+	for i, target := range targets {
+		offsets[i] = mix64(hashString(target)) % m
+		skips[i] = mix64(hashString(target+"\x00skip"))%(m-1) + 1
+	}
+	entries := make([]int32, size)
+	for j := range entries {
+		entries[j] = -1
+	}
+	// each target takes its next preferred free entry in turn
+	next := make([]uint64, len(targets))
+	for filled := 0; ; {
+		for i := range targets {
+			c := (offsets[i] + next[i]*skips[i]) % m
+			for entries[c] >= 0 {
+				next[i]++
+				c = (offsets[i] + next[i]*skips[i]) % m
+			}
+			entries[c] = int32(i)
+			next[i]++
+			if filled++; filled == size {
+				return &maglevTable{targets: targets, entries: entries}
+			}
+		}
+	}
+}
+
+func (t *maglevTable) lookup(h uint64) string {
+	return t.targets[t.entries[h%uint64(len(t.entries))]]
+}
+
+func (t *maglevTable) walk(h uint64, f func(target string) bool) {
+	i := h % uint64(len(t.entries))
+	seen := make([]bool, len(t.targets))
+	for n, left := 0, len(t.targets); n < len(t.entries) && left > 0; n++ {
+		e := t.entries[(i+uint64(n))%uint64(len(t.entries))]
+		if seen[e] {
+			continue
+		}
+		if f(t.targets[e]) {
+			return
+		}
+		seen[e] = true
+		left--
+	}
+}
+
+func (t *maglevTable) all() []string {
+	return t.targets
+}
+
+func isPrime(n int) bool {
+	if n < 2 {
+		return false
+	}
+	for d := 2; d*d <= n; d++ {
+		if n%d == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,185 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func balancerTargets(n int) []string {
+	targets := make([]string, n)
+	for i := range targets {
+		targets[i] = "http://backend-" + strconv.Itoa(i) + ":8080"
+	}
+	return targets
+}
+
+func pickKey(b Balancer, key string) string {
+	ctx := app.NewContext(0)
+	ctx.Request.Header.Set("X-User", key)
+	return b.Pick(context.Background(), ctx)
+}
+
+func TestHashBalancer(t *testing.T) {
+	for _, policy := range []HashPolicy{HashRing, HashMaglev} {
+		targets := balancerTargets(10)
+		b, err := NewHashBalancer(targets, HashBalancerOptions{Policy: policy, Key: HeaderKey("X-User"), MaglevTableSize: 1009})
+		assert.Nil(t, err)
+
+		picked := make(map[string]string)
+		counts := make(map[string]int)
+		for i := 0; i < 10000; i++ {
+			key := "user-" + strconv.Itoa(i)
+			picked[key] = pickKey(b, key)
+			counts[picked[key]]++
+			assert.DeepEqual(t, picked[key], pickKey(b, key))
+		}
+		assert.DeepEqual(t, 10, len(counts))
+		for _, n := range counts {
+			// Maglev spreads keys nearly perfectly, the ring within bounds
+			if policy == HashMaglev {
+				assert.True(t, n > 900 && n < 1100)
+			} else {
+				assert.True(t, n > 700 && n < 1300)
+			}
+		}
+
+		// removing a target moves few keys of the others
+		assert.Nil(t, b.SetTargets(targets[1:]))
+		moved := 0
+		for key, target := range picked {
+			if target != targets[0] && pickKey(b, key) != target {
+				moved++
+			}
+		}
+		if policy == HashMaglev {
+			assert.True(t, moved < 500)
+		} else {
+			assert.DeepEqual(t, 0, moved)
+		}
+
+		// requests without a key are balanced round robin
+		seen := make(map[string]bool)
+		for i := 0; i < 9; i++ {
+			seen[b.Pick(context.Background(), app.NewContext(0))] = true
+		}
+		assert.DeepEqual(t, 9, len(seen))
+	}
+}
+
+func TestHashBalancerBoundedLoad(t *testing.T) {
+	for _, policy := range []HashPolicy{HashRing, HashMaglev} {
+		targets := balancerTargets(4)
+		b, err := NewHashBalancer(targets, HashBalancerOptions{Policy: policy, Key: HeaderKey("X-User"), LoadFactor: 1.25})
+		assert.Nil(t, err)
+		home := pickKey(b, "hot")
+		b.Done(home, 200, 0)
+
+		// a hot key spills over once its target holds 1.25 times the average
+		loads := make(map[string]int)
+		var picked []string
+		for i := 0; i < 100; i++ {
+			target := pickKey(b, "hot")
+			loads[target]++
+			picked = append(picked, target)
+		}
+		assert.DeepEqual(t, 4, len(loads))
+		for _, n := range loads {
+			assert.True(t, n <= 32)
+		}
+		assert.DeepEqual(t, home, picked[0])
+
+		// the load is kept across SetTargets and released by Done
+		assert.Nil(t, b.SetTargets(append(targets, "http://backend-new:8080")))
+		for _, target := range picked {
+			b.Done(target, 200, 0)
+		}
+		assert.DeepEqual(t, int64(0), b.inFlight)
+		for _, target := range targets {
+			assert.DeepEqual(t, int64(0), *b.state.Load().(*hashState).loads[target])
+		}
+		if target := pickKey(b, "hot"); target != "http://backend-new:8080" {
+			assert.DeepEqual(t, home, target)
+		}
+	}
+}
+
+func TestMaglevTable(t *testing.T) {
+	table := newMaglevTable(balancerTargets(7), 101)
+	counts := make(map[int32]int)
+	for _, e := range table.entries {
+		counts[e]++
+	}
+	assert.DeepEqual(t, 7, len(counts))
+	for _, n := range counts {
+		assert.True(t, n == 14 || n == 15)
+	}
+}
+
+func TestHashBalancerErrors(t *testing.T) {
+	key := HeaderKey("X-User")
+	for _, tt := range []struct {
+		targets []string
+		opts    HashBalancerOptions
+	}{
+		{balancerTargets(2), HashBalancerOptions{}},
+		{nil, HashBalancerOptions{Key: key}},
+		{[]string{"http://a", "http://a"}, HashBalancerOptions{Key: key}},
+		{[]string{"ftp://a"}, HashBalancerOptions{Key: key}},
+		{balancerTargets(2), HashBalancerOptions{Key: key, Policy: HashMaglev, MaglevTableSize: 100}},
+		{balancerTargets(3), HashBalancerOptions{Key: key, Policy: HashMaglev, MaglevTableSize: 3}},
+		{balancerTargets(2), HashBalancerOptions{Key: key, LoadFactor: 1}},
+	} {
+		_, err := NewHashBalancer(tt.targets, tt.opts)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestSetBalancer(t *testing.T) {
+	proxy, err := NewReverseProxy("http://default", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		resp.SetBodyString(string(req.Host()))
+		return nil
+	})))
+	assert.Nil(t, err)
+	b, err := NewHashBalancer([]string{"http://a", "http://b"}, HashBalancerOptions{Policy: HashMaglev, Key: HeaderKey("X-User"), LoadFactor: 2})
+	assert.Nil(t, err)
+	proxy.SetBalancer(b)
+
+	serve := func(user, target string) string {
+		ctx := app.NewContext(0)
+		ctx.Request.SetRequestURI("http://localhost/")
+		ctx.Request.Header.Set("X-User", user)
+		if target != "" {
+			ctx.Set(ContextKeyTarget, target)
+		}
+		proxy.ServeHTTP(context.Background(), ctx)
+		return string(ctx.Response.Body())
+	}
+	want := serve("alice", "")
+	assert.True(t, want == "a" || want == "b")
+	for i := 0; i < 5; i++ {
+		assert.DeepEqual(t, want, serve("alice", ""))
+	}
+	// targets chosen otherwise take precedence
+	assert.DeepEqual(t, "c", serve("alice", "http://c"))
+	// the proxy reports the end of each request
+	assert.DeepEqual(t, int64(0), b.inFlight)
+}
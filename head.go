@@ -0,0 +1,53 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+// SetHeadProbes forwards GET requests for which probe returns true as HEAD,
+// e.g. health checks only looking at the status code, so that the backend
+// does not send a body. The client receives the status and headers of the
+// backend with an empty body.
+func (r *ReverseProxy) SetHeadProbes(probe func(c *app.RequestContext) bool) {
+	r.headProbe = probe
+}
+
+// isHeadProbe reports whether the GET request of c is forwarded as HEAD.
+func (r *ReverseProxy) isHeadProbe(c *app.RequestContext) bool {
+	return r.headProbe != nil && c.Request.Header.IsGet() && r.headProbe(c)
+}
+
+// skipResponseBody drops the body of the response to a HEAD request, which
+// a backend or a custom client may have returned anyway, keeping the
+// Content-Length of the backend. The body of the response to a GET request
+// forwarded as HEAD probe is empty.
+func skipResponseBody(req *protocol.Request, resp *protocol.Response, probe bool) {
+	if !probe && !req.Header.IsHead() {
+		return
+	}
+	n := resp.Header.ContentLength()
+	resp.CloseBodyStream() //nolint:errcheck
+	resp.ResetBody()
+	if probe {
+		resp.SkipBody = false
+		resp.Header.SetContentLength(0)
+		return
+	}
+	resp.Header.SetContentLength(n)
+	resp.SkipBody = true
+}
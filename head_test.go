@@ -0,0 +1,102 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/server"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestHeadRequest(t *testing.T) {
+	backend := server.New(server.WithHostPorts("127.0.0.1:10051"))
+	backend.Any("/*path", func(c context.Context, ctx *app.RequestContext) {
+		ctx.Response.Header.Set("X-Method", string(ctx.Method()))
+		ctx.String(200, strings.Repeat("a", 1000))
+	})
+	go backend.Spin()
+
+	proxy, err := NewSingleHostReverseProxy("http://127.0.0.1:10051")
+	assert.Nil(t, err)
+	proxy.SetHeadProbes(func(c *app.RequestContext) bool {
+		return string(c.Path()) == "/healthz"
+	})
+	front := server.New(server.WithHostPorts("127.0.0.1:10052"))
+	front.Any("/*path", proxy.ServeHTTP)
+	go front.Spin()
+	time.Sleep(time.Second)
+
+	conn, err := net.Dial("tcp", "127.0.0.1:10052")
+	assert.Nil(t, err)
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	for _, tt := range []struct {
+		method, path  string
+		backendMethod string
+		length        int64
+		body          string
+	}{
+		{method: "HEAD", path: "/doc", backendMethod: "HEAD", length: 1000},
+		{method: "GET", path: "/healthz", backendMethod: "HEAD", length: 0},
+		{method: "GET", path: "/doc", backendMethod: "GET", length: 1000, body: strings.Repeat("a", 1000)},
+	} {
+		fmt.Fprintf(conn, "%s %s HTTP/1.1\r\nHost: example.com\r\n\r\n", tt.method, tt.path)
+		req, _ := http.NewRequest(tt.method, tt.path, nil)
+		res, err := http.ReadResponse(br, req)
+		assert.Nil(t, err)
+		body := make([]byte, res.ContentLength)
+		if tt.method != "HEAD" {
+			_, err = io.ReadFull(res.Body, body)
+			assert.Nil(t, err)
+		}
+		res.Body.Close()
+		assert.DeepEqual(t, 200, res.StatusCode)
+		assert.DeepEqual(t, tt.backendMethod, res.Header.Get("X-Method"))
+		assert.DeepEqual(t, tt.length, res.ContentLength)
+		if tt.method != "HEAD" {
+			assert.DeepEqual(t, tt.body, string(body))
+		}
+	}
+}
+
+func TestHeadResponseBodyDropped(t *testing.T) {
+	proxy, err := NewReverseProxy("http://backend", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		assert.DeepEqual(t, "HEAD", string(req.Method()))
+		// a non-conforming backend sending a body anyway
+		resp.SetBodyStream(strings.NewReader("body"), 4)
+		return nil
+	})))
+	assert.Nil(t, err)
+
+	ctx := app.NewContext(0)
+	ctx.Request.SetMethod("HEAD")
+	ctx.Request.SetRequestURI("http://localhost/doc")
+	proxy.ServeHTTP(context.Background(), ctx)
+	assert.True(t, ctx.Response.SkipBody)
+	assert.False(t, ctx.Response.IsBodyStream())
+	assert.DeepEqual(t, 0, len(ctx.Response.Body()))
+	assert.DeepEqual(t, 4, ctx.Response.Header.ContentLength())
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"fmt"
+
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+// ResponseHeaderLimitError is the error given to the error handler when
+// the response header of the backend exceeds the limits set by
+// SetMaxResponseHeaders.
+type ResponseHeaderLimitError struct {
+	// Count and Bytes are the number of headers and their size in the
+	// response, counted as "Name: value\r\n".
+	Count, Bytes int
+	// MaxCount and MaxBytes are the limits, 0 means no limit.
+	MaxCount, MaxBytes int
+}
+
+func (e *ResponseHeaderLimitError) Error() string {
+	return fmt.Sprintf("reverseproxy: backend response header too large: %d headers (max %d), %d bytes (max %d)",
+		e.Count, e.MaxCount, e.Bytes, e.MaxBytes)
+}
+
+// SetMaxResponseHeaders limits the number of headers and their total size
+// in bytes accepted from the backend, to protect the proxy and its clients
+// from malicious or buggy backends. Larger responses are dropped and the
+// error handler is called with a *ResponseHeaderLimitError, answering 502
+// Bad Gateway by default. 0 means no limit.
+func (r *ReverseProxy) SetMaxResponseHeaders(count, bytes int) {
+	r.maxResponseHeaderCount, r.maxResponseHeaderBytes = count, bytes
+}
+
+// checkResponseHeader returns a *ResponseHeaderLimitError if the header of
+// resp exceeds the limits of r.
+func (r *ReverseProxy) checkResponseHeader(resp *protocol.Response) error {
+	if r.maxResponseHeaderCount <= 0 && r.maxResponseHeaderBytes <= 0 {
+		return nil
+	}
+	count, size := 0, 0
+	resp.Header.VisitAll(func(k, v []byte) {
+		count++
+		size += len(k) + len(v) + len(": \r\n")
+	})
+	if (r.maxResponseHeaderCount > 0 && count > r.maxResponseHeaderCount) ||
+		(r.maxResponseHeaderBytes > 0 && size > r.maxResponseHeaderBytes) {
+		return &ResponseHeaderLimitError{
+			Count: count, Bytes: size,
+			MaxCount: r.maxResponseHeaderCount, MaxBytes: r.maxResponseHeaderBytes,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestMaxResponseHeaders(t *testing.T) {
+	var headers int
+	var value string
+	proxy, err := NewReverseProxy("http://backend", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		for i := 0; i < headers; i++ {
+			resp.Header.Set(fmt.Sprintf("X-Header-%d", i), value)
+		}
+		resp.SetBodyString("ok")
+		return nil
+	})))
+	assert.Nil(t, err)
+	proxy.SetMaxResponseHeaders(10, 256)
+	var got *ProxyError
+	proxy.SetProxyErrorHandler(func(c context.Context, ctx *app.RequestContext, err *ProxyError) {
+		got = err
+		ctx.SetStatusCode(502)
+	})
+
+	for _, tt := range []struct {
+		headers int
+		value   string
+		code    int
+	}{
+		{headers: 3, value: "v", code: 200},
+		{headers: 20, value: "v", code: 502},
+		{headers: 2, value: strings.Repeat("x", 200), code: 502},
+	} {
+		headers, value, got = tt.headers, tt.value, nil
+		ctx := app.NewContext(0)
+		ctx.Request.SetRequestURI("http://localhost/")
+		proxy.ServeHTTP(context.Background(), ctx)
+		assert.DeepEqual(t, tt.code, ctx.Response.StatusCode())
+		if tt.code == 200 {
+			assert.DeepEqual(t, "ok", string(ctx.Response.Body()))
+			assert.Nil(t, got)
+			continue
+		}
+		assert.NotNil(t, got)
+		assert.DeepEqual(t, ErrorKindResponse, got.Kind)
+		var limitErr *ResponseHeaderLimitError
+		assert.True(t, errors.As(got, &limitErr))
+		assert.DeepEqual(t, "", string(ctx.Response.Header.Peek("X-Header-0")))
+	}
+}
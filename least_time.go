@@ -0,0 +1,181 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+// Defaults of LeastTimeOptions.
+const (
+	DefaultLatencyDecay   = 10 * time.Second
+	DefaultFailurePenalty = time.Second
+)
+
+// LeastTimeOptions configures a LeastTimeBalancer.
+type LeastTimeOptions struct {
+	// Decay is how fast old latencies are forgotten: after Decay, a
+	// latency has lost 63% of its weight in the average. DefaultLatencyDecay
+	// if 0.
+	Decay time.Duration
+	// FailurePenalty is the least latency recorded for 5xx responses, so
+	// that instances failing fast do not look fast, DefaultFailurePenalty
+	// if 0.
+	FailurePenalty time.Duration
+}
+
+// LeastTimeBalancer is a Balancer preferring the targets answering fastest,
+// adapting to partially degraded instances. It tracks an exponentially
+// weighted moving average of the latency of each target, which jumps up to
+// latencies above it, and picks the better of two random targets, scoring
+// them by the average times their requests in flight plus one. Targets
+// without latencies yet are tried first.
+type LeastTimeBalancer struct {
+	opts  LeastTimeOptions
+	state atomic.Value // *leastTimeState
+	// mu serializes SetTargets
+	mu sync.Mutex
+}
+
+type leastTimeState struct {
+	targets []string
+	stats   map[string]*latencyStats
+}
+
+// latencyStats are the latency average and load of a target.
+type latencyStats struct {
+	inFlight int64
+
+	mu sync.Mutex
+	// ewma is the average latency in nanoseconds, 0 before the first
+	ewma float64
+	last time.Time
+}
+
+// NewLeastTimeBalancer returns a LeastTimeBalancer of targets.
+func NewLeastTimeBalancer(targets []string, opts LeastTimeOptions) (*LeastTimeBalancer, error) {
+	if opts.Decay <= 0 {
+		opts.Decay = DefaultLatencyDecay
+	}
+	if opts.FailurePenalty <= 0 {
+		opts.FailurePenalty = DefaultFailurePenalty
+	}
+	b := &LeastTimeBalancer{opts: opts}
+	if err := b.SetTargets(targets); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// SetTargets replaces the targets of b, keeping the latencies of those
+// which remain. It is safe while serving.
+func (b *LeastTimeBalancer) SetTargets(targets []string) error {
+	if err := validateTargets(targets); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var prev map[string]*latencyStats
+	if old, _ := b.state.Load().(*leastTimeState); old != nil {
+		prev = old.stats
+	}
+	state := &leastTimeState{targets: append([]string(nil), targets...), stats: make(map[string]*latencyStats, len(targets))}
+	for _, target := range targets {
+		s := prev[target]
+		if s == nil {
+			s = &latencyStats{}
+		}
+		state.stats[target] = s
+	}
+	b.state.Store(state)
+	return nil
+}
+
+func (b *LeastTimeBalancer) Pick(ctx context.Context, c *app.RequestContext) string {
+	state := b.state.Load().(*leastTimeState)
+	picked := state.targets[0]
+	if n := len(state.targets); n > 1 {
+		// rand.Intn is safe for concurrent use
+		i := rand.Intn(n)
+		j := rand.Intn(n - 1)
+		if j >= i {
+			j++
+		}
+		picked = state.targets[i]
+		if state.stats[state.targets[j]].score() < state.stats[picked].score() {
+			picked = state.targets[j]
+		}
+	}
+	atomic.AddInt64(&state.stats[picked].inFlight, 1)
+	return picked
+}
+
+func (b *LeastTimeBalancer) Done(target string, statusCode int, latency time.Duration) {
+	s := b.state.Load().(*leastTimeState).stats[target]
+	if s == nil {
+		return
+	}
+	atomic.AddInt64(&s.inFlight, -1)
+	if statusCode >= consts.StatusInternalServerError && latency < b.opts.FailurePenalty {
+		latency = b.opts.FailurePenalty
+	}
+	if latency <= 0 {
+		// 0 means no latency yet
+		latency = 1
+	}
+	s.observe(float64(latency), b.opts.Decay)
+}
+
+// observe adds latency to the average, decayed by the time since the last
+// one.
+func (s *latencyStats) observe(latency float64, decay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.ewma == 0 || latency > s.ewma {
+		// degradations count at once
+		s.ewma = latency
+	} else {
+		w := math.Exp(-float64(now.Sub(s.last)) / float64(decay))
+		s.ewma = s.ewma*w + latency*(1-w)
+	}
+	s.last = now
+}
+
+func (s *latencyStats) score() float64 {
+	s.mu.Lock()
+	ewma := s.ewma
+	s.mu.Unlock()
+	return ewma * float64(atomic.LoadInt64(&s.inFlight)+1)
+}
+
+// Latency returns the average latency of target, 0 if it has none.
+func (b *LeastTimeBalancer) Latency(target string) time.Duration {
+	s := b.state.Load().(*leastTimeState).stats[target]
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return time.Duration(s.ewma)
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+)
+
+func TestLeastTimeBalancer(t *testing.T) {
+	const fast, slow, failing = "http://fast", "http://slow", "http://failing"
+	b, err := NewLeastTimeBalancer([]string{fast, slow, failing}, LeastTimeOptions{})
+	assert.Nil(t, err)
+	respond := func(target string) (int, time.Duration) {
+		switch target {
+		case fast:
+			return 200, time.Millisecond
+		case slow:
+			return 200, 50 * time.Millisecond
+		}
+		// failing fast does not make it look fast
+		return 503, 0
+	}
+
+	picks := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		target := b.Pick(context.Background(), app.NewContext(0))
+		picks[target]++
+		code, latency := respond(target)
+		b.Done(target, code, latency)
+	}
+	assert.True(t, picks[fast] > 500)
+	assert.True(t, picks[slow] > picks[failing])
+	assert.True(t, picks[failing] < 50)
+	assert.DeepEqual(t, time.Millisecond, b.Latency(fast))
+	assert.DeepEqual(t, DefaultFailurePenalty, b.Latency(failing))
+
+	// requests in flight count against a target
+	var held []string
+	for i := 0; i < 100; i++ {
+		held = append(held, b.Pick(context.Background(), app.NewContext(0)))
+	}
+	picks = make(map[string]int)
+	for _, target := range held {
+		picks[target]++
+	}
+	assert.True(t, picks[slow] > 0)
+	for _, target := range held {
+		b.Done(target, 200, time.Millisecond)
+	}
+
+	// latencies recover once the target is fast again
+	assert.Nil(t, b.SetTargets([]string{fast, slow}))
+	assert.DeepEqual(t, time.Millisecond, b.Latency(fast))
+	assert.DeepEqual(t, time.Duration(0), b.Latency(failing))
+	b.Done(failing, 200, time.Millisecond)
+	s := b.state.Load().(*leastTimeState).stats[slow]
+	s.mu.Lock()
+	s.last = s.last.Add(-time.Minute)
+	s.mu.Unlock()
+	b.Done(slow, 200, time.Millisecond)
+	assert.True(t, b.Latency(slow) < 2*time.Millisecond)
+
+	_, err = NewLeastTimeBalancer(nil, LeastTimeOptions{})
+	assert.NotNil(t, err)
+}
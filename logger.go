@@ -0,0 +1,171 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+// Logger receives the logs of the proxies, e.g. to route them into zap or
+// slog. It is set by SetLogger and WithLogger, hlog is used by default.
+type Logger interface {
+	Debugf(ctx context.Context, format string, v ...interface{})
+	Warnf(ctx context.Context, format string, v ...interface{})
+	Errorf(ctx context.Context, format string, v ...interface{})
+}
+
+// LogLevel is the level of a structured log entry.
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota
+	LevelWarn
+	LevelError
+)
+
+// Field is a key and value of a structured log entry.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// FieldLogger is implemented by Loggers taking structured fields, e.g.
+// adapters of zap or slog. Other Loggers get the fields appended to the
+// message as key=value pairs.
+type FieldLogger interface {
+	Logger
+	Logw(ctx context.Context, level LogLevel, msg string, fields ...Field)
+}
+
+// HeaderRequestID is the request header logged as request_id with the
+// failures of backend calls.
+const HeaderRequestID = "X-Request-Id"
+
+// NopLogger discards all logs.
+type NopLogger struct{}
+
+func (NopLogger) Debugf(context.Context, string, ...interface{}) {}
+func (NopLogger) Warnf(context.Context, string, ...interface{})  {}
+func (NopLogger) Errorf(context.Context, string, ...interface{}) {}
+
+// hlogLogger writes to hlog, the logger of hertz.
+type hlogLogger struct{}
+
+func (hlogLogger) Debugf(ctx context.Context, format string, v ...interface{}) {
+	hlog.CtxDebugf(ctx, format, v...)
+}
+
+func (hlogLogger) Warnf(ctx context.Context, format string, v ...interface{}) {
+	hlog.CtxWarnf(ctx, format, v...)
+}
+
+func (hlogLogger) Errorf(ctx context.Context, format string, v ...interface{}) {
+	hlog.CtxErrorf(ctx, format, v...)
+}
+
+// orHlog returns l, hlog if it is nil.
+func orHlog(l Logger) Logger {
+	if l == nil {
+		return hlogLogger{}
+	}
+	return l
+}
+
+// logw logs msg with fields to l.
+func logw(ctx context.Context, l Logger, level LogLevel, msg string, fields ...Field) {
+	if fl, ok := l.(FieldLogger); ok {
+		fl.Logw(ctx, level, msg, fields...)
+		return
+	}
+	var b strings.Builder
+	b.WriteString(msg)
+	for _, f := range fields {
+		b.WriteByte(' ')
+		b.WriteString(f.Key)
+		b.WriteByte('=')
+		v := fmt.Sprint(f.Value)
+		if v == "" || strings.ContainsAny(v, " =\"") {
+			v = fmt.Sprintf("%q", v)
+		}
+		b.WriteString(v)
+	}
+	switch level {
+	case LevelDebug:
+		l.Debugf(ctx, "%s", b.String())
+	case LevelWarn:
+		l.Warnf(ctx, "%s", b.String())
+	default:
+		l.Errorf(ctx, "%s", b.String())
+	}
+}
+
+// callFields are the fields logged with the outcome of a backend call of
+// req, with the name of r if it has one.
+func (r *ReverseProxy) callFields(req *protocol.Request, attempt int, latency time.Duration, err error) []Field {
+	uri := req.URI()
+	fields := []Field{
+		{Key: "request_id", Value: string(req.Header.Peek(HeaderRequestID))},
+		{Key: "method", Value: string(req.Header.Method())},
+		{Key: "path", Value: string(uri.Path())},
+		{Key: "target", Value: string(uri.Scheme()) + "://" + string(uri.Host())},
+		{Key: "attempt", Value: attempt},
+		{Key: "latency", Value: latency},
+	}
+	if r.name != "" {
+		fields = append(fields, Field{Key: "route", Value: r.name})
+	}
+	if err != nil {
+		fields = append(fields, Field{Key: "error", Value: err})
+	}
+	return fields
+}
+
+// SetLogger sets the logger of r, nil for hlog.
+func (r *ReverseProxy) SetLogger(l Logger) {
+	r.logger = l
+}
+
+func (r *ReverseProxy) log() Logger {
+	return orHlog(r.logger)
+}
+
+// WithLogger sets the logger of the websocket proxy, nil for hlog. Errors
+// of each session are logged at error level, so filtering them silences
+// noisy clients.
+func WithLogger(l Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
+
+// SetLogger sets the logger of rt and its routes, nil for hlog.
+func (rt *Router) SetLogger(l Logger) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.logger = l
+	// the routes have been compiled before
+	_ = rt.store(rt.loadTable().routes)
+}
+
+// SetLogger sets the logger of rl, nil for hlog.
+func (rl *RateLimiter) SetLogger(l Logger) {
+	rl.logger = l
+}
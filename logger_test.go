@@ -0,0 +1,142 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+type recordingLogger struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (l *recordingLogger) record(level, format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logs = append(l.logs, level+" "+fmt.Sprintf(format, v...))
+}
+
+func (l *recordingLogger) Debugf(_ context.Context, format string, v ...interface{}) {
+	l.record("debug", format, v...)
+}
+
+func (l *recordingLogger) Warnf(_ context.Context, format string, v ...interface{}) {
+	l.record("warn", format, v...)
+}
+
+func (l *recordingLogger) Errorf(_ context.Context, format string, v ...interface{}) {
+	l.record("error", format, v...)
+}
+
+func TestSetLogger(t *testing.T) {
+	proxy, err := NewReverseProxy("http://backend", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		return syscall.ECONNREFUSED
+	})))
+	assert.Nil(t, err)
+	proxy.SetRetries(1)
+	l := &recordingLogger{}
+	proxy.SetLogger(l)
+
+	ctx := app.NewContext(0)
+	ctx.Request.SetRequestURI("http://localhost/")
+	proxy.ServeHTTP(context.Background(), ctx)
+	assert.DeepEqual(t, 502, ctx.Response.StatusCode())
+	assert.DeepEqual(t, 2, len(l.logs))
+	assert.True(t, strings.HasPrefix(l.logs[0], `warn HERTZ: Backend call failed, retrying request_id="" method=GET path=/ target=http://backend attempt=1 latency=`))
+	assert.True(t, strings.HasSuffix(l.logs[0], ` error="connection refused"`))
+	assert.True(t, strings.HasPrefix(l.logs[1], `error HERTZ: Backend call failed request_id="" method=GET path=/ target=http://backend attempt=2 latency=`))
+
+	// silenced
+	proxy.SetLogger(NopLogger{})
+	l.logs = nil
+	ctx = app.NewContext(0)
+	ctx.Request.SetRequestURI("http://localhost/")
+	proxy.ServeHTTP(context.Background(), ctx)
+	assert.DeepEqual(t, 0, len(l.logs))
+}
+
+type fieldLogger struct {
+	recordingLogger
+	levels []LogLevel
+	fields [][]Field
+}
+
+func (l *fieldLogger) Logw(_ context.Context, level LogLevel, msg string, fields ...Field) {
+	l.levels = append(l.levels, level)
+	l.fields = append(l.fields, fields)
+}
+
+func TestFieldLogger(t *testing.T) {
+	var cancel context.CancelFunc
+	proxy, err := NewReverseProxy("http://backend", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		if cancel != nil {
+			cancel()
+			return context.Canceled
+		}
+		return syscall.ECONNREFUSED
+	})))
+	assert.Nil(t, err)
+	l := &fieldLogger{}
+	proxy.SetLogger(l)
+
+	ctx := app.NewContext(0)
+	ctx.Request.SetRequestURI("http://localhost/items?id=1")
+	ctx.Request.SetMethod("POST")
+	ctx.Request.Header.Set(HeaderRequestID, "req-1")
+	proxy.ServeHTTP(context.Background(), ctx)
+	assert.DeepEqual(t, []LogLevel{LevelError}, l.levels)
+	fields := l.fields[0]
+	assert.DeepEqual(t, 7, len(fields))
+	assert.DeepEqual(t, Field{Key: "request_id", Value: "req-1"}, fields[0])
+	assert.DeepEqual(t, Field{Key: "method", Value: "POST"}, fields[1])
+	assert.DeepEqual(t, Field{Key: "path", Value: "/items"}, fields[2])
+	assert.DeepEqual(t, Field{Key: "target", Value: "http://backend"}, fields[3])
+	assert.DeepEqual(t, Field{Key: "attempt", Value: 1}, fields[4])
+	assert.DeepEqual(t, "latency", fields[5].Key)
+	assert.DeepEqual(t, Field{Key: "error", Value: error(syscall.ECONNREFUSED)}, fields[6])
+	assert.DeepEqual(t, 0, len(l.logs))
+
+	// client disconnects are expected
+	l.levels, l.fields = nil, nil
+	c, cancelFunc := context.WithCancel(context.Background())
+	cancel = cancelFunc
+	ctx = app.NewContext(0)
+	ctx.Request.SetRequestURI("http://localhost/items")
+	proxy.ServeHTTP(c, ctx)
+	assert.DeepEqual(t, []LogLevel{LevelDebug}, l.levels)
+}
+
+func TestRouterSetLogger(t *testing.T) {
+	rt, err := NewRouter([]Route{{Path: "/", Target: "http://127.0.0.1:1"}})
+	assert.Nil(t, err)
+	l := &recordingLogger{}
+	rt.SetLogger(l)
+
+	ctx := app.NewContext(0)
+	ctx.Request.SetRequestURI("http://localhost/")
+	rt.ServeHTTP(context.Background(), ctx)
+	assert.DeepEqual(t, 502, ctx.Response.StatusCode())
+	assert.DeepEqual(t, 1, len(l.logs))
+}
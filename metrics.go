@@ -0,0 +1,252 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+// DefaultLatencyBuckets are the upper bounds in seconds of the latency
+// histogram unless MetricsOptions.Buckets are set.
+var DefaultLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// MetricsOptions configure NewMetrics.
+type MetricsOptions struct {
+	// Namespace prefixes the metric names, "reverseproxy" by default.
+	Namespace string
+	// Buckets are the increasing upper bounds in seconds of the latency
+	// histogram, DefaultLatencyBuckets by default.
+	Buckets []float64
+	// Labels are added to the labels method, code, target and route, their
+	// functions return the value of a request, e.g. a tenant from a header.
+	Labels map[string]func(ctx context.Context, c *app.RequestContext) string
+}
+
+// Metrics count the requests of proxies, see SetMetrics, and serve them
+// in the Prometheus text format:
+//
+//	<namespace>_requests_total            counter of responses
+//	<namespace>_request_duration_seconds  histogram of the time until the response body was written
+//	<namespace>_request_bytes_total       counter of request body bytes
+//	<namespace>_response_bytes_total      counter of response body bytes
+type Metrics struct {
+	namespace string
+	buckets   []float64
+	labels    []string
+	values    []func(ctx context.Context, c *app.RequestContext) string
+
+	mu     sync.RWMutex
+	series map[string]*metricSeries
+}
+
+// metricSeries are the metrics of one set of label values.
+type metricSeries struct {
+	labels string
+	// counts are the observations per bucket, the last one for +Inf
+	counts        []uint64
+	count         uint64
+	sumBits       uint64
+	requestBytes  int64
+	responseBytes int64
+}
+
+var labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// NewMetrics returns Metrics configured by opts.
+func NewMetrics(opts MetricsOptions) (*Metrics, error) {
+	m := &Metrics{
+		namespace: opts.Namespace,
+		buckets:   opts.Buckets,
+		labels:    []string{"method", "code", "target", "route"},
+		series:    make(map[string]*metricSeries),
+	}
+	if m.namespace == "" {
+		m.namespace = "reverseproxy"
+	}
+	if !labelName.MatchString(m.namespace) {
+		return nil, fmt.Errorf("reverseproxy: invalid metrics namespace %q", m.namespace)
+	}
+	if m.buckets == nil {
+		m.buckets = DefaultLatencyBuckets
+	}
+	for i, b := range m.buckets {
+		if math.IsNaN(b) || math.IsInf(b, 0) || i > 0 && b <= m.buckets[i-1] {
+			return nil, fmt.Errorf("reverseproxy: metric buckets must be finite and increasing: %v", m.buckets)
+		}
+	}
+	names := make([]string, 0, len(opts.Labels))
+	for name := range opts.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !labelName.MatchString(name) || strings.HasPrefix(name, "__") || name == "le" {
+			return nil, fmt.Errorf("reverseproxy: invalid metric label %q", name)
+		}
+		for _, l := range m.labels {
+			if l == name {
+				return nil, fmt.Errorf("reverseproxy: duplicate metric label %q", name)
+			}
+		}
+		m.labels = append(m.labels, name)
+		m.values = append(m.values, opts.Labels[name])
+	}
+	return m, nil
+}
+
+// SetMetrics makes r count its requests in m, which may be shared by
+// several proxies. They are labeled with the name of r, see SetName.
+func (r *ReverseProxy) SetMetrics(m *Metrics) {
+	r.metrics = m
+}
+
+// SetMetrics makes the routes of rt count their requests in m, labeled
+// with the Name of each route.
+func (rt *Router) SetMetrics(m *Metrics) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.metrics = m
+	// the routes have been compiled before
+	_ = rt.store(rt.loadTable().routes)
+}
+
+// observe counts a request once its response was handed to the server.
+func (m *Metrics) observe(ctx context.Context, c *app.RequestContext, t Transfer) {
+	var target string
+	if _, called := c.Value(ContextKeyAttempts).(int); called {
+		uri := c.Request.URI()
+		target = string(uri.Scheme()) + "://" + string(uri.Host())
+	}
+	route, _ := c.Value(ContextKeyRoute).(string)
+	values := make([]string, 0, len(m.labels))
+	values = append(values, string(c.Request.Header.Method()), strconv.Itoa(t.StatusCode), target, route)
+	for _, f := range m.values {
+		values = append(values, f(ctx, c))
+	}
+	s := m.seriesOf(values)
+
+	seconds := t.Duration.Seconds()
+	i := sort.SearchFloat64s(m.buckets, seconds)
+	atomic.AddUint64(&s.counts[i], 1)
+	atomic.AddUint64(&s.count, 1)
+	for {
+		old := atomic.LoadUint64(&s.sumBits)
+		sum := math.Float64bits(math.Float64frombits(old) + seconds)
+		if atomic.CompareAndSwapUint64(&s.sumBits, old, sum) {
+			break
+		}
+	}
+	atomic.AddInt64(&s.requestBytes, t.RequestBytes)
+	atomic.AddInt64(&s.responseBytes, t.ResponseBytes)
+}
+
+func (m *Metrics) seriesOf(values []string) *metricSeries {
+	var b strings.Builder
+	for i, v := range values {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(m.labels[i])
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(v))
+		b.WriteByte('"')
+	}
+	labels := b.String()
+	m.mu.RLock()
+	s := m.series[labels]
+	m.mu.RUnlock()
+	if s != nil {
+		return s
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s = m.series[labels]; s == nil {
+		s = &metricSeries{labels: labels, counts: make([]uint64, len(m.buckets)+1)}
+		m.series[labels] = s
+	}
+	return s
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
+
+// WriteTo writes the metrics to w in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.RLock()
+	series := make([]*metricSeries, 0, len(m.series))
+	for _, s := range m.series {
+		series = append(series, s)
+	}
+	m.mu.RUnlock()
+	sort.Slice(series, func(i, j int) bool { return series[i].labels < series[j].labels })
+
+	var b bytes.Buffer
+	name := m.namespace + "_requests_total"
+	fmt.Fprintf(&b, "# HELP %s Requests answered by the proxy.\n# TYPE %s counter\n", name, name)
+	for _, s := range series {
+		fmt.Fprintf(&b, "%s{%s} %d\n", name, s.labels, atomic.LoadUint64(&s.count))
+	}
+	name = m.namespace + "_request_duration_seconds"
+	fmt.Fprintf(&b, "# HELP %s Time until the response body was written.\n# TYPE %s histogram\n", name, name)
+	for _, s := range series {
+		var cumulative uint64
+		for i, upper := range m.buckets {
+			cumulative += atomic.LoadUint64(&s.counts[i])
+			fmt.Fprintf(&b, "%s_bucket{%s,le=\"%s\"} %d\n", name, s.labels, strconv.FormatFloat(upper, 'g', -1, 64), cumulative)
+		}
+		cumulative += atomic.LoadUint64(&s.counts[len(m.buckets)])
+		fmt.Fprintf(&b, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, s.labels, cumulative)
+		sum := math.Float64frombits(atomic.LoadUint64(&s.sumBits))
+		fmt.Fprintf(&b, "%s_sum{%s} %s\n", name, s.labels, strconv.FormatFloat(sum, 'g', -1, 64))
+		fmt.Fprintf(&b, "%s_count{%s} %d\n", name, s.labels, cumulative)
+	}
+	for _, c := range []struct {
+		name, help string
+		value      func(s *metricSeries) int64
+	}{
+		{"_request_bytes_total", "Request body bytes read from clients.", func(s *metricSeries) int64 { return atomic.LoadInt64(&s.requestBytes) }},
+		{"_response_bytes_total", "Response body bytes written to clients.", func(s *metricSeries) int64 { return atomic.LoadInt64(&s.responseBytes) }},
+	} {
+		name = m.namespace + c.name
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", name, c.help, name)
+		for _, s := range series {
+			fmt.Fprintf(&b, "%s{%s} %d\n", name, s.labels, c.value(s))
+		}
+	}
+	return b.WriteTo(w)
+}
+
+// ServeHTTP serves the metrics, e.g. with h.GET("/metrics", m.ServeHTTP).
+func (m *Metrics) ServeHTTP(ctx context.Context, c *app.RequestContext) {
+	var b bytes.Buffer
+	m.WriteTo(&b) //nolint:errcheck
+	c.Data(consts.StatusOK, "text/plain; version=0.0.4; charset=utf-8", b.Bytes())
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestMetrics(t *testing.T) {
+	m, err := NewMetrics(MetricsOptions{
+		Namespace: "gw",
+		Buckets:   []float64{0.5, 1},
+		Labels: map[string]func(ctx context.Context, c *app.RequestContext) string{
+			"tenant": func(ctx context.Context, c *app.RequestContext) string {
+				return string(c.Request.Header.Peek("X-Tenant"))
+			},
+		},
+	})
+	assert.Nil(t, err)
+	proxy, err := NewReverseProxy("http://backend:8080", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		if string(req.URI().Path()) == "/down" {
+			return syscall.ECONNREFUSED
+		}
+		resp.SetBodyString("hello")
+		return nil
+	})))
+	assert.Nil(t, err)
+	proxy.SetMetrics(m)
+	proxy.SetName("api")
+
+	for _, path := range []string{"/a", "/b", "/down"} {
+		ctx := app.NewContext(0)
+		ctx.Request.SetRequestURI("http://localhost" + path)
+		ctx.Request.Header.Set("X-Tenant", `a"b`)
+		proxy.ServeHTTP(context.Background(), ctx)
+	}
+
+	var b strings.Builder
+	_, err = m.WriteTo(&b)
+	assert.Nil(t, err)
+	out := b.String()
+	ok := `{method="GET",code="200",target="http://backend:8080",route="api",tenant="a\"b"}`
+	down := `{method="GET",code="502",target="http://backend:8080",route="api",tenant="a\"b"}`
+	for _, line := range []string{
+		"# TYPE gw_requests_total counter",
+		"gw_requests_total" + ok + " 2",
+		"gw_requests_total" + down + " 1",
+		"# TYPE gw_request_duration_seconds histogram",
+		`gw_request_duration_seconds_bucket{method="GET",code="200",target="http://backend:8080",route="api",tenant="a\"b",le="0.5"} 2`,
+		`gw_request_duration_seconds_bucket{method="GET",code="200",target="http://backend:8080",route="api",tenant="a\"b",le="1"} 2`,
+		`gw_request_duration_seconds_bucket{method="GET",code="200",target="http://backend:8080",route="api",tenant="a\"b",le="+Inf"} 2`,
+		"gw_request_duration_seconds_count" + ok + " 2",
+		"gw_response_bytes_total" + ok + " 10",
+		"gw_request_bytes_total" + ok + " 0",
+	} {
+		assert.True(t, strings.Contains(out, line+"\n"))
+	}
+
+	ctx := app.NewContext(0)
+	m.ServeHTTP(context.Background(), ctx)
+	assert.DeepEqual(t, out, string(ctx.Response.Body()))
+}
+
+func TestNewMetricsValidates(t *testing.T) {
+	label := func(ctx context.Context, c *app.RequestContext) string { return "" }
+	for _, opts := range []MetricsOptions{
+		{Namespace: "a-b"},
+		{Buckets: []float64{1, 0.5}},
+		{Labels: map[string]func(ctx context.Context, c *app.RequestContext) string{"code": label}},
+		{Labels: map[string]func(ctx context.Context, c *app.RequestContext) string{"le": label}},
+		{Labels: map[string]func(ctx context.Context, c *app.RequestContext) string{"1x": label}},
+	} {
+		_, err := NewMetrics(opts)
+		assert.NotNil(t, err)
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"sync/atomic"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+// MultipartPart describes a part of a multipart/form-data request body
+// passing through the proxy.
+type MultipartPart struct {
+	// Index is the position of the part in the body, starting at 0.
+	Index int
+	// FormName and FileName are the name and filename parameters of its
+	// Content-Disposition, FileName without directories.
+	FormName string
+	FileName string
+	// ContentType is the Content-Type of the part.
+	ContentType string
+	Header      textproto.MIMEHeader
+	// Size is the number of bytes of the part seen so far.
+	Size int64
+}
+
+// MultipartInspector checks a part of an upload, returning an error to
+// reject the request.
+type MultipartInspector func(ctx context.Context, part *MultipartPart) error
+
+// SetMultipartInspector calls inspect for the parts of multipart/form-data
+// requests while they are forwarded, once its header was read and again
+// whenever more of its content passed, so that gateways can enforce upload
+// policies, e.g. on file types or sizes, without buffering uploads.
+//
+// An error of inspect aborts the backend call and answers the request with
+// 403 Forbidden, or the status of an error with a StatusCode() int method.
+// Malformed bodies are answered with 400 Bad Request. Streamed bodies are
+// inspected as they are sent, so the backend may have received the start
+// of a rejected part; others are inspected before the backend is called.
+func (r *ReverseProxy) SetMultipartInspector(inspect MultipartInspector) {
+	r.multipartInspector = inspect
+}
+
+// ErrMalformedMultipart is the error of multipart/form-data request bodies
+// which could not be parsed for SetMultipartInspector.
+var ErrMalformedMultipart = errors.New("reverseproxy: malformed multipart body")
+
+// multipartError is an error aborting the inspection of a body.
+type multipartError struct {
+	status int
+	err    error
+}
+
+func (e *multipartError) Error() string {
+	return e.err.Error()
+}
+
+func (e *multipartError) Unwrap() error {
+	return e.err
+}
+
+// inspectMultipartRequest inspects the body of the request if it is a
+// multipart/form-data one. Buffered bodies are inspected right away, streamed
+// ones are wrapped by the returned inspector. It reports whether the request
+// was rejected.
+func (r *ReverseProxy) inspectMultipartRequest(c context.Context, ctx *app.RequestContext) (*multipartInspection, bool) {
+	if r.multipartInspector == nil {
+		return nil, false
+	}
+	req := &ctx.Request
+	mediaType, params, err := mime.ParseMediaType(b2s(req.Header.ContentType()))
+	if err != nil || mediaType != "multipart/form-data" {
+		return nil, false
+	}
+	boundary := params["boundary"]
+	if !req.IsBodyStream() {
+		if err = inspectMultipart(c, bytes.NewReader(req.Body()), boundary, r.multipartInspector); err != nil {
+			rejectMultipart(c, ctx, r.log(), err)
+			return nil, true
+		}
+		return nil, false
+	}
+	pr, pw := io.Pipe()
+	m := &multipartInspection{src: req.BodyStream(), pw: pw, done: make(chan struct{})}
+	go func() {
+		defer close(m.done)
+		err := inspectMultipart(c, pr, boundary, r.multipartInspector)
+		if err != nil {
+			if atomic.LoadInt32(&m.stopped) == 0 {
+				m.err.Store(err)
+			}
+			pr.CloseWithError(err)
+			return
+		}
+		// pass the epilogue
+		io.Copy(io.Discard, pr) //nolint:errcheck
+	}()
+	req.ConstructBodyStream(req.BodyBuffer(), m)
+	return m, false
+}
+
+// inspectMultipart calls inspect for the parts of the body read from r.
+func inspectMultipart(ctx context.Context, r io.Reader, boundary string, inspect MultipartInspector) error {
+	if boundary == "" {
+		return &multipartError{status: consts.StatusBadRequest, err: ErrMalformedMultipart}
+	}
+	mr := multipart.NewReader(r, boundary)
+	var buf []byte
+	for i := 0; ; i++ {
+		p, err := mr.NextRawPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return malformedMultipart(err)
+		}
+		part := &MultipartPart{
+			Index:       i,
+			FormName:    p.FormName(),
+			FileName:    p.FileName(),
+			ContentType: p.Header.Get("Content-Type"),
+			Header:      p.Header,
+		}
+		if err = inspectPart(ctx, inspect, part); err != nil {
+			return err
+		}
+		if buf == nil {
+			buf = make([]byte, 32*1024)
+		}
+		for {
+			n, err := p.Read(buf)
+			if n > 0 {
+				part.Size += int64(n)
+				if err := inspectPart(ctx, inspect, part); err != nil {
+					return err
+				}
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return malformedMultipart(err)
+			}
+		}
+	}
+}
+
+func inspectPart(ctx context.Context, inspect MultipartInspector, part *MultipartPart) error {
+	err := inspect(ctx, part)
+	if err == nil {
+		return nil
+	}
+	status := consts.StatusForbidden
+	if s, ok := err.(interface{ StatusCode() int }); ok && s.StatusCode() > 0 {
+		status = s.StatusCode()
+	}
+	return &multipartError{status: status, err: err}
+}
+
+func malformedMultipart(err error) error {
+	return &multipartError{status: consts.StatusBadRequest, err: fmt.Errorf("%w: %v", ErrMalformedMultipart, err)}
+}
+
+func rejectMultipart(c context.Context, ctx *app.RequestContext, log Logger, err error) {
+	log.Warnf(c, "HERTZ: Multipart request rejected: %v", err)
+	// the rest of a streamed body is not read
+	if ctx.Request.IsBodyStream() {
+		ctx.Response.Header.SetConnectionClose(true)
+	}
+	status := consts.StatusBadRequest
+	var merr *multipartError
+	if errors.As(err, &merr) {
+		status = merr.status
+	}
+	ctx.Response.Header.SetStatusCode(status)
+}
+
+// multipartInspection passes a streamed body to its inspection, failing
+// once the inspection did.
+type multipartInspection struct {
+	src  io.Reader
+	pw   *io.PipeWriter
+	done chan struct{}
+	// err is the error of the inspection
+	err     atomic.Value
+	stopped int32
+}
+
+func (m *multipartInspection) Read(p []byte) (int, error) {
+	n, err := m.src.Read(p)
+	if n > 0 {
+		if _, werr := m.pw.Write(p[:n]); werr != nil {
+			return 0, werr
+		}
+	}
+	if err == io.EOF {
+		// the end of the body must have been inspected too
+		m.pw.Close()
+		<-m.done
+		if ierr := m.rejected(); ierr != nil {
+			return 0, ierr
+		}
+	}
+	return n, err
+}
+
+func (m *multipartInspection) Close() error {
+	if c, ok := m.src.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// stop ends the inspection once the request is done with. It may be
+// called more than once.
+func (m *multipartInspection) stop() {
+	atomic.StoreInt32(&m.stopped, 1)
+	m.pw.CloseWithError(io.ErrClosedPipe)
+	<-m.done
+}
+
+// rejected returns the error of the inspection, nil while it passed.
+func (m *multipartInspection) rejected() error {
+	if m == nil {
+		return nil
+	}
+	err, _ := m.err.Load().(error)
+	return err
+}
@@ -0,0 +1,168 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"mime/multipart"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+type uploadTooLarge struct{}
+
+func (uploadTooLarge) Error() string   { return "upload too large" }
+func (uploadTooLarge) StatusCode() int { return 413 }
+
+func TestMultipartInspector(t *testing.T) {
+	var received []byte
+	proxy, err := NewReverseProxy("http://backend", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		received = nil
+		if !req.IsBodyStream() {
+			received = append(received, req.Body()...)
+			return nil
+		}
+		body, err := ioutil.ReadAll(req.BodyStream())
+		received = body
+		return err
+	})))
+	assert.Nil(t, err)
+	var seen []string
+	proxy.SetMultipartInspector(func(ctx context.Context, part *MultipartPart) error {
+		if part.Size == 0 {
+			seen = append(seen, part.FormName+":"+part.FileName+":"+part.ContentType)
+		}
+		if strings.HasSuffix(part.FileName, ".exe") {
+			return errors.New("executables are not allowed")
+		}
+		if part.Size > 1000 {
+			return uploadTooLarge{}
+		}
+		return nil
+	})
+
+	upload := func(file string, size int) (string, []byte) {
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		w.WriteField("title", "holiday") //nolint:errcheck
+		fw, _ := w.CreateFormFile("file", file)
+		fw.Write(bytes.Repeat([]byte("x"), size)) //nolint:errcheck
+		w.Close()
+		return w.FormDataContentType(), buf.Bytes()
+	}
+
+	for _, tt := range []struct {
+		name   string
+		file   string
+		size   int
+		stream bool
+		broken bool
+		code   int
+	}{
+		{name: "buffered", file: "a.png", size: 100, code: 200},
+		{name: "buffered rejected", file: "a.exe", size: 100, code: 403},
+		{name: "streamed", file: "a.png", size: 1000, stream: true, code: 200},
+		{name: "streamed rejected", file: "a.exe", size: 100, stream: true, code: 403},
+		{name: "streamed too large", file: "a.png", size: 100000, stream: true, code: 413},
+		{name: "streamed malformed", file: "a.png", size: 100, stream: true, broken: true, code: 400},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			seen, received = nil, nil
+			contentType, body := upload(tt.file, tt.size)
+			if tt.broken {
+				body = body[:len(body)-10]
+			}
+			ctx := app.NewContext(0)
+			ctx.Request.SetMethod("POST")
+			ctx.Request.SetRequestURI("http://localhost/upload")
+			ctx.Request.Header.SetContentTypeBytes([]byte(contentType))
+			if tt.stream {
+				ctx.Request.SetBodyStream(bytes.NewReader(body), len(body))
+			} else {
+				ctx.Request.SetBody(body)
+			}
+			proxy.ServeHTTP(context.Background(), ctx)
+			assert.DeepEqual(t, tt.code, ctx.Response.StatusCode())
+			assert.DeepEqual(t, tt.stream && tt.code != 200, ctx.Response.Header.ConnectionClose())
+			assert.DeepEqual(t, []string{"title::", "file:" + tt.file + ":application/octet-stream"}, seen)
+			if tt.code == 200 {
+				assert.DeepEqual(t, body, received)
+			} else if !tt.stream {
+				assert.Nil(t, received)
+			}
+		})
+	}
+}
+
+func TestMultipartInspectorIgnoresOtherBodies(t *testing.T) {
+	proxy, err := NewReverseProxy("http://backend", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		return nil
+	})))
+	assert.Nil(t, err)
+	proxy.SetMultipartInspector(func(ctx context.Context, part *MultipartPart) error {
+		return errors.New("unexpected")
+	})
+	ctx := app.NewContext(0)
+	ctx.Request.SetMethod("POST")
+	ctx.Request.SetRequestURI("http://localhost/upload")
+	ctx.Request.Header.SetContentTypeBytes([]byte("application/json"))
+	ctx.Request.SetBodyString(`{"a":1}`)
+	proxy.ServeHTTP(context.Background(), ctx)
+	assert.DeepEqual(t, 200, ctx.Response.StatusCode())
+}
+
+func TestMultipartInspectionEndsOnEarlyReturn(t *testing.T) {
+	proxy, err := NewReverseProxy("http://backend", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		return nil
+	})))
+	assert.Nil(t, err)
+	proxy.SetMultipartInspector(func(ctx context.Context, part *MultipartPart) error {
+		return nil
+	})
+	proxy.SetTargetFunc(func(ctx context.Context, c *app.RequestContext) (string, error) {
+		return "", errors.New("no target")
+	})
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	w.WriteField("title", "holiday") //nolint:errcheck
+	w.Close()
+	ctx := app.NewContext(0)
+	ctx.Request.SetMethod("POST")
+	ctx.Request.SetRequestURI("http://localhost/upload")
+	ctx.Request.Header.SetContentTypeBytes([]byte(w.FormDataContentType()))
+	ctx.Request.SetBodyStream(bytes.NewReader(buf.Bytes()), buf.Len())
+	proxy.ServeHTTP(context.Background(), ctx)
+	assert.DeepEqual(t, 502, ctx.Response.StatusCode())
+
+	// the goroutine of the inspection is gone without the body being read
+	inspecting := true
+	for deadline := time.Now().Add(time.Second); inspecting && time.Now().Before(deadline); {
+		stacks := make([]byte, 1<<20)
+		inspecting = bytes.Contains(stacks[:runtime.Stack(stacks, true)], []byte("inspectMultipartRequest.func"))
+		if inspecting {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	assert.False(t, inspecting)
+}
@@ -0,0 +1,32 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+// ContextKeyRoute is the name of the proxy or route serving the request,
+// a string, see SetName. It is set before the backend is called, so
+// that access logs can break traffic down by route.
+const ContextKeyRoute = "reverseproxy.route"
+
+// SetName names the logical route served by r, e.g. "checkout", for the
+// route label of Metrics, the route field of logs and ContextKeyRoute,
+// rather than labeling traffic by raw paths of high cardinality.
+func (r *ReverseProxy) SetName(name string) {
+	r.name = name
+}
+
+// Name returns the name set by SetName.
+func (r *ReverseProxy) Name() string {
+	return r.name
+}
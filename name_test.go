@@ -0,0 +1,74 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+)
+
+func TestRouteNames(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "routes.yaml")
+	assert.Nil(t, ioutil.WriteFile(file, []byte(`routes:
+  - name: checkout
+    path: /checkout/
+    target: http://127.0.0.1:10065
+  - path: /other/
+    target: http://127.0.0.1:10065
+`), 0o600))
+	routes, err := LoadRoutes(file)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, "checkout", routes[0].Name)
+	assert.DeepEqual(t, "checkout", routes[0].Config().Name)
+
+	rt, err := NewRouter(routes)
+	assert.Nil(t, err)
+	m, err := NewMetrics(MetricsOptions{})
+	assert.Nil(t, err)
+	rt.SetMetrics(m)
+	l := &recordingLogger{}
+	rt.SetLogger(l)
+
+	for _, path := range []string{"/checkout/cart/1", "/checkout/cart/2", "/other/x"} {
+		ctx := app.NewContext(0)
+		ctx.Request.SetRequestURI("http://localhost" + path)
+		rt.ServeHTTP(context.Background(), ctx)
+		assert.DeepEqual(t, 502, ctx.Response.StatusCode())
+		if strings.HasPrefix(path, "/checkout/") {
+			assert.DeepEqual(t, "checkout", ctx.GetString(ContextKeyRoute))
+		} else {
+			_, named := ctx.Get(ContextKeyRoute)
+			assert.False(t, named)
+		}
+	}
+
+	var b strings.Builder
+	_, err = m.WriteTo(&b)
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(b.String(),
+		`reverseproxy_requests_total{method="GET",code="502",target="http://127.0.0.1:10065",route="checkout"} 2`+"\n"))
+	assert.True(t, strings.Contains(b.String(),
+		`reverseproxy_requests_total{method="GET",code="502",target="http://127.0.0.1:10065",route=""} 1`+"\n"))
+
+	assert.DeepEqual(t, 3, len(l.logs))
+	assert.True(t, strings.Contains(l.logs[0], " route=checkout error="))
+	assert.False(t, strings.Contains(l.logs[2], "route="))
+}
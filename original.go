@@ -0,0 +1,76 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+// Default headers of SetOriginalRequestHeaders.
+const (
+	HeaderOriginalURI    = "X-Original-URI"
+	HeaderOriginalMethod = "X-Original-Method"
+)
+
+// ContextKeyOriginalURI is the request URI before an earlier handler
+// rewrote it, a string. The Router sets it before stripping prefixes or
+// expanding patterns, middleware rewriting requests may set it too.
+const ContextKeyOriginalURI = "reverseproxy.original_uri"
+
+// SetOriginalRequestHeaders passes the path and query and the method of
+// requests as received, before the path prefixes, the director or head
+// probes rewrote them, to the backend in the headers uriHeader and
+// methodHeader, e.g. HeaderOriginalURI and HeaderOriginalMethod for auth
+// services or access logs. Values sent by the client are replaced, an
+// empty name does not send the value.
+func (r *ReverseProxy) SetOriginalRequestHeaders(uriHeader, methodHeader string) {
+	r.originalURIHeader, r.originalMethodHeader = uriHeader, methodHeader
+}
+
+// SetOriginalRequestHeaders sets the headers of the original URI and
+// method for all routes, see ReverseProxy.SetOriginalRequestHeaders.
+func (rt *Router) SetOriginalRequestHeaders(uriHeader, methodHeader string) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.originalURIHeader, rt.originalMethodHeader = uriHeader, methodHeader
+	// the routes have been compiled before
+	_ = rt.store(rt.loadTable().routes)
+}
+
+// originalRequest returns the URI and method of the request before the
+// proxy rewrites them, empty unless SetOriginalRequestHeaders is used.
+func (r *ReverseProxy) originalRequest(c *app.RequestContext) (uri, method string) {
+	if r.originalURIHeader != "" {
+		var ok bool
+		if uri, ok = c.Value(ContextKeyOriginalURI).(string); !ok {
+			uri = string(c.Request.URI().RequestURI())
+		}
+	}
+	if r.originalMethodHeader != "" {
+		method = string(c.Request.Header.Method())
+	}
+	return uri, method
+}
+
+// setOriginalRequestHeaders sets the values of originalRequest on req.
+func (r *ReverseProxy) setOriginalRequestHeaders(req *protocol.Request, uri, method string) {
+	if r.originalURIHeader != "" {
+		req.Header.Set(r.originalURIHeader, uri)
+	}
+	if r.originalMethodHeader != "" {
+		req.Header.Set(r.originalMethodHeader, method)
+	}
+}
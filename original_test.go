@@ -0,0 +1,96 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/server"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestOriginalRequestHeaders(t *testing.T) {
+	var uri, method, path string
+	proxy, err := NewReverseProxy("http://backend/base", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		uri = req.Header.Get(HeaderOriginalURI)
+		method = req.Header.Get(HeaderOriginalMethod)
+		path = string(req.URI().Path())
+		return nil
+	})))
+	assert.Nil(t, err)
+	proxy.SetStripPrefix("/api")
+	director := proxy.Director()
+	proxy.SetDirector(func(req *protocol.Request) {
+		director(req)
+		req.Header.SetMethod("POST")
+		req.URI().SetPath("/rewritten")
+	})
+
+	serve := func() {
+		ctx := app.NewContext(0)
+		ctx.Request.SetRequestURI("http://localhost/api/users?id=1")
+		ctx.Request.Header.Set(HeaderOriginalURI, "/spoofed")
+		proxy.ServeHTTP(context.Background(), ctx)
+	}
+	serve()
+	assert.DeepEqual(t, "/rewritten", path)
+	assert.DeepEqual(t, "/spoofed", uri)
+	assert.DeepEqual(t, "", method)
+
+	proxy.SetOriginalRequestHeaders(HeaderOriginalURI, HeaderOriginalMethod)
+	serve()
+	assert.DeepEqual(t, "/api/users?id=1", uri)
+	assert.DeepEqual(t, "GET", method)
+
+	// only the method
+	proxy.SetOriginalRequestHeaders("", "X-Method")
+	serve()
+	assert.DeepEqual(t, "/spoofed", uri)
+}
+
+func TestRouterOriginalRequestHeaders(t *testing.T) {
+	backend := server.New(server.WithHostPorts("127.0.0.1:10064"))
+	backend.Any("/*path", func(cc context.Context, ctx *app.RequestContext) {
+		ctx.String(200, "%s %s %s %s", ctx.Request.URI().RequestURI(), ctx.Request.Header.Get(HeaderOriginalMethod),
+			ctx.Request.Header.Get(HeaderOriginalURI), ctx.Request.Header.Get(HeaderForwardedPrefix))
+	})
+	go backend.Spin()
+	defer backend.Close()
+	time.Sleep(time.Second)
+
+	rt, err := NewRouter([]Route{
+		{Path: "/api/", Target: "http://127.0.0.1:10064/v1", StripPrefix: true},
+		{Path: "/users/:id", Target: "http://127.0.0.1:10064/people/:id"},
+	})
+	assert.Nil(t, err)
+	rt.SetOriginalRequestHeaders(HeaderOriginalURI, HeaderOriginalMethod)
+
+	for uri, want := range map[string]string{
+		"/api/items?page=2": "/v1/items?page=2 DELETE /api/items?page=2 /api",
+		"/users/7?full=1":   "/people/7?full=1 DELETE /users/7?full=1 ",
+	} {
+		ctx := app.NewContext(0)
+		ctx.Request.SetMethod("DELETE")
+		ctx.Request.SetRequestURI("http://localhost" + uri)
+		rt.ServeHTTP(context.Background(), ctx)
+		body, err := ctx.Response.BodyE()
+		assert.Nil(t, err)
+		assert.DeepEqual(t, want, string(body))
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"bytes"
+)
+
+// TrailingSlash is the policy for the trailing slash of forwarded paths.
+type TrailingSlash int
+
+const (
+	// TrailingSlashKeep forwards the path with or without trailing slash
+	// as requested, the default.
+	TrailingSlashKeep TrailingSlash = iota
+	// TrailingSlashAdd appends a slash to paths without one.
+	TrailingSlashAdd
+	// TrailingSlashRemove removes the trailing slash of paths other than "/".
+	TrailingSlashRemove
+)
+
+// PathNormalization configures how the forwarded path is normalized, see
+// ReverseProxy.SetPathNormalization.
+type PathNormalization struct {
+	// CollapseSlashes replaces runs of slashes with one, e.g. "/a//b" with
+	// "/a/b".
+	CollapseSlashes bool
+	// ResolveDots removes "." segments and resolves ".." segments like RFC
+	// 3986 section 5.2.4, also if the dots are percent-encoded.
+	ResolveDots bool
+	// TrailingSlash adds or removes the trailing slash.
+	TrailingSlash TrailingSlash
+}
+
+// SetPathNormalization normalizes the path of each request as set by n
+// before prefixes are stripped and the path is joined with the target. The
+// decoded path used by default already has its slashes collapsed and dots
+// resolved by the server, so CollapseSlashes and ResolveDots matter with
+// SetPreserveRawPath, whose path is otherwise forwarded verbatim; encoded
+// slashes such as "%2F" never separate segments there.
+func (r *ReverseProxy) SetPathNormalization(n PathNormalization) {
+	if n == (PathNormalization{}) {
+		r.pathNormalization = nil
+		return
+	}
+	r.pathNormalization = &n
+}
+
+// normalize returns path normalized as set by n, path itself if unchanged.
+func (n *PathNormalization) normalize(path []byte) []byte {
+	if len(path) == 0 || path[0] != '/' {
+		return path
+	}
+	var segments [][]byte
+	trailing := false
+	for rest := path[1:]; ; {
+		var seg []byte
+		i := bytes.IndexByte(rest, '/')
+		if i < 0 {
+			seg = rest
+		} else {
+			seg = rest[:i]
+		}
+		last := i < 0
+		if !last {
+			rest = rest[i+1:]
+		}
+		switch {
+		case last && len(seg) == 0:
+			trailing = true
+		case n.ResolveDots && isDotSegment(seg, 1):
+			trailing = last
+		case n.ResolveDots && isDotSegment(seg, 2):
+			if len(segments) > 0 {
+				segments = segments[:len(segments)-1]
+			}
+			trailing = last
+		case n.CollapseSlashes && len(seg) == 0:
+		default:
+			segments = append(segments, seg)
+		}
+		if last {
+			break
+		}
+	}
+	if len(segments) > 0 {
+		switch n.TrailingSlash {
+		case TrailingSlashAdd:
+			trailing = true
+		case TrailingSlashRemove:
+			trailing = false
+		}
+	}
+	out := make([]byte, 0, len(path)+1)
+	for _, seg := range segments {
+		out = append(out, '/')
+		out = append(out, seg...)
+	}
+	if trailing || len(segments) == 0 {
+		out = append(out, '/')
+	}
+	if bytes.Equal(out, path) {
+		return path
+	}
+	return out
+}
+
+// isDotSegment reports whether seg consists of n dots, each possibly
+// percent-encoded as "%2e".
+func isDotSegment(seg []byte, n int) bool {
+	for ; n > 0; n-- {
+		switch {
+		case len(seg) > 0 && seg[0] == '.':
+			seg = seg[1:]
+		case len(seg) > 2 && seg[0] == '%' && seg[1] == '2' && (seg[2] == 'e' || seg[2] == 'E'):
+			seg = seg[3:]
+		default:
+			return false
+		}
+	}
+	return len(seg) == 0
+}
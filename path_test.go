@@ -0,0 +1,89 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestPathNormalize(t *testing.T) {
+	collapse := PathNormalization{CollapseSlashes: true}
+	dots := PathNormalization{ResolveDots: true}
+	all := PathNormalization{CollapseSlashes: true, ResolveDots: true}
+	add := PathNormalization{TrailingSlash: TrailingSlashAdd}
+	remove := PathNormalization{TrailingSlash: TrailingSlashRemove}
+	for _, tt := range []struct {
+		n          PathNormalization
+		path, want string
+	}{
+		{collapse, "/a//b///c", "/a/b/c"},
+		{collapse, "//a/b//", "/a/b/"},
+		{collapse, "/a/../b", "/a/../b"},
+		{dots, "/a/./b/../c", "/a/c"},
+		{dots, "/a/b/..", "/a/"},
+		{dots, "/../../a", "/a"},
+		{dots, "/a/%2e%2E/b", "/b"},
+		{dots, "/a/.b/..c", "/a/.b/..c"},
+		{dots, "/a//b", "/a//b"},
+		{all, "/a//.//b/%2e/", "/a/b/"},
+		{all, "/a%2F..%2Fb", "/a%2F..%2Fb"},
+		{add, "/a/b", "/a/b/"},
+		{add, "/", "/"},
+		{remove, "/a/b/", "/a/b"},
+		{remove, "/", "/"},
+		{all, "", ""},
+	} {
+		assert.DeepEqual(t, tt.want, string(tt.n.normalize([]byte(tt.path))))
+	}
+}
+
+func TestSetPathNormalization(t *testing.T) {
+	var got string
+	proxy, err := NewReverseProxy("http://backend/base", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		got = string(req.URI().RequestURI())
+		return nil
+	})))
+	assert.Nil(t, err)
+
+	serve := func(uri string) string {
+		ctx := app.NewContext(0)
+		ctx.Request.SetRequestURI("http://localhost" + uri)
+		proxy.ServeHTTP(context.Background(), ctx)
+		return got
+	}
+
+	// the decoded path is normalized by hertz
+	assert.DeepEqual(t, "/base/a/c/", serve("/a//b/../c/"))
+
+	proxy.SetPreserveRawPath(true)
+	assert.DeepEqual(t, "/base/a//b/../c%2F/", serve("/a//b/../c%2F/"))
+
+	proxy.SetPathNormalization(PathNormalization{CollapseSlashes: true, ResolveDots: true, TrailingSlash: TrailingSlashRemove})
+	assert.DeepEqual(t, "/base/a/c%2F?x=1", serve("/a//b/../c%2F/?x=1"))
+	// dots are resolved before the prefix is stripped
+	handler := proxy.Handler(WithCallStripPrefix("/api"))
+	ctx := app.NewContext(0)
+	ctx.Request.SetRequestURI("http://localhost/api/../admin")
+	handler(context.Background(), ctx)
+	assert.DeepEqual(t, "/base/admin", got)
+
+	proxy.SetPathNormalization(PathNormalization{})
+	assert.DeepEqual(t, "/base/a//b", serve("/a//b"))
+}
@@ -14,7 +14,13 @@
 
 package reverseproxy
 
-import "time"
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
 
 type clientBehaviorType int
 
@@ -25,9 +31,13 @@ const (
 	doTimeout
 )
 
+// clientBehavior selects the client method used for the backend call,
+// only the field of its type is set.
 type clientBehavior struct {
 	clientBehaviorType clientBehaviorType
-	param              interface{}
+	deadline           time.Time
+	maxRedirects       int
+	timeout            time.Duration
 }
 
 func ClientDo() clientBehavior {
@@ -39,20 +49,65 @@ func ClientDo() clientBehavior {
 func ClientDoRedirects(param int) clientBehavior {
 	return clientBehavior{
 		clientBehaviorType: doRedirects,
-		param:              param,
+		maxRedirects:       param,
 	}
 }
 
 func ClientDoDeadline(param time.Time) clientBehavior {
 	return clientBehavior{
 		clientBehaviorType: doDeadline,
-		param:              param,
+		deadline:           param,
 	}
 }
 
 func ClientDoTimeout(param time.Duration) clientBehavior {
 	return clientBehavior{
 		clientBehaviorType: doTimeout,
-		param:              param,
+		timeout:            param,
+	}
+}
+
+func (cb clientBehavior) validate() error {
+	switch cb.clientBehaviorType {
+	case doDeadline:
+		if cb.deadline.IsZero() {
+			return errors.New("reverseproxy: deadline must be set")
+		}
+	case doRedirects:
+		if cb.maxRedirects < 0 {
+			return errors.New("reverseproxy: max redirects must not be negative")
+		}
+	case doTimeout:
+		if cb.timeout <= 0 {
+			return errors.New("reverseproxy: request timeout must be positive")
+		}
+	}
+	return nil
+}
+
+func (r *ReverseProxy) doClientBehavior(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+	start := time.Now()
+	return headerTimeoutError(r.callClient(ctx, req, resp), r.responseHeaderTimeout, start)
+}
+
+func (r *ReverseProxy) callClient(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+	cb := r.clientBehavior
+	switch cb.clientBehaviorType {
+	case doDeadline:
+		if d, ok := r.client.(deadlineDoer); ok {
+			return d.DoDeadline(ctx, req, resp, cb.deadline)
+		}
+		return doWithTimeout(ctx, r.client, req, resp, time.Until(cb.deadline))
+	case doRedirects:
+		// Doers without DoRedirects do not follow redirects
+		if d, ok := r.client.(redirectsDoer); ok {
+			return d.DoRedirects(ctx, req, resp, cb.maxRedirects)
+		}
+	case doTimeout:
+		if d, ok := r.client.(timeoutDoer); ok {
+			return d.DoTimeout(ctx, req, resp, cb.timeout)
+		}
+		return doWithTimeout(ctx, r.client, req, resp, cb.timeout)
 	}
+	return r.client.Do(ctx, req, resp)
 }
@@ -0,0 +1,264 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/client"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+// HeaderRules rewrite the headers of requests to the backend or of
+// responses to the client. Remove is applied first, then Set and Add.
+type HeaderRules struct {
+	Set    map[string]string `json:"set,omitempty" yaml:"set,omitempty"`
+	Add    map[string]string `json:"add,omitempty" yaml:"add,omitempty"`
+	Remove []string          `json:"remove,omitempty" yaml:"remove,omitempty"`
+}
+
+func (hr *HeaderRules) empty() bool {
+	return hr == nil || len(hr.Set) == 0 && len(hr.Add) == 0 && len(hr.Remove) == 0
+}
+
+func (hr *HeaderRules) applyRequest(h *protocol.RequestHeader) {
+	for _, k := range hr.Remove {
+		h.DelBytes(s2b(k))
+	}
+	for k, v := range hr.Set {
+		h.Set(k, v)
+	}
+	for k, v := range hr.Add {
+		h.Add(k, v)
+	}
+}
+
+func (hr *HeaderRules) applyResponse(h *protocol.ResponseHeader) {
+	for _, k := range hr.Remove {
+		h.Del(k)
+	}
+	for k, v := range hr.Set {
+		h.Set(k, v)
+	}
+	for k, v := range hr.Add {
+		h.Add(k, v)
+	}
+}
+
+// SetRequestHeaderRules rewrites the headers of requests to the backend,
+// after the director.
+func (r *ReverseProxy) SetRequestHeaderRules(rules HeaderRules) {
+	r.requestHeaders = &rules
+}
+
+// SetResponseHeaderRules rewrites the headers of backend responses, before
+// the ModifyResponse hooks.
+func (r *ReverseProxy) SetResponseHeaderRules(rules HeaderRules) {
+	r.responseHeaders = &rules
+}
+
+// TLSConfig configures TLS connections to https targets.
+type TLSConfig struct {
+	// ServerName defaults to the target host.
+	ServerName         string `json:"server_name,omitempty" yaml:"server_name,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty" yaml:"insecure_skip_verify,omitempty"`
+	// CAFile holds PEM certificates to verify the backend with instead of
+	// the system roots.
+	CAFile string `json:"ca_file,omitempty" yaml:"ca_file,omitempty"`
+	// CertFile and KeyFile hold a PEM client certificate and its key.
+	CertFile string `json:"cert_file,omitempty" yaml:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty" yaml:"key_file,omitempty"`
+}
+
+func (tc *TLSConfig) load() (*tls.Config, error) {
+	c := &tls.Config{ServerName: tc.ServerName, InsecureSkipVerify: tc.InsecureSkipVerify}
+	if tc.CAFile != "" {
+		pem, err := ioutil.ReadFile(tc.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("reverseproxy: no certificates in %s", tc.CAFile)
+		}
+	}
+	if tc.CertFile != "" || tc.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(tc.CertFile, tc.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
+
+// WebSocketConfig configures upgrade requests, e.g. websockets, see UpgradeOptions.
+type WebSocketConfig struct {
+	Disabled    bool     `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	DialTimeout Duration `json:"dial_timeout,omitempty" yaml:"dial_timeout,omitempty"`
+}
+
+// ProxyConfig is the declarative configuration of a ReverseProxy, see
+// NewFromConfig, e.g. in YAML
+//
+//	target: https://api:8443/v1
+//	timeout: 3s
+//	retries: 2
+//	request_headers:
+//	  set: {X-Env: prod}
+//	tls:
+//	  ca_file: /etc/proxy/ca.pem
+//	websocket:
+//	  dial_timeout: 1s
+//
+// Reload replaces the settings down to ResponseHeaders on a live proxy,
+// the remaining ones configure the client and are only read by NewFromConfig.
+type ProxyConfig struct {
+	// Name labels the traffic of the proxy, see SetName.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Target is the backend, see NewSingleHostReverseProxy.
+	Target string `json:"target" yaml:"target"`
+	// Timeout limits each backend call, 0 means no limit.
+	Timeout     Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Retries     int      `json:"retries,omitempty" yaml:"retries,omitempty"`
+	StripPrefix string   `json:"strip_prefix,omitempty" yaml:"strip_prefix,omitempty"`
+	AddPrefix   string   `json:"add_prefix,omitempty" yaml:"add_prefix,omitempty"`
+
+	RequestHeaders  HeaderRules `json:"request_headers,omitempty" yaml:"request_headers,omitempty"`
+	ResponseHeaders HeaderRules `json:"response_headers,omitempty" yaml:"response_headers,omitempty"`
+
+	// DialTimeout, MaxConnsPerHost, MaxIdleConnDuration and MaxConnWaitTimeout
+	// configure the client, 0 means the default of NewReverseProxy.
+	DialTimeout         Duration `json:"dial_timeout,omitempty" yaml:"dial_timeout,omitempty"`
+	MaxConnsPerHost     int      `json:"max_conns_per_host,omitempty" yaml:"max_conns_per_host,omitempty"`
+	MaxIdleConnDuration Duration `json:"max_idle_conn_duration,omitempty" yaml:"max_idle_conn_duration,omitempty"`
+	MaxConnWaitTimeout  Duration `json:"max_conn_wait_timeout,omitempty" yaml:"max_conn_wait_timeout,omitempty"`
+	DisableKeepAlive    bool     `json:"disable_keep_alive,omitempty" yaml:"disable_keep_alive,omitempty"`
+	TransferTrailer     bool     `json:"transfer_trailer,omitempty" yaml:"transfer_trailer,omitempty"`
+
+	TLS       *TLSConfig      `json:"tls,omitempty" yaml:"tls,omitempty"`
+	WebSocket WebSocketConfig `json:"websocket,omitempty" yaml:"websocket,omitempty"`
+}
+
+func (cfg *ProxyConfig) validate() error {
+	if cfg.Timeout < 0 || cfg.Retries < 0 {
+		return fmt.Errorf("reverseproxy: timeout and retries must not be negative")
+	}
+	return nil
+}
+
+// NewFromConfig returns a ReverseProxy configured by cfg, which is usually
+// read from a JSON or YAML file. opts are applied before cfg, e.g. to set
+// hooks which have no config representation. The client settings of cfg
+// are ignored if opts contain WithClient.
+func NewFromConfig(cfg ProxyConfig, opts ...ProxyOption) (*ReverseProxy, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.DialTimeout < 0 || cfg.MaxConnsPerHost < 0 || cfg.MaxIdleConnDuration < 0 ||
+		cfg.MaxConnWaitTimeout < 0 || cfg.WebSocket.DialTimeout < 0 {
+		return nil, fmt.Errorf("reverseproxy: client settings must not be negative")
+	}
+	var clientOpts []config.ClientOption
+	if cfg.DialTimeout > 0 {
+		clientOpts = append(clientOpts, client.WithDialTimeout(time.Duration(cfg.DialTimeout)))
+	}
+	if cfg.MaxConnsPerHost > 0 {
+		clientOpts = append(clientOpts, client.WithMaxConnsPerHost(cfg.MaxConnsPerHost))
+	}
+	if cfg.MaxIdleConnDuration > 0 {
+		clientOpts = append(clientOpts, client.WithMaxIdleConnDuration(time.Duration(cfg.MaxIdleConnDuration)))
+	}
+	if cfg.MaxConnWaitTimeout > 0 {
+		clientOpts = append(clientOpts, client.WithMaxConnWaitTimeout(time.Duration(cfg.MaxConnWaitTimeout)))
+	}
+	if cfg.DisableKeepAlive {
+		clientOpts = append(clientOpts, client.WithKeepAlive(false))
+	}
+	var tlsConfig *tls.Config
+	if cfg.TLS != nil {
+		var err error
+		if tlsConfig, err = cfg.TLS.load(); err != nil {
+			return nil, err
+		}
+		clientOpts = append(clientOpts, client.WithTLSConfig(tlsConfig))
+	}
+	opts = append(opts, WithClientOptions(clientOpts...), WithTransferTrailer(cfg.TransferTrailer))
+	r, err := NewReverseProxy(cfg.Target, opts...)
+	if err != nil {
+		return nil, err
+	}
+	r.SetUpgradeOptions(UpgradeOptions{
+		Disabled:    cfg.WebSocket.Disabled,
+		DialTimeout: time.Duration(cfg.WebSocket.DialTimeout),
+		TLSConfig:   tlsConfig,
+	})
+	r.applyConfig(&cfg)
+	return r, nil
+}
+
+// Reload atomically replaces the settings of cfg on a live proxy, e.g. on
+// SIGHUP. Requests in flight complete with the settings they started with,
+// new requests use cfg. The other settings, like hooks and the client, are
+// kept; they must not be changed with setters once Reload has been called.
+// Proxies cloned from r before do not follow the reloads, handlers of
+// Handler do. Rollback
+// restores the settings before the last Reload.
+func (r *ReverseProxy) Reload(cfg ProxyConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	c := r.Clone()
+	if err := c.SetTarget(cfg.Target); err != nil {
+		return err
+	}
+	c.applyConfig(&cfg)
+	switchMu.Lock()
+	defer switchMu.Unlock()
+	r.live.Store(&liveProxy{proxy: c, previous: r.current()})
+	return nil
+}
+
+// applyConfig applies the settings of cfg which Reload replaces, except the target.
+func (r *ReverseProxy) applyConfig(cfg *ProxyConfig) {
+	r.clientBehavior = r.baseBehavior
+	if cfg.Timeout > 0 {
+		r.clientBehavior = ClientDoTimeout(time.Duration(cfg.Timeout))
+	}
+	r.retries = cfg.Retries
+	r.SetName(cfg.Name)
+	r.SetStripPrefix(cfg.StripPrefix)
+	r.SetAddPrefix(cfg.AddPrefix)
+	r.SetRequestHeaderRules(cfg.RequestHeaders)
+	r.SetResponseHeaderRules(cfg.ResponseHeaders)
+}
+
+// serveReloaded serves the request with the proxy of the last Reload or
+// SwitchTarget, if any.
+func (r *ReverseProxy) serveReloaded(ctx context.Context, c *app.RequestContext) bool {
+	p := r.current()
+	if p == r {
+		return false
+	}
+	p.ServeHTTP(ctx, c)
+	return true
+}
@@ -0,0 +1,147 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"gopkg.in/yaml.v3"
+)
+
+func TestReverseProxyReload(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		called  []string
+		block   = make(chan struct{})
+		started = make(chan struct{})
+	)
+	proxy, _ := NewSingleHostReverseProxy("http://old/v1")
+	proxy.SetClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		if string(req.Header.Peek("X-Block")) == "1" {
+			close(started)
+			<-block
+		}
+		mu.Lock()
+		called = append(called, string(req.URI().FullURI())+" "+req.Header.Get("X-Env")+" "+req.Options().RequestTimeout().String())
+		mu.Unlock()
+		resp.Header.Set("Server-Timing", "db;dur=53")
+		return nil
+	}))
+
+	serve := func(uri string, block bool) *app.RequestContext {
+		ctx := app.NewContext(0)
+		ctx.Request.SetRequestURI(uri)
+		if block {
+			ctx.Request.Header.Set("X-Block", "1")
+		}
+		proxy.ServeHTTP(context.Background(), ctx)
+		return ctx
+	}
+
+	// a request in flight during Reload completes against the old target
+	done := make(chan struct{})
+	go func() {
+		serve("http://localhost/users", true)
+		close(done)
+	}()
+	<-started
+	assert.Nil(t, proxy.Reload(ProxyConfig{
+		Target:          "http://new/v2",
+		Timeout:         Duration(time.Second),
+		StripPrefix:     "/api",
+		RequestHeaders:  HeaderRules{Set: map[string]string{"X-Env": "prod"}, Remove: []string{"X-Block"}},
+		ResponseHeaders: HeaderRules{Remove: []string{"Server-Timing"}, Add: map[string]string{"X-Proxy": "hertz"}},
+	}))
+	ctx := serve("http://localhost/api/users", false)
+	close(block)
+	<-done
+	assert.DeepEqual(t, "", ctx.Response.Header.Get("Server-Timing"))
+	assert.DeepEqual(t, "hertz", ctx.Response.Header.Get("X-Proxy"))
+
+	// a reload replaces all settings of the previous one
+	assert.Nil(t, proxy.Reload(ProxyConfig{Target: "http://new/v3"}))
+	ctx = serve("http://localhost/users", false)
+	assert.DeepEqual(t, "db;dur=53", ctx.Response.Header.Get("Server-Timing"))
+
+	assert.NotNil(t, proxy.Reload(ProxyConfig{Target: "new:8080"}))
+	assert.NotNil(t, proxy.Reload(ProxyConfig{Target: "http://new", Retries: -1}))
+
+	assert.DeepEqual(t, []string{
+		"http://new/v2/users prod 1s",
+		"http://old/v1/users  0s",
+		"http://new/v3/users  0s",
+	}, called)
+	assert.DeepEqual(t, "http://old/v1", proxy.Target)
+}
+
+func TestNewFromConfig(t *testing.T) {
+	var cfg ProxyConfig
+	assert.Nil(t, yaml.Unmarshal([]byte(`
+target: http://backend/v1
+timeout: 2s
+retries: 1
+strip_prefix: /api
+request_headers:
+  set: {X-Env: prod}
+max_conns_per_host: 64
+websocket:
+  disabled: true
+`), &cfg))
+	assert.DeepEqual(t, Duration(2*time.Second), cfg.Timeout)
+	assert.DeepEqual(t, 64, cfg.MaxConnsPerHost)
+
+	var called []string
+	proxy, err := NewFromConfig(cfg, WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		called = append(called, string(req.URI().FullURI())+" "+req.Header.Get("X-Env")+" "+
+			req.Header.Get("Upgrade")+" "+req.Options().RequestTimeout().String())
+		return nil
+	})))
+	assert.Nil(t, err)
+	ctx := app.NewContext(0)
+	ctx.Request.SetRequestURI("http://localhost/api/ws")
+	ctx.Request.Header.Set("Connection", "Upgrade")
+	ctx.Request.Header.Set("Upgrade", "websocket")
+	proxy.ServeHTTP(context.Background(), ctx)
+	// upgrades are disabled, so the request goes through the client without Upgrade
+	assert.DeepEqual(t, []string{"http://backend/v1/ws prod  2s"}, called)
+
+	for _, cfg := range []ProxyConfig{
+		{Target: "backend:8080"},
+		{Target: "http://backend", Retries: -1},
+		{Target: "http://backend", MaxConnWaitTimeout: -1},
+		{Target: "https://backend", TLS: &TLSConfig{CAFile: "testdata/missing.pem"}},
+	} {
+		_, err = NewFromConfig(cfg)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestNewFromConfigKeepsClientBehavior(t *testing.T) {
+	proxy, err := NewFromConfig(ProxyConfig{Target: "http://backend"}, WithRequestTimeout(3*time.Second))
+	assert.Nil(t, err)
+	assert.DeepEqual(t, ClientDoTimeout(3*time.Second), proxy.current().clientBehavior)
+
+	assert.Nil(t, proxy.Reload(ProxyConfig{Target: "http://backend", Timeout: Duration(time.Second)}))
+	assert.DeepEqual(t, ClientDoTimeout(time.Second), proxy.current().clientBehavior)
+	// without Timeout, the behavior of the options is back
+	assert.Nil(t, proxy.Reload(ProxyConfig{Target: "http://other"}))
+	assert.DeepEqual(t, ClientDoTimeout(3*time.Second), proxy.current().clientBehavior)
+}
@@ -0,0 +1,108 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import "strings"
+
+// QueryMerge chooses how the query of the target and the query of the
+// request are combined, see ReverseProxy.SetQueryMerge. Parameter names
+// are compared as sent, without decoding.
+type QueryMerge int
+
+const (
+	// QueryAppend appends the query of the request to the query of the
+	// target, the default.
+	QueryAppend QueryMerge = iota
+	// QueryTargetWins drops the parameters of the request named like a
+	// parameter of the target.
+	QueryTargetWins
+	// QueryRequestWins drops the parameters of the target named like a
+	// parameter of the request.
+	QueryRequestWins
+	// QueryDedupe keeps the first parameter of each name, looking at the
+	// target before the request.
+	QueryDedupe
+)
+
+// SetQueryMerge sets how the query of the target and the query of the
+// request are combined when both have one.
+func (r *ReverseProxy) SetQueryMerge(merge QueryMerge) {
+	r.queryMerge = merge
+}
+
+// appendMergedQuery appends the queries of the target and of the request,
+// merged as set by merge, to dst.
+func appendMergedQuery(dst []byte, target, request string, merge QueryMerge) []byte {
+	start, sep := len(dst)+1, byte('?')
+	add := func(param string) {
+		dst = append(dst, sep)
+		dst = append(dst, param...)
+		sep = '&'
+	}
+	for q := target; q != ""; {
+		var param string
+		param, q = nextParam(q)
+		if param == "" {
+			continue
+		}
+		name := paramName(param)
+		if merge == QueryRequestWins && hasParam(request, name) ||
+			merge == QueryDedupe && len(dst) > start && hasParam(b2s(dst[start:]), name) {
+			continue
+		}
+		add(param)
+	}
+	for q := request; q != ""; {
+		var param string
+		param, q = nextParam(q)
+		if param == "" {
+			continue
+		}
+		name := paramName(param)
+		if merge == QueryTargetWins && hasParam(target, name) ||
+			merge == QueryDedupe && len(dst) > start && hasParam(b2s(dst[start:]), name) {
+			continue
+		}
+		add(param)
+	}
+	return dst
+}
+
+// nextParam splits the first parameter off the query q.
+func nextParam(q string) (param, rest string) {
+	if i := strings.IndexByte(q, '&'); i >= 0 {
+		return q[:i], q[i+1:]
+	}
+	return q, ""
+}
+
+func paramName(param string) string {
+	if i := strings.IndexByte(param, '='); i >= 0 {
+		return param[:i]
+	}
+	return param
+}
+
+// hasParam reports whether the query q has a parameter named name.
+func hasParam(q, name string) bool {
+	for q != "" {
+		var param string
+		param, q = nextParam(q)
+		if param != "" && paramName(param) == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestQueryMerge(t *testing.T) {
+	var got string
+	proxy, err := NewReverseProxy("http://backend/api?key=t&v=1", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		got = string(req.URI().QueryString())
+		return nil
+	})))
+	assert.Nil(t, err)
+
+	for _, tt := range []struct {
+		merge QueryMerge
+		query string
+		want  string
+	}{
+		{QueryAppend, "key=r&x=2", "key=t&v=1&key=r&x=2"},
+		{QueryTargetWins, "key=r&x=2", "key=t&v=1&x=2"},
+		{QueryRequestWins, "key=r&x=2", "v=1&key=r&x=2"},
+		{QueryDedupe, "key=r&x=2&x=3&v", "key=t&v=1&x=2"},
+		{QueryTargetWins, "", "key=t&v=1"},
+		{QueryRequestWins, "v=2", "key=t&v=2"},
+	} {
+		proxy.SetQueryMerge(tt.merge)
+		for _, assigned := range []bool{false, true} {
+			if assigned {
+				// parsed per request by JoinURLPath
+				proxy.Target = "http://backend/api/?key=t&v=1"
+			} else {
+				assert.Nil(t, proxy.SetTarget("http://backend/api?key=t&v=1"))
+			}
+			ctx := app.NewContext(0)
+			ctx.Request.SetRequestURI("http://localhost/users?" + tt.query)
+			proxy.ServeHTTP(context.Background(), ctx)
+			assert.DeepEqual(t, tt.want, got)
+		}
+	}
+
+	// without query of the target, duplicates of the request are dropped
+	assert.Nil(t, proxy.SetTarget("http://backend/api"))
+	proxy.SetQueryMerge(QueryDedupe)
+	ctx := app.NewContext(0)
+	ctx.Request.SetRequestURI("http://localhost/users?a=1&a=2&b=3")
+	proxy.ServeHTTP(context.Background(), ctx)
+	assert.DeepEqual(t, "a=1&b=3", got)
+}
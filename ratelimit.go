@@ -0,0 +1,231 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+// RateLimit allows Requests per Per on average, in bursts of up to Burst
+// requests. Burst 0 means Requests.
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+func (l RateLimit) validate() error {
+	if l.Requests <= 0 || l.Per <= 0 || l.Burst < 0 {
+		return errors.New("reverseproxy: rate limit requests and period must be positive")
+	}
+	return nil
+}
+
+func (l RateLimit) burst() int {
+	if l.Burst == 0 {
+		return l.Requests
+	}
+	return l.Burst
+}
+
+// RateLimitResult is the outcome of RateLimitStore.Take.
+type RateLimitResult struct {
+	Allowed bool
+	// Remaining is the number of requests allowed right now.
+	Remaining int
+	// RetryAfter is the time until the next request is allowed, if not Allowed.
+	RetryAfter time.Duration
+}
+
+// RateLimitStore holds the state of the rate limits by key, e.g. in memory
+// or, to share the limits between proxy instances, in Redis.
+type RateLimitStore interface {
+	// Take counts a request for key against limit.
+	Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
+}
+
+// RateLimiter is a middleware limiting the rate of requests per key, e.g.
+// per API key or tenant, answering requests over the limit with 429 Too
+// Many Requests and a Retry-After header:
+//
+//	rl, err := reverseproxy.NewRateLimiter(reverseproxy.HeaderKey("X-API-Key"), reverseproxy.RateLimit{Requests: 100, Per: time.Second})
+//	rl.SetKeyLimit("premium-key", reverseproxy.RateLimit{Requests: 1000, Per: time.Second})
+//	h.Use(rl.ServeHTTP)
+//
+// If the store fails, the request is let through.
+type RateLimiter struct {
+	key   func(ctx context.Context, c *app.RequestContext) string
+	limit RateLimit
+	store RateLimitStore
+
+	mu sync.RWMutex
+	// limits overrides limit by key
+	limits map[string]RateLimit
+	// logger is set by SetLogger
+	logger Logger
+}
+
+// NewRateLimiter returns a RateLimiter applying limit to each key returned
+// by key, in memory. Requests for which key returns "" are not limited.
+func NewRateLimiter(key func(ctx context.Context, c *app.RequestContext) string, limit RateLimit) (*RateLimiter, error) {
+	if err := limit.validate(); err != nil {
+		return nil, err
+	}
+	return &RateLimiter{
+		key:    key,
+		limit:  limit,
+		store:  NewMemoryRateLimitStore(),
+		limits: make(map[string]RateLimit),
+	}, nil
+}
+
+// HeaderKey is a key function of NewRateLimiter returning the value of
+// the header name, e.g. "X-API-Key" or "X-Tenant-ID".
+func HeaderKey(name string) func(ctx context.Context, c *app.RequestContext) string {
+	return func(ctx context.Context, c *app.RequestContext) string {
+		return string(c.Request.Header.Peek(name))
+	}
+}
+
+// SetStore replaces the in-memory store, it must be called before serving.
+func (rl *RateLimiter) SetStore(store RateLimitStore) {
+	rl.store = store
+}
+
+// SetKeyLimit sets the limit of key instead of the default one.
+func (rl *RateLimiter) SetKeyLimit(key string, limit RateLimit) error {
+	if err := limit.validate(); err != nil {
+		return err
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.limits[key] = limit
+	return nil
+}
+
+// RemoveKeyLimit makes key use the default limit again.
+func (rl *RateLimiter) RemoveKeyLimit(key string) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	delete(rl.limits, key)
+}
+
+func (rl *RateLimiter) keyLimit(key string) RateLimit {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	if limit, ok := rl.limits[key]; ok {
+		return limit
+	}
+	return rl.limit
+}
+
+// ServeHTTP passes the request on to the next handler unless its key is
+// over the limit.
+func (rl *RateLimiter) ServeHTTP(ctx context.Context, c *app.RequestContext) {
+	key := rl.key(ctx, c)
+	if key == "" {
+		c.Next(ctx)
+		return
+	}
+	if takeRateLimit(ctx, c, rl.store, key, rl.keyLimit(key), rl.logger) {
+		c.Next(ctx)
+	}
+}
+
+// takeRateLimit counts the request of c for key against limit in store,
+// setting the rate limit headers. It aborts with 429 and returns false if
+// the request is over the limit. If the store fails, the request is let
+// through.
+func takeRateLimit(ctx context.Context, c *app.RequestContext, store RateLimitStore, key string, limit RateLimit, logger Logger) bool {
+	res, err := store.Take(ctx, key, limit)
+	if err != nil {
+		orHlog(logger).Errorf(ctx, "HERTZ: rate limit store error: %v", err)
+		return true
+	}
+	c.Response.Header.Set("X-RateLimit-Limit", strconv.Itoa(limit.burst()))
+	c.Response.Header.Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	if !res.Allowed {
+		c.Response.Header.Set("Retry-After", strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds()))))
+		c.AbortWithStatus(consts.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// tokenBucket is the state of a key in a MemoryRateLimitStore.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	// full is when the bucket is full again, so it can be dropped
+	full time.Time
+}
+
+// MemoryRateLimitStore keeps a token bucket per key in memory. Buckets
+// which are full again are dropped from time to time.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// NewMemoryRateLimitStore returns an empty MemoryRateLimitStore.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*tokenBucket), lastSweep: time.Now()}
+}
+
+// sweepInterval is how often full buckets are dropped.
+const sweepInterval = time.Minute
+
+// Take implements RateLimitStore.
+func (s *MemoryRateLimitStore) Take(_ context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	now := time.Now()
+	rate := float64(limit.Requests) / limit.Per.Seconds() // tokens per second
+	burst := float64(limit.burst())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) > sweepInterval {
+		for k, b := range s.buckets {
+			if now.After(b.full) {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	b := s.buckets[key]
+	if b == nil {
+		b = &tokenBucket{tokens: burst, last: now}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	res := RateLimitResult{Allowed: b.tokens >= 1}
+	if res.Allowed {
+		b.tokens--
+	} else {
+		res.RetryAfter = time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	res.Remaining = int(b.tokens)
+	b.full = now.Add(time.Duration((burst - b.tokens) / rate * float64(time.Second)))
+	return res, nil
+}
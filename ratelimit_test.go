@@ -0,0 +1,94 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+)
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, RateLimit) (RateLimitResult, error) {
+	return RateLimitResult{}, errors.New("store down")
+}
+
+func TestRateLimiter(t *testing.T) {
+	rl, err := NewRateLimiter(HeaderKey("X-API-Key"), RateLimit{Requests: 2, Per: time.Minute})
+	assert.Nil(t, err)
+	assert.Nil(t, rl.SetKeyLimit("premium", RateLimit{Requests: 10, Per: time.Minute}))
+	serve := func(key string) *app.RequestContext {
+		c := app.NewContext(0)
+		if key != "" {
+			c.Request.Header.Set("X-API-Key", key)
+		}
+		rl.ServeHTTP(context.Background(), c)
+		return c
+	}
+
+	for i := 0; i < 2; i++ {
+		c := serve("a")
+		assert.False(t, c.IsAborted())
+		assert.DeepEqual(t, "2", c.Response.Header.Get("X-RateLimit-Limit"))
+	}
+	c := serve("a")
+	assert.True(t, c.IsAborted())
+	assert.DeepEqual(t, 429, c.Response.StatusCode())
+	assert.DeepEqual(t, "0", c.Response.Header.Get("X-RateLimit-Remaining"))
+	assert.DeepEqual(t, "30", c.Response.Header.Get("Retry-After"))
+
+	// keys are limited independently
+	assert.False(t, serve("b").IsAborted())
+	for i := 0; i < 10; i++ {
+		assert.False(t, serve("premium").IsAborted())
+	}
+	assert.True(t, serve("premium").IsAborted())
+	// requests without key are not limited
+	for i := 0; i < 5; i++ {
+		assert.False(t, serve("").IsAborted())
+	}
+
+	rl.SetStore(failingStore{})
+	assert.False(t, serve("a").IsAborted())
+
+	_, err = NewRateLimiter(HeaderKey("X-API-Key"), RateLimit{Requests: 1})
+	assert.NotNil(t, err)
+	assert.NotNil(t, rl.SetKeyLimit("x", RateLimit{Per: time.Second}))
+}
+
+func TestMemoryRateLimitStoreRefill(t *testing.T) {
+	s := NewMemoryRateLimitStore()
+	limit := RateLimit{Requests: 100, Per: time.Second, Burst: 1}
+	res, _ := s.Take(context.Background(), "k", limit)
+	assert.True(t, res.Allowed)
+	res, _ = s.Take(context.Background(), "k", limit)
+	assert.False(t, res.Allowed)
+	assert.True(t, res.RetryAfter > 0 && res.RetryAfter <= 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	res, _ = s.Take(context.Background(), "k", limit)
+	assert.True(t, res.Allowed)
+
+	// full buckets are dropped
+	s.lastSweep = time.Now().Add(-2 * sweepInterval)
+	time.Sleep(20 * time.Millisecond)
+	_, _ = s.Take(context.Background(), "other", limit)
+	_, ok := s.buckets["k"]
+	assert.False(t, ok)
+}
@@ -0,0 +1,239 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/network"
+	"github.com/cloudwego/hertz/pkg/network/standard"
+)
+
+// Resolver resolves the host names of backends to addresses. *net.Resolver
+// implements it, e.g. with a Dial function querying other DNS servers.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) (addrs []string, err error)
+}
+
+// StaticResolver resolves the hosts in the map to their addresses, like
+// /etc/hosts or a stub in tests, and other hosts with net.DefaultResolver.
+type StaticResolver map[string][]string
+
+func (s StaticResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if addrs, ok := s[host]; ok {
+		return addrs, nil
+	}
+	return net.DefaultResolver.LookupHost(ctx, host)
+}
+
+// WithResolver makes the proxy resolve backend hosts with res instead of
+// the system resolver, both in the client created by NewReverseProxy, whose
+// dialer it replaces, and for upgrade requests. The addresses are tried in
+// order until one accepts the connection.
+func WithResolver(res Resolver) ProxyOption {
+	return func(o *ProxyOptions) {
+		o.Resolver = res
+	}
+}
+
+// DefaultHappyEyeballsDelay is the delay after which the next address of
+// a backend is dialed while the previous attempt is pending, the
+// Connection Attempt Delay recommended by RFC 8305.
+const DefaultHappyEyeballsDelay = 250 * time.Millisecond
+
+// WithHappyEyeballs makes the proxy resolve backend hosts itself, with the
+// resolver set by WithResolver or the system one, and race connections to
+// their addresses per RFC 8305: IPv6 and IPv4 addresses are interleaved and
+// the next one is dialed after delay, or as soon as the previous attempt
+// failed, so that a broken address family costs delay rather than the dial
+// timeout. The first connection established is used. A delay of 0 means
+// DefaultHappyEyeballsDelay. Hosts resolved by WithResolver are always
+// raced, with DefaultHappyEyeballsDelay unless delay is given here.
+func WithHappyEyeballs(delay time.Duration) ProxyOption {
+	return func(o *ProxyOptions) {
+		if delay <= 0 {
+			delay = DefaultHappyEyeballsDelay
+		}
+		o.HappyEyeballsDelay = delay
+	}
+}
+
+// resolvingDialer resolves host names with a Resolver before dialing,
+// racing the addresses.
+type resolvingDialer struct {
+	network.Dialer
+	resolver Resolver
+	// delay is the Happy Eyeballs delay, DefaultHappyEyeballsDelay if 0
+	delay time.Duration
+}
+
+func newResolvingDialer(res Resolver) *resolvingDialer {
+	return &resolvingDialer{Dialer: standard.NewDialer(), resolver: res}
+}
+
+func (d *resolvingDialer) DialConnection(n, address string, timeout time.Duration, tlsConfig *tls.Config) (network.Conn, error) {
+	conn, err := d.dial(address, timeout, func(addr string, timeout time.Duration) (io.Closer, error) {
+		conn, err := d.Dialer.DialConnection(n, addr, timeout, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		return conn, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conn.(network.Conn), nil
+}
+
+func (d *resolvingDialer) DialTimeout(n, address string, timeout time.Duration, tlsConfig *tls.Config) (net.Conn, error) {
+	conn, err := d.dial(address, timeout, func(addr string, timeout time.Duration) (io.Closer, error) {
+		conn, err := d.Dialer.DialTimeout(n, addr, timeout, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		return conn, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conn.(net.Conn), nil
+}
+
+// dial resolves the host of address and races dial with its addresses,
+// sharing timeout between lookup and dials.
+func (d *resolvingDialer) dial(address string, timeout time.Duration, dial func(addr string, timeout time.Duration) (io.Closer, error)) (io.Closer, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) != nil {
+		return dial(address, timeout)
+	}
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	deadline := time.Now().Add(timeout)
+	if timeout > 0 {
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+	}
+	addrs, err := d.resolver.LookupHost(ctx, host)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("reverseproxy: no addresses for host %q", host)
+	}
+	addrs = interleaveFamilies(addrs)
+
+	type attempt struct {
+		conn io.Closer
+		err  error
+	}
+	delay := d.delay
+	if delay <= 0 {
+		delay = DefaultHappyEyeballsDelay
+	}
+	// buffered so that the attempts losing the race end
+	attempts := make(chan attempt, len(addrs))
+	next, pending := 0, 0
+	start := func() bool {
+		left := timeout
+		if timeout > 0 {
+			if left = time.Until(deadline); left <= 0 {
+				return false
+			}
+		}
+		addr := net.JoinHostPort(addrs[next], port)
+		next++
+		pending++
+		go func() {
+			conn, err := dial(addr, left)
+			attempts <- attempt{conn: conn, err: err}
+		}()
+		return true
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	started := start()
+	for pending > 0 {
+		var fallback <-chan time.Time
+		if started && next < len(addrs) {
+			fallback = timer.C
+		}
+		select {
+		case a := <-attempts:
+			pending--
+			if a.err == nil {
+				go func(pending int) {
+					for ; pending > 0; pending-- {
+						if a := <-attempts; a.err == nil {
+							a.conn.Close()
+						}
+					}
+				}(pending)
+				return a.conn, nil
+			}
+			err = a.err
+		case <-fallback:
+		}
+		if started && next < len(addrs) {
+			started = start()
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(delay)
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("reverseproxy: dialing %s timed out", address)
+	}
+	return nil, err
+}
+
+// interleaveFamilies orders addrs alternating between IPv6 and IPv4,
+// starting with the family of the first one, as RFC 8305 recommends.
+func interleaveFamilies(addrs []string) []string {
+	var first, second []string
+	firstIsV4 := isIPv4(addrs[0])
+	for _, addr := range addrs {
+		if isIPv4(addr) == firstIsV4 {
+			first = append(first, addr)
+		} else {
+			second = append(second, addr)
+		}
+	}
+	if len(second) == 0 {
+		return addrs
+	}
+	interleaved := make([]string, 0, len(addrs))
+	for i := 0; i < len(first) || i < len(second); i++ {
+		if i < len(first) {
+			interleaved = append(interleaved, first[i])
+		}
+		if i < len(second) {
+			interleaved = append(interleaved, second[i])
+		}
+	}
+	return interleaved
+}
+
+func isIPv4(addr string) bool {
+	ip := net.ParseIP(addr)
+	return ip != nil && ip.To4() != nil
+}
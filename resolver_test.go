@@ -0,0 +1,159 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/server"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/network"
+)
+
+func TestWithResolver(t *testing.T) {
+	backend := server.New(server.WithHostPorts("127.0.0.1:10053"))
+	backend.GET("/hello", func(c context.Context, ctx *app.RequestContext) {
+		ctx.String(200, "hello from %s", ctx.Request.Host())
+	})
+	go backend.Spin()
+	time.Sleep(time.Second)
+
+	resolver := StaticResolver{
+		"backend.test": {"127.0.0.1"},
+		// nothing listens on 127.0.0.2, the next address is tried
+		"fallback.test": {"127.0.0.2", "127.0.0.1"},
+		"empty.test":    {},
+	}
+	for _, tt := range []struct {
+		host string
+		code int
+		body string
+	}{
+		{host: "backend.test", code: 200, body: "hello from backend.test:10053"},
+		{host: "fallback.test", code: 200, body: "hello from fallback.test:10053"},
+		{host: "empty.test", code: 502},
+	} {
+		proxy, err := NewReverseProxy("http://"+tt.host+":10053", WithResolver(resolver))
+		assert.Nil(t, err)
+		ctx := app.NewContext(0)
+		ctx.Request.SetRequestURI("http://localhost/hello")
+		proxy.ServeHTTP(context.Background(), ctx)
+		assert.DeepEqual(t, tt.code, ctx.Response.StatusCode())
+		if tt.code == 200 {
+			assert.DeepEqual(t, tt.body, string(ctx.Response.Body()))
+		}
+	}
+}
+
+func TestInterleaveFamilies(t *testing.T) {
+	assert.DeepEqual(t, []string{"::1", "10.0.0.1", "::2", "10.0.0.2", "::3"},
+		interleaveFamilies([]string{"::1", "::2", "::3", "10.0.0.1", "10.0.0.2"}))
+	assert.DeepEqual(t, []string{"10.0.0.1", "::1", "10.0.0.2"},
+		interleaveFamilies([]string{"10.0.0.1", "10.0.0.2", "::1"}))
+	assert.DeepEqual(t, []string{"10.0.0.1", "10.0.0.2"}, interleaveFamilies([]string{"10.0.0.1", "10.0.0.2"}))
+}
+
+// familyDialer fails to connect to IPv6 addresses after hang, like a
+// broken IPv6 route, and connects to IPv4 ones unless they are refused.
+type familyDialer struct {
+	network.Dialer
+	hang    time.Duration
+	refused string
+
+	mu     sync.Mutex
+	dialed []string
+	closed int
+}
+
+type closeCounter struct {
+	net.Conn
+	d *familyDialer
+}
+
+func (c *closeCounter) Close() error {
+	c.d.mu.Lock()
+	c.d.closed++
+	c.d.mu.Unlock()
+	return c.Conn.Close()
+}
+
+func (d *familyDialer) DialTimeout(n, address string, timeout time.Duration, tlsConfig *tls.Config) (net.Conn, error) {
+	d.mu.Lock()
+	d.dialed = append(d.dialed, address)
+	d.mu.Unlock()
+	host, _, _ := net.SplitHostPort(address)
+	if !isIPv4(host) {
+		time.Sleep(d.hang)
+		return nil, errors.New("network unreachable")
+	}
+	if host == d.refused {
+		return nil, errors.New("connection refused")
+	}
+	conn, _ := net.Pipe()
+	return &closeCounter{Conn: conn, d: d}, nil
+}
+
+func TestHappyEyeballs(t *testing.T) {
+	res := StaticResolver{
+		"dual.test":    {"2001:db8::1", "2001:db8::2", "192.0.2.1", "192.0.2.2"},
+		"v4-only.test": {"192.0.2.1", "192.0.2.2"},
+	}
+
+	// the IPv4 address is dialed after the delay instead of the timeout
+	fd := &familyDialer{hang: time.Second}
+	d := &resolvingDialer{Dialer: fd, resolver: res, delay: 20 * time.Millisecond}
+	start := time.Now()
+	conn, err := d.DialTimeout("tcp", "dual.test:80", 5*time.Second, nil)
+	assert.Nil(t, err)
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+	conn.Close()
+	assert.DeepEqual(t, []string{"[2001:db8::1]:80", "192.0.2.1:80"}, fd.dialed)
+
+	// failed attempts start the next one right away
+	fd = &familyDialer{refused: "192.0.2.1"}
+	d = &resolvingDialer{Dialer: fd, resolver: res, delay: time.Second}
+	start = time.Now()
+	conn, err = d.DialTimeout("tcp", "dual.test:80", 5*time.Second, nil)
+	assert.Nil(t, err)
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+	conn.Close()
+	assert.DeepEqual(t, 4, len(fd.dialed))
+	assert.DeepEqual(t, "192.0.2.2:80", fd.dialed[3])
+
+	fd = &familyDialer{refused: "192.0.2.1"}
+	d = &resolvingDialer{Dialer: fd, resolver: StaticResolver{"v4-only.test": {"192.0.2.1"}}}
+	_, err = d.DialTimeout("tcp", "v4-only.test:80", time.Second, nil)
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "refused"))
+
+	// connections losing the race are closed
+	fd = &familyDialer{}
+	d = &resolvingDialer{Dialer: fd, resolver: res, delay: time.Nanosecond}
+	conn, err = d.DialTimeout("tcp", "v4-only.test:80", time.Second, nil)
+	assert.Nil(t, err)
+	time.Sleep(50 * time.Millisecond)
+	fd.mu.Lock()
+	assert.DeepEqual(t, len(fd.dialed)-1, fd.closed)
+	fd.mu.Unlock()
+	conn.Close()
+}
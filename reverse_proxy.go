@@ -28,25 +28,49 @@ import (
 	"context"
 	"fmt"
 	"net"
-	"net/textproto"
-	"reflect"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
-	"unsafe"
 
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/app/client"
+	"github.com/cloudwego/hertz/pkg/common/bytebufferpool"
 	"github.com/cloudwego/hertz/pkg/common/config"
-	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/network"
 	"github.com/cloudwego/hertz/pkg/protocol"
 	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/cloudwego/hertz/pkg/protocol/suite"
+)
+
+// Keys of the proxy metadata stored in the app.RequestContext once the
+// backend was called, e.g. for logging middleware running after the proxy.
+const (
+	// ContextKeyUpstream is the URI of the backend request, a string.
+	ContextKeyUpstream = "reverseproxy.upstream"
+	// ContextKeyAttempts is the number of backend calls, an int, see SetRetries.
+	ContextKeyAttempts = "reverseproxy.attempts"
+	// ContextKeyUpstreamLatency is the time.Duration of the backend calls,
+	// until the response header was read if the body is streamed.
+	ContextKeyUpstreamLatency = "reverseproxy.upstream_latency"
+	// ContextKeyTarget is set by earlier middleware to forward a request to
+	// another target than the configured Target, a string or a fmt.Stringer
+	// such as *url.URL. It is honored by the director of
+	// NewSingleHostReverseProxy only.
+	ContextKeyTarget = "reverseproxy.target"
 )
 
 type ReverseProxy struct {
-	client *client.Client
+	client Doer
+
+	// name is set by SetName
+	name string
 
 	clientBehavior clientBehavior
+	// baseBehavior is the client behavior set by options or
+	// SetClientBehavior, which configs without Timeout keep
+	baseBehavior clientBehavior
 
 	// target is set as a reverse proxy address
 	Target string
@@ -57,6 +81,12 @@ type ReverseProxy struct {
 	// saveOriginResponse is whether to save the original response header
 	saveOriginResHeader bool
 
+	// stripPrefix is removed from the request path before director is called
+	stripPrefix string
+
+	// addPrefix is prepended to the request path before director is called
+	addPrefix string
+
 	// director must be a function which modifies the request
 	// into a new request. Its response is then redirected
 	// back to the original client unmodified.
@@ -64,6 +94,9 @@ type ReverseProxy struct {
 	// after returning.
 	director func(*protocol.Request)
 
+	// defaultDirector is set while director is singleHostDirector
+	defaultDirector bool
+
 	// modifyResponse is an optional function that modifies the
 	// Response from the backend. It is called if the backend
 	// returns a response at all, with any HTTP status code.
@@ -75,12 +108,117 @@ type ReverseProxy struct {
 	// implementation is used.
 	modifyResponse func(*protocol.Response) error
 
+	// modifyResponseWithContext is like modifyResponse with access to
+	// the request context, it is called after modifyResponse.
+	modifyResponseWithContext func(ctx context.Context, c *app.RequestContext, resp *protocol.Response) error
+
 	// errorHandler is an optional function that handles errors
 	// reaching the backend or errors from modifyResponse.
 	//
-	// If nil, the default is to log the provided error and return
-	// a 502 Status Bad Gateway response.
+	// If nil, the default is to answer with the status code of the
+	// kind of error, see SetErrorStatusCodes.
 	errorHandler func(*app.RequestContext, error)
+
+	// retries is the number of times failed idempotent requests are retried
+	retries int
+
+	// proxyErrorHandler takes precedence over errorHandler, see SetProxyErrorHandler
+	proxyErrorHandler func(context.Context, *app.RequestContext, *ProxyError)
+	// errorStatus is set by SetErrorStatusCodes
+	errorStatus map[ErrorKind]int
+
+	// responseTransformers are applied in order to the response body
+	// after modifyResponse, streaming if the body is a stream.
+	responseTransformers []TransformerFactory
+	// sse handles event streams if not nil, see SetSSE
+	sse *SSEOptions
+	// upgrade configures upgrade requests, see SetUpgradeOptions
+	upgrade *UpgradeOptions
+
+	// target is Target parsed by NewSingleHostReverseProxy
+	target *proxyTarget
+	// preserveRawPath is set by SetPreserveRawPath
+	preserveRawPath bool
+	// pathNormalization is set by SetPathNormalization
+	pathNormalization *PathNormalization
+	// queryMerge is set by SetQueryMerge
+	queryMerge QueryMerge
+	// schemeFunc is set by SetSchemeFunc
+	schemeFunc SchemeFunc
+	// targetFunc is set by SetTargetFunc
+	targetFunc func(ctx context.Context, c *app.RequestContext) (string, error)
+	// balancer is set by SetBalancer
+	balancer Balancer
+
+	// bufferPool provides the copy buffers, see SetBufferPool
+	bufferPool BufferPool
+	// resolver and happyEyeballsDelay are set by WithResolver and
+	// WithHappyEyeballs
+	resolver           Resolver
+	happyEyeballsDelay time.Duration
+
+	requestHeaders  *HeaderRules
+	responseHeaders *HeaderRules
+
+	// maxRequestBodySize is set by SetMaxRequestBodySize
+	maxRequestBodySize int
+	// dropBodyMethods is set by SetDropRequestBody
+	dropBodyMethods []string
+	// multipartInspector is set by SetMultipartInspector
+	multipartInspector MultipartInspector
+	// graphQL is set by SetGraphQL
+	graphQL *GraphQLOptions
+	// grpcWeb is set by SetGRPCWeb
+	grpcWeb bool
+	// statusRewrite and statusRewriteFunc are set by SetStatusRewrite and
+	// SetStatusRewriteFunc
+	statusRewrite     map[int]int
+	statusRewriteFunc func(ctx context.Context, c *app.RequestContext, status int) int
+	// logger is set by SetLogger
+	logger Logger
+	// metrics is set by SetMetrics
+	metrics *Metrics
+	// attemptHeaders is set by SetAttemptHeaders
+	attemptHeaders bool
+	// originalURIHeader and originalMethodHeader are set by
+	// SetOriginalRequestHeaders
+	originalURIHeader    string
+	originalMethodHeader string
+	// cookieRewrite and cookieNames, the names of clients to the names of
+	// the backend, are set by SetCookieRewrite
+	cookieRewrite *CookieRewrite
+	cookieNames   map[string]string
+	// onResponse is set by SetOnResponse
+	onResponse func(ctx context.Context, c *app.RequestContext, t Transfer)
+	// transferred counts the bytes of routes, see UpstreamStats
+	transferred func(t Transfer)
+	// headProbe is set by SetHeadProbes
+	headProbe func(c *app.RequestContext) bool
+	// corsPreflight is set by SetCORSPreflight
+	corsPreflight *corsPolicy
+	// corsHeaders is set by SetCORSHeaders
+	corsHeaders *corsPolicy
+
+	// maxResponseHeaderCount and maxResponseHeaderBytes are set by SetMaxResponseHeaders
+	maxResponseHeaderCount int
+	maxResponseHeaderBytes int
+
+	// bandwidth limits the rate of response bodies, see SetBandwidthLimit
+	bandwidth *bandwidthLimit
+
+	// responseHeaderTimeout is set by WithResponseHeaderTimeout
+	responseHeaderTimeout time.Duration
+
+	// coalesceKey and coalescer are set by SetCoalescing
+	coalesceKey func(req *protocol.Request) string
+	coalescer   *coalescer
+
+	// faults holds the *Faults set by SetFaults
+	faults atomic.Value
+
+	// live holds the *liveProxy serving requests since the last Reload
+	// or SwitchTarget
+	live atomic.Value
 }
 
 // Hop-by-hop headers. These are removed when sent to the backend.
@@ -110,13 +248,22 @@ var hopHeaders = []string{
 //
 // When passing config.ClientOption it will initialize a local client.Client instance.
 // Using ReverseProxy.SetClient if there is need for shared customized client.Client instance.
+//
+// A target like "unix:///var/run/app.sock" forwards to the unix domain socket
+// at that path, with "localhost" or the value of a "host" query argument, e.g.
+// "unix:///var/run/app.sock?host=app.local", as Host header. The client dials
+// the socket, so SetClient must not be used for such targets.
+//
+// The target must be an absolute http or https URL with a host, otherwise an
+// error is returned. Its scheme and host are lower-cased.
 func NewSingleHostReverseProxy(target string, options ...config.ClientOption) (*ReverseProxy, error) {
-	r := &ReverseProxy{
-		Target: target,
-		director: func(req *protocol.Request) {
-			req.SetRequestURI(b2s(JoinURLPath(req, target)))
-			req.Header.SetHostBytes(req.URI().Host())
-		},
+	if socket, httpTarget, ok := parseUnixTarget(target); ok {
+		target = httpTarget
+		options = append(options[:len(options):len(options)], withUnixSocket(socket))
+	}
+	r, err := newSingleHostReverseProxy(target)
+	if err != nil {
+		return nil, err
 	}
 	c, err := client.NewClient(options...)
 	if err != nil {
@@ -126,76 +273,353 @@ func NewSingleHostReverseProxy(target string, options ...config.ClientOption) (*
 	return r, nil
 }
 
+// newSingleHostReverseProxy is NewSingleHostReverseProxy without a client,
+// for callers sharing a client between proxies.
+func newSingleHostReverseProxy(target string) (*ReverseProxy, error) {
+	t, err := parseTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	r := &ReverseProxy{Target: t.raw, defaultDirector: true, target: t}
+	r.director = r.singleHostDirector
+	return r, nil
+}
+
+// singleHostDirector is the director of NewSingleHostReverseProxy.
+func (r *ReverseProxy) singleHostDirector(req *protocol.Request) {
+	if t := r.target; t != nil && t.raw == r.Target {
+		var scratch [256]byte
+		req.SetRequestURI(b2s(t.appendURI(scratch[:0], req, r.requestPath(req), r.queryMerge)))
+		req.Header.SetHost(t.host)
+		return
+	}
+	// Target was changed after construction
+	directTo(req, r.Target, r.requestPath(req), r.queryMerge)
+}
+
+// requestPath returns the path of req to join with the target: decoded, or
+// as sent by the client if SetPreserveRawPath is set, normalized as set by
+// SetPathNormalization.
+func (r *ReverseProxy) requestPath(req *protocol.Request) []byte {
+	path := req.URI().Path()
+	if r.preserveRawPath {
+		path = req.URI().PathOriginal()
+	}
+	if r.pathNormalization != nil {
+		path = r.pathNormalization.normalize(path)
+	}
+	return path
+}
+
+// SetPreserveRawPath forwards the path as sent by the client, keeping its
+// percent-encoding, e.g. "%2F" or "%20", instead of the decoded and
+// normalized path, which may be encoded differently or change meaning on
+// the way to the backend. Prefixes set by the Handler options are matched
+// against the raw path too.
+func (r *ReverseProxy) SetPreserveRawPath(b bool) {
+	r.preserveRawPath = b
+}
+
+func directTo(req *protocol.Request, target string, path []byte, merge QueryMerge) {
+	req.SetRequestURI(b2s(joinURLPath(req, target, path, merge)))
+	uri := req.URI()
+	if bytes.IndexByte(uri.Host(), '%') < 0 {
+		req.Header.SetHostBytes(uri.Host())
+		return
+	}
+	// an IPv6 literal with zone
+	host := unescapeZone(uri.Host())
+	uri.SetHostBytes(host)
+	req.Header.SetHost(stripZone(string(host)))
+}
+
+// targetOverride returns the target set under ContextKeyTarget, if any.
+func targetOverride(ctx *app.RequestContext) string {
+	switch v := ctx.Value(ContextKeyTarget).(type) {
+	case string:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	}
+	return ""
+}
+
+// SetTarget validates and parses target like NewSingleHostReverseProxy, so
+// that the default director forwards to it without parsing it per request.
+// Assigning Target directly works too, but parses it for each request.
+func (r *ReverseProxy) SetTarget(target string) error {
+	t, err := parseTarget(target)
+	if err != nil {
+		return err
+	}
+	r.Target, r.target = t.raw, t
+	return nil
+}
+
+// Clone returns a copy of r sharing its client, e.g. to derive proxies
+// for several routes from one configured proxy. The director, Target and
+// hooks of the copy can be changed without affecting r. If r uses the
+// director of NewSingleHostReverseProxy, the copy forwards to its own Target.
+func (r *ReverseProxy) Clone() *ReverseProxy {
+	c := *r
+	c.live = atomic.Value{}
+	c.responseTransformers = append([]TransformerFactory(nil), r.responseTransformers...)
+	if r.sse != nil {
+		sse := *r.sse
+		c.sse = &sse
+	}
+	if r.upgrade != nil {
+		upgrade := *r.upgrade
+		c.upgrade = &upgrade
+	}
+	if c.defaultDirector {
+		c.director = c.singleHostDirector
+	}
+	return &c
+}
+
 func JoinURLPath(req *protocol.Request, target string) (path []byte) {
-	aslash := req.URI().Path()[0] == '/'
-	var bslash bool
+	return joinURLPath(req, target, req.URI().Path(), QueryAppend)
+}
+
+// joinURLPath is JoinURLPath with reqPath as path of req and the queries
+// merged as set by merge.
+func joinURLPath(req *protocol.Request, target string, reqPath []byte, merge QueryMerge) (path []byte) {
+	var host []byte
+	var bslash, sep bool
 	if strings.HasPrefix(target, "http") {
 		// absolute path
 		bslash = strings.HasSuffix(target, "/")
 	} else {
 		// default redirect to local
-		bslash = strings.HasPrefix(target, "/")
-		if bslash {
-			target = fmt.Sprintf("%s%s", req.Host(), target)
-		} else {
-			target = fmt.Sprintf("%s/%s", req.Host(), target)
+		host, sep = req.Host(), !strings.HasPrefix(target, "/")
+		bslash = strings.HasSuffix(target, "/") || target == ""
+	}
+
+	base, query, hasQuery := target, "", false
+	if i := strings.IndexByte(target, '?'); i >= 0 {
+		base, query, hasQuery = target[:i], target[i+1:], true
+		if j := strings.IndexByte(query, '?'); j >= 0 {
+			query = query[:j]
 		}
-		bslash = strings.HasSuffix(target, "/")
 	}
+	path = make([]byte, 0, len(host)+len(target)+len(reqPath)+len(req.QueryString())+3)
+	path = append(path, host...)
+	if sep {
+		path = append(path, '/')
+	}
+	return appendJoinedURI(path, base, query, hasQuery, bslash, reqPath, req, merge)
+}
 
-	targetQuery := strings.Split(target, "?")
-	var buffer bytes.Buffer
-	buffer.WriteString(targetQuery[0])
+// appendJoinedURI appends base joined with path, followed by the query of
+// the target and the query of req merged as set by merge.
+func appendJoinedURI(dst []byte, base, query string, hasQuery, bslash bool, path []byte, req *protocol.Request, merge QueryMerge) []byte {
+	dst = append(dst, base...)
+	aslash := len(path) > 0 && path[0] == '/'
 	switch {
 	case aslash && bslash:
-		buffer.Write(req.URI().Path()[1:])
+		dst = append(dst, path[1:]...)
 	case !aslash && !bslash:
-		buffer.Write([]byte{'/'})
-		buffer.Write(req.URI().Path())
+		dst = append(dst, '/')
+		dst = append(dst, path...)
 	default:
-		buffer.Write(req.URI().Path())
+		dst = append(dst, path...)
 	}
-	if len(targetQuery) > 1 {
-		buffer.Write([]byte{'?'})
-		buffer.WriteString(targetQuery[1])
+	qs := req.QueryString()
+	if merge != QueryAppend {
+		return appendMergedQuery(dst, query, b2s(qs), merge)
 	}
-	if len(req.QueryString()) > 0 {
-		if len(targetQuery) == 1 {
-			buffer.Write([]byte{'?'})
+	if hasQuery {
+		dst = append(dst, '?')
+		dst = append(dst, query...)
+	}
+	if len(qs) > 0 {
+		if hasQuery {
+			dst = append(dst, '&')
 		} else {
-			buffer.Write([]byte{'&'})
+			dst = append(dst, '?')
 		}
-		buffer.Write(req.QueryString())
+		dst = append(dst, qs...)
 	}
-	return buffer.Bytes()
+	return dst
 }
 
-// removeRequestConnHeaders removes hop-by-hop headers listed in the "Connection" header of h.
-// See RFC 7230, section 6.1
-func removeRequestConnHeaders(c *app.RequestContext) {
+// removeRequestHopHeaders removes the hop-by-hop headers of the request in
+// a single pass over its headers: hopHeaders, except Trailer if keepTrailer,
+// and the headers listed in "Connection". See RFC 7230, section 6.1
+func removeRequestHopHeaders(c *app.RequestContext, keepTrailer bool) {
+	var buf [16][]byte
+	names := buf[:0]
 	c.Request.Header.VisitAll(func(k, v []byte) {
-		if b2s(k) == "Connection" {
-			for _, sf := range strings.Split(b2s(v), ",") {
-				if sf = textproto.TrimString(sf); sf != "" {
-					c.Request.Header.DelBytes(s2b(sf))
-				}
-			}
-		}
+		names = appendHopHeaders(names, k, v, keepTrailer)
 	})
+	for _, name := range names {
+		c.Request.Header.DelBytes(name)
+	}
 }
 
-// removeRespConnHeaders removes hop-by-hop headers listed in the "Connection" header of h.
-// See RFC 7230, section 6.1
-func removeResponseConnHeaders(c *app.RequestContext) {
+// removeResponseHopHeaders is removeRequestHopHeaders for the response.
+func removeResponseHopHeaders(c *app.RequestContext, keepTrailer bool) {
+	var buf [16][]byte
+	names := buf[:0]
 	c.Response.Header.VisitAll(func(k, v []byte) {
-		if b2s(k) == "Connection" {
-			for _, sf := range strings.Split(b2s(v), ",") {
-				if sf = textproto.TrimString(sf); sf != "" {
-					c.Response.Header.DelBytes(s2b(sf))
+		names = appendHopHeaders(names, k, v, keepTrailer)
+	})
+	for _, name := range names {
+		c.Response.Header.DelBytes(name)
+	}
+}
+
+// appendHopHeaders appends the names of the hop-by-hop headers to delete
+// for the header k: v to names.
+func appendHopHeaders(names [][]byte, k, v []byte, keepTrailer bool) [][]byte {
+	if b2s(k) == "Connection" {
+		for len(v) > 0 {
+			var sf []byte
+			sf, v = nextToken(v)
+			if len(sf) > 0 {
+				names = append(names, sf)
+			}
+		}
+	}
+	for _, h := range hopHeaders {
+		if b2s(k) == h {
+			if !keepTrailer || h != "Trailer" {
+				names = append(names, s2b(h))
+			}
+			break
+		}
+	}
+	return names
+}
+
+// nextToken splits the first element off a comma-separated header value
+// and trims its optional whitespace, without allocating.
+func nextToken(v []byte) (token, rest []byte) {
+	if i := bytes.IndexByte(v, ','); i >= 0 {
+		token, rest = v[:i], v[i+1:]
+	} else {
+		token = v
+	}
+	for len(token) > 0 && (token[0] == ' ' || token[0] == '\t') {
+		token = token[1:]
+	}
+	for len(token) > 0 && (token[len(token)-1] == ' ' || token[len(token)-1] == '\t') {
+		token = token[:len(token)-1]
+	}
+	return token, rest
+}
+
+// prepareRequestHeaders removes hop-by-hop headers from the request to the
+// backend and appends the client address to X-Forwarded-For. It does not
+// allocate for typical requests.
+func (r *ReverseProxy) prepareRequestHeaders(ctx *app.RequestContext) {
+	req := &ctx.Request
+	hasTeTrailer := false
+	if r.transferTrailer {
+		hasTeTrailer = checkTeHeader(&req.Header)
+	}
+
+	// Remove hop-by-hop headers to the backend. Especially
+	// important is "Connection" because we want a persistent
+	// connection, regardless of what the client sent to us.
+	removeRequestHopHeaders(ctx, r.transferTrailer)
+
+	// Check if 'trailers' exists in te header, If exists, add an additional Te header
+	if r.transferTrailer && hasTeTrailer {
+		req.Header.Set("Te", "trailers")
+	}
+
+	// prepare request(replace headers and some URL host)
+	addXForwardedFor(req, ctx.RemoteAddr())
+}
+
+// addXForwardedFor appends the IP of addr to the X-Forwarded-For chain of
+// req, built in a pooled buffer. An empty X-Forwarded-For asks not to add one.
+func addXForwardedFor(req *protocol.Request, addr net.Addr) {
+	tmp := req.Header.Peek("X-Forwarded-For")
+	if tmp != nil && len(tmp) == 0 {
+		return
+	}
+	bb := bytebufferpool.Get()
+	if len(tmp) > 0 {
+		bb.B = append(append(bb.B, tmp...), ", "...)
+	}
+	var ok bool
+	if bb.B, ok = appendRemoteIP(bb.B, addr); ok {
+		req.Header.AddArgBytes(s2b("X-Forwarded-For"), bb.B, false)
+	}
+	bytebufferpool.Put(bb)
+}
+
+// appendRemoteIP appends the IP of addr to dst. IPv4 addresses of TCP
+// connections are formatted without allocating.
+func appendRemoteIP(dst []byte, addr net.Addr) ([]byte, bool) {
+	if a, ok := addr.(*net.TCPAddr); ok {
+		if ip4 := a.IP.To4(); ip4 != nil {
+			for i, b := range ip4 {
+				if i > 0 {
+					dst = append(dst, '.')
 				}
+				dst = strconv.AppendUint(dst, uint64(b), 10)
 			}
+			return dst, true
 		}
-	})
+	}
+	ip, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return dst, false
+	}
+	// the zone of a link-local address is meaningless to the backend
+	if i := strings.IndexByte(ip, '%'); i >= 0 {
+		ip = ip[:i]
+	}
+	return append(dst, ip...), true
+}
+
+// rewritePathPrefix applies stripPrefix and addPrefix to the request path.
+func (r *ReverseProxy) rewritePathPrefix(req *protocol.Request) {
+	if r.stripPrefix == "" && r.addPrefix == "" {
+		return
+	}
+	uri := req.URI()
+	path := r.requestPath(req)
+	if r.stripPrefix != "" && bytes.HasPrefix(path, s2b(r.stripPrefix)) {
+		// only strip whole segments, "/api" is not a prefix of "/apis"
+		if rest := path[len(r.stripPrefix):]; len(rest) == 0 || rest[0] == '/' {
+			path = rest
+			addForwardedPrefix(req, r.stripPrefix)
+		}
+	}
+	if r.addPrefix == "" && len(path) > 0 {
+		uri.SetPathBytes(path)
+		return
+	}
+	buf := make([]byte, 0, len(r.addPrefix)+len(path)+1)
+	buf = append(buf, r.addPrefix...)
+	if len(path) == 0 || path[0] != '/' {
+		buf = append(buf, '/')
+	}
+	uri.SetPathBytes(append(buf, path...))
+}
+
+// HeaderForwardedPrefix is the path prefix stripped from a forwarded
+// request, e.g. "/api", so that backends can build external links and
+// redirects.
+const HeaderForwardedPrefix = "X-Forwarded-Prefix"
+
+// addForwardedPrefix appends the stripped prefix to the X-Forwarded-Prefix
+// of req, which keeps the prefixes stripped by earlier proxies.
+func addForwardedPrefix(req *protocol.Request, prefix string) {
+	if prefix == "" {
+		return
+	}
+	prior := bytes.TrimRight(req.Header.Peek(HeaderForwardedPrefix), "/")
+	if len(prior) == 0 {
+		req.Header.Set(HeaderForwardedPrefix, prefix)
+		return
+	}
+	req.Header.Set(HeaderForwardedPrefix, string(prior)+prefix)
 }
 
 // checkTeHeader check RequestHeader if has 'Te: trailers'
@@ -210,125 +634,372 @@ func checkTeHeader(header *protocol.RequestHeader) bool {
 	return false
 }
 
-func (r *ReverseProxy) defaultErrorHandler(c *app.RequestContext, _ error) {
-	c.Response.Header.SetStatusCode(consts.StatusBadGateway)
+// headerSnapshot holds response headers saved by SetSaveOriginResHeader as
+// alternating keys and values in one flat buffer, so that saving them does
+// not allocate once the snapshot is reused.
+type headerSnapshot struct {
+	buf  []byte
+	ends []int // end offsets in buf of each key and value
 }
 
-var respTmpHeaderPool = sync.Pool{
+var headerSnapshotPool = sync.Pool{
 	New: func() interface{} {
-		return make(map[string][]string)
+		return &headerSnapshot{}
 	},
 }
 
+func (hs *headerSnapshot) save(h *protocol.ResponseHeader) {
+	h.VisitAll(func(key, value []byte) {
+		hs.buf = append(hs.buf, key...)
+		hs.ends = append(hs.ends, len(hs.buf))
+		hs.buf = append(hs.buf, value...)
+		hs.ends = append(hs.ends, len(hs.buf))
+	})
+}
+
+// restore adds the saved headers to h in their original order.
+func (hs *headerSnapshot) restore(h *protocol.ResponseHeader) {
+	start := 0
+	for i := 0; i+1 < len(hs.ends); i += 2 {
+		k, v := hs.buf[start:hs.ends[i]], hs.buf[hs.ends[i]:hs.ends[i+1]]
+		h.Add(b2s(k), b2s(v))
+		start = hs.ends[i+1]
+	}
+}
+
+func (hs *headerSnapshot) release() {
+	hs.buf, hs.ends = hs.buf[:0], hs.ends[:0]
+	headerSnapshotPool.Put(hs)
+}
+
 func (r *ReverseProxy) ServeHTTP(c context.Context, ctx *app.RequestContext) {
+	if r.serveReloaded(c, ctx) {
+		return
+	}
+	if r.servePreflight(ctx) {
+		return
+	}
 	req := &ctx.Request
 	resp := &ctx.Response
 
+	if r.name != "" {
+		ctx.Set(ContextKeyRoute, r.name)
+	}
+	transfer := countTransfer(ctx)
+	defer transfer.finish(r, c, ctx)
+	if r.attemptHeaders {
+		defer annotateResponse(ctx)
+	}
+	if r.injectFaults(c, ctx) {
+		return
+	}
+
+	if stream := r.dropRequestBody(ctx); stream != nil {
+		defer func() {
+			req.ConstructBodyStream(req.BodyBuffer(), stream)
+		}()
+	}
+	limitedBody, rejected := r.limitRequestBody(ctx)
+	if rejected {
+		return
+	}
+	inspection, rejected := r.inspectMultipartRequest(c, ctx)
+	if rejected {
+		return
+	}
+	if inspection != nil {
+		defer func() {
+			// give the body back so that the server skips the rest of it
+			req.ConstructBodyStream(req.BodyBuffer(), inspection.src)
+		}()
+		// ends the inspection on every return, also before the backend call
+		defer inspection.stop()
+	}
+	stream, rejected := r.checkGraphQL(c, ctx)
+	if stream != nil {
+		defer func() {
+			req.ConstructBodyStream(req.BodyBuffer(), stream)
+		}()
+	}
+	if rejected {
+		return
+	}
+
 	// save tmp resp header
-	respTmpHeader := respTmpHeaderPool.Get().(map[string][]string)
+	var origin *headerSnapshot
 	if r.saveOriginResHeader {
 		resp.Header.SetNoDefaultContentType(true)
-		resp.Header.VisitAll(func(key, value []byte) {
-			keyStr := string(key)
-			valueStr := string(value)
-			if _, ok := respTmpHeader[keyStr]; !ok {
-				respTmpHeader[keyStr] = []string{valueStr}
-			} else {
-				respTmpHeader[keyStr] = append(respTmpHeader[keyStr], valueStr)
-			}
-		})
+		origin = headerSnapshotPool.Get().(*headerSnapshot)
+		defer origin.release()
+		origin.save(&resp.Header)
 	}
 
-	if r.director != nil {
+	target, err := r.chooseTarget(c, ctx)
+	if err != nil {
+		r.log().Errorf(c, "HERTZ: Choosing the target failed: %v", err)
+		r.handleError(c, ctx, ErrorKindTarget, err, 0)
+		return
+	}
+	if target == "" && r.balancer != nil {
+		if target = r.balancer.Pick(c, ctx); target != "" {
+			defer func(picked time.Time) {
+				r.balancer.Done(target, resp.StatusCode(), time.Since(picked))
+			}(time.Now())
+		}
+	}
+	scheme := r.backendScheme(c, ctx)
+	originalURI, originalMethod := r.originalRequest(ctx)
+	// the backend URI keeps the scheme of the target even if the client
+	// connected over TLS, unless the SchemeFunc chose another one
+	req.SetIsTLS(false)
+	r.rewritePathPrefix(req)
+	if target != "" && r.defaultDirector {
+		directTo(req, target, r.requestPath(req), r.queryMerge)
+	} else if r.director != nil {
 		r.director(&ctx.Request)
 	}
+	if scheme != "" {
+		req.URI().SetScheme(scheme)
+	}
+	if r.preserveRawPath {
+		// send the path as joined instead of encoding the decoded path
+		req.URI().DisablePathNormalizing = true
+	}
 	req.Header.ResetConnectionClose()
-
-	hasTeTrailer := false
-	if r.transferTrailer {
-		hasTeTrailer = checkTeHeader(&req.Header)
+	var upgrade string
+	if r.upgrade == nil || !r.upgrade.Disabled {
+		upgrade = upgradeType(&req.Header)
 	}
 
-	removeRequestConnHeaders(ctx)
-	// Remove hop-by-hop headers to the backend. Especially
-	// important is "Connection" because we want a persistent
-	// connection, regardless of what the client sent to us.
-	for _, h := range hopHeaders {
-		if r.transferTrailer && h == "Trailer" {
-			continue
-		}
-		req.Header.DelBytes(s2b(h))
+	probe := upgrade == "" && r.isHeadProbe(ctx)
+	if probe {
+		req.Header.SetMethod(consts.MethodHead)
 	}
 
-	// Check if 'trailers' exists in te header, If exists, add an additional Te header
-	if r.transferTrailer && hasTeTrailer {
-		req.Header.Set("Te", "trailers")
+	r.prepareRequestHeaders(ctx)
+	r.setOriginalRequestHeaders(req, originalURI, originalMethod)
+	r.rewriteRequestCookies(c, ctx)
+	grpcWeb, webStream, err := r.translateGRPCWebRequest(req)
+	if webStream != nil {
+		defer func() {
+			req.ConstructBodyStream(req.BodyBuffer(), webStream)
+		}()
+	}
+	if err != nil {
+		r.log().Warnf(c, "HERTZ: gRPC-Web request rejected: %v", err)
+		ctx.Response.Header.SetStatusCode(consts.StatusBadRequest)
+		return
+	}
+	if !r.requestHeaders.empty() {
+		r.requestHeaders.applyRequest(&req.Header)
 	}
 
-	// prepare request(replace headers and some URL host)
-	if ip, _, err := net.SplitHostPort(ctx.RemoteAddr().String()); err == nil {
-		tmp := req.Header.Peek("X-Forwarded-For")
-		if len(tmp) > 0 {
-			ip = fmt.Sprintf("%s, %s", tmp, ip)
-		}
-		if tmp == nil || string(tmp) != "" {
-			req.Header.Add("X-Forwarded-For", ip)
-		}
+	var sseReq *protocol.Request
+	if r.sse != nil && r.sse.Reconnect && upgrade == "" {
+		sseReq = protocol.AcquireRequest()
+		req.CopyTo(sseReq)
+		// unless the event stream took it over
+		defer func() { releaseRequest(sseReq) }()
 	}
 
-	err := r.doClientBehavior(c, req, resp)
+	var backend network.Conn
+	attempts, start := 1, time.Now()
+	if upgrade != "" {
+		backend, err = doUpgrade(req, resp, upgrade, r.upgrade, r.backendDialer())
+	} else if key := r.coalescingKey(req); key != "" {
+		attempts, err = r.coalescer.do(c, key, resp, func() (int, error) {
+			return r.doWithRetries(c, req, resp)
+		})
+	} else {
+		attempts, err = r.doWithRetries(c, req, resp)
+	}
+	if probe {
+		req.Header.SetMethod(consts.MethodGet)
+	}
+	latency := time.Since(start)
+	ctx.Set(ContextKeyUpstream, string(req.URI().FullURI()))
+	ctx.Set(ContextKeyAttempts, attempts)
+	ctx.Set(ContextKeyUpstreamLatency, latency)
+	if err != nil && c.Err() != nil {
+		// an expected end of the request rather than a failure
+		logw(c, r.log(), LevelDebug, "HERTZ: Client went away, discarding the backend response", r.callFields(req, attempts, latency, err)...)
+		resp.CloseBodyStream() //nolint:errcheck
+		resp.Reset()
+		r.handleError(c, ctx, ErrorKindClientAbort, clientAbortError(err), attempts)
+		return
+	}
+	if err != nil && limitedBody.tooLarge() {
+		resp.Reset()
+		rejectRequestBody(ctx)
+		return
+	}
+	if ierr := inspection.rejected(); err != nil && ierr != nil {
+		resp.Reset()
+		rejectMultipart(c, ctx, r.log(), ierr)
+		return
+	}
 	if err != nil {
-		hlog.CtxErrorf(c, "HERTZ: Client request error: %#v", err.Error())
-		r.getErrorHandler()(ctx, err)
+		logw(c, r.log(), LevelError, "HERTZ: Backend call failed", r.callFields(req, attempts, latency, err)...)
+		r.handleError(c, ctx, ErrorKindBackend, err, attempts)
+		return
+	}
+	if err = r.checkResponseHeader(resp); err != nil {
+		logw(c, r.log(), LevelError, "HERTZ: Backend response rejected", r.callFields(req, attempts, latency, err)...)
+		if backend != nil {
+			backend.Close()
+		}
+		resp.CloseBodyStream() //nolint:errcheck
+		resp.Reset()
+		r.handleError(c, ctx, ErrorKindResponse, err, attempts)
 		return
 	}
+	skipResponseBody(req, resp, probe)
 
 	// add tmp resp header
-	for key, hs := range respTmpHeader {
-		for _, h := range hs {
-			resp.Header.Add(key, h)
-		}
+	if origin != nil {
+		origin.restore(&resp.Header)
 	}
 
-	// Clear and put respTmpHeader back to respTmpHeaderPool
-	for k := range respTmpHeader {
-		delete(respTmpHeader, k)
+	if grpcWeb != nil {
+		// before the Trailer header is removed with the trailers
+		grpcWeb.translateResponse(resp)
+	}
+	removeResponseHopHeaders(ctx, r.transferTrailer)
+	if !r.responseHeaders.empty() {
+		r.responseHeaders.applyResponse(&resp.Header)
 	}
-	respTmpHeaderPool.Put(respTmpHeader)
+	r.applyCORSHeaders(ctx)
 
-	removeResponseConnHeaders(ctx)
+	if backend != nil {
+		resp.Header.Set("Connection", "Upgrade")
+		resp.Header.Set("Upgrade", upgrade)
+	}
 
-	for _, h := range hopHeaders {
-		if r.transferTrailer && h == "Trailer" {
-			continue
+	err = r.rewriteResponseCookies(c, ctx)
+	if err == nil && r.modifyResponse != nil {
+		err = r.modifyResponse(resp)
+	}
+	if err == nil && r.modifyResponseWithContext != nil {
+		err = r.modifyResponseWithContext(c, ctx, resp)
+	}
+	if err != nil {
+		if backend != nil {
+			backend.Close()
 		}
-		resp.Header.DelBytes(s2b(h))
+		r.handleError(c, ctx, ErrorKindResponse, err, attempts)
+		return
 	}
 
-	if r.modifyResponse == nil {
+	if backend != nil {
+		// splice the connections once the 101 response is written,
+		// which is skipped for "Connection: close"
+		req.Header.ResetConnectionClose()
+		ctx.Hijack(func(conn network.Conn) {
+			r.tunnel(conn, backend)
+		})
 		return
 	}
-	err = r.modifyResponse(resp)
-	if err != nil {
-		r.getErrorHandler()(ctx, err)
+
+	r.rewriteStatus(c, ctx)
+
+	if r.sse != nil && r.proxySSE(c, sseReq, resp) {
+		sseReq = nil
+	}
+
+	if err = r.transformResponse(resp); err != nil {
+		r.handleError(c, ctx, ErrorKindResponse, err, attempts)
+		return
+	}
+	r.throttleResponse(resp)
+}
+
+// doWithRetries calls the backend, retrying as set by SetRetries, and
+// returns the number of calls. Like net/http, idempotent requests failing
+// because the backend closed the connection are sent once more on another
+// connection in any case.
+func (r *ReverseProxy) doWithRetries(c context.Context, req *protocol.Request, resp *protocol.Response) (int, error) {
+	attempts, start := 0, time.Now()
+	call := func() error {
+		attempts++
+		if r.attemptHeaders {
+			req.Header.Set(HeaderProxyAttempt, strconv.Itoa(attempts))
+		}
+		return r.doClientBehavior(c, req, resp)
+	}
+	err := call()
+	if err != nil && canResend(req) && isStaleConnError(err) {
+		logw(c, r.log(), LevelDebug, "HERTZ: Backend closed the connection, sending the request again", r.callFields(req, attempts, time.Since(start), err)...)
+		resp.Reset()
+		err = call()
+	}
+	for retries := 0; err != nil && c.Err() == nil && retries < r.retries && isRetryable(req, err); retries++ {
+		logw(c, r.log(), LevelWarn, "HERTZ: Backend call failed, retrying", r.callFields(req, attempts, time.Since(start), err)...)
+		resp.Reset()
+		err = call()
+	}
+	return attempts, err
+}
+
+// coalescingKey returns the key of req for SetCoalescing, "" if the
+// request is not coalesced.
+func (r *ReverseProxy) coalescingKey(req *protocol.Request) string {
+	if r.coalesceKey == nil {
+		return ""
 	}
+	return r.coalesceKey(req)
 }
 
 // SetDirector use to customize protocol.Request
 func (r *ReverseProxy) SetDirector(director func(req *protocol.Request)) {
 	r.director = director
+	r.defaultDirector = false
 }
 
-// SetClient use to customize client
-func (r *ReverseProxy) SetClient(client *client.Client) {
+// SetClient use to customize client, e.g. a shared *client.Client or a
+// wrapper around it
+func (r *ReverseProxy) SetClient(client Doer) {
 	r.client = client
 }
 
+// SetRetries sets how often a request is sent again if the backend call
+// fails. Only requests with idempotent methods and without body stream are
+// retried, and only on connection errors and timeouts.
+func (r *ReverseProxy) SetRetries(retries int) {
+	r.retries = retries
+}
+
+// SetClientFactory sets the protocol the client speaks to the backend, e.g.
+// HTTP/2 with the factory of github.com/hertz-contrib/http2:
+//
+//	rp.SetClientFactory(factory.NewClientFactory(config.WithDialer(standard.NewDialer())))
+//
+// which negotiates h2 over TLS, or factory.NewClientFactory(config.WithAllowHTTP(true))
+// for h2c with prior knowledge. Requests to a backend are multiplexed over
+// few connections. It must be called before the first request and applies to
+// every proxy sharing the client.
+//
+// The client must have a SetClientFactory method like *client.Client,
+// otherwise cf is ignored.
+func (r *ReverseProxy) SetClientFactory(cf suite.ClientFactory) {
+	if c, ok := r.client.(interface{ SetClientFactory(suite.ClientFactory) }); ok {
+		c.SetClientFactory(cf)
+	}
+}
+
 // SetModifyResponse use to modify response
 func (r *ReverseProxy) SetModifyResponse(mr func(*protocol.Response) error) {
 	r.modifyResponse = mr
 }
 
+// SetModifyResponseWithContext is like SetModifyResponse, but mr also gets
+// the request context, e.g. to modify the response depending on the path
+// or the Accept header of the request. The request is the one sent to the
+// backend, as rewritten by the director. mr is called after the function
+// set by SetModifyResponse.
+func (r *ReverseProxy) SetModifyResponseWithContext(mr func(ctx context.Context, c *app.RequestContext, resp *protocol.Response) error) {
+	r.modifyResponseWithContext = mr
+}
+
 // SetErrorHandler use to customize error handler
 func (r *ReverseProxy) SetErrorHandler(eh func(c *app.RequestContext, err error)) {
 	r.errorHandler = eh
@@ -342,53 +1013,80 @@ func (r *ReverseProxy) SetSaveOriginResHeader(b bool) {
 	r.saveOriginResHeader = b
 }
 
+// SetStripPrefix removes prefix from the request path before forwarding,
+// e.g. with "/api" a request for "/api/users" is forwarded as "/users".
+// Only whole path segments are stripped. The stripped prefix is sent in
+// X-Forwarded-Prefix, after the one of an earlier proxy.
+func (r *ReverseProxy) SetStripPrefix(prefix string) {
+	r.stripPrefix = strings.TrimSuffix(prefix, "/")
+}
+
+// SetAddPrefix prepends prefix to the request path before forwarding,
+// e.g. with "/v2" a request for "/users" is forwarded as "/v2/users".
+// It is applied after SetStripPrefix.
+func (r *ReverseProxy) SetAddPrefix(prefix string) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix != "" && prefix[0] != '/' {
+		prefix = "/" + prefix
+	}
+	r.addPrefix = prefix
+}
+
+// SetResponseTransformers sets the transformers the response body is passed
+// through, e.g. GzipDecoder(), a rewriter and GzipEncoder(gzip.DefaultCompression).
+func (r *ReverseProxy) SetResponseTransformers(ts ...TransformerFactory) {
+	r.responseTransformers = ts
+}
+
 func (r *ReverseProxy) SetClientBehavior(cb clientBehavior) {
 	r.clientBehavior = cb
+	r.baseBehavior = cb
 }
 
-func (r *ReverseProxy) getErrorHandler() func(c *app.RequestContext, err error) {
-	if r.errorHandler != nil {
-		return r.errorHandler
-	}
-	return r.defaultErrorHandler
+// Director returns the director, see SetDirector.
+func (r *ReverseProxy) Director() func(req *protocol.Request) {
+	return r.director
 }
 
-func (r *ReverseProxy) doClientBehavior(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
-	var err error
-	switch r.clientBehavior.clientBehaviorType {
-	case doDeadline:
-		deadline := r.clientBehavior.param.(time.Time)
-		err = r.client.DoDeadline(ctx, req, resp, deadline)
-	case doRedirects:
-		maxRedirectsCount := r.clientBehavior.param.(int)
-		err = r.client.DoRedirects(ctx, req, resp, maxRedirectsCount)
-	case doTimeout:
-		timeout := r.clientBehavior.param.(time.Duration)
-		err = r.client.DoTimeout(ctx, req, resp, timeout)
-	default:
-		err = r.client.Do(ctx, req, resp)
-	}
-	return err
+// Client returns the client used for backend calls.
+func (r *ReverseProxy) Client() Doer {
+	return r.client
 }
 
-// b2s converts byte slice to a string without memory allocation.
-// See https://groups.google.com/forum/#!msg/Golang-Nuts/ENgbUzYvCuU/90yGx7GUAgAJ .
-//
-// Note it may break if string and/or slice header will change
-// in the future go versions.
-func b2s(b []byte) string {
-	return *(*string)(unsafe.Pointer(&b))
+// ModifyResponse returns the function set by SetModifyResponse.
+func (r *ReverseProxy) ModifyResponse() func(*protocol.Response) error {
+	return r.modifyResponse
 }
 
-// s2b converts string to a byte slice without memory allocation.
-//
-// Note it may break if string and/or slice header will change
-// in the future go versions.
-func s2b(s string) (b []byte) {
-	bh := (*reflect.SliceHeader)(unsafe.Pointer(&b))
-	sh := (*reflect.StringHeader)(unsafe.Pointer(&s))
-	bh.Data = sh.Data
-	bh.Cap = sh.Len
-	bh.Len = sh.Len
-	return
+// ErrorHandler returns the function set by SetErrorHandler, nil if the
+// default handler is used, which answers with ProxyError.StatusCode, e.g.
+// 504 for timeouts and 503 for rejected requests.
+func (r *ReverseProxy) ErrorHandler() func(c *app.RequestContext, err error) {
+	return r.errorHandler
+}
+
+// TransferTrailer reports whether trailers are forwarded, see SetTransferTrailer.
+func (r *ReverseProxy) TransferTrailer() bool {
+	return r.transferTrailer
+}
+
+// SaveOriginResHeader reports whether the response headers set before the
+// proxy are kept, see SetSaveOriginResHeader.
+func (r *ReverseProxy) SaveOriginResHeader() bool {
+	return r.saveOriginResHeader
+}
+
+// StripPrefix returns the prefix set by SetStripPrefix.
+func (r *ReverseProxy) StripPrefix() string {
+	return r.stripPrefix
+}
+
+// AddPrefix returns the prefix set by SetAddPrefix.
+func (r *ReverseProxy) AddPrefix() string {
+	return r.addPrefix
+}
+
+// ResponseTransformers returns the transformers set by SetResponseTransformers.
+func (r *ReverseProxy) ResponseTransformers() []TransformerFactory {
+	return append([]TransformerFactory(nil), r.responseTransformers...)
 }
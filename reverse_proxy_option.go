@@ -0,0 +1,341 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/client"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+// Connection pool settings of the client created by NewReverseProxy, sized
+// for a gateway rather than for a single service calling out.
+const (
+	DefaultProxyMaxConnsPerHost     = 1024
+	DefaultProxyMaxIdleConnDuration = time.Minute
+	// DefaultProxyMaxConnWaitTimeout lets requests wait for a free
+	// connection instead of failing as soon as the pool is exhausted.
+	DefaultProxyMaxConnWaitTimeout = time.Second
+)
+
+// ProxyOption configures the ReverseProxy returned by NewReverseProxy.
+type ProxyOption func(o *ProxyOptions)
+
+// ProxyOptions are the settings of NewReverseProxy, each corresponding
+// to a setter of ReverseProxy.
+type ProxyOptions struct {
+	Director                  func(req *protocol.Request)
+	ModifyResponse            func(resp *protocol.Response) error
+	ModifyResponseWithContext func(ctx context.Context, c *app.RequestContext, resp *protocol.Response) error
+	ErrorHandler              func(c *app.RequestContext, err error)
+	ProxyErrorHandler         func(ctx context.Context, c *app.RequestContext, err *ProxyError)
+	Client                    Doer
+	ClientOptions             []config.ClientOption
+	IsolatedUpstreams         bool
+	UpstreamClientOptions     map[string][]config.ClientOption
+	TransferTrailer           bool
+	BufferPool                BufferPool
+	Resolver                  Resolver
+	HappyEyeballsDelay        time.Duration
+	DNSCache                  *DNSCacheOptions
+	TLSHandshakeTimeout       time.Duration
+	ResponseHeaderTimeout     time.Duration
+	BodyReadTimeout           time.Duration
+
+	// behaviors set by WithRequestTimeout, WithDeadline and WithMaxRedirects
+	behaviors []clientBehavior
+}
+
+func (o *ProxyOptions) apply(opts ...ProxyOption) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+// NewReverseProxy is NewSingleHostReverseProxy configured by options
+// instead of setters, so that the proxy is complete before it is shared.
+// Unless WithClient is given, its client pools connections as set by
+// WithMaxConnsPerHost, WithMaxIdleConnDuration, WithMaxConnWaitTimeout and
+// WithKeepAlive, with the DefaultProxy* settings by default.
+//
+//	rp, err := reverseproxy.NewReverseProxy("http://backend:8080",
+//		reverseproxy.WithModifyResponse(modify),
+//		reverseproxy.WithClientOptions(client.WithDialTimeout(time.Second)),
+//	)
+func NewReverseProxy(target string, opts ...ProxyOption) (*ReverseProxy, error) {
+	o := &ProxyOptions{}
+	o.apply(opts...)
+	if o.DNSCache != nil {
+		o.Resolver = NewCachingResolver(o.Resolver, *o.DNSCache)
+	}
+	if len(o.behaviors) > 1 {
+		return nil, errors.New("reverseproxy: at most one of WithRequestTimeout, WithDeadline and WithMaxRedirects may be given")
+	}
+	for _, cb := range o.behaviors {
+		if err := cb.validate(); err != nil {
+			return nil, err
+		}
+	}
+	var (
+		r   *ReverseProxy
+		err error
+	)
+	if o.Client != nil {
+		if r, err = newSingleHostReverseProxy(target); err != nil {
+			return nil, err
+		}
+		r.client = o.Client
+	} else {
+		options := append(defaultPoolOptions(), o.ClientOptions...)
+		if d := o.dialer(); d != nil {
+			options = append(options, client.WithDialer(d))
+		}
+		if _, _, unix := parseUnixTarget(target); o.IsolatedUpstreams && !unix {
+			if r, err = newSingleHostReverseProxy(target); err != nil {
+				return nil, err
+			}
+			if r.client, err = newUpstreamClients(options, o.UpstreamClientOptions); err != nil {
+				return nil, err
+			}
+		} else if r, err = NewSingleHostReverseProxy(target, options...); err != nil {
+			return nil, err
+		}
+	}
+	if o.Director != nil {
+		r.director = o.Director
+		r.defaultDirector = false
+	}
+	r.modifyResponse = o.ModifyResponse
+	r.modifyResponseWithContext = o.ModifyResponseWithContext
+	r.errorHandler = o.ErrorHandler
+	r.proxyErrorHandler = o.ProxyErrorHandler
+	r.transferTrailer = o.TransferTrailer
+	r.bufferPool = o.BufferPool
+	r.resolver = o.Resolver
+	r.happyEyeballsDelay = o.HappyEyeballsDelay
+	if r.resolver == nil && r.happyEyeballsDelay > 0 {
+		r.resolver = net.DefaultResolver
+	}
+	r.responseHeaderTimeout = o.ResponseHeaderTimeout
+	for _, cb := range o.behaviors {
+		r.SetClientBehavior(cb)
+	}
+	return r, nil
+}
+
+func defaultPoolOptions() []config.ClientOption {
+	return []config.ClientOption{
+		client.WithMaxConnsPerHost(DefaultProxyMaxConnsPerHost),
+		client.WithMaxIdleConnDuration(DefaultProxyMaxIdleConnDuration),
+		client.WithMaxConnWaitTimeout(DefaultProxyMaxConnWaitTimeout),
+	}
+}
+
+// WithProxyDirector replaces the default director, see ReverseProxy.SetDirector.
+// It is not named WithDirector, which configures the websocket reverse proxy.
+func WithProxyDirector(director func(req *protocol.Request)) ProxyOption {
+	return func(o *ProxyOptions) {
+		o.Director = director
+	}
+}
+
+// WithModifyResponse see ReverseProxy.SetModifyResponse
+func WithModifyResponse(mr func(*protocol.Response) error) ProxyOption {
+	return func(o *ProxyOptions) {
+		o.ModifyResponse = mr
+	}
+}
+
+// WithModifyResponseWithContext see ReverseProxy.SetModifyResponseWithContext
+func WithModifyResponseWithContext(mr func(ctx context.Context, c *app.RequestContext, resp *protocol.Response) error) ProxyOption {
+	return func(o *ProxyOptions) {
+		o.ModifyResponseWithContext = mr
+	}
+}
+
+// WithErrorHandler see ReverseProxy.SetErrorHandler
+func WithErrorHandler(eh func(c *app.RequestContext, err error)) ProxyOption {
+	return func(o *ProxyOptions) {
+		o.ErrorHandler = eh
+	}
+}
+
+// WithProxyErrorHandler see ReverseProxy.SetProxyErrorHandler
+func WithProxyErrorHandler(eh func(ctx context.Context, c *app.RequestContext, err *ProxyError)) ProxyOption {
+	return func(o *ProxyOptions) {
+		o.ProxyErrorHandler = eh
+	}
+}
+
+// WithClient uses a shared client instead of creating one, see ReverseProxy.SetClient.
+func WithClient(c Doer) ProxyOption {
+	return func(o *ProxyOptions) {
+		o.Client = c
+	}
+}
+
+// WithClientOptions are used to create the client of the proxy, unless WithClient is given.
+func WithClientOptions(options ...config.ClientOption) ProxyOption {
+	return func(o *ProxyOptions) {
+		o.ClientOptions = append(o.ClientOptions, options...)
+	}
+}
+
+// WithMaxConnsPerHost limits the connections to each backend host,
+// DefaultProxyMaxConnsPerHost by default. It is ignored with WithClient.
+func WithMaxConnsPerHost(n int) ProxyOption {
+	return WithClientOptions(client.WithMaxConnsPerHost(n))
+}
+
+// WithMaxIdleConnDuration closes backend connections idle for longer than d,
+// DefaultProxyMaxIdleConnDuration by default. It is ignored with WithClient.
+func WithMaxIdleConnDuration(d time.Duration) ProxyOption {
+	return WithClientOptions(client.WithMaxIdleConnDuration(d))
+}
+
+// WithMaxConnWaitTimeout is how long a request waits for a free backend
+// connection once WithMaxConnsPerHost is reached, DefaultProxyMaxConnWaitTimeout
+// by default. It is ignored with WithClient.
+func WithMaxConnWaitTimeout(d time.Duration) ProxyOption {
+	return WithClientOptions(client.WithMaxConnWaitTimeout(d))
+}
+
+// WithKeepAlive sets whether backend connections are reused, true by
+// default. It is ignored with WithClient.
+func WithKeepAlive(b bool) ProxyOption {
+	return WithClientOptions(client.WithKeepAlive(b))
+}
+
+// WithTransferTrailer see ReverseProxy.SetTransferTrailer
+func WithTransferTrailer(b bool) ProxyOption {
+	return func(o *ProxyOptions) {
+		o.TransferTrailer = b
+	}
+}
+
+// WithBufferPool see ReverseProxy.SetBufferPool
+func WithBufferPool(p BufferPool) ProxyOption {
+	return func(o *ProxyOptions) {
+		o.BufferPool = p
+	}
+}
+
+// WithRequestTimeout limits the backend call to timeout, see client.Client.DoTimeout.
+func WithRequestTimeout(timeout time.Duration) ProxyOption {
+	return func(o *ProxyOptions) {
+		o.behaviors = append(o.behaviors, ClientDoTimeout(timeout))
+	}
+}
+
+// WithDeadline makes backend calls fail after deadline, see client.Client.DoDeadline.
+func WithDeadline(deadline time.Time) ProxyOption {
+	return func(o *ProxyOptions) {
+		o.behaviors = append(o.behaviors, ClientDoDeadline(deadline))
+	}
+}
+
+// WithMaxRedirects makes the proxy follow up to maxRedirects redirects of
+// the backend, see client.Client.DoRedirects.
+func WithMaxRedirects(maxRedirects int) ProxyOption {
+	return func(o *ProxyOptions) {
+		o.behaviors = append(o.behaviors, ClientDoRedirects(maxRedirects))
+	}
+}
+
+// CallOption adjusts the proxy behind a handler returned by ReverseProxy.Handler.
+type CallOption func(r *ReverseProxy)
+
+// Handler returns a handler forwarding like r, adjusted by opts. The options
+// are bound once, so one configured proxy can back several routes:
+//
+//	h.GET("/search", rp.Handler(reverseproxy.WithCallTimeout(time.Second)))
+//	h.GET("/api/*path", rp.Handler(reverseproxy.WithCallStripPrefix("/api"), reverseproxy.WithCallRetries(2)))
+//
+// The handler follows SwitchTarget, Reload and Rollback of r, applying opts
+// on top of the proxy serving new requests.
+func (r *ReverseProxy) Handler(opts ...CallOption) app.HandlerFunc {
+	if len(opts) == 0 {
+		return r.ServeHTTP
+	}
+	h := &callHandler{base: r, opts: opts}
+	return h.ServeHTTP
+}
+
+// callHandler is the handler of ReverseProxy.Handler.
+type callHandler struct {
+	base *ReverseProxy
+	opts []CallOption
+	// derived holds the *derivedProxy of the proxy last serving new
+	// requests of base
+	derived atomic.Value
+}
+
+type derivedProxy struct {
+	from, proxy *ReverseProxy
+}
+
+func (h *callHandler) ServeHTTP(ctx context.Context, c *app.RequestContext) {
+	h.proxy().ServeHTTP(ctx, c)
+}
+
+// proxy returns the proxy serving new requests of base adjusted by opts,
+// derived again once base switched.
+func (h *callHandler) proxy() *ReverseProxy {
+	cur := h.base.current()
+	if d, _ := h.derived.Load().(*derivedProxy); d != nil && d.from == cur {
+		return d.proxy
+	}
+	p := cur.Clone()
+	for _, opt := range h.opts {
+		opt(p)
+	}
+	h.derived.Store(&derivedProxy{from: cur, proxy: p})
+	return p
+}
+
+// WithCallTimeout limits the backend call, see ClientDoTimeout.
+func WithCallTimeout(timeout time.Duration) CallOption {
+	return func(r *ReverseProxy) {
+		r.SetClientBehavior(ClientDoTimeout(timeout))
+	}
+}
+
+// WithCallRetries see ReverseProxy.SetRetries
+func WithCallRetries(retries int) CallOption {
+	return func(r *ReverseProxy) {
+		r.SetRetries(retries)
+	}
+}
+
+// WithCallStripPrefix see ReverseProxy.SetStripPrefix
+func WithCallStripPrefix(prefix string) CallOption {
+	return func(r *ReverseProxy) {
+		r.SetStripPrefix(prefix)
+	}
+}
+
+// WithCallAddPrefix see ReverseProxy.SetAddPrefix
+func WithCallAddPrefix(prefix string) CallOption {
+	return func(r *ReverseProxy) {
+		r.SetAddPrefix(prefix)
+	}
+}
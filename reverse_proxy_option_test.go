@@ -0,0 +1,162 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/client"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+func TestProxyOptions(t *testing.T) {
+	director := func(req *protocol.Request) {}
+	modifyResponse := func(resp *protocol.Response) error { return nil }
+	errorHandler := func(c *app.RequestContext, err error) {}
+	cli, _ := client.NewClient()
+	rp, err := NewReverseProxy("http://127.0.0.1:9990",
+		WithProxyDirector(director),
+		WithModifyResponse(modifyResponse),
+		WithErrorHandler(errorHandler),
+		WithClient(cli),
+		WithTransferTrailer(true),
+	)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, fmt.Sprintf("%p", director), fmt.Sprintf("%p", rp.director))
+	assert.DeepEqual(t, fmt.Sprintf("%p", modifyResponse), fmt.Sprintf("%p", rp.modifyResponse))
+	assert.DeepEqual(t, fmt.Sprintf("%p", errorHandler), fmt.Sprintf("%p", rp.errorHandler))
+	assert.DeepEqual(t, cli, rp.client)
+	assert.True(t, rp.transferTrailer)
+}
+
+func TestDefaultProxyOptions(t *testing.T) {
+	rp, err := NewReverseProxy("http://127.0.0.1:9990", WithClientOptions(client.WithDialTimeout(1)))
+	assert.Nil(t, err)
+	assert.NotNil(t, rp.client)
+	assert.NotNil(t, rp.director)
+	assert.Nil(t, rp.modifyResponse)
+	assert.Nil(t, rp.errorHandler)
+	assert.False(t, rp.transferTrailer)
+}
+
+func TestProxyPoolOptions(t *testing.T) {
+	rp, err := NewReverseProxy("http://127.0.0.1:9990")
+	assert.Nil(t, err)
+	opts := rp.Client().(*client.Client).GetOptions()
+	assert.DeepEqual(t, DefaultProxyMaxConnsPerHost, opts.MaxConnsPerHost)
+	assert.DeepEqual(t, DefaultProxyMaxIdleConnDuration, opts.MaxIdleConnDuration)
+	assert.DeepEqual(t, DefaultProxyMaxConnWaitTimeout, opts.MaxConnWaitTimeout)
+	assert.True(t, opts.KeepAlive)
+
+	rp, err = NewReverseProxy("http://127.0.0.1:9990",
+		WithMaxConnsPerHost(64),
+		WithMaxIdleConnDuration(5*time.Second),
+		WithMaxConnWaitTimeout(0),
+		WithKeepAlive(false),
+	)
+	assert.Nil(t, err)
+	opts = rp.Client().(*client.Client).GetOptions()
+	assert.DeepEqual(t, 64, opts.MaxConnsPerHost)
+	assert.DeepEqual(t, 5*time.Second, opts.MaxIdleConnDuration)
+	assert.DeepEqual(t, time.Duration(0), opts.MaxConnWaitTimeout)
+	assert.False(t, opts.KeepAlive)
+}
+
+func TestProxyClientBehaviorOptions(t *testing.T) {
+	deadline := time.Now().Add(time.Minute)
+	for _, tt := range []struct {
+		opts []ProxyOption
+		want clientBehavior
+		err  bool
+	}{
+		{nil, ClientDo(), false},
+		{[]ProxyOption{WithRequestTimeout(time.Second)}, ClientDoTimeout(time.Second), false},
+		{[]ProxyOption{WithDeadline(deadline)}, ClientDoDeadline(deadline), false},
+		{[]ProxyOption{WithMaxRedirects(3)}, ClientDoRedirects(3), false},
+		{[]ProxyOption{WithRequestTimeout(0)}, clientBehavior{}, true},
+		{[]ProxyOption{WithDeadline(time.Time{})}, clientBehavior{}, true},
+		{[]ProxyOption{WithMaxRedirects(-1)}, clientBehavior{}, true},
+		{[]ProxyOption{WithRequestTimeout(time.Second), WithMaxRedirects(3)}, clientBehavior{}, true},
+	} {
+		rp, err := NewReverseProxy("http://127.0.0.1:9990", tt.opts...)
+		if tt.err {
+			assert.NotNil(t, err)
+			continue
+		}
+		assert.Nil(t, err)
+		assert.DeepEqual(t, tt.want, rp.clientBehavior)
+	}
+}
+
+func TestReverseProxyHandler(t *testing.T) {
+	var uris []string
+	fail := 0
+	base, _ := NewSingleHostReverseProxy("http://backend")
+	base.SetClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		uris = append(uris, string(req.URI().FullURI()))
+		if fail > 0 {
+			fail--
+			return &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}
+		}
+		return nil
+	}))
+	handler := base.Handler(WithCallStripPrefix("/api"), WithCallAddPrefix("/v2"), WithCallRetries(1), WithCallTimeout(time.Second))
+	assert.DeepEqual(t, "", base.StripPrefix())
+	assert.DeepEqual(t, 0, base.retries)
+
+	for _, tt := range []struct {
+		method string
+		fail   int
+		status int
+		calls  int
+	}{
+		{consts.MethodGet, 0, 200, 1},
+		{consts.MethodGet, 1, 200, 2},
+		{consts.MethodGet, 2, 502, 2},
+		{consts.MethodPost, 1, 502, 1},
+	} {
+		uris, fail = nil, tt.fail
+		ctx := app.NewContext(0)
+		ctx.Request.SetMethod(tt.method)
+		ctx.Request.SetRequestURI("http://localhost/api/users")
+		handler(context.Background(), ctx)
+		assert.DeepEqual(t, tt.status, ctx.Response.StatusCode())
+		assert.DeepEqual(t, tt.calls, len(uris))
+		assert.DeepEqual(t, "http://backend/v2/users", uris[0])
+	}
+
+	// the handler follows the live target of base
+	serve := func() string {
+		uris = nil
+		ctx := app.NewContext(0)
+		ctx.Request.SetRequestURI("http://localhost/api/users")
+		handler(context.Background(), ctx)
+		return uris[0]
+	}
+	assert.Nil(t, base.SwitchTarget("http://green"))
+	assert.DeepEqual(t, "http://green/v2/users", serve())
+	assert.Nil(t, base.Reload(ProxyConfig{Target: "http://reloaded"}))
+	assert.DeepEqual(t, "http://reloaded/v2/users", serve())
+	assert.Nil(t, base.Rollback())
+	assert.DeepEqual(t, "http://green/v2/users", serve())
+}
@@ -28,8 +28,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -37,7 +40,12 @@ import (
 	"github.com/cloudwego/hertz/pkg/app/client"
 	"github.com/cloudwego/hertz/pkg/app/server"
 	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/network/standard"
 	"github.com/cloudwego/hertz/pkg/protocol"
+	protocolclient "github.com/cloudwego/hertz/pkg/protocol/client"
+	"github.com/cloudwego/hertz/pkg/protocol/http1"
+	"github.com/cloudwego/hertz/pkg/protocol/http1/factory"
+	"github.com/cloudwego/hertz/pkg/protocol/suite"
 )
 
 // Reverse proxy tests.
@@ -462,6 +470,43 @@ func TestReverseProxyModifyResponse(t *testing.T) {
 	}
 }
 
+func TestReverseProxyModifyResponseWithContext(t *testing.T) {
+	r := server.New(server.WithHostPorts("127.0.0.1:10032"))
+	r.GET("/proxy/mod", func(cc context.Context, ctx *app.RequestContext) {
+		ctx.Data(200, "application/json", []byte("hi"))
+	})
+	proxy, _ := NewSingleHostReverseProxy("http://127.0.0.1:10032/proxy")
+	proxy.SetModifyResponseWithContext(func(ctx context.Context, c *app.RequestContext, resp *protocol.Response) error {
+		if string(c.Request.Header.Peek("Accept")) != "application/json" {
+			return fmt.Errorf("unacceptable")
+		}
+		resp.Header.Set("X-Path", string(c.Request.URI().Path()))
+		return nil
+	})
+	r.GET("/mod", proxy.ServeHTTP)
+	go r.Spin()
+	defer r.Shutdown(context.TODO())
+	time.Sleep(time.Second)
+
+	cli, _ := client.NewClient()
+	for _, tt := range []struct {
+		accept   string
+		wantCode int
+		wantPath string
+	}{
+		{"application/json", http.StatusOK, "/proxy/mod"},
+		{"text/html", http.StatusBadGateway, ""},
+	} {
+		req := protocol.AcquireRequest()
+		resp := protocol.AcquireResponse()
+		req.SetRequestURI("http://127.0.0.1:10032/mod")
+		req.Header.Set("Accept", tt.accept)
+		assert.Nil(t, cli.Do(context.Background(), req, resp))
+		assert.DeepEqual(t, tt.wantCode, resp.StatusCode())
+		assert.DeepEqual(t, tt.wantPath, resp.Header.Get("X-Path"))
+	}
+}
+
 func TestReverseProxyErrorHandler(t *testing.T) {
 	r := server.New(server.WithHostPorts("127.0.0.1:9998"))
 
@@ -590,3 +635,354 @@ func TestReverseProxySaveRespHeader(t *testing.T) {
 	}
 	assert.DeepEqual(t, "bbb", res.Header.Get("aaa"))
 }
+
+func TestReverseProxySaveRespHeaderSnapshot(t *testing.T) {
+	proxy, _ := NewSingleHostReverseProxy("http://backend")
+	proxy.SetSaveOriginResHeader(true)
+	proxy.SetClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		resp.Reset()
+		resp.Header.Set("X-Backend", "1")
+		return nil
+	}))
+
+	ctx := app.NewContext(0)
+	ctx.Request.SetRequestURI("http://localhost/users")
+	ctx.Response.Header.Add("X-Origin", "a")
+	ctx.Response.Header.Add("X-Origin", "b")
+	ctx.Response.Header.Set("X-Other", "c")
+	proxy.ServeHTTP(context.Background(), ctx)
+	assert.DeepEqual(t, "1", ctx.Response.Header.Get("X-Backend"))
+	var origin []string
+	ctx.Response.Header.VisitAll(func(key, value []byte) {
+		if string(key) != "X-Backend" && string(key) != "Content-Type" {
+			origin = append(origin, string(key)+": "+string(value))
+		}
+	})
+	assert.DeepEqual(t, []string{"X-Origin: a", "X-Origin: b", "X-Other: c"}, origin)
+
+	hs := &headerSnapshot{}
+	allocs := testing.AllocsPerRun(100, func() {
+		hs.save(&ctx.Response.Header)
+		hs.buf, hs.ends = hs.buf[:0], hs.ends[:0]
+	})
+	assert.DeepEqual(t, float64(0), allocs)
+}
+
+func TestReverseProxyPathPrefix(t *testing.T) {
+	tests := []struct {
+		strip, add string
+		path       string
+		want       string
+		// prior and prefix are the X-Forwarded-Prefix sent and forwarded
+		prior, prefix string
+	}{
+		{"/api", "", "/api/users", "/users", "", "/api"},
+		{"/api/", "", "/api", "/", "", "/api"},
+		{"/api", "", "/apis/users", "/apis/users", "", ""},
+		{"", "/v2", "/users", "/v2/users", "", ""},
+		{"", "v2/", "/", "/v2/", "", ""},
+		{"/api", "/v2", "/api/users", "/v2/users", "", "/api"},
+		{"/api", "", "/api/users", "/users", "/edge/", "/edge/api"},
+	}
+	for _, tt := range tests {
+		proxy, _ := NewSingleHostReverseProxy("http://127.0.0.1:9990")
+		proxy.SetStripPrefix(tt.strip)
+		proxy.SetAddPrefix(tt.add)
+		req := protocol.AcquireRequest()
+		req.SetRequestURI("http://localhost" + tt.path)
+		if tt.prior != "" {
+			req.Header.Set(HeaderForwardedPrefix, tt.prior)
+		}
+		proxy.rewritePathPrefix(req)
+		assert.DeepEqual(t, tt.want, string(req.URI().Path()))
+		assert.DeepEqual(t, tt.prefix, req.Header.Get(HeaderForwardedPrefix))
+	}
+}
+
+func TestReverseProxyClone(t *testing.T) {
+	base, _ := NewSingleHostReverseProxy("http://127.0.0.1:9990/base")
+	base.SetResponseTransformers(GzipDecoder())
+	clone := base.Clone()
+	clone.Target = "http://127.0.0.1:9991/clone"
+	clone.SetResponseTransformers()
+	assert.DeepEqual(t, base.client, clone.client)
+	assert.DeepEqual(t, 1, len(base.responseTransformers))
+
+	for _, tt := range []struct {
+		proxy *ReverseProxy
+		want  string
+	}{
+		{base, "http://127.0.0.1:9990/base/users"},
+		{clone, "http://127.0.0.1:9991/clone/users"},
+	} {
+		req := protocol.AcquireRequest()
+		req.SetRequestURI("http://localhost/users")
+		tt.proxy.director(req)
+		assert.DeepEqual(t, tt.want, string(req.URI().FullURI()))
+	}
+
+	clone.SetDirector(func(req *protocol.Request) {
+		req.SetRequestURI("http://127.0.0.1:9992/custom")
+	})
+	again := clone.Clone()
+	req := protocol.AcquireRequest()
+	again.director(req)
+	assert.DeepEqual(t, "http://127.0.0.1:9992/custom", string(req.URI().FullURI()))
+}
+
+func TestReverseProxyGetters(t *testing.T) {
+	proxy, _ := NewSingleHostReverseProxy("http://127.0.0.1:9990")
+	assert.NotNil(t, proxy.Director())
+	assert.NotNil(t, proxy.Client())
+	assert.Nil(t, proxy.ModifyResponse())
+	assert.Nil(t, proxy.ErrorHandler())
+
+	cli, _ := client.NewClient()
+	proxy.SetClient(cli)
+	proxy.SetModifyResponse(func(resp *protocol.Response) error { return nil })
+	proxy.SetErrorHandler(func(c *app.RequestContext, err error) {})
+	proxy.SetTransferTrailer(true)
+	proxy.SetSaveOriginResHeader(true)
+	proxy.SetStripPrefix("/api/")
+	proxy.SetAddPrefix("v2")
+	proxy.SetResponseTransformers(GzipDecoder())
+	assert.DeepEqual(t, cli, proxy.Client())
+	assert.NotNil(t, proxy.ModifyResponse())
+	assert.NotNil(t, proxy.ErrorHandler())
+	assert.True(t, proxy.TransferTrailer())
+	assert.True(t, proxy.SaveOriginResHeader())
+	assert.DeepEqual(t, "/api", proxy.StripPrefix())
+	assert.DeepEqual(t, "/v2", proxy.AddPrefix())
+	assert.DeepEqual(t, 1, len(proxy.ResponseTransformers()))
+}
+
+func TestReverseProxyDoer(t *testing.T) {
+	var called []string
+	proxy, _ := NewSingleHostReverseProxy("http://backend/base")
+	proxy.SetClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		called = append(called, string(req.URI().FullURI()))
+		resp.SetStatusCode(http.StatusTeapot)
+		resp.SetBodyString("mocked")
+		return nil
+	}))
+	proxy.SetClientBehavior(ClientDoTimeout(time.Second))
+
+	ctx := app.NewContext(0)
+	ctx.Request.SetRequestURI("http://localhost/users")
+	proxy.ServeHTTP(context.Background(), ctx)
+	assert.DeepEqual(t, []string{"http://backend/base/users"}, called)
+	assert.DeepEqual(t, http.StatusTeapot, ctx.Response.StatusCode())
+	assert.DeepEqual(t, "mocked", string(ctx.Response.Body()))
+	assert.DeepEqual(t, time.Second, ctx.Request.Options().RequestTimeout())
+	assert.DeepEqual(t, "http://backend/base/users", ctx.GetString(ContextKeyUpstream))
+	assert.DeepEqual(t, 1, ctx.GetInt(ContextKeyAttempts))
+	_, ok := ctx.Get(ContextKeyUpstreamLatency)
+	assert.True(t, ok)
+}
+
+func TestReverseProxyTargetOverride(t *testing.T) {
+	var called []string
+	proxy, _ := NewSingleHostReverseProxy("http://backend/base")
+	proxy.SetClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		called = append(called, string(req.URI().FullURI())+" "+string(req.Host()))
+		return nil
+	}))
+
+	ctx := app.NewContext(0)
+	ctx.Request.SetRequestURI("http://localhost/users")
+	ctx.Set(ContextKeyTarget, "http://tenant-a/v2")
+	proxy.ServeHTTP(context.Background(), ctx)
+
+	ctx = app.NewContext(0)
+	ctx.Request.SetRequestURI("http://localhost/users")
+	u, _ := url.Parse("http://tenant-b")
+	ctx.Set(ContextKeyTarget, u)
+	proxy.ServeHTTP(context.Background(), ctx)
+
+	ctx = app.NewContext(0)
+	ctx.Request.SetRequestURI("http://localhost/users")
+	proxy.ServeHTTP(context.Background(), ctx)
+
+	assert.DeepEqual(t, []string{
+		"http://tenant-a/v2/users tenant-a",
+		"http://tenant-b/users tenant-b",
+		"http://backend/base/users backend",
+	}, called)
+}
+
+type countingClientFactory struct {
+	suite.ClientFactory
+	hostClients int32
+}
+
+func (f *countingClientFactory) NewHostClient() (protocolclient.HostClient, error) {
+	atomic.AddInt32(&f.hostClients, 1)
+	return f.ClientFactory.NewHostClient()
+}
+
+func TestReverseProxyClientFactory(t *testing.T) {
+	r := server.New(server.WithHostPorts("127.0.0.1:10022"))
+	r.GET("/proxy/backend", func(cc context.Context, ctx *app.RequestContext) {
+		ctx.String(200, "hi")
+	})
+	proxy, _ := NewSingleHostReverseProxy("http://127.0.0.1:10022/proxy")
+	cf := &countingClientFactory{ClientFactory: factory.NewClientFactory(&http1.ClientOptions{Dialer: standard.NewDialer()})}
+	proxy.SetClientFactory(cf)
+	r.GET("/backend", proxy.ServeHTTP)
+	go r.Spin()
+	defer r.Shutdown(context.TODO())
+	time.Sleep(time.Second)
+
+	cli, _ := client.NewClient()
+	for i := 0; i < 2; i++ {
+		status, body, err := cli.Get(context.Background(), nil, "http://127.0.0.1:10022/backend")
+		assert.Nil(t, err)
+		assert.DeepEqual(t, 200, status)
+		assert.DeepEqual(t, "hi", string(body))
+	}
+	assert.DeepEqual(t, int32(1), atomic.LoadInt32(&cf.hostClients))
+}
+
+func TestReverseProxyHeaderAllocs(t *testing.T) {
+	proxy, _ := NewSingleHostReverseProxy("http://backend")
+	ctx := app.NewContext(0)
+	allocs := testing.AllocsPerRun(100, func() {
+		ctx.Request.Header.Set("Connection", "keep-alive, X-Hop")
+		ctx.Request.Header.Set("X-Hop", "1")
+		ctx.Request.Header.Set("Keep-Alive", "timeout=5")
+		ctx.Request.Header.DelBytes([]byte("X-Forwarded-For"))
+		ctx.Request.Header.Set("X-Forwarded-For", "10.0.0.1")
+		proxy.prepareRequestHeaders(ctx)
+		ctx.Response.Header.Set("Connection", "X-Hop")
+		ctx.Response.Header.Set("X-Hop", "1")
+		ctx.Response.Header.Set("Keep-Alive", "timeout=5")
+		removeResponseHopHeaders(ctx, false)
+	})
+	if !raceEnabled {
+		assert.DeepEqual(t, float64(0), allocs)
+	}
+	assert.DeepEqual(t, "", ctx.Request.Header.Get("X-Hop"))
+	assert.DeepEqual(t, "", ctx.Request.Header.Get("Keep-Alive"))
+	xff := ctx.Request.Header.PeekAll("X-Forwarded-For")
+	assert.DeepEqual(t, "10.0.0.1, 0.0.0.0", string(xff[len(xff)-1]))
+	assert.DeepEqual(t, "", ctx.Response.Header.Get("X-Hop"))
+	assert.DeepEqual(t, "", ctx.Response.Header.Get("Keep-Alive"))
+}
+
+func TestRemoveHopHeaders(t *testing.T) {
+	for _, keepTrailer := range []bool{false, true} {
+		ctx := app.NewContext(0)
+		ctx.Request.Header.Set("Connection", "X-Listed, x-lower")
+		ctx.Request.Header.Set("X-Listed", "1")
+		ctx.Request.Header.Set("X-Lower", "1")
+		ctx.Request.Header.Set("Upgrade", "h2c")
+		ctx.Request.Header.Set("Proxy-Authorization", "secret")
+		ctx.Request.Header.Set("Trailer", "X-Checksum")
+		ctx.Request.Header.Set("X-Kept", "1")
+		removeRequestHopHeaders(ctx, keepTrailer)
+		var left []string
+		ctx.Request.Header.VisitAll(func(k, v []byte) {
+			left = append(left, string(k))
+		})
+		if keepTrailer {
+			assert.DeepEqual(t, []string{"Trailer", "X-Kept"}, left)
+		} else {
+			assert.DeepEqual(t, []string{"X-Kept"}, left)
+		}
+	}
+}
+
+func TestNextToken(t *testing.T) {
+	var tokens []string
+	for v := []byte(" keep-alive,\tX-Hop ,, Upgrade"); len(v) > 0; {
+		var token []byte
+		token, v = nextToken(v)
+		tokens = append(tokens, string(token))
+	}
+	assert.DeepEqual(t, []string{"keep-alive", "X-Hop", "", "Upgrade"}, tokens)
+}
+
+func BenchmarkReverseProxyHeaders(b *testing.B) {
+	proxy, _ := NewSingleHostReverseProxy("http://backend")
+	ctx := app.NewContext(0)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ctx.Request.Header.Set("Connection", "keep-alive")
+		ctx.Request.Header.DelBytes([]byte("X-Forwarded-For"))
+		ctx.Request.Header.Set("X-Forwarded-For", "10.0.0.1")
+		proxy.prepareRequestHeaders(ctx)
+		removeResponseHopHeaders(ctx, false)
+	}
+}
+
+func BenchmarkReverseProxyPassthrough(b *testing.B) {
+	proxy, _ := NewSingleHostReverseProxy("http://backend/base")
+	proxy.SetClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		resp.SetStatusCode(http.StatusOK)
+		return nil
+	}))
+	ctx := app.NewContext(0)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ctx.Reset()
+		ctx.Request.SetRequestURI("http://localhost/users?id=1")
+		ctx.Request.Header.Set("Accept", "application/json")
+		proxy.ServeHTTP(context.Background(), ctx)
+	}
+}
+
+func TestAddXForwardedFor(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.ParseIP("192.168.1.20"), Port: 4000}
+	for _, tt := range []struct {
+		prev []string
+		want string
+	}{
+		{nil, "192.168.1.20"},
+		{[]string{"10.0.0.1"}, "10.0.0.1, 192.168.1.20"},
+		{[]string{strings.Repeat("10.0.0.1, ", 20) + "10.0.0.2"}, strings.Repeat("10.0.0.1, ", 20) + "10.0.0.2, 192.168.1.20"},
+		{[]string{""}, ""},
+	} {
+		req := protocol.AcquireRequest()
+		for _, v := range tt.prev {
+			req.Header.Set("X-Forwarded-For", v)
+		}
+		addXForwardedFor(req, addr)
+		xff := req.Header.PeekAll("X-Forwarded-For")
+		assert.DeepEqual(t, tt.want, string(xff[len(xff)-1]))
+		protocol.ReleaseRequest(req)
+	}
+	v6 := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 4000}
+	req := protocol.AcquireRequest()
+	addXForwardedFor(req, v6)
+	assert.DeepEqual(t, "2001:db8::1", req.Header.Get("X-Forwarded-For"))
+	protocol.ReleaseRequest(req)
+	zoned := &net.TCPAddr{IP: net.ParseIP("fe80::1"), Port: 4000, Zone: "eth0"}
+	req = protocol.AcquireRequest()
+	addXForwardedFor(req, zoned)
+	assert.DeepEqual(t, "fe80::1", req.Header.Get("X-Forwarded-For"))
+	protocol.ReleaseRequest(req)
+}
+
+func BenchmarkXForwardedFor(b *testing.B) {
+	addr := &net.TCPAddr{IP: net.ParseIP("192.168.1.20"), Port: 4000}
+	for _, bb := range []struct {
+		name, prev string
+	}{
+		{"none", ""},
+		{"one", "10.0.0.1"},
+		{"long", strings.Repeat("10.0.0.1, ", 20) + "10.0.0.2"},
+	} {
+		prev := bb.prev
+		b.Run(bb.name, func(b *testing.B) {
+			req := protocol.AcquireRequest()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				req.Header.DelBytes([]byte("X-Forwarded-For"))
+				if prev != "" {
+					req.Header.Set("X-Forwarded-For", prev)
+				}
+				addXForwardedFor(req, addr)
+			}
+		})
+	}
+}
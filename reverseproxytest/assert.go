@@ -0,0 +1,94 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxytest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+// Serve calls handler, e.g. the ServeHTTP method of a proxy, with a request
+// for method and uri with body and returns its context holding the
+// response.
+func Serve(handler app.HandlerFunc, method, uri, body string) *app.RequestContext {
+	ctx := app.NewContext(0)
+	ctx.Request.SetMethod(method)
+	ctx.Request.SetRequestURI(uri)
+	if body != "" {
+		ctx.Request.SetBodyString(body)
+	}
+	handler(context.Background(), ctx)
+	return ctx
+}
+
+// AssertStatus fails t unless the response of ctx has status.
+func AssertStatus(t testing.TB, ctx *app.RequestContext, status int) {
+	t.Helper()
+	if got := ctx.Response.StatusCode(); got != status {
+		t.Errorf("status = %d, want %d", got, status)
+	}
+}
+
+// AssertHeader fails t unless the response of ctx has the header with
+// value, "" asserting that it is missing.
+func AssertHeader(t testing.TB, ctx *app.RequestContext, key, value string) {
+	t.Helper()
+	if got := string(ctx.Response.Header.Peek(key)); got != value {
+		t.Errorf("response header %s = %q, want %q", key, got, value)
+	}
+}
+
+// AssertBody fails t unless the response of ctx has body, reading it if it
+// is streamed.
+func AssertBody(t testing.TB, ctx *app.RequestContext, body string) {
+	t.Helper()
+	got, err := ctx.Response.BodyE()
+	if err != nil {
+		t.Errorf("reading the response body: %v", err)
+		return
+	}
+	if string(got) != body {
+		t.Errorf("body = %q, want %q", got, body)
+	}
+}
+
+// AssertForwardedURI fails t unless req, e.g. Backend.LastRequest, was
+// sent to uri.
+func AssertForwardedURI(t testing.TB, req *protocol.Request, uri string) {
+	t.Helper()
+	if req == nil {
+		t.Errorf("no request forwarded, want one to %s", uri)
+		return
+	}
+	if got := string(req.URI().FullURI()); got != uri {
+		t.Errorf("forwarded to %s, want %s", got, uri)
+	}
+}
+
+// AssertForwardedHeader fails t unless req, e.g. Backend.LastRequest, has
+// the header with value, "" asserting that it is missing.
+func AssertForwardedHeader(t testing.TB, req *protocol.Request, key, value string) {
+	t.Helper()
+	if req == nil {
+		t.Errorf("no request forwarded, want one with %s", key)
+		return
+	}
+	if got := string(req.Header.Peek(key)); got != value {
+		t.Errorf("forwarded header %s = %q, want %q", key, got, value)
+	}
+}
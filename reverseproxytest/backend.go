@@ -0,0 +1,187 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package reverseproxytest provides fake backends and assertions to test
+// directors, response modifiers and other hooks of reverseproxy without
+// starting servers:
+//
+//	backend := reverseproxytest.NewBackend(reverseproxytest.Reply(200, "ok"))
+//	proxy, _ := reverseproxy.NewReverseProxy("http://backend", reverseproxy.WithClient(backend))
+//	ctx := reverseproxytest.Serve(proxy.ServeHTTP, "GET", "http://localhost/users", "")
+//	reverseproxytest.AssertStatus(t, ctx, 200)
+//	reverseproxytest.AssertForwardedHeader(t, backend.LastRequest(), "X-Forwarded-For", "0.0.0.0")
+package reverseproxytest
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	errs "github.com/cloudwego/hertz/pkg/common/errors"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+// Response is a scripted answer of a Backend.
+type Response struct {
+	Status int
+	// Header are added to the response as key and value pairs.
+	Header [][2]string
+	Body   string
+	// Stream sends Body as a stream of unknown size, like a chunked
+	// response.
+	Stream bool
+	// Delay is waited before answering. Longer than the timeout of the
+	// request, the call fails with a timeout after it instead.
+	Delay time.Duration
+	// Err fails the call instead, see Disconnect and Refuse.
+	Err error
+}
+
+// Reply returns a Response with status and body.
+func Reply(status int, body string) Response {
+	return Response{Status: status, Body: body}
+}
+
+// WithHeader returns a copy of r with the header added.
+func (r Response) WithHeader(key, value string) Response {
+	r.Header = append(r.Header[:len(r.Header):len(r.Header)], [2]string{key, value})
+	return r
+}
+
+// WithDelay returns a copy of r answering after d.
+func (r Response) WithDelay(d time.Duration) Response {
+	r.Delay = d
+	return r
+}
+
+// Streamed returns a copy of r sending its body as a stream.
+func (r Response) Streamed() Response {
+	r.Stream = true
+	return r
+}
+
+// Disconnect fails the call like a backend closing the connection before
+// answering.
+func Disconnect() Response {
+	return Response{Err: errs.ErrConnectionClosed}
+}
+
+// Refuse fails the call like a backend which is down.
+func Refuse() Response {
+	return Response{Err: syscall.ECONNREFUSED}
+}
+
+// Backend is a fake backend answering calls with scripted responses, in
+// order, and then with its fallback. It implements reverseproxy.Doer, so
+// it is set with reverseproxy.WithClient or SetClient, and records the
+// requests it received. It is safe for concurrent use.
+type Backend struct {
+	mu       sync.Mutex
+	script   []Response
+	fallback Response
+	handler  func(req *protocol.Request) Response
+	requests []*protocol.Request
+}
+
+// NewBackend returns a Backend answering with responses in order and then
+// with the last one. Without responses it answers 200 with an empty body.
+func NewBackend(responses ...Response) *Backend {
+	b := &Backend{fallback: Reply(200, "")}
+	if len(responses) > 0 {
+		b.script = append(b.script, responses[:len(responses)-1]...)
+		b.fallback = responses[len(responses)-1]
+	}
+	return b
+}
+
+// HandleFunc answers calls after the scripted responses with f, e.g. to
+// answer depending on the path.
+func (b *Backend) HandleFunc(f func(req *protocol.Request) Response) *Backend {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handler = f
+	return b
+}
+
+// Do records req and answers it with the next response.
+func (b *Backend) Do(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+	recorded := &protocol.Request{}
+	req.CopyTo(recorded)
+	if req.IsBodyStream() {
+		body, err := ioutil.ReadAll(req.BodyStream())
+		if err != nil {
+			return err
+		}
+		recorded.SetBody(body)
+	}
+
+	b.mu.Lock()
+	b.requests = append(b.requests, recorded)
+	r := b.fallback
+	switch {
+	case len(b.script) > 0:
+		r, b.script = b.script[0], b.script[1:]
+	case b.handler != nil:
+		r = b.handler(recorded)
+	}
+	b.mu.Unlock()
+
+	if r.Delay > 0 {
+		if timeout := req.Options().RequestTimeout(); timeout > 0 && timeout < r.Delay {
+			time.Sleep(timeout)
+			return errs.ErrTimeout
+		}
+		time.Sleep(r.Delay)
+	}
+	if r.Err != nil {
+		return r.Err
+	}
+	resp.SetStatusCode(r.Status)
+	for _, h := range r.Header {
+		resp.Header.Add(h[0], h[1])
+	}
+	if r.Stream {
+		resp.SetBodyStream(strings.NewReader(r.Body), -1)
+	} else {
+		resp.SetBodyString(r.Body)
+	}
+	return nil
+}
+
+// Requests returns the requests received so far, with their bodies read.
+func (b *Backend) Requests() []*protocol.Request {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*protocol.Request(nil), b.requests...)
+}
+
+// LastRequest returns the last request received, nil if there was none.
+func (b *Backend) LastRequest() *protocol.Request {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.requests) == 0 {
+		return nil
+	}
+	return b.requests[len(b.requests)-1]
+}
+
+// Calls returns the number of requests received so far.
+func (b *Backend) Calls() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.requests)
+}
@@ -0,0 +1,92 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxytest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/hertz-contrib/reverseproxy"
+	"github.com/hertz-contrib/reverseproxy/reverseproxytest"
+)
+
+func TestBackend(t *testing.T) {
+	backend := reverseproxytest.NewBackend(
+		reverseproxytest.Refuse(),
+		reverseproxytest.Reply(201, "created").WithHeader("X-Id", "7"),
+		reverseproxytest.Reply(200, "streamed").Streamed(),
+	)
+	proxy, err := reverseproxy.NewReverseProxy("http://backend/api", reverseproxy.WithClient(backend))
+	assert.Nil(t, err)
+	proxy.SetModifyResponse(func(resp *protocol.Response) error {
+		resp.Header.Set("X-Modified", "1")
+		return nil
+	})
+
+	ctx := reverseproxytest.Serve(proxy.ServeHTTP, "POST", "http://localhost/users", "alice")
+	reverseproxytest.AssertStatus(t, ctx, 502)
+
+	ctx = reverseproxytest.Serve(proxy.ServeHTTP, "POST", "http://localhost/users", "alice")
+	reverseproxytest.AssertStatus(t, ctx, 201)
+	reverseproxytest.AssertHeader(t, ctx, "X-Id", "7")
+	reverseproxytest.AssertHeader(t, ctx, "X-Modified", "1")
+	reverseproxytest.AssertBody(t, ctx, "created")
+	reverseproxytest.AssertForwardedURI(t, backend.LastRequest(), "http://backend/api/users")
+	assert.DeepEqual(t, "alice", string(backend.LastRequest().Body()))
+
+	// the last response is repeated
+	for i := 0; i < 2; i++ {
+		ctx = reverseproxytest.Serve(proxy.ServeHTTP, "GET", "http://localhost/feed", "")
+		reverseproxytest.AssertBody(t, ctx, "streamed")
+	}
+	assert.DeepEqual(t, 4, backend.Calls())
+	assert.DeepEqual(t, 4, len(backend.Requests()))
+}
+
+func TestBackendHandleFunc(t *testing.T) {
+	backend := reverseproxytest.NewBackend().HandleFunc(func(req *protocol.Request) reverseproxytest.Response {
+		if string(req.URI().Path()) == "/gone" {
+			return reverseproxytest.Disconnect()
+		}
+		return reverseproxytest.Reply(200, string(req.Header.Peek("X-Tenant")))
+	})
+	proxy, err := reverseproxy.NewReverseProxy("http://backend", reverseproxy.WithClient(backend))
+	assert.Nil(t, err)
+	proxy.SetDirector(func(req *protocol.Request) {
+		req.Header.Set("X-Tenant", "acme")
+		req.SetRequestURI("http://backend" + string(req.URI().Path()))
+	})
+
+	ctx := reverseproxytest.Serve(proxy.ServeHTTP, "GET", "http://localhost/items", "")
+	reverseproxytest.AssertBody(t, ctx, "acme")
+	reverseproxytest.AssertForwardedHeader(t, backend.LastRequest(), "X-Tenant", "acme")
+
+	ctx = reverseproxytest.Serve(proxy.ServeHTTP, "POST", "http://localhost/gone", "")
+	reverseproxytest.AssertStatus(t, ctx, 502)
+}
+
+func TestBackendDelay(t *testing.T) {
+	backend := reverseproxytest.NewBackend(reverseproxytest.Reply(200, "slow").WithDelay(time.Second))
+	proxy, err := reverseproxy.NewReverseProxy("http://backend",
+		reverseproxy.WithClient(backend), reverseproxy.WithRequestTimeout(50*time.Millisecond))
+	assert.Nil(t, err)
+
+	start := time.Now()
+	ctx := reverseproxytest.Serve(proxy.ServeHTTP, "POST", "http://localhost/", "")
+	reverseproxytest.AssertStatus(t, ctx, 504)
+	assert.True(t, time.Since(start) < time.Second)
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxytest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// WSEchoBackend is a websocket backend sending every message back, ready
+// to be dialed once it is returned.
+type WSEchoBackend struct {
+	// URL is the ws:// URL of the backend, e.g. the target of
+	// reverseproxy.NewWSReverseProxy.
+	URL string
+
+	server   *httptest.Server
+	upgrader websocket.Upgrader
+
+	mu      sync.Mutex
+	headers []http.Header
+}
+
+// NewWSEchoBackend starts a WSEchoBackend on a local port.
+func NewWSEchoBackend() *WSEchoBackend {
+	b := &WSEchoBackend{}
+	b.server = httptest.NewServer(http.HandlerFunc(b.serve))
+	b.URL = "ws" + strings.TrimPrefix(b.server.URL, "http")
+	return b
+}
+
+func (b *WSEchoBackend) serve(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	b.headers = append(b.headers, r.Header.Clone())
+	b.mu.Unlock()
+	conn, err := b.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	for {
+		msgType, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err = conn.WriteMessage(msgType, msg); err != nil {
+			return
+		}
+	}
+}
+
+// Headers returns the headers of the upgrade requests received so far.
+func (b *WSEchoBackend) Headers() []http.Header {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]http.Header(nil), b.headers...)
+}
+
+// Close stops the backend and closes its connections.
+func (b *WSEchoBackend) Close() {
+	b.server.CloseClientConnections()
+	b.server.Close()
+}
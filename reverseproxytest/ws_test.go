@@ -0,0 +1,39 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxytest_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/gorilla/websocket"
+	"github.com/hertz-contrib/reverseproxy/reverseproxytest"
+)
+
+func TestWSEchoBackend(t *testing.T) {
+	backend := reverseproxytest.NewWSEchoBackend()
+	defer backend.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial(backend.URL, http.Header{"X-Tenant": []string{"acme"}})
+	assert.Nil(t, err)
+	defer conn.Close()
+	assert.Nil(t, conn.WriteMessage(websocket.TextMessage, []byte("hello")))
+	msgType, msg, err := conn.ReadMessage()
+	assert.Nil(t, err)
+	assert.DeepEqual(t, websocket.TextMessage, msgType)
+	assert.DeepEqual(t, "hello", string(msg))
+	assert.DeepEqual(t, "acme", backend.Headers()[0].Get("X-Tenant"))
+}
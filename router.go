@@ -0,0 +1,943 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/client"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/cloudwego/hertz/pkg/protocol/suite"
+)
+
+// Route maps matching requests to a backend target.
+type Route struct {
+	// Name labels the traffic of the route in metrics, logs and
+	// ContextKeyRoute, see ReverseProxy.SetName. Routes may share a name.
+	Name string
+
+	// Host restricts the route to requests for this host, compared
+	// case-insensitively and without port. A leading "*." matches any
+	// subdomain, e.g. "*.example.com" matches "a.example.com" and
+	// "a.b.example.com". Routes of the most specific host are tried
+	// first, then wildcards (longest first), then routes without Host.
+	Host string
+
+	// Methods restricts the route to these HTTP methods, e.g. GET routes
+	// to a read replica and POST to the primary. Empty means any method.
+	Methods []string
+
+	// Headers and Query restrict the route to requests carrying these
+	// header values and query arguments, e.g. {"X-Tenant": "acme"} or
+	// {"beta": "1"}. An empty value only requires presence. Among routes
+	// for the same path, routes with such predicates are tried first.
+	Headers map[string]string
+	Query   map[string]string
+
+	// Priority orders routes matching the same request: the highest
+	// priority wins. Routes for a more specific Host are still tried
+	// first. On equal priority, exact paths win over regular expressions,
+	// which win over prefixes (longest first); for the same path routes
+	// with predicates win, then the first declared one.
+	Priority int
+
+	// Director, ModifyResponse and ErrorHandler customize the route's
+	// ReverseProxy, see its setters. Director runs after the default
+	// director, which has already pointed the request to Target.
+	Director       func(req *protocol.Request)
+	ModifyResponse func(resp *protocol.Response) error
+	ErrorHandler   func(c *app.RequestContext, err error)
+
+	// ClientOptions gives the route its own client instead of the one
+	// shared by all routes, with these options added to those of the
+	// Router. The client is kept across table updates as long as the
+	// route keeps the same ClientOptions slice.
+	ClientOptions []config.ClientOption
+
+	// Path is the request path the route matches exactly. A path ending
+	// in "/" matches the whole subtree, e.g. "/api/" matches "/api/users";
+	// the longest matching prefix wins and exact paths take precedence.
+	//
+	// A path starting with "^" is a regular expression matched against the
+	// request path, e.g. `^/v(\d+)/users/(.*)$`. Regular expressions are
+	// tried in order after exact paths and before prefixes.
+	//
+	// Segments starting with ":" are parameters matching one segment and a
+	// last segment starting with "*" matches the rest of the path, e.g.
+	// "/users/:id/avatar" or "/static/*file". Such paths are matched like
+	// regular expressions.
+	Path string
+
+	// Target is the backend the request is forwarded to. As with
+	// NewSingleHostReverseProxy, the request path is appended to
+	// the target's base path.
+	//
+	// For regular expression routes Target is the complete URL instead,
+	// with $1, ${name} etc. replaced by the capture groups as in
+	// regexp.Regexp.Expand, e.g. "http://users-v$1/${2}". The query
+	// string of the request is appended. The same holds for paths with
+	// parameters, whose ":name" placeholders in Target are replaced by the
+	// parameter values, e.g. "/users/:id/avatar" to "http://media/:id/avatar.png".
+	//
+	// For other routes, Target may also be a unix domain socket, see
+	// NewSingleHostReverseProxy.
+	Target string
+
+	// StripPrefix removes the matched prefix of a subtree route from the
+	// request path before forwarding, "/api/users" becomes "/users". The
+	// prefix is sent in X-Forwarded-Prefix.
+	StripPrefix bool
+
+	// AddPrefix is prepended to the forwarded path, see ReverseProxy.SetAddPrefix.
+	AddPrefix string
+
+	// Timeout limits the time of the backend call. 0 means the default
+	// timeout of the Router, see SetDefaultTimeout.
+	Timeout time.Duration
+
+	// LongPolling marks a backend holding requests open until it has
+	// something to answer. The default timeout of the Router does not
+	// apply and the read timeout of the client is extended to Timeout,
+	// or DefaultLongPollingTimeout if Timeout is 0.
+	LongPolling bool
+
+	// Canary sends part of the requests of the route to another target.
+	Canary *Canary
+
+	// Experiment splits the clients of the route between variants. It
+	// cannot be combined with Canary.
+	Experiment *Experiment
+
+	// Balancer spreads the requests of the route across several targets,
+	// see ReverseProxy.SetBalancer, Target being used if it picks none.
+	// For patterns, the scheme and host of the picked target replace those
+	// of the expanded Target. It cannot be combined with Director, and
+	// canaries and variants with their own target do not use it.
+	Balancer Balancer
+}
+
+// DefaultLongPollingTimeout is the read timeout of long-polling routes
+// without Timeout.
+const DefaultLongPollingTimeout = 5 * time.Minute
+
+type compiledRoute struct {
+	Route
+	re *regexp.Regexp
+	// target is the template expanded with the submatches of re
+	target string
+	proxy  *ReverseProxy
+	// stats of Target, shared by routes with the same Target
+	stats *upstreamStats
+	// canary is the route to Canary.Target, if any
+	canary *compiledRoute
+	// variants are the routes of the variants of Experiment
+	variants      []*compiledRoute
+	variantName   string
+	variantWeight int
+}
+
+// pick returns the route serving the request: r, its canary or a variant.
+// assigned reports whether the client is newly assigned to the variant.
+func (r *compiledRoute) pick(c *app.RequestContext) (route *compiledRoute, assigned bool) {
+	if len(r.variants) > 0 {
+		if v, isNew := r.variant(c); v != nil {
+			return v, isNew
+		}
+		return r, false
+	}
+	if r.useCanary(c) {
+		return r.canary, false
+	}
+	return r, false
+}
+
+func (r *compiledRoute) serve(ctx context.Context, c *app.RequestContext) {
+	uri := c.Request.URI()
+	if r.proxy.originalURIHeader != "" && (r.re != nil || r.StripPrefix) {
+		if _, ok := c.Value(ContextKeyOriginalURI).(string); !ok {
+			c.Set(ContextKeyOriginalURI, string(uri.RequestURI()))
+		}
+	}
+	switch {
+	case r.re != nil:
+		path := b2s(uri.Path())
+		target := r.re.ExpandString(nil, r.target, path, r.re.FindStringSubmatchIndex(path))
+		if qs := uri.QueryString(); len(qs) > 0 {
+			if strings.IndexByte(r.target, '?') < 0 {
+				target = append(target, '?')
+			} else {
+				target = append(target, '&')
+			}
+			target = append(target, qs...)
+		}
+		c.Request.SetRequestURI(b2s(target))
+		if r.Balancer != nil {
+			if picked := r.Balancer.Pick(ctx, c); picked != "" {
+				base, uri := protocol.ParseURI(picked), c.Request.URI()
+				uri.SetSchemeBytes(base.Scheme())
+				uri.SetHostBytes(base.Host())
+				defer func(start time.Time) {
+					r.Balancer.Done(picked, c.Response.StatusCode(), time.Since(start))
+				}(time.Now())
+			}
+		}
+	case r.StripPrefix && isPrefixPath(r.Path):
+		uri.SetPathBytes(uri.Path()[len(r.Path)-1:])
+		addForwardedPrefix(&c.Request, r.Path[:len(r.Path)-1])
+	}
+	r.proxy.ServeHTTP(ctx, c)
+}
+
+func (r *compiledRoute) allows(method []byte) bool {
+	if len(r.Methods) == 0 {
+		return true
+	}
+	for _, m := range r.Methods {
+		if strings.EqualFold(m, b2s(method)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether the method and predicates of the route allow the request.
+func (r *compiledRoute) matches(c *app.RequestContext) bool {
+	if !r.allows(c.Request.Header.Method()) {
+		return false
+	}
+	for k, v := range r.Headers {
+		got := c.Request.Header.Peek(k)
+		if got == nil || (v != "" && b2s(got) != v) {
+			return false
+		}
+	}
+	for k, v := range r.Query {
+		got, ok := c.GetQuery(k)
+		if !ok || (v != "" && got != v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *compiledRoute) hasPredicates() bool {
+	return len(r.Headers) > 0 || len(r.Query) > 0
+}
+
+func (r *compiledRoute) overlaps(o *compiledRoute) bool {
+	if !reflect.DeepEqual(r.Headers, o.Headers) || !reflect.DeepEqual(r.Query, o.Query) {
+		return false
+	}
+	if len(r.Methods) == 0 || len(o.Methods) == 0 {
+		return true
+	}
+	for _, m := range o.Methods {
+		if r.allows(s2b(m)) {
+			return true
+		}
+	}
+	return false
+}
+
+func isPrefixPath(path string) bool {
+	return strings.HasSuffix(path, "/")
+}
+
+func isDefaultPath(path string) bool {
+	return path == "*"
+}
+
+func isRegexpPath(path string) bool {
+	return strings.HasPrefix(path, "^")
+}
+
+// isParamPath reports whether path has ":name" or "*name" segments.
+func isParamPath(path string) bool {
+	return strings.Contains(path, "/:") || strings.Contains(path, "/*")
+}
+
+// compileParamPath converts a path with parameters into a regular expression
+// with named groups and target into a template for regexp.Regexp.Expand.
+func compileParamPath(path, target string) (*regexp.Regexp, string, error) {
+	var b strings.Builder
+	b.WriteByte('^')
+	params := make(map[string]bool)
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		if i > 0 {
+			b.WriteByte('/')
+		}
+		if len(seg) < 2 || (seg[0] != ':' && seg[0] != '*') {
+			b.WriteString(regexp.QuoteMeta(seg))
+			continue
+		}
+		name := seg[1:]
+		if params[name] {
+			return nil, "", fmt.Errorf("reverseproxy: route %q: duplicate parameter %q", path, name)
+		}
+		params[name] = true
+		if seg[0] == '*' {
+			if i != len(segments)-1 {
+				return nil, "", fmt.Errorf("reverseproxy: route %q: %q must be the last segment", path, seg)
+			}
+			b.WriteString("(?P<" + name + ">.*)")
+		} else {
+			b.WriteString("(?P<" + name + ">[^/]+)")
+		}
+	}
+	b.WriteByte('$')
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, "", fmt.Errorf("reverseproxy: route %q: %w", path, err)
+	}
+
+	// escape "$" and replace ":name" of known parameters by "${name}"
+	var t strings.Builder
+	for i := 0; i < len(target); i++ {
+		switch target[i] {
+		case '$':
+			t.WriteString("$$")
+			continue
+		case ':':
+			j := i + 1
+			for j < len(target) && isParamNameByte(target[j]) {
+				j++
+			}
+			if params[target[i+1:j]] {
+				t.WriteString("${" + target[i+1:j] + "}")
+				i = j - 1
+				continue
+			}
+		}
+		t.WriteByte(target[i])
+	}
+	return re, t.String(), nil
+}
+
+func isParamNameByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// isMethodList reports whether s looks like "GET" or "GET,HEAD".
+func isMethodList(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if (s[i] < 'A' || s[i] > 'Z') && s[i] != ',' {
+			return false
+		}
+	}
+	return true
+}
+
+type pathTable struct {
+	// routes by Path, see sort for their order
+	routes map[string][]*compiledRoute
+	// distinct regular expression and parameter paths, in declaration order
+	regexp []string
+	// distinct prefix paths, longest first
+	prefix []string
+	// prioritized is set if routes differ in priority, so that
+	// every candidate has to be looked at
+	prioritized bool
+}
+
+func newPathTable() *pathTable {
+	return &pathTable{routes: make(map[string][]*compiledRoute)}
+}
+
+func (t *pathTable) add(r *compiledRoute) {
+	if _, ok := t.routes[r.Path]; !ok {
+		switch {
+		case r.re != nil:
+			t.regexp = append(t.regexp, r.Path)
+		case isPrefixPath(r.Path):
+			t.prefix = append(t.prefix, r.Path)
+		}
+	}
+	t.routes[r.Path] = append(t.routes[r.Path], r)
+	for _, routes := range t.routes {
+		if routes[0].Priority != r.Priority {
+			t.prioritized = true
+		}
+	}
+}
+
+func (t *pathTable) match(c *app.RequestContext, path string, drained *bool) *compiledRoute {
+	var best *compiledRoute
+	// better records r and reports whether the search is over
+	better := func(r *compiledRoute) bool {
+		if r != nil && (best == nil || r.Priority > best.Priority) {
+			best = r
+		}
+		return best != nil && !t.prioritized
+	}
+	if better(t.matchRoutes(c, path, drained)) {
+		return best
+	}
+	for _, p := range t.regexp {
+		if t.routes[p][0].re.MatchString(path) && better(t.matchRoutes(c, p, drained)) {
+			return best
+		}
+	}
+	for _, prefix := range t.prefix {
+		if strings.HasPrefix(path, prefix) && better(t.matchRoutes(c, prefix, drained)) {
+			return best
+		}
+	}
+	return best
+}
+
+// matchRoutes returns the first route for path matching the request whose
+// upstream is not draining. drained is set if such a route was skipped.
+func (t *pathTable) matchRoutes(c *app.RequestContext, path string, drained *bool) *compiledRoute {
+	for _, r := range t.routes[path] {
+		if r.matches(c) {
+			if r.stats.isDraining() {
+				*drained = true
+				continue
+			}
+			return r
+		}
+	}
+	return nil
+}
+
+// sort orders prefixes longest first and routes for the same path by
+// priority, then routes with predicates first.
+func (t *pathTable) sort() {
+	for _, routes := range t.routes {
+		sort.SliceStable(routes, func(i, j int) bool {
+			if routes[i].Priority != routes[j].Priority {
+				return routes[i].Priority > routes[j].Priority
+			}
+			return routes[i].hasPredicates() && !routes[j].hasPredicates()
+		})
+	}
+	sort.SliceStable(t.prefix, func(i, j int) bool {
+		return len(t.prefix[i]) > len(t.prefix[j])
+	})
+}
+
+type wildcardTable struct {
+	// suffix is the wildcard host without "*", e.g. ".example.com"
+	suffix string
+	paths  *pathTable
+}
+
+// clientKey identifies the client of a route by its first ClientOption,
+// if any, and its unix socket, if any.
+type clientKey struct {
+	options *config.ClientOption
+	socket  string
+}
+
+// routeTable is immutable once compiled, so that it can be read
+// without locking while Router swaps in new tables.
+type routeTable struct {
+	// routes the table was compiled from
+	routes []Route
+	// clients of routes with ClientOptions or unix socket targets
+	clients map[clientKey]*client.Client
+
+	hosts map[string]*pathTable
+	// wildcard hosts, longest first
+	wildcards []wildcardTable
+	anyHost   *pathTable
+	// fallback is the default route, may be nil
+	fallback *compiledRoute
+	// upstreams holds the stats of each target, kept across table updates
+	upstreams map[string]*upstreamStats
+}
+
+// match returns the route of the request, skipping routes of draining
+// upstreams. If there is none, drained reports whether one was skipped.
+func (t *routeTable) match(c *app.RequestContext) (route *compiledRoute, drained bool) {
+	path := b2s(c.Request.URI().Path())
+	if len(t.hosts) > 0 || len(t.wildcards) > 0 {
+		host := normalizeHost(b2s(c.Request.Host()))
+		if paths, ok := t.hosts[host]; ok {
+			if r := paths.match(c, path, &drained); r != nil {
+				return r, false
+			}
+		}
+		for _, w := range t.wildcards {
+			if strings.HasSuffix(host, w.suffix) {
+				if r := w.paths.match(c, path, &drained); r != nil {
+					return r, false
+				}
+			}
+		}
+	}
+	if r := t.anyHost.match(c, path, &drained); r != nil {
+		return r, false
+	}
+	if t.fallback != nil && t.fallback.stats.isDraining() {
+		return nil, true
+	}
+	if t.fallback != nil {
+		return t.fallback, false
+	}
+	return nil, drained
+}
+
+// normalizeHost lower-cases host and removes the port.
+func normalizeHost(host string) string {
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && !strings.Contains(host[i:], "]") {
+		host = host[:i]
+	}
+	return strings.ToLower(host)
+}
+
+func (t *routeTable) paths(host string) *pathTable {
+	if host == "" {
+		return t.anyHost
+	}
+	host = normalizeHost(host)
+	if strings.HasPrefix(host, "*.") {
+		suffix := host[1:]
+		for _, w := range t.wildcards {
+			if w.suffix == suffix {
+				return w.paths
+			}
+		}
+		t.wildcards = append(t.wildcards, wildcardTable{suffix: suffix, paths: newPathTable()})
+		return t.wildcards[len(t.wildcards)-1].paths
+	}
+	if t.hosts[host] == nil {
+		t.hosts[host] = newPathTable()
+	}
+	return t.hosts[host]
+}
+
+func (t *routeTable) sort() {
+	t.anyHost.sort()
+	for _, paths := range t.hosts {
+		paths.sort()
+	}
+	for _, w := range t.wildcards {
+		w.paths.sort()
+	}
+	sort.SliceStable(t.wildcards, func(i, j int) bool {
+		return len(t.wildcards[i].suffix) > len(t.wildcards[j].suffix)
+	})
+}
+
+// Router is a middleware forwarding requests to the target of the
+// matching route. Requests matching no route go to the default route,
+// if any, and are otherwise passed on to the next handler unless
+// SetNoMatchStatus is used. All routes share one client,
+// which streams response bodies.
+type Router struct {
+	client *client.Client
+	// options of client, for clients of unix socket targets
+	options []config.ClientOption
+	// table holds the current *routeTable
+	table atomic.Value
+	// mu serializes table updates
+	mu sync.Mutex
+
+	// defaultTimeout is the timeout of routes without Timeout
+	defaultTimeout time.Duration
+
+	// noMatchStatus is the status code of requests matching no route,
+	// 0 passes them on to the next handler
+	noMatchStatus int
+
+	// logger is set by SetLogger
+	logger Logger
+	// metrics is set by SetMetrics
+	metrics *Metrics
+	// originalURIHeader and originalMethodHeader are set by
+	// SetOriginalRequestHeaders
+	originalURIHeader    string
+	originalMethodHeader string
+
+	// file the routes are loaded from, see NewRouterFromFile
+	file string
+
+	// xdsBalancers are the balancers of the clusters of ApplyXDS by name,
+	// guarded by xdsMu
+	xdsBalancers map[string]*LeastTimeBalancer
+	xdsMu        sync.Mutex
+
+	// stats are the request counters, see Stats
+	stats *routerStats
+}
+
+// NewRouter returns a Router for routes. The config.ClientOption are
+// used to build the client shared by all routes.
+func NewRouter(routes []Route, options ...config.ClientOption) (*Router, error) {
+	options = append([]config.ClientOption{client.WithResponseBodyStream(true)}, options...)
+	c, err := client.NewClient(options...)
+	if err != nil {
+		return nil, err
+	}
+	rt := &Router{client: c, options: options, stats: &routerStats{}}
+	if err = rt.ReplaceTable(routes); err != nil {
+		return nil, err
+	}
+	return rt, nil
+}
+
+func (rt *Router) compile(routes []Route) (*routeTable, error) {
+	table := &routeTable{
+		routes:    routes,
+		clients:   make(map[clientKey]*client.Client),
+		upstreams: make(map[string]*upstreamStats),
+		hosts:     make(map[string]*pathTable),
+		anyHost:   newPathTable(),
+	}
+	prev, _ := rt.table.Load().(*routeTable)
+	for _, route := range routes {
+		if route.Path == "" || route.Target == "" {
+			return nil, fmt.Errorf("reverseproxy: route %q -> %q: path and target must not be empty", route.Path, route.Target)
+		}
+		cr := &compiledRoute{Route: route}
+		if isDefaultPath(route.Path) {
+			if route.Host != "" || len(route.Methods) > 0 || cr.hasPredicates() {
+				return nil, fmt.Errorf("reverseproxy: default route must not have host, methods, headers or query")
+			}
+			if table.fallback != nil {
+				return nil, fmt.Errorf("reverseproxy: duplicate default route")
+			}
+			table.fallback = cr
+		}
+		t := table.paths(route.Host)
+		for _, other := range t.routes[route.Path] {
+			if other.overlaps(cr) {
+				return nil, fmt.Errorf("reverseproxy: duplicate route for host %q, path %q and methods %v", route.Host, route.Path, route.Methods)
+			}
+		}
+		if err := rt.build(table, prev, cr); err != nil {
+			return nil, err
+		}
+		if c := route.Canary; c != nil {
+			if c.Target == "" {
+				return nil, fmt.Errorf("reverseproxy: route %q: canary target must not be empty", route.Path)
+			}
+			if c.Percent < 0 || c.Percent > 100 {
+				return nil, fmt.Errorf("reverseproxy: route %q: canary percent %d out of range [0, 100]", route.Path, c.Percent)
+			}
+			canary := route
+			canary.Target, canary.Canary, canary.Balancer = c.Target, nil, nil
+			cr.canary = &compiledRoute{Route: canary}
+			if err := rt.build(table, prev, cr.canary); err != nil {
+				return nil, err
+			}
+		}
+		if e := route.Experiment; e != nil {
+			if route.Canary != nil {
+				return nil, fmt.Errorf("reverseproxy: route %q: canary and experiment cannot be combined", route.Path)
+			}
+			if err := e.validate(route.Path); err != nil {
+				return nil, err
+			}
+			for _, v := range e.Variants {
+				variant := route
+				if v.Target != "" {
+					variant.Target, variant.Balancer = v.Target, nil
+				}
+				vr := &compiledRoute{Route: variant, variantName: v.Name, variantWeight: v.Weight}
+				if err := rt.build(table, prev, vr); err != nil {
+					return nil, err
+				}
+				cr.variants = append(cr.variants, vr)
+			}
+		}
+		if cr != table.fallback {
+			t.add(cr)
+		}
+	}
+	table.sort()
+	return table, nil
+}
+
+// build sets up the proxy, client and stats of cr.
+func (rt *Router) build(table, prev *routeTable, cr *compiledRoute) error {
+	route := cr.Route
+	target := route.Target
+	socket, httpTarget, isUnix := parseUnixTarget(target)
+	if isUnix {
+		target = httpTarget
+	}
+	switch {
+	case isRegexpPath(route.Path):
+		re, err := regexp.Compile(route.Path)
+		if err != nil {
+			return fmt.Errorf("reverseproxy: route %q: %w", route.Path, err)
+		}
+		cr.re, cr.target = re, route.Target
+	case isParamPath(route.Path):
+		re, target, err := compileParamPath(route.Path, route.Target)
+		if err != nil {
+			return err
+		}
+		cr.re, cr.target = re, target
+	}
+	if cr.re != nil && isUnix {
+		return fmt.Errorf("reverseproxy: route %q: unix socket targets are not supported for patterns", route.Path)
+	}
+	if route.Balancer != nil && route.Director != nil {
+		return fmt.Errorf("reverseproxy: route %q: balancer and director cannot be combined", route.Path)
+	}
+	if cr.re != nil {
+		// the target has already been expanded into the request URI
+		cr.proxy = &ReverseProxy{Target: route.Target, director: func(req *protocol.Request) {
+			req.Header.SetHostBytes(req.URI().Host())
+		}}
+	} else {
+		proxy, err := newSingleHostReverseProxy(target)
+		if err != nil {
+			return err
+		}
+		cr.proxy = proxy
+		// patterns pick their target in serve
+		cr.proxy.SetBalancer(route.Balancer)
+	}
+	if route.Director != nil {
+		director, routeDirector := cr.proxy.director, route.Director
+		cr.proxy.SetDirector(func(req *protocol.Request) {
+			director(req)
+			routeDirector(req)
+		})
+	}
+	cr.proxy.SetAddPrefix(route.AddPrefix)
+	timeout := route.Timeout
+	if timeout == 0 && !route.LongPolling {
+		timeout = rt.defaultTimeout
+	}
+	if timeout > 0 {
+		cr.proxy.clientBehavior = ClientDoTimeout(timeout)
+	}
+	if route.LongPolling {
+		readTimeout, director := route.Timeout, cr.proxy.director
+		if readTimeout == 0 {
+			readTimeout = DefaultLongPollingTimeout
+		}
+		cr.proxy.SetDirector(func(req *protocol.Request) {
+			director(req)
+			req.SetOptions(config.WithReadTimeout(readTimeout))
+		})
+	}
+	cr.proxy.modifyResponse = route.ModifyResponse
+	cr.proxy.errorHandler = route.ErrorHandler
+	cr.proxy.logger = rt.logger
+	cr.proxy.metrics = rt.metrics
+	cr.proxy.SetName(route.Name)
+	cr.proxy.SetOriginalRequestHeaders(rt.originalURIHeader, rt.originalMethodHeader)
+	cr.proxy.client = rt.client
+	if len(route.ClientOptions) > 0 || isUnix {
+		key, options := clientKey{socket: socket}, rt.options
+		if len(route.ClientOptions) > 0 {
+			// on top of the options of the router, which stream bodies
+			key.options, options = &route.ClientOptions[0], append(options[:len(options):len(options)], route.ClientOptions...)
+		}
+		c := table.clients[key]
+		if c == nil && prev != nil {
+			c = prev.clients[key]
+		}
+		if c == nil {
+			if isUnix {
+				options = append(options[:len(options):len(options)], withUnixSocket(socket))
+			}
+			var err error
+			if c, err = client.NewClient(options...); err != nil {
+				return fmt.Errorf("reverseproxy: route %q: %w", route.Path, err)
+			}
+		}
+		table.clients[key] = c
+		cr.proxy.client = c
+	}
+	cr.stats = table.upstreams[route.Target]
+	if cr.stats == nil && prev != nil {
+		cr.stats = prev.upstreams[route.Target]
+	}
+	if cr.stats == nil {
+		cr.stats = &upstreamStats{}
+	}
+	table.upstreams[route.Target] = cr.stats
+	cr.proxy.transferred = cr.stats.transferred
+	return nil
+}
+
+// Routes returns a copy of the current routes.
+func (rt *Router) Routes() []Route {
+	return append([]Route(nil), rt.loadTable().routes...)
+}
+
+// ReplaceTable atomically replaces all routes. It is safe to call while
+// serving: requests see either the old or the new routes, never a mix.
+func (rt *Router) ReplaceTable(routes []Route) error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.store(append([]Route(nil), routes...))
+}
+
+// AddRoute adds a route at runtime, see ReplaceTable.
+func (rt *Router) AddRoute(route Route) error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	routes := rt.loadTable().routes
+	return rt.store(append(routes[:len(routes):len(routes)], route))
+}
+
+// RemoveRoute removes the routes for host and path at runtime and returns
+// how many were removed, see ReplaceTable.
+func (rt *Router) RemoveRoute(host, path string) int {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	old := rt.loadTable().routes
+	routes := make([]Route, 0, len(old))
+	for _, route := range old {
+		if route.Host != host || route.Path != path {
+			routes = append(routes, route)
+		}
+	}
+	if len(routes) == len(old) {
+		return 0
+	}
+	// the remaining routes have been compiled before
+	_ = rt.store(routes)
+	return len(old) - len(routes)
+}
+
+// store compiles routes and swaps them in, rt.mu must be held.
+func (rt *Router) store(routes []Route) error {
+	table, err := rt.compile(routes)
+	if err != nil {
+		return err
+	}
+	rt.table.Store(table)
+	return nil
+}
+
+func (rt *Router) loadTable() *routeTable {
+	return rt.table.Load().(*routeTable)
+}
+
+// SetClientFactory sets the protocol of the client shared by all routes,
+// e.g. HTTP/2, see ReverseProxy.SetClientFactory. Routes with ClientOptions
+// keep their own client.
+func (rt *Router) SetClientFactory(cf suite.ClientFactory) {
+	rt.client.SetClientFactory(cf)
+}
+
+// SetDefaultTimeout sets the timeout of the backend call for routes
+// without Timeout, except long-polling ones, 0 means no limit.
+func (rt *Router) SetDefaultTimeout(timeout time.Duration) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.defaultTimeout = timeout
+	// the routes have been compiled before
+	_ = rt.store(rt.loadTable().routes)
+}
+
+// SetNoMatchStatus sets the status code returned for requests matching no
+// route when there is no default route, e.g. consts.StatusNotFound or consts.StatusBadGateway. With 0, the
+// default, such requests are passed on to the next handler.
+func (rt *Router) SetNoMatchStatus(statusCode int) {
+	rt.noMatchStatus = statusCode
+}
+
+// ServeHTTP forwards the request to the matching route. Otherwise it calls
+// the next handler or aborts with the status set by SetNoMatchStatus.
+func (rt *Router) ServeHTTP(ctx context.Context, c *app.RequestContext) {
+	if rt.Draining() {
+		rt.reject(c)
+		return
+	}
+	route, drained := rt.loadTable().match(c)
+	if drained {
+		rt.reject(c)
+		return
+	}
+	if route == nil {
+		atomic.AddInt64(&rt.stats.noMatch, 1)
+		if rt.noMatchStatus != 0 {
+			c.AbortWithStatus(rt.noMatchStatus)
+			return
+		}
+		c.Next(ctx)
+		return
+	}
+	atomic.AddInt64(&rt.stats.requests, 1)
+	atomic.AddInt64(&rt.stats.inFlight, 1)
+	route, assigned := route.pick(c)
+	if route.variantName != "" {
+		c.Set(ContextKeyVariant, route.variantName)
+	}
+	route.stats.begin()
+	route.serve(ctx, c)
+	route.stats.end(c.Response.StatusCode())
+	if assigned {
+		route.setVariantCookie(c)
+	}
+	atomic.AddInt64(&rt.stats.inFlight, -1)
+	c.Abort()
+}
+
+// reject answers a request arriving while draining.
+func (rt *Router) reject(c *app.RequestContext) {
+	atomic.AddInt64(&rt.stats.rejected, 1)
+	c.Response.Header.SetConnectionClose(true)
+	c.AbortWithStatus(consts.StatusServiceUnavailable)
+}
+
+// Proxy returns a middleware proxying requests whose path is a key of
+// table to the corresponding target. Keys ending in "/" match the whole
+// subtree, keys starting with "^" are regular expressions and the key "*"
+// is the default target for all other requests, see Route.
+// Keys may be preceded by a host, e.g. "*.example.com/static/", and by
+// comma-separated methods and a space, e.g. "GET,HEAD /reports".
+// For example
+//
+//	proxy, err := reverseproxy.Proxy(map[string]string{"/login": "http://auth:8080", "/api/": "http://api:8080"})
+//	h.Use(proxy)
+func Proxy(table map[string]string, options ...config.ClientOption) (app.HandlerFunc, error) {
+	routes := make([]Route, 0, len(table))
+	for key, target := range table {
+		route := Route{Path: key, Target: target}
+		if i := strings.IndexByte(route.Path, ' '); i > 0 && isMethodList(route.Path[:i]) {
+			route.Methods = strings.Split(route.Path[:i], ",")
+			route.Path = strings.TrimLeft(route.Path[i:], " ")
+		}
+		if i := strings.IndexByte(route.Path, '/'); i > 0 && !isRegexpPath(route.Path) {
+			route.Host, route.Path = route.Path[:i], route.Path[i:]
+		}
+		routes = append(routes, route)
+	}
+	// regular expressions are tried in order, keep it deterministic
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Host != routes[j].Host {
+			return routes[i].Host < routes[j].Host
+		}
+		return routes[i].Path < routes[j].Path
+	})
+	rt, err := NewRouter(routes, options...)
+	if err != nil {
+		return nil, err
+	}
+	return rt.ServeHTTP, nil
+}
@@ -0,0 +1,225 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is a time.Duration read from strings like "1.5s" in config files.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// RouteConfig is the config file representation of a Route.
+type RouteConfig struct {
+	Name        string            `json:"name,omitempty" yaml:"name,omitempty"`
+	Host        string            `json:"host,omitempty" yaml:"host,omitempty"`
+	Path        string            `json:"path" yaml:"path"`
+	Methods     []string          `json:"methods,omitempty" yaml:"methods,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Query       map[string]string `json:"query,omitempty" yaml:"query,omitempty"`
+	Priority    int               `json:"priority,omitempty" yaml:"priority,omitempty"`
+	Target      string            `json:"target" yaml:"target"`
+	StripPrefix bool              `json:"strip_prefix,omitempty" yaml:"strip_prefix,omitempty"`
+	AddPrefix   string            `json:"add_prefix,omitempty" yaml:"add_prefix,omitempty"`
+	Timeout     Duration          `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	LongPolling bool              `json:"long_polling,omitempty" yaml:"long_polling,omitempty"`
+	Canary      *Canary           `json:"canary,omitempty" yaml:"canary,omitempty"`
+	Experiment  *Experiment       `json:"experiment,omitempty" yaml:"experiment,omitempty"`
+}
+
+// Route converts the config into a Route.
+func (rc RouteConfig) Route() Route {
+	return Route{
+		Name:        rc.Name,
+		Host:        rc.Host,
+		Path:        rc.Path,
+		Methods:     rc.Methods,
+		Headers:     rc.Headers,
+		Query:       rc.Query,
+		Priority:    rc.Priority,
+		Target:      rc.Target,
+		StripPrefix: rc.StripPrefix,
+		AddPrefix:   rc.AddPrefix,
+		Timeout:     time.Duration(rc.Timeout),
+		LongPolling: rc.LongPolling,
+		Canary:      rc.Canary,
+		Experiment:  rc.Experiment,
+	}
+}
+
+// Config converts the route into a RouteConfig. Director, ModifyResponse,
+// ErrorHandler and ClientOptions have no config representation.
+func (r Route) Config() RouteConfig {
+	return RouteConfig{
+		Name:        r.Name,
+		Host:        r.Host,
+		Path:        r.Path,
+		Methods:     r.Methods,
+		Headers:     r.Headers,
+		Query:       r.Query,
+		Priority:    r.Priority,
+		Target:      r.Target,
+		StripPrefix: r.StripPrefix,
+		AddPrefix:   r.AddPrefix,
+		Timeout:     Duration(r.Timeout),
+		LongPolling: r.LongPolling,
+		Canary:      r.Canary,
+		Experiment:  r.Experiment,
+	}
+}
+
+// RoutesConfig is the content of a routes file, e.g. in YAML
+//
+//	routes:
+//	  - path: /api/
+//	    target: http://api:8080
+//	    strip_prefix: true
+//	    timeout: 3s
+//	    canary:
+//	      target: http://api-canary:8080
+//	      percent: 5
+//	      headers: {X-Canary: "1"}
+//	  - path: /reports
+//	    methods: [POST]
+//	    target: http://primary:8080
+//	apis:
+//	  - prefix: /orders/
+//	    header: X-API-Version
+//	    default: v2
+//	    versions:
+//	      - {name: v1, target: "http://orders-legacy:8080"}
+//	      - {name: v2, target: "http://orders:8080"}
+//
+// The routes of the APIs, see APIVersions, follow the routes.
+type RoutesConfig struct {
+	Routes []RouteConfig `json:"routes" yaml:"routes"`
+	APIs   []APIVersions `json:"apis,omitempty" yaml:"apis,omitempty"`
+}
+
+// LoadRoutes reads routes from a JSON file, or a YAML file if the name
+// ends in ".yaml" or ".yml".
+func LoadRoutes(path string) ([]Route, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rc RoutesConfig
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &rc)
+	default:
+		err = json.Unmarshal(data, &rc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reverseproxy: parse %s: %w", path, err)
+	}
+	routes := make([]Route, 0, len(rc.Routes))
+	for _, r := range rc.Routes {
+		routes = append(routes, r.Route())
+	}
+	for _, api := range rc.APIs {
+		apiRoutes, err := api.Routes()
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, apiRoutes...)
+	}
+	return routes, nil
+}
+
+// NewRouterFromFile returns a Router for the routes in file, see LoadRoutes.
+// Call Reload or WatchFile to pick up changes of the file.
+func NewRouterFromFile(file string, options ...config.ClientOption) (*Router, error) {
+	routes, err := LoadRoutes(file)
+	if err != nil {
+		return nil, err
+	}
+	rt, err := NewRouter(routes, options...)
+	if err != nil {
+		return nil, err
+	}
+	rt.file = file
+	return rt, nil
+}
+
+// Reload re-reads the file the Router was created from and atomically
+// replaces the routes. On error the current routes are kept.
+func (rt *Router) Reload() error {
+	if rt.file == "" {
+		return fmt.Errorf("reverseproxy: router was not created from a file")
+	}
+	routes, err := LoadRoutes(rt.file)
+	if err != nil {
+		return err
+	}
+	return rt.ReplaceTable(routes)
+}
+
+// WatchFile checks the file the Router was created from every interval
+// and reloads it when its modification time changes. Reload errors are
+// logged and the current routes are kept. Call the returned function to
+// stop watching; calling it again has no effect.
+func (rt *Router) WatchFile(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	var modTime time.Time
+	if fi, err := os.Stat(rt.file); err == nil {
+		modTime = fi.ModTime()
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			fi, err := os.Stat(rt.file)
+			if err != nil || fi.ModTime().Equal(modTime) {
+				continue
+			}
+			modTime = fi.ModTime()
+			if err = rt.Reload(); err != nil {
+				orHlog(rt.logger).Errorf(context.Background(), "HERTZ: reload routes from %s failed: %v", rt.file, err)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
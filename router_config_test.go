@@ -0,0 +1,98 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+)
+
+func TestLoadRoutes(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "routes.yaml")
+	assert.Nil(t, ioutil.WriteFile(yamlFile, []byte(`
+routes:
+  - path: /api/
+    target: http://api:8080
+    strip_prefix: true
+    add_prefix: /v2
+    timeout: 1500ms
+  - host: "*.example.com"
+    path: /reports
+    methods: [POST]
+    headers:
+      X-Tenant: acme
+    priority: 2
+    target: http://primary:8080
+    canary:
+      target: http://canary:8080
+      percent: 5
+      cookies: {canary: ""}
+`), 0o644))
+	routes, err := LoadRoutes(yamlFile)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, 2, len(routes))
+	assert.DeepEqual(t, Route{Path: "/api/", Target: "http://api:8080", StripPrefix: true, AddPrefix: "/v2", Timeout: 1500 * time.Millisecond}, routes[0])
+	assert.DeepEqual(t, "*.example.com", routes[1].Host)
+	assert.DeepEqual(t, []string{"POST"}, routes[1].Methods)
+	assert.DeepEqual(t, "acme", routes[1].Headers["X-Tenant"])
+	assert.DeepEqual(t, 2, routes[1].Priority)
+	assert.DeepEqual(t, &Canary{Target: "http://canary:8080", Percent: 5, Cookies: map[string]string{"canary": ""}}, routes[1].Canary)
+
+	jsonFile := filepath.Join(dir, "routes.json")
+	assert.Nil(t, ioutil.WriteFile(jsonFile, []byte(`{"routes": [{"path": "/a", "target": "http://a", "timeout": "2s"}]}`), 0o644))
+	routes, err = LoadRoutes(jsonFile)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, []Route{{Path: "/a", Target: "http://a", Timeout: 2 * time.Second}}, routes)
+
+	assert.Nil(t, ioutil.WriteFile(jsonFile, []byte(`{"routes": [{"path": "/a", "target": "http://a", "timeout": "2 weeks"}]}`), 0o644))
+	_, err = LoadRoutes(jsonFile)
+	assert.NotNil(t, err)
+}
+
+func TestRouterReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "routes.json")
+	assert.Nil(t, ioutil.WriteFile(file, []byte(`{"routes": [{"path": "/a", "target": "http://a"}]}`), 0o644))
+	rt, err := NewRouterFromFile(file)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, "http://a", rt.Routes()[0].Target)
+
+	assert.Nil(t, ioutil.WriteFile(file, []byte(`{"routes": [{"path": "/a", "target": "http://b"}]}`), 0o644))
+	assert.Nil(t, rt.Reload())
+	assert.DeepEqual(t, "http://b", rt.Routes()[0].Target)
+
+	// invalid content keeps the current routes
+	assert.Nil(t, ioutil.WriteFile(file, []byte(`{"routes": [{"path": "/a"}]}`), 0o644))
+	assert.NotNil(t, rt.Reload())
+	assert.DeepEqual(t, "http://b", rt.Routes()[0].Target)
+
+	stop := rt.WatchFile(10 * time.Millisecond)
+	defer stop()
+	assert.Nil(t, ioutil.WriteFile(file, []byte(`{"routes": [{"path": "/a", "target": "http://c"}]}`), 0o644))
+	future := time.Now().Add(time.Second)
+	assert.Nil(t, os.Chtimes(file, future, future))
+	deadline := time.Now().Add(2 * time.Second)
+	for rt.Routes()[0].Target != "http://c" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.DeepEqual(t, "http://c", rt.Routes()[0].Target)
+	// stop may be called more than once
+	stop()
+}
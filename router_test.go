@@ -0,0 +1,602 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/client"
+	"github.com/cloudwego/hertz/pkg/app/server"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestProxyTable(t *testing.T) {
+	backend := server.New(server.WithHostPorts("127.0.0.1:10000"))
+	backend.POST("/users/create", func(cc context.Context, ctx *app.RequestContext) {
+		if ctx.Request.Header.Get("Connection") != "" {
+			t.Errorf("backend got Connection header")
+		}
+		ctx.Response.Header.Set("X-Backend", "users")
+		ctx.Data(201, "text/plain", ctx.Request.Body())
+	})
+	go backend.Spin()
+
+	handler, err := Proxy(map[string]string{
+		"/create": "http://127.0.0.1:10000/users",
+		"/down":   "http://127.0.0.1:10009",
+	})
+	assert.Nil(t, err)
+	r := server.New(server.WithHostPorts("127.0.0.1:10001"))
+	r.Use(handler)
+	r.GET("/local", func(cc context.Context, ctx *app.RequestContext) {
+		ctx.String(200, "local")
+	})
+	go r.Spin()
+	time.Sleep(time.Second)
+
+	cli, _ := client.NewClient()
+	req := protocol.AcquireRequest()
+	resp := protocol.AcquireResponse()
+	req.SetMethod("POST")
+	req.SetBodyString("payload")
+	req.Header.Set("Connection", "keep-alive")
+	req.SetRequestURI("http://127.0.0.1:10001/create")
+	assert.Nil(t, cli.Do(context.Background(), req, resp))
+	assert.DeepEqual(t, 201, resp.StatusCode())
+	assert.DeepEqual(t, "users", resp.Header.Get("X-Backend"))
+	assert.DeepEqual(t, "payload", string(resp.Body()))
+
+	// unmatched requests fall through to the next handler
+	req.Reset()
+	resp.Reset()
+	req.SetRequestURI("http://127.0.0.1:10001/local")
+	assert.Nil(t, cli.Do(context.Background(), req, resp))
+	assert.DeepEqual(t, "local", string(resp.Body()))
+
+	// unreachable backend
+	req.Reset()
+	resp.Reset()
+	req.SetRequestURI("http://127.0.0.1:10001/down")
+	assert.Nil(t, cli.Do(context.Background(), req, resp))
+	assert.DeepEqual(t, 502, resp.StatusCode())
+}
+
+func TestNewRouterInvalid(t *testing.T) {
+	_, err := NewRouter([]Route{{Path: "/a"}})
+	assert.NotNil(t, err)
+	_, err = NewRouter([]Route{{Path: "/a", Target: "http://a"}, {Path: "/a", Target: "http://b"}})
+	assert.NotNil(t, err)
+}
+
+func TestRouterPrefix(t *testing.T) {
+	backend := server.New(server.WithHostPorts("127.0.0.1:10002"))
+	backend.GET("/*path", func(cc context.Context, ctx *app.RequestContext) {
+		ctx.String(200, string(ctx.Request.URI().Path()))
+	})
+	go backend.Spin()
+
+	rt, err := NewRouter([]Route{
+		{Path: "/api/", Target: "http://127.0.0.1:10002/a"},
+		{Path: "/api/v2/", Target: "http://127.0.0.1:10002/b", StripPrefix: true},
+		{Path: "/api/v2/exact", Target: "http://127.0.0.1:10002/c"},
+	})
+	assert.Nil(t, err)
+	r := server.New(server.WithHostPorts("127.0.0.1:10003"))
+	r.Use(rt.ServeHTTP)
+	go r.Spin()
+	time.Sleep(time.Second)
+
+	cli, _ := client.NewClient()
+	for _, tt := range []struct {
+		path string
+		want string
+	}{
+		{"/api/users", "/a/api/users"},
+		{"/api/v2/users", "/b/users"},
+		{"/api/v2/exact", "/c/api/v2/exact"},
+	} {
+		_, body, err := cli.Get(context.Background(), nil, "http://127.0.0.1:10003"+tt.path)
+		assert.Nil(t, err)
+		assert.DeepEqual(t, tt.want, string(body))
+	}
+}
+
+func TestRouterRegexp(t *testing.T) {
+	backend := server.New(server.WithHostPorts("127.0.0.1:10004"))
+	backend.GET("/*path", func(cc context.Context, ctx *app.RequestContext) {
+		ctx.String(200, string(ctx.Request.RequestURI()))
+	})
+	go backend.Spin()
+
+	handler, err := Proxy(map[string]string{
+		`^/v(\d+)/users/(.*)$`: "http://127.0.0.1:10004/users-v$1/${2}.json",
+		"/v1/":                 "http://127.0.0.1:10004/prefix",
+	})
+	assert.Nil(t, err)
+	r := server.New(server.WithHostPorts("127.0.0.1:10005"))
+	r.Use(handler)
+	go r.Spin()
+	time.Sleep(time.Second)
+
+	cli, _ := client.NewClient()
+	for _, tt := range []struct {
+		uri  string
+		want string
+	}{
+		{"/v2/users/42?fields=name", "/users-v2/42.json?fields=name"},
+		{"/v1/orders", "/prefix/v1/orders"},
+	} {
+		_, body, err := cli.Get(context.Background(), nil, "http://127.0.0.1:10005"+tt.uri)
+		assert.Nil(t, err)
+		assert.DeepEqual(t, tt.want, string(body))
+	}
+
+	_, err = NewRouter([]Route{{Path: "^/(", Target: "http://a"}})
+	assert.NotNil(t, err)
+}
+
+func TestRouterParams(t *testing.T) {
+	backend := server.New(server.WithHostPorts("127.0.0.1:10017"))
+	backend.GET("/*path", func(cc context.Context, ctx *app.RequestContext) {
+		ctx.String(200, string(ctx.Request.RequestURI()))
+	})
+	go backend.Spin()
+
+	handler, err := Proxy(map[string]string{
+		"/users/:id/avatar":    "http://127.0.0.1:10017/media/:id/avatar.png",
+		"/files/:bucket/*name": "http://127.0.0.1:10017/:bucket/$:name",
+	})
+	assert.Nil(t, err)
+	r := server.New(server.WithHostPorts("127.0.0.1:10018"))
+	r.Use(handler)
+	go r.Spin()
+	time.Sleep(time.Second)
+
+	cli, _ := client.NewClient()
+	for _, tt := range []struct {
+		uri    string
+		status int
+		want   string
+	}{
+		{"/users/42/avatar?size=64", 200, "/media/42/avatar.png?size=64"},
+		{"/files/docs/a/b.txt", 200, "/docs/$a/b.txt"},
+		{"/users/42/43/avatar", 404, ""},
+	} {
+		status, body, err := cli.Get(context.Background(), nil, "http://127.0.0.1:10018"+tt.uri)
+		assert.Nil(t, err)
+		assert.DeepEqual(t, tt.status, status)
+		if tt.status == 200 {
+			assert.DeepEqual(t, tt.want, string(body))
+		}
+	}
+
+	_, err = NewRouter([]Route{{Path: "/a/*rest/b", Target: "http://a"}})
+	assert.NotNil(t, err)
+	_, err = NewRouter([]Route{{Path: "/a/:id/:id", Target: "http://a"}})
+	assert.NotNil(t, err)
+}
+
+func TestRouterDefault(t *testing.T) {
+	backend := server.New(server.WithHostPorts("127.0.0.1:10020"))
+	backend.GET("/*path", func(cc context.Context, ctx *app.RequestContext) {
+		ctx.String(200, string(ctx.Request.URI().Path()))
+	})
+	go backend.Spin()
+
+	rt, err := NewRouter([]Route{
+		{Host: "api.example.com", Path: "/users", Target: "http://127.0.0.1:10020/api"},
+		{Path: "*", Target: "http://127.0.0.1:10020/default"},
+	})
+	assert.Nil(t, err)
+	rt.SetNoMatchStatus(http.StatusBadGateway)
+	r := server.New(server.WithHostPorts("127.0.0.1:10021"))
+	r.Use(rt.ServeHTTP)
+	go r.Spin()
+	time.Sleep(time.Second)
+
+	cli, _ := client.NewClient()
+	for _, tt := range []struct {
+		host string
+		uri  string
+		want string
+	}{
+		{"api.example.com", "/users", "/api/users"},
+		{"api.example.com", "/orders", "/default/orders"},
+		{"other.example.com", "/users", "/default/users"},
+	} {
+		req, resp := protocol.AcquireRequest(), protocol.AcquireResponse()
+		req.SetRequestURI("http://127.0.0.1:10021" + tt.uri)
+		req.Header.SetHost(tt.host)
+		assert.Nil(t, cli.Do(context.Background(), req, resp))
+		assert.DeepEqual(t, 200, resp.StatusCode())
+		assert.DeepEqual(t, tt.want, string(resp.Body()))
+	}
+
+	_, err = NewRouter([]Route{{Path: "*", Target: "http://a"}, {Path: "*", Target: "http://b"}})
+	assert.NotNil(t, err)
+	_, err = NewRouter([]Route{{Host: "a.com", Path: "*", Target: "http://a"}})
+	assert.NotNil(t, err)
+}
+
+func TestRouterHost(t *testing.T) {
+	backend := server.New(server.WithHostPorts("127.0.0.1:10006"))
+	backend.GET("/*path", func(cc context.Context, ctx *app.RequestContext) {
+		ctx.String(200, string(ctx.Request.URI().Path()))
+	})
+	go backend.Spin()
+
+	handler, err := Proxy(map[string]string{
+		"api.example.com/":      "http://127.0.0.1:10006/api",
+		"*.example.com/":        "http://127.0.0.1:10006/wildcard",
+		"*.eu.example.com/":     "http://127.0.0.1:10006/eu",
+		"api.example.com/local": "http://127.0.0.1:10006/api-local",
+		"/":                     "http://127.0.0.1:10006/default",
+	})
+	assert.Nil(t, err)
+	r := server.New(server.WithHostPorts("127.0.0.1:10007"))
+	r.Use(handler)
+	go r.Spin()
+	time.Sleep(time.Second)
+
+	cli, _ := client.NewClient()
+	for _, tt := range []struct {
+		host string
+		path string
+		want string
+	}{
+		{"API.example.com:10007", "/x", "/api/x"},
+		{"api.example.com", "/local", "/api-local/local"},
+		{"www.example.com", "/x", "/wildcard/x"},
+		{"a.eu.example.com", "/x", "/eu/x"},
+		{"example.com", "/x", "/default/x"},
+	} {
+		req := protocol.AcquireRequest()
+		resp := protocol.AcquireResponse()
+		req.SetRequestURI("http://127.0.0.1:10007" + tt.path)
+		req.Header.SetHost(tt.host)
+		assert.Nil(t, cli.Do(context.Background(), req, resp))
+		assert.DeepEqual(t, tt.want, string(resp.Body()))
+	}
+}
+
+func TestRouterMethods(t *testing.T) {
+	backend := server.New(server.WithHostPorts("127.0.0.1:10008"))
+	backend.Any("/*path", func(cc context.Context, ctx *app.RequestContext) {
+		ctx.String(200, string(ctx.Request.URI().Path()))
+	})
+	go backend.Spin()
+
+	handler, err := Proxy(map[string]string{
+		"GET,HEAD /reports": "http://127.0.0.1:10008/replica",
+		"POST /reports":     "http://127.0.0.1:10008/primary",
+	})
+	assert.Nil(t, err)
+	r := server.New(server.WithHostPorts("127.0.0.1:10010"))
+	r.Use(handler)
+	r.Any("/reports", func(cc context.Context, ctx *app.RequestContext) {
+		ctx.String(405, "not proxied")
+	})
+	go r.Spin()
+	time.Sleep(time.Second)
+
+	cli, _ := client.NewClient()
+	for _, tt := range []struct {
+		method string
+		want   string
+	}{
+		{"GET", "/replica/reports"},
+		{"POST", "/primary/reports"},
+		{"DELETE", "not proxied"},
+	} {
+		req := protocol.AcquireRequest()
+		resp := protocol.AcquireResponse()
+		req.SetMethod(tt.method)
+		req.SetRequestURI("http://127.0.0.1:10010/reports")
+		assert.Nil(t, cli.Do(context.Background(), req, resp))
+		assert.DeepEqual(t, tt.want, string(resp.Body()))
+	}
+
+	_, err = NewRouter([]Route{
+		{Path: "/a", Target: "http://a", Methods: []string{"GET", "POST"}},
+		{Path: "/a", Target: "http://b", Methods: []string{"post"}},
+	})
+	assert.NotNil(t, err)
+}
+
+func TestRouterPredicates(t *testing.T) {
+	backend := server.New(server.WithHostPorts("127.0.0.1:10011"))
+	backend.Any("/*path", func(cc context.Context, ctx *app.RequestContext) {
+		ctx.String(200, string(ctx.Request.URI().Path()))
+	})
+	go backend.Spin()
+
+	rt, err := NewRouter([]Route{
+		{Path: "/api/", Target: "http://127.0.0.1:10011/default"},
+		{Path: "/api/", Target: "http://127.0.0.1:10011/acme", Headers: map[string]string{"X-Tenant": "acme"}},
+		{Path: "/api/", Target: "http://127.0.0.1:10011/beta", Query: map[string]string{"beta": "1"}},
+	})
+	assert.Nil(t, err)
+	r := server.New(server.WithHostPorts("127.0.0.1:10012"))
+	r.Use(rt.ServeHTTP)
+	go r.Spin()
+	time.Sleep(time.Second)
+
+	cli, _ := client.NewClient()
+	for _, tt := range []struct {
+		uri    string
+		tenant string
+		want   string
+	}{
+		{"/api/x", "", "/default/api/x"},
+		{"/api/x", "acme", "/acme/api/x"},
+		{"/api/x", "other", "/default/api/x"},
+		{"/api/x?beta=1", "", "/beta/api/x"},
+		{"/api/x?beta=2", "", "/default/api/x"},
+	} {
+		req := protocol.AcquireRequest()
+		resp := protocol.AcquireResponse()
+		req.SetRequestURI("http://127.0.0.1:10012" + tt.uri)
+		if tt.tenant != "" {
+			req.Header.Set("X-Tenant", tt.tenant)
+		}
+		assert.Nil(t, cli.Do(context.Background(), req, resp))
+		assert.DeepEqual(t, tt.want, string(resp.Body()))
+	}
+}
+
+func TestRouterPriority(t *testing.T) {
+	backend := server.New(server.WithHostPorts("127.0.0.1:10013"))
+	backend.Any("/*path", func(cc context.Context, ctx *app.RequestContext) {
+		ctx.String(200, string(ctx.Request.URI().Path()))
+	})
+	go backend.Spin()
+
+	rt, err := NewRouter([]Route{
+		{Path: "/api/users", Target: "http://127.0.0.1:10013/exact"},
+		{Path: "/api/", Target: "http://127.0.0.1:10013/maintenance", Priority: 10, Headers: map[string]string{"X-Maintenance": ""}},
+		{Path: `^/api/(.*)$`, Target: "http://127.0.0.1:10013/regexp/$1"},
+	})
+	assert.Nil(t, err)
+	rt.SetNoMatchStatus(404)
+	r := server.New(server.WithHostPorts("127.0.0.1:10014"))
+	r.Use(rt.ServeHTTP)
+	r.GET("/local", func(cc context.Context, ctx *app.RequestContext) {
+		ctx.String(200, "local")
+	})
+	go r.Spin()
+	time.Sleep(time.Second)
+
+	cli, _ := client.NewClient()
+	for _, tt := range []struct {
+		uri         string
+		maintenance bool
+		code        int
+		want        string
+	}{
+		{"/api/users", false, 200, "/exact/api/users"},
+		{"/api/orders", false, 200, "/regexp/orders"},
+		{"/api/users", true, 200, "/maintenance/api/users"},
+		{"/local", false, 404, ""},
+	} {
+		req := protocol.AcquireRequest()
+		resp := protocol.AcquireResponse()
+		req.SetRequestURI("http://127.0.0.1:10014" + tt.uri)
+		if tt.maintenance {
+			req.Header.Set("X-Maintenance", "1")
+		}
+		assert.Nil(t, cli.Do(context.Background(), req, resp))
+		assert.DeepEqual(t, tt.code, resp.StatusCode())
+		if tt.want != "" {
+			assert.DeepEqual(t, tt.want, string(resp.Body()))
+		}
+	}
+}
+
+func TestRouterDynamicUpdates(t *testing.T) {
+	rt, err := NewRouter(nil)
+	assert.Nil(t, err)
+
+	c := app.NewContext(0)
+	c.Request.SetRequestURI("http://example.com/a")
+	route, _ := rt.loadTable().match(c)
+	assert.Nil(t, route)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			rc := app.NewContext(0)
+			rc.Request.SetRequestURI("http://example.com/a")
+			rt.loadTable().match(rc)
+		}
+	}()
+	assert.Nil(t, rt.AddRoute(Route{Path: "/a", Target: "http://a"}))
+	assert.Nil(t, rt.AddRoute(Route{Path: "/b/", Target: "http://b"}))
+	assert.NotNil(t, rt.AddRoute(Route{Path: "/a", Target: "http://dup"}))
+	<-done
+
+	assert.DeepEqual(t, 2, len(rt.Routes()))
+	route, _ = rt.loadTable().match(c)
+	assert.DeepEqual(t, "http://a", route.Target)
+
+	assert.DeepEqual(t, 1, rt.RemoveRoute("", "/a"))
+	assert.DeepEqual(t, 0, rt.RemoveRoute("", "/a"))
+	route, _ = rt.loadTable().match(c)
+	assert.Nil(t, route)
+
+	assert.Nil(t, rt.ReplaceTable([]Route{{Path: "/", Target: "http://root"}}))
+	route, _ = rt.loadTable().match(c)
+	assert.DeepEqual(t, "http://root", route.Target)
+}
+
+func TestRouterPerRouteHooks(t *testing.T) {
+	backend := server.New(server.WithHostPorts("127.0.0.1:10015"))
+	backend.Any("/*path", func(cc context.Context, ctx *app.RequestContext) {
+		ctx.String(200, ctx.Request.Header.Get("X-Route"))
+	})
+	go backend.Spin()
+
+	opts := []config.ClientOption{client.WithDialTimeout(time.Second)}
+	rt, err := NewRouter([]Route{
+		{
+			Path:   "/a",
+			Target: "http://127.0.0.1:10015",
+			Director: func(req *protocol.Request) {
+				req.Header.Set("X-Route", "a")
+			},
+			ModifyResponse: func(resp *protocol.Response) error {
+				resp.Header.Set("X-Modified", "a")
+				return nil
+			},
+			ClientOptions: opts,
+		},
+		{
+			Path:   "/down",
+			Target: "http://127.0.0.1:10019",
+			ErrorHandler: func(c *app.RequestContext, err error) {
+				c.Response.SetStatusCode(http.StatusServiceUnavailable)
+			},
+		},
+	})
+	assert.Nil(t, err)
+	own := rt.loadTable().clients[clientKey{options: &opts[0]}]
+	assert.NotNil(t, own)
+	// the route's client streams bodies like the shared one
+	assert.True(t, own.GetOptions().ResponseBodyStream)
+	assert.DeepEqual(t, time.Second, own.GetOptions().DialTimeout)
+	assert.Nil(t, rt.AddRoute(Route{Path: "/b", Target: "http://127.0.0.1:10015"}))
+	assert.DeepEqual(t, own, rt.loadTable().clients[clientKey{options: &opts[0]}])
+
+	r := server.New(server.WithHostPorts("127.0.0.1:10016"))
+	r.Use(rt.ServeHTTP)
+	go r.Spin()
+	time.Sleep(time.Second)
+
+	cli, _ := client.NewClient()
+	req := protocol.AcquireRequest()
+	resp := protocol.AcquireResponse()
+	req.SetRequestURI("http://127.0.0.1:10016/a")
+	assert.Nil(t, cli.Do(context.Background(), req, resp))
+	assert.DeepEqual(t, "a", string(resp.Body()))
+	assert.DeepEqual(t, "a", resp.Header.Get("X-Modified"))
+
+	req.SetRequestURI("http://127.0.0.1:10016/b")
+	assert.Nil(t, cli.Do(context.Background(), req, resp))
+	assert.DeepEqual(t, "", string(resp.Body()))
+	assert.DeepEqual(t, "", resp.Header.Get("X-Modified"))
+
+	req.SetRequestURI("http://127.0.0.1:10016/down")
+	assert.Nil(t, cli.Do(context.Background(), req, resp))
+	assert.DeepEqual(t, http.StatusServiceUnavailable, resp.StatusCode())
+}
+
+func TestRouterLongPolling(t *testing.T) {
+	backend := server.New(server.WithHostPorts("127.0.0.1:10030"))
+	backend.GET("/*path", func(cc context.Context, ctx *app.RequestContext) {
+		time.Sleep(500 * time.Millisecond)
+		ctx.String(200, "done")
+	})
+	go backend.Spin()
+
+	rt, err := NewRouter([]Route{
+		{Path: "/slow", Target: "http://127.0.0.1:10030"},
+		{Path: "/poll", Target: "http://127.0.0.1:10030", LongPolling: true},
+	}, client.WithClientReadTimeout(200*time.Millisecond))
+	assert.Nil(t, err)
+	r := server.New(server.WithHostPorts("127.0.0.1:10031"))
+	r.Use(rt.ServeHTTP)
+	go r.Spin()
+	time.Sleep(time.Second)
+
+	cli, _ := client.NewClient()
+	status, _, err := cli.Get(context.Background(), nil, "http://127.0.0.1:10031/slow")
+	assert.Nil(t, err)
+	assert.DeepEqual(t, http.StatusGatewayTimeout, status)
+	status, body, err := cli.Get(context.Background(), nil, "http://127.0.0.1:10031/poll")
+	assert.Nil(t, err)
+	assert.DeepEqual(t, 200, status)
+	assert.DeepEqual(t, "done", string(body))
+
+	rt.SetDefaultTimeout(time.Second)
+	paths := rt.loadTable().anyHost
+	assert.DeepEqual(t, ClientDoTimeout(time.Second), paths.routes["/slow"][0].proxy.clientBehavior)
+	assert.DeepEqual(t, ClientDo(), paths.routes["/poll"][0].proxy.clientBehavior)
+}
+
+// cycleBalancer picks its targets in turn and records the Done calls.
+type cycleBalancer struct {
+	targets []string
+	picks   int
+	done    []string
+}
+
+func (b *cycleBalancer) Pick(ctx context.Context, c *app.RequestContext) string {
+	target := b.targets[b.picks%len(b.targets)]
+	b.picks++
+	return target
+}
+
+func (b *cycleBalancer) Done(target string, statusCode int, latency time.Duration) {
+	b.done = append(b.done, fmt.Sprintf("%s %d", target, statusCode))
+}
+
+func TestRouterBalancer(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1:10068", "127.0.0.1:10069"} {
+		backend := server.New(server.WithHostPorts(addr))
+		backend.GET("/*path", func(cc context.Context, ctx *app.RequestContext) {
+			ctx.String(200, string(ctx.Host())+string(ctx.Request.RequestURI()))
+		})
+		go backend.Spin()
+	}
+	time.Sleep(time.Second)
+
+	b := &cycleBalancer{targets: []string{"http://127.0.0.1:10068", "http://127.0.0.1:10069"}}
+	rt, err := NewRouter([]Route{
+		{Path: "/api/", Target: "http://127.0.0.1:10068", Balancer: b},
+		{Path: `^/v(\d+)/users$`, Target: "http://127.0.0.1:10068/users-v$1", Balancer: b},
+		{Path: "/canary", Target: "http://127.0.0.1:10068", Balancer: b, Canary: &Canary{Target: "http://127.0.0.1:10068", Percent: 100}},
+	})
+	assert.Nil(t, err)
+
+	var got []string
+	for _, uri := range []string{"/api/a", "/api/b", "/v1/users", "/v2/users?id=1", "/canary"} {
+		ctx := app.NewContext(0)
+		ctx.Request.SetRequestURI("http://localhost" + uri)
+		rt.ServeHTTP(context.Background(), ctx)
+		got = append(got, string(ctx.Response.Body()))
+	}
+	assert.DeepEqual(t, []string{
+		"127.0.0.1:10068/api/a",
+		"127.0.0.1:10069/api/b",
+		"127.0.0.1:10068/users-v1",
+		"127.0.0.1:10069/users-v2?id=1",
+		// the canary has its own target
+		"127.0.0.1:10068/canary",
+	}, got)
+	assert.DeepEqual(t, []string{
+		"http://127.0.0.1:10068 200", "http://127.0.0.1:10069 200",
+		"http://127.0.0.1:10068 200", "http://127.0.0.1:10069 200",
+	}, b.done)
+
+	_, err = NewRouter([]Route{{Path: "/", Target: "http://a", Balancer: b, Director: func(req *protocol.Request) {}}})
+	assert.NotNil(t, err)
+}
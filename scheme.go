@@ -0,0 +1,53 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// SchemeFunc returns the scheme, "http" or "https", of the backend request
+// for the incoming request c, or "" to keep the scheme of the target.
+type SchemeFunc func(ctx context.Context, c *app.RequestContext) string
+
+// IncomingScheme is a SchemeFunc forwarding over https if c arrived over
+// TLS and over http otherwise.
+func IncomingScheme(_ context.Context, c *app.RequestContext) string {
+	if bytes.Equal(c.Request.URI().Scheme(), []byte("https")) {
+		return "https"
+	}
+	return "http"
+}
+
+// SetSchemeFunc sets f to choose the scheme of each backend request instead
+// of always using the scheme of the target, e.g. IncomingScheme. f is called
+// before the director, and its result replaces the scheme of the URI set by
+// the director; the host and port are kept. The client must be configured
+// for TLS to forward over https.
+func (r *ReverseProxy) SetSchemeFunc(f SchemeFunc) {
+	r.schemeFunc = f
+}
+
+// backendScheme returns the scheme chosen by the SchemeFunc of r, if any,
+// before the director rewrites the request URI.
+func (r *ReverseProxy) backendScheme(ctx context.Context, c *app.RequestContext) string {
+	if r.schemeFunc == nil {
+		return ""
+	}
+	return r.schemeFunc(ctx, c)
+}
@@ -0,0 +1,59 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestSchemeFunc(t *testing.T) {
+	var got string
+	proxy, err := NewReverseProxy("http://backend:8080/api", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		got = req.URI().String()
+		return nil
+	})))
+	assert.Nil(t, err)
+
+	serve := func(tls bool) {
+		ctx := app.NewContext(0)
+		ctx.Request.SetIsTLS(tls)
+		ctx.Request.Header.SetHost("example.com")
+		ctx.Request.Header.SetRequestURIBytes([]byte("/users?id=1"))
+		proxy.ServeHTTP(context.Background(), ctx)
+	}
+
+	serve(true)
+	assert.DeepEqual(t, "http://backend:8080/api/users?id=1", got)
+
+	proxy.SetSchemeFunc(IncomingScheme)
+	serve(true)
+	assert.DeepEqual(t, "https://backend:8080/api/users?id=1", got)
+	serve(false)
+	assert.DeepEqual(t, "http://backend:8080/api/users?id=1", got)
+
+	proxy.SetSchemeFunc(func(_ context.Context, c *app.RequestContext) string {
+		return string(c.Request.Header.Peek("X-Forwarded-Proto"))
+	})
+	ctx := app.NewContext(0)
+	ctx.Request.SetRequestURI("http://example.com/users")
+	ctx.Request.Header.Set("X-Forwarded-Proto", "https")
+	proxy.ServeHTTP(context.Background(), ctx)
+	assert.DeepEqual(t, "https://backend:8080/api/users", got)
+}
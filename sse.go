@@ -0,0 +1,203 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+// DefaultSSEMaxReconnects is the number of attempts to re-establish a
+// dropped event stream if SSEOptions.MaxReconnects is 0.
+const DefaultSSEMaxReconnects = 3
+
+// SSEOptions configures the handling of server-sent events (responses
+// of type text/event-stream), see ReverseProxy.SetSSE. The Last-Event-ID
+// header of reconnecting clients is forwarded to the backend as is.
+type SSEOptions struct {
+	// Retry is sent to clients as reconnection time when positive.
+	Retry time.Duration
+
+	// Reconnect re-establishes the backend stream with the Last-Event-ID
+	// of the last event forwarded when the backend drops it, transparently
+	// for the client. It requires a client streaming response bodies,
+	// see client.WithResponseBodyStream.
+	Reconnect bool
+	// MaxReconnects limits consecutive attempts without receiving an event,
+	// 0 means DefaultSSEMaxReconnects.
+	MaxReconnects int
+	// ReconnectDelay is waited before each attempt.
+	ReconnectDelay time.Duration
+}
+
+// SetSSE enables the handling of server-sent events.
+func (r *ReverseProxy) SetSSE(opts SSEOptions) {
+	if opts.MaxReconnects == 0 {
+		opts.MaxReconnects = DefaultSSEMaxReconnects
+	}
+	r.sse = &opts
+}
+
+func isEventStream(resp *protocol.Response) bool {
+	return bytes.HasPrefix(resp.Header.ContentType(), []byte("text/event-stream"))
+}
+
+// proxySSE injects the retry hint into an event stream and, if enabled,
+// reconnects to the backend when it drops the stream. req is a copy of
+// the request sent to the backend if reconnecting is enabled, else nil.
+// proxySSE reports whether it took req over, to release it once the
+// stream ends.
+func (r *ReverseProxy) proxySSE(ctx context.Context, req *protocol.Request, resp *protocol.Response) (keptReq bool) {
+	if resp.StatusCode() != 200 || resp.MustSkipBody() || !isEventStream(resp) {
+		return false
+	}
+	var retry []byte
+	if r.sse.Retry > 0 {
+		retry = []byte("retry: " + strconv.FormatInt(r.sse.Retry.Milliseconds(), 10) + "\n\n")
+	}
+	if !resp.IsBodyStream() {
+		if retry != nil {
+			resp.SetBody(append(retry, resp.Body()...))
+		}
+		return false
+	}
+
+	pr, pw := io.Pipe()
+	src := resp.BodyStream()
+	go func() {
+		defer releaseRequest(req)
+		if retry != nil {
+			if _, err := pw.Write(retry); err != nil {
+				closeBody(src)
+				return
+			}
+		}
+		var lastID []byte
+		attempts := 0
+		for {
+			n, err := copyEvents(pw, src, &lastID)
+			closeBody(src)
+			if n > 0 {
+				attempts = 0
+			}
+			if err == errClientGone || req == nil || attempts >= r.sse.MaxReconnects {
+				pw.CloseWithError(err)
+				return
+			}
+			attempts++
+			time.Sleep(r.sse.ReconnectDelay)
+			if src = r.reconnectSSE(ctx, req, lastID); src == nil {
+				pw.Close()
+				return
+			}
+		}
+	}()
+	resp.SetBodyStreamNoReset(pr, -1)
+	return true
+}
+
+// reconnectSSE requests the event stream again from the backend and
+// returns its body, or nil on failure.
+func (r *ReverseProxy) reconnectSSE(ctx context.Context, req *protocol.Request, lastID []byte) io.Reader {
+	if lastID != nil {
+		req.Header.Set("Last-Event-ID", string(lastID))
+	}
+	resp := protocol.AcquireResponse()
+	if err := r.doClientBehavior(ctx, req, resp); err != nil {
+		r.log().Errorf(ctx, "HERTZ: reconnect event stream failed: %v", err)
+		protocol.ReleaseResponse(resp)
+		return nil
+	}
+	if resp.StatusCode() != 200 || !isEventStream(resp) || !resp.IsBodyStream() {
+		r.log().Errorf(ctx, "HERTZ: reconnect event stream failed: status %d", resp.StatusCode())
+		resp.CloseBodyStream()
+		protocol.ReleaseResponse(resp)
+		return nil
+	}
+	return &sseBody{resp: resp}
+}
+
+// sseBody is the body of a reconnected stream, closing releases resp.
+type sseBody struct {
+	resp *protocol.Response
+}
+
+func (b *sseBody) Read(p []byte) (int, error) { return b.resp.BodyStream().Read(p) }
+
+func (b *sseBody) Close() error {
+	err := b.resp.CloseBodyStream()
+	protocol.ReleaseResponse(b.resp)
+	return err
+}
+
+func releaseRequest(req *protocol.Request) {
+	if req != nil {
+		protocol.ReleaseRequest(req)
+	}
+}
+
+func closeBody(r io.Reader) {
+	if closer, ok := r.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+type sseError string
+
+func (e sseError) Error() string { return string(e) }
+
+const errClientGone = sseError("client closed the event stream")
+
+// copyEvents copies complete events from src to dst, so that a dropped
+// stream does not leave a partial event, and records their ids. It
+// returns the number of events copied.
+func copyEvents(dst io.Writer, src io.Reader, lastID *[]byte) (n int, err error) {
+	br := bufio.NewReader(src)
+	var event []byte
+	var id []byte
+	for {
+		line, err := br.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			event = append(event, line...)
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		event = append(event, line...)
+		trimmed := bytes.TrimRight(line, "\r\n")
+		if len(trimmed) > 0 {
+			if bytes.HasPrefix(trimmed, []byte("id:")) {
+				id = bytes.TrimPrefix(trimmed[3:], []byte(" "))
+				id = append([]byte(nil), id...)
+			}
+			continue
+		}
+		if _, err = dst.Write(event); err != nil {
+			return n, errClientGone
+		}
+		if id != nil {
+			*lastID, id = id, nil
+		}
+		event = event[:0]
+		n++
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/client"
+	"github.com/cloudwego/hertz/pkg/app/server"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+)
+
+func TestReverseProxySSE(t *testing.T) {
+	var (
+		mu           sync.Mutex
+		lastEventIDs []string
+	)
+	backend := server.New(server.WithHostPorts("127.0.0.1:10028"))
+	backend.GET("/events", func(cc context.Context, ctx *app.RequestContext) {
+		id := string(ctx.Request.Header.Peek("Last-Event-ID"))
+		mu.Lock()
+		lastEventIDs = append(lastEventIDs, id)
+		mu.Unlock()
+		var body string
+		switch id {
+		case "":
+			// the partial event is dropped
+			body = "id: 1\ndata: a\n\ndata: partial\n"
+		case "1":
+			body = "id: 2\ndata: b\n\n"
+		default:
+			ctx.SetStatusCode(204)
+			return
+		}
+		ctx.SetContentType("text/event-stream")
+		ctx.SetBodyStream(strings.NewReader(body), -1)
+	})
+	go backend.Spin()
+
+	proxy, _ := NewSingleHostReverseProxy("http://127.0.0.1:10028", client.WithResponseBodyStream(true))
+	proxy.SetSSE(SSEOptions{Retry: 100 * time.Millisecond, Reconnect: true})
+	r := server.New(server.WithHostPorts("127.0.0.1:10029"))
+	r.GET("/events", proxy.ServeHTTP)
+	go r.Spin()
+	time.Sleep(time.Second)
+
+	cli, _ := client.NewClient()
+	status, body, err := cli.Get(context.Background(), nil, "http://127.0.0.1:10029/events")
+	assert.Nil(t, err)
+	assert.DeepEqual(t, 200, status)
+	assert.DeepEqual(t, "retry: 100\n\nid: 1\ndata: a\n\nid: 2\ndata: b\n\n", string(body))
+	mu.Lock()
+	defer mu.Unlock()
+	assert.DeepEqual(t, []string{"", "1", "2"}, lastEventIDs)
+}
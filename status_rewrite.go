@@ -0,0 +1,59 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// SetStatusRewrite replaces the status codes of backend responses found in
+// m by their values, e.g. {401: 407}, after ModifyResponse. Bodies are kept.
+// Responses of the proxy itself, e.g. to failed backend calls, are not
+// rewritten. A nil map removes the rewrites.
+func (r *ReverseProxy) SetStatusRewrite(m map[int]int) {
+	if len(m) == 0 {
+		r.statusRewrite = nil
+		return
+	}
+	r.statusRewrite = make(map[int]int, len(m))
+	for from, to := range m {
+		r.statusRewrite[from] = to
+	}
+}
+
+// SetStatusRewriteFunc decides rewrites per request: f is called after the
+// rewrites of SetStatusRewrite with the resulting status and returns the one
+// to send, e.g. 200 instead of 404 for probing clients, in which case f may
+// also reset the body of c.Response.
+func (r *ReverseProxy) SetStatusRewriteFunc(f func(ctx context.Context, c *app.RequestContext, status int) int) {
+	r.statusRewriteFunc = f
+}
+
+// rewriteStatus applies the status rewrites to the backend response.
+func (r *ReverseProxy) rewriteStatus(c context.Context, ctx *app.RequestContext) {
+	if r.statusRewrite == nil && r.statusRewriteFunc == nil {
+		return
+	}
+	status := ctx.Response.StatusCode()
+	if to, ok := r.statusRewrite[status]; ok {
+		status = to
+	}
+	if r.statusRewriteFunc != nil {
+		status = r.statusRewriteFunc(c, ctx, status)
+	}
+	ctx.Response.SetStatusCode(status)
+}
@@ -0,0 +1,78 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestStatusRewrite(t *testing.T) {
+	proxy, err := NewReverseProxy("http://backend", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		status, _ := strconv.Atoi(string(req.URI().QueryArgs().Peek("status")))
+		if status == 0 {
+			return syscall.ECONNREFUSED
+		}
+		resp.SetStatusCode(status)
+		resp.SetBodyString("body")
+		return nil
+	})))
+	assert.Nil(t, err)
+	proxy.SetModifyResponse(func(resp *protocol.Response) error {
+		// the rewrite comes after ModifyResponse
+		if resp.StatusCode() == 418 {
+			resp.SetStatusCode(401)
+		}
+		return nil
+	})
+	proxy.SetStatusRewrite(map[int]int{401: 407, 502: 200})
+	proxy.SetStatusRewriteFunc(func(ctx context.Context, c *app.RequestContext, status int) int {
+		if status == 404 && string(c.Request.Header.UserAgent()) == "probe" {
+			c.Response.ResetBody()
+			return 200
+		}
+		return status
+	})
+
+	for _, tt := range []struct {
+		status    int
+		userAgent string
+		code      int
+		body      string
+	}{
+		{status: 200, code: 200, body: "body"},
+		{status: 401, code: 407, body: "body"},
+		{status: 418, code: 407, body: "body"},
+		{status: 404, code: 404, body: "body"},
+		{status: 404, userAgent: "probe", code: 200},
+		// responses of the proxy are kept
+		{code: 502},
+	} {
+		ctx := app.NewContext(0)
+		ctx.Request.SetRequestURI("http://localhost/?status=" + strconv.Itoa(tt.status))
+		ctx.Request.Header.SetUserAgentBytes([]byte(tt.userAgent))
+		proxy.ServeHTTP(context.Background(), ctx)
+		assert.DeepEqual(t, tt.code, ctx.Response.StatusCode())
+		if tt.body != "" {
+			assert.DeepEqual(t, tt.body, string(ctx.Response.Body()))
+		}
+	}
+}
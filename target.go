@@ -0,0 +1,123 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+// proxyTarget is a Target parsed once at construction, so that requests are
+// directed without parsing it again.
+type proxyTarget struct {
+	// raw is the Target it was parsed from, to detect changes of Target.
+	raw   string
+	host  string
+	base  string // scheme, host and path
+	query string
+	slash bool // base ends in "/"
+}
+
+// parseTarget validates an absolute http or https target URL and normalizes
+// the case of its scheme and host.
+func parseTarget(target string) (*proxyTarget, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("reverseproxy: invalid target %q: %w", target, err)
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return nil, fmt.Errorf("reverseproxy: invalid target %q: scheme must be http or https", target)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("reverseproxy: invalid target %q: missing host", target)
+	}
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("reverseproxy: invalid target %q: invalid port %q", target, port)
+		}
+	}
+	host := strings.ToLower(u.Host)
+	base := scheme + "://" + host + u.EscapedPath()
+	t := &proxyTarget{raw: base, host: stripZone(host), base: base, query: u.RawQuery, slash: strings.HasSuffix(base, "/")}
+	if t.query != "" {
+		t.raw += "?" + t.query
+	}
+	return t, nil
+}
+
+// stripZone removes the zone of an IPv6 literal from host, e.g.
+// "[fe80::1%eth0]:8080" or its escaped form "[fe80::1%25eth0]:8080", as the
+// zone is meaningless to other machines and not sent in the Host header
+// (RFC 6874).
+func stripZone(host string) string {
+	if len(host) == 0 || host[0] != '[' {
+		return host
+	}
+	end := strings.IndexByte(host, ']')
+	zone := strings.IndexByte(host, '%')
+	if end < 0 || zone < 0 || zone > end {
+		return host
+	}
+	return host[:zone] + host[end:]
+}
+
+// unescapeZone unescapes the zone of an IPv6 literal in host, e.g.
+// "[fe80::1%25eth0]:8080" from a URI, to the form dialers expect.
+func unescapeZone(host []byte) []byte {
+	if len(host) == 0 || host[0] != '[' {
+		return host
+	}
+	end := bytes.IndexByte(host, ']')
+	zone := bytes.Index(host, []byte("%25"))
+	if end < 0 || zone < 0 || zone > end {
+		return host
+	}
+	return append(append([]byte(nil), host[:zone+1]...), host[zone+3:]...)
+}
+
+// appendURI appends the URI of req forwarded to t, like JoinURLPath.
+func (t *proxyTarget) appendURI(dst []byte, req *protocol.Request, path []byte, merge QueryMerge) []byte {
+	return appendJoinedURI(dst, t.base, t.query, t.query != "", t.slash, path, req, merge)
+}
+
+// SetTargetFunc sets f to choose the target of each request, e.g. from a
+// header, the path or a service registry. A non-empty target replaces
+// Target like ContextKeyTarget, which it takes precedence over, and "" keeps
+// it. If f fails, the error handler is called with ErrorKindTarget and the
+// backend is not called. Like ContextKeyTarget, the target is honored by
+// the director of NewSingleHostReverseProxy only.
+func (r *ReverseProxy) SetTargetFunc(f func(ctx context.Context, c *app.RequestContext) (string, error)) {
+	r.targetFunc = f
+}
+
+// chooseTarget returns the target of the request set by SetTargetFunc or
+// ContextKeyTarget, "" if Target is used.
+func (r *ReverseProxy) chooseTarget(ctx context.Context, c *app.RequestContext) (string, error) {
+	if r.targetFunc != nil {
+		target, err := r.targetFunc(ctx, c)
+		if err != nil || target != "" {
+			return target, err
+		}
+	}
+	return targetOverride(c), nil
+}
@@ -0,0 +1,284 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/server"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestParseTarget(t *testing.T) {
+	for _, tt := range []struct {
+		target, raw string
+		wantErr     bool
+	}{
+		{target: "http://backend", raw: "http://backend"},
+		{target: "HTTPS://Backend:8443/Base/?a=1", raw: "https://backend:8443/Base/?a=1"},
+		{target: "http://[::1]:8080/api", raw: "http://[::1]:8080/api"},
+		{target: "http://[FE80::1%25eth0]:8080/api?a=1", raw: "http://[fe80::1%eth0]:8080/api?a=1"},
+		{target: "backend:8080", wantErr: true},
+		{target: "/local", wantErr: true},
+		{target: "ftp://backend", wantErr: true},
+		{target: "http://", wantErr: true},
+		{target: "http://:8080", wantErr: true},
+		{target: "http://backend:0", wantErr: true},
+		{target: "http://backend:70000", wantErr: true},
+		{target: "http://backend\x7f", wantErr: true},
+	} {
+		pt, err := parseTarget(tt.target)
+		if tt.wantErr {
+			assert.NotNil(t, err)
+			continue
+		}
+		assert.Nil(t, err)
+		assert.DeepEqual(t, tt.raw, pt.raw)
+	}
+
+	_, err := NewSingleHostReverseProxy("backend:8080")
+	assert.NotNil(t, err)
+	_, err = NewRouter([]Route{{Path: "/api/", Target: "api:8080"}})
+	assert.NotNil(t, err)
+}
+
+func TestProxyTargetAppendURI(t *testing.T) {
+	for _, tt := range []struct {
+		target, uri string
+	}{
+		{"http://backend", "/users"},
+		{"http://backend/", "/users"},
+		{"http://backend/base", "/users?id=1"},
+		{"http://backend/base/", "/users?id=1"},
+		{"http://backend/base?a=1", "/users"},
+		{"http://backend/base?a=1", "/users?id=1"},
+	} {
+		pt, err := parseTarget(tt.target)
+		assert.Nil(t, err)
+		req := protocol.AcquireRequest()
+		req.SetRequestURI("http://localhost" + tt.uri)
+		assert.DeepEqual(t, string(JoinURLPath(req, tt.target)), string(pt.appendURI(nil, req, req.URI().Path(), QueryAppend)))
+		protocol.ReleaseRequest(req)
+	}
+}
+
+func TestJoinURLPath(t *testing.T) {
+	for _, tt := range []struct {
+		target, uri, want string
+	}{
+		{"http://backend", "/users", "http://backend/users"},
+		{"http://backend/base/", "/users?id=1", "http://backend/base/users?id=1"},
+		{"http://backend/base?a=1", "/users?id=1", "http://backend/base/users?a=1&id=1"},
+		{"/local", "/users", "example.com/local/users"},
+		{"local/", "/users", "example.com/local/users"},
+		{"", "/users", "example.com/users"},
+	} {
+		req := protocol.AcquireRequest()
+		req.SetRequestURI("http://example.com" + tt.uri)
+		assert.DeepEqual(t, tt.want, string(JoinURLPath(req, tt.target)))
+		protocol.ReleaseRequest(req)
+	}
+}
+
+func TestReverseProxySetTarget(t *testing.T) {
+	proxy, _ := NewSingleHostReverseProxy("http://backend/base")
+	assert.NotNil(t, proxy.SetTarget("backend:8080"))
+	assert.DeepEqual(t, "http://backend/base", proxy.Target)
+	assert.Nil(t, proxy.SetTarget("HTTP://Other/v2"))
+	assert.DeepEqual(t, "http://other/v2", proxy.Target)
+
+	req := protocol.AcquireRequest()
+	defer protocol.ReleaseRequest(req)
+	req.SetRequestURI("http://localhost/users")
+	proxy.director(req)
+	assert.DeepEqual(t, "http://other/v2/users", string(req.URI().FullURI()))
+	assert.DeepEqual(t, "other", string(req.Host()))
+}
+
+func BenchmarkDirector(b *testing.B) {
+	proxy, _ := NewSingleHostReverseProxy("http://backend/base?a=1")
+	req := protocol.AcquireRequest()
+	b.Run("parsed", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			req.SetRequestURI("/users?id=1")
+			proxy.director(req)
+		}
+	})
+	b.Run("JoinURLPath", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			req.SetRequestURI("/users?id=1")
+			directTo(req, proxy.Target, req.URI().Path(), QueryAppend)
+		}
+	})
+}
+
+func TestReverseProxySetTargetFunc(t *testing.T) {
+	var got []string
+	proxy, err := NewReverseProxy("http://default:8080", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		got = append(got, req.URI().String())
+		return nil
+	})))
+	assert.Nil(t, err)
+	errUnknownTenant := errors.New("unknown tenant")
+	proxy.SetTargetFunc(func(_ context.Context, c *app.RequestContext) (string, error) {
+		switch tenant := string(c.Request.Header.Peek("X-Tenant")); tenant {
+		case "":
+			return "", nil
+		case "a", "b":
+			return "http://tenant-" + tenant + ":8080/v1", nil
+		default:
+			return "", errUnknownTenant
+		}
+	})
+	var gotErr *ProxyError
+	proxy.SetProxyErrorHandler(func(ctx context.Context, c *app.RequestContext, err *ProxyError) {
+		gotErr = err
+		c.SetStatusCode(err.StatusCode())
+	})
+
+	serve := func(tenant, override string) int {
+		ctx := app.NewContext(0)
+		ctx.Request.SetRequestURI("http://localhost/users?id=1")
+		if tenant != "" {
+			ctx.Request.Header.Set("X-Tenant", tenant)
+		}
+		if override != "" {
+			ctx.Set(ContextKeyTarget, override)
+		}
+		proxy.ServeHTTP(context.Background(), ctx)
+		return ctx.Response.StatusCode()
+	}
+
+	assert.DeepEqual(t, 200, serve("a", ""))
+	assert.DeepEqual(t, 200, serve("b", "http://override:8080"))
+	assert.DeepEqual(t, 200, serve("", ""))
+	assert.DeepEqual(t, 200, serve("", "http://override:8080"))
+	assert.DeepEqual(t, []string{
+		"http://tenant-a:8080/v1/users?id=1",
+		"http://tenant-b:8080/v1/users?id=1",
+		"http://default:8080/users?id=1",
+		"http://override:8080/users?id=1",
+	}, got)
+
+	got = nil
+	assert.DeepEqual(t, 502, serve("c", ""))
+	assert.DeepEqual(t, 0, len(got))
+	assert.DeepEqual(t, ErrorKindTarget, gotErr.Kind)
+	assert.DeepEqual(t, 0, gotErr.Attempts)
+	assert.True(t, errors.Is(gotErr, errUnknownTenant))
+	assert.True(t, strings.HasPrefix(gotErr.Error(), "reverseproxy: target error"))
+}
+
+func TestIPv6Targets(t *testing.T) {
+	for _, tt := range []struct {
+		host, stripped, unescaped string
+	}{
+		{host: "backend:8080", stripped: "backend:8080", unescaped: "backend:8080"},
+		{host: "[::1]:8080", stripped: "[::1]:8080", unescaped: "[::1]:8080"},
+		{host: "[fe80::1%eth0]", stripped: "[fe80::1]", unescaped: "[fe80::1%eth0]"},
+		{host: "[fe80::1%25eth0]:8080", stripped: "[fe80::1]:8080", unescaped: "[fe80::1%eth0]:8080"},
+	} {
+		assert.DeepEqual(t, tt.stripped, stripZone(tt.host))
+		assert.DeepEqual(t, tt.unescaped, string(unescapeZone([]byte(tt.host))))
+	}
+
+	var uri, host string
+	doer := DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		uri, host = string(req.URI().FullURI()), string(req.Header.Host())
+		return nil
+	})
+	for _, tt := range []struct {
+		target, uri, host string
+	}{
+		{"http://[::1]:8080/base?x=1", "http://[::1]:8080/base/p?x=1&q=1", "[::1]:8080"},
+		{"http://[::1]/base", "http://[::1]/base/p?q=1", "[::1]"},
+		{"http://[fe80::1%25eth0]:8080/base", "http://[fe80::1%eth0]:8080/base/p?q=1", "[fe80::1]:8080"},
+	} {
+		proxy, err := NewReverseProxy(tt.target, WithClient(doer))
+		assert.Nil(t, err)
+		for _, assigned := range []bool{false, true} {
+			if assigned {
+				// parsed per request by JoinURLPath
+				proxy.Target = tt.target
+			}
+			ctx := app.NewContext(0)
+			ctx.Request.SetRequestURI("http://[::2]:9/p?q=1")
+			proxy.ServeHTTP(context.Background(), ctx)
+			assert.DeepEqual(t, tt.uri, uri)
+			assert.DeepEqual(t, tt.host, host)
+		}
+	}
+}
+
+func TestIPv6Backend(t *testing.T) {
+	backend := server.New(server.WithHostPorts("[::1]:10054"))
+	backend.GET("/v6", func(c context.Context, ctx *app.RequestContext) {
+		ctx.String(200, "%s %s", ctx.Request.Host(), ctx.Request.Header.Get("X-Forwarded-For"))
+	})
+	go backend.Spin()
+	time.Sleep(time.Second)
+
+	proxy, err := NewSingleHostReverseProxy("http://[::1]:10054")
+	assert.Nil(t, err)
+	ctx := app.NewContext(0)
+	ctx.Request.SetRequestURI("http://localhost/v6")
+	proxy.ServeHTTP(context.Background(), ctx)
+	assert.DeepEqual(t, 200, ctx.Response.StatusCode())
+	assert.DeepEqual(t, "[::1]:10054 0.0.0.0", string(ctx.Response.Body()))
+}
+
+func TestPreserveRawPath(t *testing.T) {
+	backend := server.New(server.WithHostPorts("127.0.0.1:10055"))
+	backend.Any("/*path", func(c context.Context, ctx *app.RequestContext) {
+		ctx.String(200, "%s", ctx.Request.Header.RequestURI())
+	})
+	go backend.Spin()
+	time.Sleep(time.Second)
+
+	for _, tt := range []struct {
+		raw       bool
+		assigned  bool
+		uri, want string
+	}{
+		{raw: false, uri: "/files/a%2Fb%20c.txt?x=%2F", want: "/base/files/a/b%20c.txt?x=%2F"},
+		{raw: true, uri: "/files/a%2Fb%20c.txt?x=%2F", want: "/base/files/a%2Fb%20c.txt?x=%2F"},
+		{raw: true, assigned: true, uri: "/files/a%2Fb", want: "/base/files/a%2Fb"},
+		{raw: true, uri: "/api/a%2Fb", want: "/base/v2/a%2Fb"},
+	} {
+		proxy, err := NewSingleHostReverseProxy("http://127.0.0.1:10055/base")
+		assert.Nil(t, err)
+		proxy.SetPreserveRawPath(tt.raw)
+		if tt.assigned {
+			proxy.Target = "http://127.0.0.1:10055/base/"
+		}
+		handler := proxy.ServeHTTP
+		if strings.HasPrefix(tt.uri, "/api") {
+			handler = proxy.Handler(WithCallStripPrefix("/api"), WithCallAddPrefix("/v2"))
+		}
+		ctx := app.NewContext(0)
+		ctx.Request.SetRequestURI("http://localhost" + tt.uri)
+		handler(context.Background(), ctx)
+		assert.DeepEqual(t, 200, ctx.Response.StatusCode())
+		assert.DeepEqual(t, tt.want, string(ctx.Response.Body()))
+	}
+}
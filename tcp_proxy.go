@@ -0,0 +1,308 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/network"
+	"github.com/cloudwego/hertz/pkg/network/standard"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+// TCPProxy is a layer 4 proxy splicing the bytes of client connections to
+// one of its backends, for protocols the HTTP proxy cannot parse, e.g.
+// databases or TLS passthrough. Connections are balanced round robin across
+// the healthy backends; a backend failing to accept one is skipped for the
+// next. The backends are reported unhealthy after DefaultUnhealthyThreshold
+// consecutive failed dials, which SetHealthCheck also makes.
+type TCPProxy struct {
+	backends []*tcpBackend
+	next     uint32
+	dialer   network.Dialer
+	// dialTimeout is set by SetDialTimeout
+	dialTimeout time.Duration
+	// logger is set by SetLogger
+	logger Logger
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	stopCheck chan struct{}
+	closed    bool
+}
+
+// tcpBackend is a backend of a TCPProxy.
+type tcpBackend struct {
+	addr  string
+	stats upstreamStats
+}
+
+// NewTCPProxy returns a TCPProxy forwarding to backends, given as
+// "host:port".
+func NewTCPProxy(backends ...string) (*TCPProxy, error) {
+	if len(backends) == 0 {
+		return nil, errors.New("reverseproxy: TCP proxy needs backends")
+	}
+	p := &TCPProxy{
+		dialer:      standard.NewDialer(),
+		dialTimeout: 10 * time.Second,
+		listeners:   make(map[net.Listener]struct{}),
+	}
+	for _, addr := range backends {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return nil, fmt.Errorf("reverseproxy: TCP backend %q: %w", addr, err)
+		}
+		p.backends = append(p.backends, &tcpBackend{addr: addr})
+	}
+	return p, nil
+}
+
+// SetDialTimeout sets the timeout for connecting to a backend, 10s by
+// default.
+func (p *TCPProxy) SetDialTimeout(timeout time.Duration) {
+	p.dialTimeout = timeout
+}
+
+// SetResolver makes p resolve backend hosts with res instead of the system
+// resolver, like WithResolver.
+func (p *TCPProxy) SetResolver(res Resolver) {
+	p.dialer = newResolvingDialer(res)
+}
+
+// SetLogger sets the logger of p, nil for hlog.
+func (p *TCPProxy) SetLogger(l Logger) {
+	p.logger = l
+}
+
+func (p *TCPProxy) log() Logger {
+	return orHlog(p.logger)
+}
+
+// SetHealthCheck dials each backend every interval, so that unreachable
+// backends are known before clients connect, and ones which came back are
+// used again. 0 stops the checks.
+func (p *TCPProxy) SetHealthCheck(interval time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopCheck != nil {
+		close(p.stopCheck)
+		p.stopCheck = nil
+	}
+	if interval <= 0 || p.closed {
+		return
+	}
+	p.stopCheck = make(chan struct{})
+	go p.checkHealth(interval, p.stopCheck)
+}
+
+func (p *TCPProxy) checkHealth(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		for _, b := range p.backends {
+			conn, err := p.dialer.DialTimeout("tcp", b.addr, p.dialTimeout, nil)
+			if err != nil {
+				p.log().Warnf(context.Background(), "HERTZ: TCP health check of %s failed: %v", b.addr, err)
+				b.stats.fail()
+				continue
+			}
+			conn.Close()
+			b.stats.succeed()
+		}
+	}
+}
+
+// Serve accepts connections on ln and forwards them until ln fails or p
+// is closed, in which case it returns nil.
+func (p *TCPProxy) Serve(ln net.Listener) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		ln.Close()
+		return nil
+	}
+	p.listeners[ln] = struct{}{}
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.listeners, ln)
+		p.mu.Unlock()
+	}()
+
+	var delay time.Duration
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			p.mu.Lock()
+			closed := p.closed
+			p.mu.Unlock()
+			if closed {
+				return nil
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() { //nolint:staticcheck
+				// back off like net/http, e.g. when out of file descriptors
+				if delay = delay * 2; delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay > time.Second {
+					delay = time.Second
+				}
+				time.Sleep(delay)
+				continue
+			}
+			return err
+		}
+		delay = 0
+		go p.ServeConn(conn)
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and calls Serve.
+func (p *TCPProxy) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return p.Serve(ln)
+}
+
+// Close stops the listeners of Serve and the health checks. Forwarded
+// connections are not interrupted.
+func (p *TCPProxy) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	if p.stopCheck != nil {
+		close(p.stopCheck)
+		p.stopCheck = nil
+	}
+	var err error
+	for ln := range p.listeners {
+		if cerr := ln.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// ServeConn forwards conn to a backend and closes it once both directions
+// are done. It also serves connections accepted elsewhere, e.g. those
+// hijacked by a hertz handler.
+func (p *TCPProxy) ServeConn(conn net.Conn) {
+	defer conn.Close()
+	b, backend, err := p.dialBackend()
+	if err != nil {
+		p.log().Errorf(context.Background(), "HERTZ: TCP connection from %s not forwarded: %v", conn.RemoteAddr(), err)
+		return
+	}
+	defer backend.Close()
+	b.stats.begin()
+	b.stats.succeed()
+	sent, received := splice(conn, backend)
+	b.stats.transferred(Transfer{RequestBytes: sent, ResponseBytes: received})
+	b.stats.end(consts.StatusOK)
+}
+
+// dialBackend connects to the next healthy backend round robin, trying the
+// others in turn if it fails, and the unhealthy ones as a last resort.
+func (p *TCPProxy) dialBackend() (*tcpBackend, net.Conn, error) {
+	n := uint32(len(p.backends))
+	start := atomic.AddUint32(&p.next, 1) - 1
+	err := ErrBackendUnavailable
+	for _, healthy := range []bool{true, false} {
+		for i := uint32(0); i < n; i++ {
+			b := p.backends[(start+i)%n]
+			if b.stats.isDraining() || b.stats.isHealthy() != healthy {
+				continue
+			}
+			conn, derr := p.dialer.DialTimeout("tcp", b.addr, p.dialTimeout, nil)
+			if derr == nil {
+				return b, conn, nil
+			}
+			b.stats.fail()
+			err = fmt.Errorf("%s: %w", b.addr, derr)
+		}
+	}
+	return nil, nil, err
+}
+
+// splice copies between client and backend until both directions are done,
+// passing on half-closes where the connections support them, and returns
+// the bytes sent by either side.
+func splice(client, backend net.Conn) (sent, received int64) {
+	done := make(chan struct{})
+	go func() {
+		sent, _ = io.Copy(backend, client)
+		closeWrite(backend)
+		close(done)
+	}()
+	received, _ = io.Copy(client, backend)
+	closeWrite(client)
+	<-done
+	return sent, received
+}
+
+// closeWrite signals the end of the data written to c, closing c if it
+// cannot be half-closed.
+func closeWrite(c net.Conn) {
+	if cw, ok := c.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite() //nolint:errcheck
+		return
+	}
+	c.Close()
+}
+
+// Upstreams returns the stats of the backends of p, in the order given to
+// NewTCPProxy. Requests counts forwarded connections and Failures failed
+// dials, including those of health checks.
+func (p *TCPProxy) Upstreams() []UpstreamStats {
+	stats := make([]UpstreamStats, len(p.backends))
+	for i, b := range p.backends {
+		stats[i] = b.stats.snapshot(b.addr)
+	}
+	return stats
+}
+
+// DrainUpstream stops forwarding new connections to the backend addr while
+// the forwarded ones continue. It reports whether addr is a backend of p.
+func (p *TCPProxy) DrainUpstream(addr string) bool {
+	return p.setUpstreamDraining(addr, 1)
+}
+
+// ResumeUpstream forwards connections to addr again after DrainUpstream.
+func (p *TCPProxy) ResumeUpstream(addr string) bool {
+	return p.setUpstreamDraining(addr, 0)
+}
+
+func (p *TCPProxy) setUpstreamDraining(addr string, draining int32) bool {
+	for _, b := range p.backends {
+		if b.addr == addr {
+			atomic.StoreInt32(&b.stats.draining, draining)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+)
+
+// tcpEcho serves connections by echoing them, prefixed by name, until the
+// client half-closes.
+func tcpEcho(t *testing.T, name string) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.WriteString(conn, name+":") //nolint:errcheck
+				io.Copy(conn, conn)            //nolint:errcheck
+				conn.(*net.TCPConn).CloseWrite()
+			}()
+		}
+	}()
+	return ln
+}
+
+func tcpCall(t *testing.T, addr, msg string) string {
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, msg)
+	assert.Nil(t, err)
+	conn.(*net.TCPConn).CloseWrite()
+	reply, _ := ioutil.ReadAll(conn)
+	return string(reply)
+}
+
+func TestTCPProxy(t *testing.T) {
+	a, b := tcpEcho(t, "a"), tcpEcho(t, "b")
+	defer a.Close()
+	defer b.Close()
+	dead, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	dead.Close()
+
+	p, err := NewTCPProxy(a.Addr().String(), dead.Addr().String(), b.Addr().String())
+	assert.Nil(t, err)
+	p.SetDialTimeout(time.Second)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	served := make(chan error)
+	go func() {
+		served <- p.Serve(ln)
+	}()
+
+	// the dead backend is skipped
+	replies := map[string]int{}
+	for i := 0; i < 4; i++ {
+		replies[tcpCall(t, ln.Addr().String(), "ping")]++
+	}
+	assert.DeepEqual(t, map[string]int{"a:ping": 2, "b:ping": 2}, replies)
+	// the stats are recorded once the proxy closed the connections
+	stats := p.Upstreams()
+	for i := 0; i < 100 && stats[0].InFlight+stats[2].InFlight > 0; i++ {
+		time.Sleep(time.Millisecond)
+		stats = p.Upstreams()
+	}
+	assert.DeepEqual(t, a.Addr().String(), stats[0].Target)
+	assert.DeepEqual(t, int64(2), stats[0].Requests)
+	assert.DeepEqual(t, int64(8), stats[0].RequestBytes)
+	assert.DeepEqual(t, int64(12), stats[0].ResponseBytes)
+	assert.DeepEqual(t, int64(0), stats[1].Requests)
+	assert.True(t, stats[1].Failures > 0)
+
+	// health checks mark it unhealthy
+	p.SetHealthCheck(5 * time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	assert.False(t, p.Upstreams()[1].Healthy)
+	assert.True(t, p.Upstreams()[0].Healthy)
+
+	assert.True(t, p.DrainUpstream(a.Addr().String()))
+	for i := 0; i < 2; i++ {
+		assert.DeepEqual(t, "b:ping", tcpCall(t, ln.Addr().String(), "ping"))
+	}
+	assert.True(t, p.ResumeUpstream(a.Addr().String()))
+	assert.False(t, p.DrainUpstream("127.0.0.1:1"))
+
+	assert.Nil(t, p.Close())
+	assert.Nil(t, <-served)
+}
+
+func TestTCPProxyUnavailable(t *testing.T) {
+	dead, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	dead.Close()
+	p, err := NewTCPProxy(dead.Addr().String())
+	assert.Nil(t, err)
+	p.SetLogger(NopLogger{})
+
+	client, conn := net.Pipe()
+	go p.ServeConn(conn)
+	_, err = client.Read(make([]byte, 1))
+	assert.DeepEqual(t, io.EOF, err)
+
+	_, err = NewTCPProxy("no-port")
+	assert.NotNil(t, err)
+	_, err = NewTCPProxy()
+	assert.NotNil(t, err)
+}
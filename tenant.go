@@ -0,0 +1,191 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// ContextKeyTenant is set by TenantRouter to the ID of the tenant of the
+// request, see TenantLabel.
+const ContextKeyTenant = "reverseproxy.tenant"
+
+// Tenant is the backend of a tenant of a TenantRouter.
+type Tenant struct {
+	ID string
+	// Target is the backend of the tenant, with an optional base path the
+	// request path is appended to, e.g. "http://shared:8080/tenants/acme".
+	Target string
+	// RateLimit limits the requests of the tenant, if Requests is set.
+	RateLimit RateLimit
+}
+
+// TenantRouter forwards the requests of each tenant, identified by a key
+// function such as HeaderKey("X-Tenant-ID"), SubdomainKey("example.com")
+// or a callback reading a claim of a JWT verified by earlier middleware,
+// to the Target of the tenant. Requests are forwarded by one proxy, whose
+// director must be the default one, with ContextKeyTenant set, so that
+// Metrics can count each tenant apart with TenantLabel. Requests of unknown
+// tenants are passed on to the next handler unless SetNoMatchStatus is used.
+//
+//	tr, err := reverseproxy.NewTenantRouter(reverseproxy.SubdomainKey("example.com"), proxy, []reverseproxy.Tenant{
+//		{ID: "acme", Target: "http://acme:8080"},
+//		{ID: "globex", Target: "http://shared:8080/globex", RateLimit: reverseproxy.RateLimit{Requests: 100, Per: time.Second}},
+//	})
+//	h.Use(tr.ServeHTTP)
+type TenantRouter struct {
+	key   func(ctx context.Context, c *app.RequestContext) string
+	proxy *ReverseProxy
+	store RateLimitStore
+
+	mu      sync.RWMutex
+	tenants map[string]Tenant
+
+	// noMatchStatus is the status code of requests of unknown tenants, 0
+	// passes them on to the next handler
+	noMatchStatus int
+}
+
+// NewTenantRouter returns a TenantRouter of tenants, forwarding with proxy.
+func NewTenantRouter(key func(ctx context.Context, c *app.RequestContext) string, proxy *ReverseProxy, tenants []Tenant) (*TenantRouter, error) {
+	if key == nil || proxy == nil {
+		return nil, errors.New("reverseproxy: tenant router needs a key and a proxy")
+	}
+	tr := &TenantRouter{
+		key:     key,
+		proxy:   proxy,
+		store:   NewMemoryRateLimitStore(),
+		tenants: make(map[string]Tenant, len(tenants)),
+	}
+	for _, t := range tenants {
+		if _, ok := tr.tenants[t.ID]; ok {
+			return nil, fmt.Errorf("reverseproxy: duplicate tenant %q", t.ID)
+		}
+		if err := tr.SetTenant(t); err != nil {
+			return nil, err
+		}
+	}
+	return tr, nil
+}
+
+// SubdomainKey is a key function of NewTenantRouter returning the label of
+// the Host of the request below domain, e.g. "acme" for "acme.example.com"
+// with domain "example.com", and "" for other hosts.
+func SubdomainKey(domain string) func(ctx context.Context, c *app.RequestContext) string {
+	suffix := "." + strings.ToLower(strings.Trim(domain, "."))
+	return func(ctx context.Context, c *app.RequestContext) string {
+		host := normalizeHost(string(c.Request.Host()))
+		if !strings.HasSuffix(host, suffix) {
+			return ""
+		}
+		label := host[:len(host)-len(suffix)]
+		if strings.IndexByte(label, '.') >= 0 {
+			return ""
+		}
+		return label
+	}
+}
+
+// TenantLabel returns the tenant set by TenantRouter, e.g. as metric label:
+//
+//	reverseproxy.MetricsOptions{Labels: map[string]func(ctx context.Context, c *app.RequestContext) string{
+//		"tenant": reverseproxy.TenantLabel,
+//	}}
+func TenantLabel(ctx context.Context, c *app.RequestContext) string {
+	tenant, _ := c.Value(ContextKeyTenant).(string)
+	return tenant
+}
+
+// SetTenant adds or replaces the tenant t. It is safe while serving.
+func (tr *TenantRouter) SetTenant(t Tenant) error {
+	if t.ID == "" {
+		return errors.New("reverseproxy: tenant needs an ID")
+	}
+	if _, err := parseTarget(t.Target); err != nil {
+		return err
+	}
+	if t.RateLimit != (RateLimit{}) {
+		if err := t.RateLimit.validate(); err != nil {
+			return err
+		}
+	}
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.tenants[t.ID] = t
+	return nil
+}
+
+// RemoveTenant removes the tenant id.
+func (tr *TenantRouter) RemoveTenant(id string) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	delete(tr.tenants, id)
+}
+
+// Tenants returns the tenants sorted by ID.
+func (tr *TenantRouter) Tenants() []Tenant {
+	tr.mu.RLock()
+	tenants := make([]Tenant, 0, len(tr.tenants))
+	for _, t := range tr.tenants {
+		tenants = append(tenants, t)
+	}
+	tr.mu.RUnlock()
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].ID < tenants[j].ID })
+	return tenants
+}
+
+// SetRateLimitStore replaces the in-memory store of the tenant rate limits,
+// e.g. to share them between proxy instances. It must be called before
+// serving.
+func (tr *TenantRouter) SetRateLimitStore(store RateLimitStore) {
+	tr.store = store
+}
+
+// SetNoMatchStatus makes requests of unknown tenants, or without one, be
+// answered with statusCode, e.g. 404. By default, such requests are passed
+// on to the next handler.
+func (tr *TenantRouter) SetNoMatchStatus(statusCode int) {
+	tr.noMatchStatus = statusCode
+}
+
+// ServeHTTP forwards the request to the Target of its tenant.
+func (tr *TenantRouter) ServeHTTP(ctx context.Context, c *app.RequestContext) {
+	id := tr.key(ctx, c)
+	tr.mu.RLock()
+	t, ok := tr.tenants[id]
+	tr.mu.RUnlock()
+	if !ok {
+		if tr.noMatchStatus != 0 {
+			c.AbortWithStatus(tr.noMatchStatus)
+			return
+		}
+		c.Next(ctx)
+		return
+	}
+	c.Set(ContextKeyTenant, t.ID)
+	if t.RateLimit.Requests > 0 && !takeRateLimit(ctx, c, tr.store, "tenant:"+t.ID, t.RateLimit, tr.proxy.logger) {
+		return
+	}
+	c.Set(ContextKeyTarget, t.Target)
+	tr.proxy.ServeHTTP(ctx, c)
+	c.Abort()
+}
@@ -0,0 +1,99 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestTenantRouter(t *testing.T) {
+	proxy, err := NewReverseProxy("http://default", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		resp.SetBodyString(string(req.URI().Host()) + string(req.URI().Path()))
+		return nil
+	})))
+	assert.Nil(t, err)
+	m, err := NewMetrics(MetricsOptions{Labels: map[string]func(ctx context.Context, c *app.RequestContext) string{"tenant": TenantLabel}})
+	assert.Nil(t, err)
+	proxy.SetMetrics(m)
+	tr, err := NewTenantRouter(SubdomainKey("example.com"), proxy, []Tenant{
+		{ID: "acme", Target: "http://acme:8080"},
+		{ID: "globex", Target: "http://shared:8080/globex", RateLimit: RateLimit{Requests: 2, Per: time.Hour}},
+	})
+	assert.Nil(t, err)
+
+	serve := func(host string) *app.RequestContext {
+		ctx := app.NewContext(0)
+		ctx.Request.SetRequestURI("http://" + host + "/orders")
+		tr.ServeHTTP(context.Background(), ctx)
+		return ctx
+	}
+	ctx := serve("acme.example.com")
+	assert.DeepEqual(t, "acme:8080/orders", string(ctx.Response.Body()))
+	assert.DeepEqual(t, "acme", ctx.Value(ContextKeyTenant))
+	assert.True(t, ctx.IsAborted())
+	ctx = serve("Globex.Example.com:443")
+	assert.DeepEqual(t, "shared:8080/globex/orders", string(ctx.Response.Body()))
+
+	// rate limits apply per tenant
+	serve("globex.example.com")
+	ctx = serve("globex.example.com")
+	assert.DeepEqual(t, 429, ctx.Response.StatusCode())
+	assert.DeepEqual(t, "acme:8080/orders", string(serve("acme.example.com").Response.Body()))
+
+	// unknown tenants are passed on
+	for _, host := range []string{"initech.example.com", "a.acme.example.com", "example.com", "acme.other.com"} {
+		ctx = serve(host)
+		assert.False(t, ctx.IsAborted())
+		assert.DeepEqual(t, 0, len(ctx.Response.Body()))
+	}
+	tr.SetNoMatchStatus(404)
+	assert.DeepEqual(t, 404, serve("initech.example.com").Response.StatusCode())
+	assert.Nil(t, tr.SetTenant(Tenant{ID: "initech", Target: "http://initech"}))
+	assert.DeepEqual(t, "initech/orders", string(serve("initech.example.com").Response.Body()))
+	tr.RemoveTenant("acme")
+	assert.DeepEqual(t, 404, serve("acme.example.com").Response.StatusCode())
+	tenants := tr.Tenants()
+	assert.DeepEqual(t, 2, len(tenants))
+	assert.DeepEqual(t, "globex", tenants[0].ID)
+
+	var b strings.Builder
+	_, err = m.WriteTo(&b)
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(b.String(), `reverseproxy_requests_total{method="GET",code="200",target="http://acme:8080",route="",tenant="acme"} 2`))
+	assert.True(t, strings.Contains(b.String(), `reverseproxy_requests_total{method="GET",code="200",target="http://shared:8080",route="",tenant="globex"} 2`))
+}
+
+func TestTenantRouterErrors(t *testing.T) {
+	proxy, err := NewReverseProxy("http://default")
+	assert.Nil(t, err)
+	for _, tenants := range [][]Tenant{
+		{{ID: "", Target: "http://a"}},
+		{{ID: "a", Target: "ftp://a"}},
+		{{ID: "a", Target: "http://a"}, {ID: "a", Target: "http://b"}},
+		{{ID: "a", Target: "http://a", RateLimit: RateLimit{Requests: 1}}},
+	} {
+		_, err = NewTenantRouter(HeaderKey("X-Tenant"), proxy, tenants)
+		assert.NotNil(t, err)
+	}
+	_, err = NewTenantRouter(nil, proxy, nil)
+	assert.NotNil(t, err)
+}
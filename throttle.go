@@ -0,0 +1,99 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"bytes"
+	"io"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+// bandwidthLimit is set by SetBandwidthLimit.
+type bandwidthLimit struct {
+	rate  int // bytes per second
+	burst int
+}
+
+// SetBandwidthLimit caps the rate at which each response body is sent to
+// the client to bytesPerSecond, allowing bursts of up to burst bytes, e.g.
+// to serve large files without saturating the egress link. A burst of 0
+// means bytesPerSecond. Buffered bodies are streamed to apply the limit.
+// A rate of 0 removes the limit.
+func (r *ReverseProxy) SetBandwidthLimit(bytesPerSecond, burst int) {
+	if bytesPerSecond <= 0 {
+		r.bandwidth = nil
+		return
+	}
+	if burst <= 0 {
+		burst = bytesPerSecond
+	}
+	r.bandwidth = &bandwidthLimit{rate: bytesPerSecond, burst: burst}
+}
+
+// throttleResponse makes the body of resp a stream read at the rate of r.bandwidth.
+func (r *ReverseProxy) throttleResponse(resp *protocol.Response) {
+	if r.bandwidth == nil || resp.MustSkipBody() {
+		return
+	}
+	if resp.IsBodyStream() {
+		resp.SetBodyStreamNoReset(newThrottledReader(resp.BodyStream(), r.bandwidth), resp.Header.ContentLength())
+		return
+	}
+	// the body buffer stays owned by resp until it is written
+	body := resp.BodyBytes()
+	resp.SetBodyStreamNoReset(newThrottledReader(bytes.NewReader(body), r.bandwidth), len(body))
+}
+
+// throttledReader is a token bucket limiting the rate of reads from src.
+type throttledReader struct {
+	src    io.Reader
+	limit  *bandwidthLimit
+	tokens float64
+	last   time.Time
+}
+
+func newThrottledReader(src io.Reader, limit *bandwidthLimit) *throttledReader {
+	return &throttledReader{src: src, limit: limit, tokens: float64(limit.burst), last: time.Now()}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > t.limit.burst {
+		p = p[:t.limit.burst]
+	}
+	n, err := t.src.Read(p)
+	now := time.Now()
+	t.tokens += now.Sub(t.last).Seconds() * float64(t.limit.rate)
+	if t.tokens > float64(t.limit.burst) {
+		t.tokens = float64(t.limit.burst)
+	}
+	t.tokens -= float64(n)
+	t.last = now
+	// hold the bytes back until they are paid for
+	if t.tokens < 0 {
+		time.Sleep(time.Duration(-t.tokens / float64(t.limit.rate) * float64(time.Second)))
+		t.tokens, t.last = 0, time.Now()
+	}
+	return n, err
+}
+
+// Close closes src, so that the stream of the backend is released.
+func (t *throttledReader) Close() error {
+	if c, ok := t.src.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
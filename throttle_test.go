@@ -0,0 +1,68 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestBandwidthLimit(t *testing.T) {
+	body := strings.Repeat("x", 3000)
+	for _, stream := range []bool{false, true} {
+		proxy, err := NewReverseProxy("http://backend", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+			if stream {
+				resp.SetBodyStream(strings.NewReader(body), len(body))
+			} else {
+				resp.SetBodyString(body)
+			}
+			return nil
+		})))
+		assert.Nil(t, err)
+		proxy.SetBandwidthLimit(10000, 1000)
+
+		ctx := app.NewContext(0)
+		ctx.Request.SetRequestURI("http://localhost/file")
+		proxy.ServeHTTP(context.Background(), ctx)
+		assert.True(t, ctx.Response.IsBodyStream())
+		assert.DeepEqual(t, len(body), ctx.Response.Header.ContentLength())
+
+		// the burst is sent at once, the remaining 2000 bytes take 200ms
+		start := time.Now()
+		got, err := ioutil.ReadAll(ctx.Response.BodyStream())
+		assert.Nil(t, err)
+		assert.DeepEqual(t, body, string(got))
+		elapsed := time.Since(start)
+		assert.True(t, elapsed >= 190*time.Millisecond)
+		assert.True(t, elapsed < time.Second)
+	}
+}
+
+func TestThrottledReaderBurst(t *testing.T) {
+	r := newThrottledReader(bytes.NewReader(make([]byte, 100)), &bandwidthLimit{rate: 10, burst: 100})
+	start := time.Now()
+	n, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, 100, len(n))
+	assert.True(t, time.Since(start) < 100*time.Millisecond)
+}
@@ -0,0 +1,268 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app/client"
+	errs "github.com/cloudwego/hertz/pkg/common/errors"
+	"github.com/cloudwego/hertz/pkg/network"
+	"github.com/cloudwego/hertz/pkg/network/standard"
+)
+
+// WithDialTimeout limits establishing a connection to the backend, see
+// client.WithDialTimeout. It is ignored with WithClient.
+func WithDialTimeout(d time.Duration) ProxyOption {
+	return WithClientOptions(client.WithDialTimeout(d))
+}
+
+// WithTLSHandshakeTimeout limits the TLS handshake with https backends,
+// which is otherwise part of writing the first request. It is ignored with
+// WithClient.
+func WithTLSHandshakeTimeout(d time.Duration) ProxyOption {
+	return func(o *ProxyOptions) {
+		o.TLSHandshakeTimeout = d
+	}
+}
+
+// WithResponseHeaderTimeout limits how long the backend may take to start
+// answering once the request was sent, independently of how long the body
+// takes. It is ignored with WithClient.
+func WithResponseHeaderTimeout(d time.Duration) ProxyOption {
+	return func(o *ProxyOptions) {
+		o.ResponseHeaderTimeout = d
+	}
+}
+
+// ResponseHeaderTimeoutError is the error of backend calls which did not
+// receive the response header within WithResponseHeaderTimeout. It is
+// classified as ErrorKindHeaderTimeout.
+type ResponseHeaderTimeoutError struct {
+	// Timeout is the response header timeout.
+	Timeout time.Duration
+	// Elapsed is how long the backend call took.
+	Elapsed time.Duration
+	Err     error
+}
+
+func (e *ResponseHeaderTimeoutError) Error() string {
+	return fmt.Sprintf("reverseproxy: no response header from the backend after %v", e.Elapsed)
+}
+
+func (e *ResponseHeaderTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// headerTimeoutError returns err as *ResponseHeaderTimeoutError if the call
+// started at start timed out reading the response header after the response
+// header timeout rather than a shorter timeout of the call. The hertz client
+// replaces the read error by its timeout error then, telling the phase in
+// its meta.
+func headerTimeoutError(err error, timeout time.Duration, start time.Time) error {
+	if err == nil || timeout <= 0 {
+		return err
+	}
+	var herr *errs.Error
+	if !errors.As(err, &herr) || !errors.Is(herr.Err, errs.ErrTimeout) || herr.Meta != "read response header" {
+		return err
+	}
+	elapsed := time.Since(start)
+	if elapsed < timeout {
+		return err
+	}
+	return &ResponseHeaderTimeoutError{Timeout: timeout, Elapsed: elapsed, Err: err}
+}
+
+// WithBodyReadTimeout limits how long the backend may stay silent while it
+// sends the response, so that slow but steady streams are not cut off like
+// with a timeout of the whole call. It is ignored with WithClient.
+func WithBodyReadTimeout(d time.Duration) ProxyOption {
+	return func(o *ProxyOptions) {
+		o.BodyReadTimeout = d
+	}
+}
+
+// dialer returns the dialer of the client created by NewReverseProxy, nil
+// to keep the default one.
+func (o *ProxyOptions) dialer() network.Dialer {
+	var d network.Dialer
+	res := o.Resolver
+	if res == nil && o.HappyEyeballsDelay > 0 {
+		res = net.DefaultResolver
+	}
+	if res != nil {
+		d = &resolvingDialer{Dialer: standard.NewDialer(), resolver: res, delay: o.HappyEyeballsDelay}
+	}
+	if o.TLSHandshakeTimeout > 0 || o.ResponseHeaderTimeout > 0 || o.BodyReadTimeout > 0 {
+		if d == nil {
+			d = standard.NewDialer()
+		}
+		d = &timeoutDialer{
+			Dialer:    d,
+			handshake: o.TLSHandshakeTimeout,
+			header:    o.ResponseHeaderTimeout,
+			idle:      o.BodyReadTimeout,
+		}
+	}
+	return d
+}
+
+// timeoutDialer applies the timeouts of the phases of a backend call to
+// its connections.
+type timeoutDialer struct {
+	network.Dialer
+	handshake time.Duration
+	header    time.Duration
+	idle      time.Duration
+}
+
+func (d *timeoutDialer) DialConnection(n, address string, timeout time.Duration, tlsConfig *tls.Config) (network.Conn, error) {
+	if d.handshake <= 0 || tlsConfig == nil {
+		conn, err := d.Dialer.DialConnection(n, address, timeout, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		return d.wrap(conn), nil
+	}
+	conn, err := d.Dialer.DialConnection(n, address, timeout, nil)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(d.handshake)) //nolint:errcheck
+	tlsConn, err := d.Dialer.AddTLS(conn, tlsConfig)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	tlsConn.SetDeadline(time.Time{}) //nolint:errcheck
+	return d.wrap(tlsConn), nil
+}
+
+func (d *timeoutDialer) wrap(conn network.Conn) network.Conn {
+	if d.header <= 0 && d.idle <= 0 {
+		return conn
+	}
+	return &timeoutConn{Conn: conn, header: d.header, idle: d.idle}
+}
+
+// timeoutConn reads responses within the response header timeout until the
+// first byte arrived and then within the body read timeout of each read from
+// the network, never beyond the read timeout set by the client.
+type timeoutConn struct {
+	network.Conn
+	header time.Duration
+	idle   time.Duration
+
+	// waiting is true until the response started
+	waiting bool
+	// deadline is the read timeout set by the client, zero if none
+	deadline time.Time
+}
+
+func (c *timeoutConn) SetReadTimeout(t time.Duration) error {
+	c.deadline = time.Time{}
+	if t > 0 {
+		c.deadline = time.Now().Add(t)
+	}
+	c.waiting = c.header > 0
+	return c.arm()
+}
+
+// arm sets the read timeout of the current phase.
+func (c *timeoutConn) arm() error {
+	t := c.idle
+	if c.waiting {
+		t = c.header
+	}
+	if !c.deadline.IsZero() {
+		left := time.Until(c.deadline)
+		if left <= 0 {
+			left = time.Nanosecond
+		}
+		if t <= 0 || left < t {
+			t = left
+		}
+	}
+	return c.Conn.SetReadTimeout(t)
+}
+
+// fill makes n bytes readable, waiting for each read of the response at
+// most as long as the timeout of the current phase.
+func (c *timeoutConn) fill(n int) error {
+	for l := c.Conn.Len(); l < n; l = c.Conn.Len() {
+		if !c.waiting {
+			if c.idle <= 0 {
+				return nil
+			}
+			c.arm() //nolint:errcheck
+		}
+		if _, err := c.Conn.Peek(l + 1); err != nil {
+			return err
+		}
+		c.started()
+	}
+	if c.Conn.Len() > 0 {
+		c.started()
+	}
+	return nil
+}
+
+// started ends the wait for the response once it started.
+func (c *timeoutConn) started() {
+	if c.waiting {
+		c.waiting = false
+		c.arm() //nolint:errcheck
+	}
+}
+
+func (c *timeoutConn) Peek(n int) ([]byte, error) {
+	if err := c.fill(n); err != nil {
+		return nil, err
+	}
+	return c.Conn.Peek(n)
+}
+
+func (c *timeoutConn) ReadByte() (byte, error) {
+	if err := c.fill(1); err != nil {
+		return 0, err
+	}
+	return c.Conn.ReadByte()
+}
+
+func (c *timeoutConn) ReadBinary(n int) ([]byte, error) {
+	if err := c.fill(n); err != nil {
+		return nil, err
+	}
+	return c.Conn.ReadBinary(n)
+}
+
+func (c *timeoutConn) Read(p []byte) (int, error) {
+	if err := c.fill(1); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(p)
+}
+
+func (c *timeoutConn) ToHertzError(err error) error {
+	if n, ok := c.Conn.(network.ErrorNormalization); ok {
+		return n.ToHertzError(err)
+	}
+	return err
+}
@@ -0,0 +1,150 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+)
+
+// rawBackend serves each connection with serve after reading the request head.
+func rawBackend(t *testing.T, serve func(conn net.Conn)) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				for {
+					line, err := br.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == "\r\n" {
+						break
+					}
+				}
+				serve(conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveProxy(proxy *ReverseProxy) *app.RequestContext {
+	ctx := app.NewContext(0)
+	ctx.Request.SetRequestURI("http://localhost/")
+	proxy.ServeHTTP(context.Background(), ctx)
+	return ctx
+}
+
+func TestResponseHeaderTimeout(t *testing.T) {
+	slow := rawBackend(t, func(conn net.Conn) {
+		time.Sleep(300 * time.Millisecond)
+		fmt.Fprint(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+	})
+	proxy, err := NewReverseProxy("http://"+slow, WithResponseHeaderTimeout(100*time.Millisecond))
+	assert.Nil(t, err)
+	start := time.Now()
+	ctx := serveProxy(proxy)
+	assert.DeepEqual(t, http.StatusGatewayTimeout, ctx.Response.StatusCode())
+	assert.True(t, time.Since(start) < 250*time.Millisecond)
+
+	var got *ProxyError
+	proxy.SetProxyErrorHandler(func(ctx context.Context, c *app.RequestContext, err *ProxyError) {
+		got = err
+		c.AbortWithStatus(err.StatusCode())
+	})
+	ctx = serveProxy(proxy)
+	assert.DeepEqual(t, http.StatusGatewayTimeout, ctx.Response.StatusCode())
+	assert.DeepEqual(t, ErrorKindHeaderTimeout, got.Kind)
+	var headerErr *ResponseHeaderTimeoutError
+	assert.True(t, errors.As(got, &headerErr))
+	assert.DeepEqual(t, 100*time.Millisecond, headerErr.Timeout)
+	assert.True(t, headerErr.Elapsed >= 100*time.Millisecond)
+
+	// a shorter timeout of the call is no header timeout
+	proxy.SetClientBehavior(ClientDoTimeout(50 * time.Millisecond))
+	serveProxy(proxy)
+	assert.DeepEqual(t, ErrorKindTimeout, got.Kind)
+
+	// the body may take longer than the header timeout as long as it flows
+	trickle := rawBackend(t, func(conn net.Conn) {
+		fmt.Fprint(conn, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\n")
+		for i := 0; i < 5; i++ {
+			time.Sleep(60 * time.Millisecond)
+			fmt.Fprint(conn, "x")
+		}
+	})
+	proxy, err = NewReverseProxy("http://"+trickle,
+		WithResponseHeaderTimeout(100*time.Millisecond),
+		WithBodyReadTimeout(100*time.Millisecond))
+	assert.Nil(t, err)
+	ctx = serveProxy(proxy)
+	assert.DeepEqual(t, http.StatusOK, ctx.Response.StatusCode())
+	assert.DeepEqual(t, "xxxxx", string(ctx.Response.Body()))
+}
+
+func TestBodyReadTimeout(t *testing.T) {
+	stall := rawBackend(t, func(conn net.Conn) {
+		fmt.Fprint(conn, "HTTP/1.1 200 OK\r\nContent-Length: 4\r\n\r\nab")
+		time.Sleep(400 * time.Millisecond)
+		fmt.Fprint(conn, "cd")
+	})
+	proxy, err := NewReverseProxy("http://"+stall, WithBodyReadTimeout(100*time.Millisecond))
+	assert.Nil(t, err)
+	start := time.Now()
+	ctx := serveProxy(proxy)
+	assert.DeepEqual(t, http.StatusGatewayTimeout, ctx.Response.StatusCode())
+	assert.True(t, time.Since(start) < 300*time.Millisecond)
+}
+
+func TestTLSHandshakeTimeout(t *testing.T) {
+	// accepts the connection but never answers the client hello
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	proxy, err := NewReverseProxy("https://"+ln.Addr().String(), WithTLSHandshakeTimeout(100*time.Millisecond))
+	assert.Nil(t, err)
+	start := time.Now()
+	ctx := serveProxy(proxy)
+	assert.DeepEqual(t, http.StatusGatewayTimeout, ctx.Response.StatusCode())
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+}
@@ -0,0 +1,163 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+const (
+	// ContextKeyRequestBytes is the number of request body bytes read from
+	// the client, an int64.
+	ContextKeyRequestBytes = "reverseproxy.request_bytes"
+	// ContextKeyResponseBytes is the size of the response body, an int64,
+	// or -1 if it is streamed to the client after the handler returned, see
+	// SetOnResponse.
+	ContextKeyResponseBytes = "reverseproxy.response_bytes"
+)
+
+// Transfer are the bytes a request moved through the proxy.
+type Transfer struct {
+	// RequestBytes is the number of request body bytes read from the client.
+	RequestBytes int64
+	// ResponseBytes is the number of response body bytes written to the
+	// client, including streamed bodies.
+	ResponseBytes int64
+	StatusCode    int
+	// Duration is the time from the start of the handler until the
+	// response was handed to the server.
+	Duration time.Duration
+}
+
+// SetOnResponse calls f with the bytes of each request once its response
+// was handed to the server, after a streamed body was written, e.g. for
+// billing or bandwidth dashboards. Error responses of the proxy are
+// reported too.
+func (r *ReverseProxy) SetOnResponse(f func(ctx context.Context, c *app.RequestContext, t Transfer)) {
+	r.onResponse = f
+}
+
+// transferCounter counts the bytes of a request.
+type transferCounter struct {
+	// stream is the request body stream of the client, nil if buffered
+	stream  io.Reader
+	request int64
+	start   time.Time
+}
+
+// countTransfer starts counting the request body of c.
+func countTransfer(c *app.RequestContext) *transferCounter {
+	req := &c.Request
+	if !req.IsBodyStream() {
+		return &transferCounter{request: int64(len(req.Body())), start: time.Now()}
+	}
+	t := &transferCounter{stream: req.BodyStream(), start: time.Now()}
+	req.ConstructBodyStream(req.BodyBuffer(), &countingReader{src: t.stream, n: &t.request})
+	return t
+}
+
+// finish sets the context keys and reports the transfer once the response
+// body was written.
+func (t *transferCounter) finish(r *ReverseProxy, c context.Context, ctx *app.RequestContext) {
+	if t.stream != nil {
+		// give the body back so that the server skips the rest of it
+		ctx.Request.ConstructBodyStream(ctx.Request.BodyBuffer(), t.stream)
+	}
+	tr := Transfer{RequestBytes: atomic.LoadInt64(&t.request)}
+	ctx.Set(ContextKeyRequestBytes, tr.RequestBytes)
+	resp := &ctx.Response
+	if !resp.IsBodyStream() || resp.MustSkipBody() {
+		if !resp.MustSkipBody() {
+			tr.ResponseBytes = int64(len(resp.Body()))
+		}
+		ctx.Set(ContextKeyResponseBytes, tr.ResponseBytes)
+		tr.Duration = time.Since(t.start)
+		r.reportTransfer(c, ctx, tr)
+		return
+	}
+	ctx.Set(ContextKeyResponseBytes, int64(-1))
+	if r.onResponse == nil && r.transferred == nil && r.metrics == nil {
+		return
+	}
+	body := &countedBody{src: resp.BodyStream()}
+	body.done = func() {
+		tr.ResponseBytes = body.n
+		tr.Duration = time.Since(t.start)
+		r.reportTransfer(c, ctx, tr)
+	}
+	resp.SetBodyStreamNoReset(body, resp.Header.ContentLength())
+}
+
+func (r *ReverseProxy) reportTransfer(c context.Context, ctx *app.RequestContext, t Transfer) {
+	t.StatusCode = ctx.Response.StatusCode()
+	if r.transferred != nil {
+		r.transferred(t)
+	}
+	if r.metrics != nil {
+		r.metrics.observe(c, ctx, t)
+	}
+	if r.onResponse != nil {
+		r.onResponse(c, ctx, t)
+	}
+}
+
+// countingReader adds the bytes read from src to n.
+type countingReader struct {
+	src io.Reader
+	n   *int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.src.Read(p)
+	atomic.AddInt64(cr.n, int64(n))
+	return n, err
+}
+
+func (cr *countingReader) Close() error {
+	if c, ok := cr.src.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// countedBody counts a response body stream and calls done once the
+// server closed it.
+type countedBody struct {
+	src  io.Reader
+	n    int64
+	done func()
+	once sync.Once
+}
+
+func (b *countedBody) Read(p []byte) (int, error) {
+	n, err := b.src.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+func (b *countedBody) Close() error {
+	var err error
+	if c, ok := b.src.(io.Closer); ok {
+		err = c.Close()
+	}
+	b.once.Do(b.done)
+	return err
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestOnResponse(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		streamRequest bool
+		streamBody    bool
+		down          bool
+		want          Transfer
+		keyResponse   int64
+	}{
+		{name: "buffered", want: Transfer{RequestBytes: 5, ResponseBytes: 6, StatusCode: 200}, keyResponse: 6},
+		{name: "streamed", streamRequest: true, streamBody: true, want: Transfer{RequestBytes: 5, ResponseBytes: 6, StatusCode: 200}, keyResponse: -1},
+		{name: "error", down: true, want: Transfer{RequestBytes: 5, StatusCode: 502}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy, err := NewReverseProxy("http://backend", WithClient(DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+				if tt.down {
+					return syscall.ECONNREFUSED
+				}
+				if req.IsBodyStream() {
+					ioutil.ReadAll(req.BodyStream()) //nolint:errcheck
+				}
+				if tt.streamBody {
+					resp.SetBodyStream(strings.NewReader("world!"), -1)
+				} else {
+					resp.SetBodyString("world!")
+				}
+				return nil
+			})))
+			assert.Nil(t, err)
+			var got []Transfer
+			proxy.SetOnResponse(func(ctx context.Context, c *app.RequestContext, tr Transfer) {
+				assert.True(t, tr.Duration > 0)
+				tr.Duration = 0
+				got = append(got, tr)
+			})
+
+			ctx := app.NewContext(0)
+			ctx.Request.SetMethod("POST")
+			ctx.Request.SetRequestURI("http://localhost/upload")
+			if tt.streamRequest {
+				ctx.Request.SetBodyStream(strings.NewReader("hello"), -1)
+			} else {
+				ctx.Request.SetBodyString("hello")
+			}
+			proxy.ServeHTTP(context.Background(), ctx)
+			assert.DeepEqual(t, int64(5), ctx.GetInt64(ContextKeyRequestBytes))
+			assert.DeepEqual(t, tt.keyResponse, ctx.GetInt64(ContextKeyResponseBytes))
+			if tt.streamBody {
+				// reported once the server wrote and closed the body
+				assert.DeepEqual(t, 0, len(got))
+				body, err := ioutil.ReadAll(ctx.Response.BodyStream())
+				assert.Nil(t, err)
+				assert.DeepEqual(t, "world!", string(body))
+				assert.Nil(t, ctx.Response.CloseBodyStream())
+			}
+			assert.DeepEqual(t, []Transfer{tt.want}, got)
+		})
+	}
+}
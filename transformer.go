@@ -0,0 +1,209 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+// Transformer transforms a body as a byte stream. Bytes written to a
+// Transformer are processed and passed on to the next stage, Flush pushes
+// buffered output downstream and Close finishes the stream. Close must not
+// close the underlying writer.
+type Transformer interface {
+	io.Writer
+	Flush() error
+	Close() error
+}
+
+// TransformerFactory creates a Transformer writing its output to dst.
+// It may inspect and update the response header (e.g. Content-Encoding).
+// Returning a nil Transformer skips the stage for this response.
+type TransformerFactory func(resp *protocol.Response, dst io.Writer) (Transformer, error)
+
+// stageWriter links a stage to the next one, which is only known
+// once the next factory has been called.
+type stageWriter struct {
+	w io.Writer
+}
+
+func (s *stageWriter) Write(p []byte) (int, error) {
+	return s.w.Write(p)
+}
+
+// transformChain is a built chain of transformers. Writes go to the first
+// stage and the last stage writes to the final destination.
+type transformChain struct {
+	head   *stageWriter
+	stages []Transformer
+}
+
+// newTransformChain calls factories in order so that each one sees the
+// header as updated by the previous stages.
+func newTransformChain(resp *protocol.Response, dst io.Writer, factories []TransformerFactory) (*transformChain, error) {
+	c := &transformChain{head: &stageWriter{}}
+	cur := c.head
+	for _, f := range factories {
+		next := &stageWriter{}
+		t, err := f(resp, next)
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			continue
+		}
+		cur.w = t
+		c.stages = append(c.stages, t)
+		cur = next
+	}
+	cur.w = dst
+	return c, nil
+}
+
+func (c *transformChain) Write(p []byte) (int, error) {
+	return c.head.Write(p)
+}
+
+func (c *transformChain) Flush() error {
+	for _, t := range c.stages {
+		if err := t.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *transformChain) Close() error {
+	for _, t := range c.stages {
+		if err := t.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transformResponse runs the response body through the configured transformers.
+// Streamed bodies stay streamed: the chain runs in its own goroutine and feeds
+// a pipe which becomes the new body stream.
+func (r *ReverseProxy) transformResponse(resp *protocol.Response) error {
+	if len(r.responseTransformers) == 0 || resp.MustSkipBody() {
+		return nil
+	}
+
+	if !resp.IsBodyStream() {
+		var buf bytes.Buffer
+		chain, err := newTransformChain(resp, &buf, r.responseTransformers)
+		if err != nil {
+			return err
+		}
+		if len(chain.stages) == 0 {
+			return nil
+		}
+		if _, err = chain.Write(resp.Body()); err != nil {
+			return err
+		}
+		if err = chain.Close(); err != nil {
+			return err
+		}
+		resp.SetBody(buf.Bytes())
+		return nil
+	}
+
+	pr, pw := io.Pipe()
+	chain, err := newTransformChain(resp, pw, r.responseTransformers)
+	if err != nil {
+		return err
+	}
+	if len(chain.stages) == 0 {
+		return nil
+	}
+	src := resp.BodyStream()
+	go func() {
+		_, err := r.copyBuffer(chain, src)
+		if cerr := chain.Close(); err == nil {
+			err = cerr
+		}
+		if closer, ok := src.(io.Closer); ok {
+			closer.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	resp.SetBodyStreamNoReset(pr, -1)
+	return nil
+}
+
+type gzipEncoder struct {
+	zw *gzip.Writer
+}
+
+func (g *gzipEncoder) Write(p []byte) (int, error) { return g.zw.Write(p) }
+func (g *gzipEncoder) Flush() error                { return g.zw.Flush() }
+func (g *gzipEncoder) Close() error                { return g.zw.Close() }
+
+// GzipEncoder returns a TransformerFactory which gzip-compresses the body
+// and sets Content-Encoding. Responses which are already encoded are skipped.
+func GzipEncoder(level int) TransformerFactory {
+	return func(resp *protocol.Response, dst io.Writer) (Transformer, error) {
+		if len(resp.Header.Peek("Content-Encoding")) > 0 {
+			return nil, nil
+		}
+		zw, err := gzip.NewWriterLevel(dst, level)
+		if err != nil {
+			return nil, err
+		}
+		resp.Header.Set("Content-Encoding", "gzip")
+		return &gzipEncoder{zw: zw}, nil
+	}
+}
+
+type gzipDecoder struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+func (g *gzipDecoder) Write(p []byte) (int, error) { return g.pw.Write(p) }
+func (g *gzipDecoder) Flush() error                { return nil }
+
+func (g *gzipDecoder) Close() error {
+	g.pw.Close()
+	return <-g.done
+}
+
+// GzipDecoder returns a TransformerFactory which decompresses gzip-encoded
+// bodies and removes the Content-Encoding header. Other responses are skipped.
+func GzipDecoder() TransformerFactory {
+	return func(resp *protocol.Response, dst io.Writer) (Transformer, error) {
+		if !bytes.EqualFold(resp.Header.Peek("Content-Encoding"), []byte("gzip")) {
+			return nil, nil
+		}
+		resp.Header.Del("Content-Encoding")
+		pr, pw := io.Pipe()
+		g := &gzipDecoder{pw: pw, done: make(chan error, 1)}
+		go func() {
+			zr, err := gzip.NewReader(pr)
+			if err == nil {
+				_, err = io.Copy(dst, zr)
+			}
+			// unblock pending writes if decoding stopped early
+			pr.CloseWithError(err)
+			g.done <- err
+		}()
+		return g, nil
+	}
+}
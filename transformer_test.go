@@ -0,0 +1,83 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+type upperTransformer struct {
+	dst io.Writer
+}
+
+func (u *upperTransformer) Write(p []byte) (int, error) { return u.dst.Write(bytes.ToUpper(p)) }
+func (u *upperTransformer) Flush() error                { return nil }
+func (u *upperTransformer) Close() error                { return nil }
+
+func upper(_ *protocol.Response, dst io.Writer) (Transformer, error) {
+	return &upperTransformer{dst: dst}, nil
+}
+
+func gzipBytes(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(b)
+	assert.Nil(t, err)
+	assert.Nil(t, zw.Close())
+	return buf.Bytes()
+}
+
+func gunzipBytes(t *testing.T, b []byte) []byte {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	assert.Nil(t, err)
+	out, err := ioutil.ReadAll(zr)
+	assert.Nil(t, err)
+	return out
+}
+
+func TestTransformResponse(t *testing.T) {
+	proxy, _ := NewSingleHostReverseProxy("http://127.0.0.1:9990/proxy")
+	proxy.SetResponseTransformers(GzipDecoder(), upper, GzipEncoder(gzip.DefaultCompression))
+
+	resp := protocol.AcquireResponse()
+	resp.Header.Set("Content-Encoding", "gzip")
+	resp.SetBody(gzipBytes(t, []byte("hello transformer")))
+	assert.Nil(t, proxy.transformResponse(resp))
+	assert.DeepEqual(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.DeepEqual(t, "HELLO TRANSFORMER", string(gunzipBytes(t, resp.Body())))
+
+	// streamed bodies stay streamed
+	resp = protocol.AcquireResponse()
+	resp.Header.Set("Content-Encoding", "gzip")
+	resp.SetBodyStream(bytes.NewReader(gzipBytes(t, []byte("hello stream"))), -1)
+	assert.Nil(t, proxy.transformResponse(resp))
+	assert.True(t, resp.IsBodyStream())
+	assert.DeepEqual(t, "HELLO STREAM", string(gunzipBytes(t, resp.Body())))
+
+	// plain responses only go through the stages which apply to them
+	proxy.SetResponseTransformers(GzipDecoder(), upper)
+	resp = protocol.AcquireResponse()
+	resp.SetBody([]byte("plain"))
+	assert.Nil(t, proxy.transformResponse(resp))
+	assert.DeepEqual(t, "", resp.Header.Get("Content-Encoding"))
+	assert.DeepEqual(t, "PLAIN", string(resp.Body()))
+}
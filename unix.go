@@ -0,0 +1,65 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"crypto/tls"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app/client"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/network"
+	"github.com/cloudwego/hertz/pkg/network/standard"
+)
+
+// unixDialer dials the unix socket at path whatever address is asked for.
+type unixDialer struct {
+	network.Dialer
+	path string
+}
+
+func (d *unixDialer) DialConnection(_, _ string, timeout time.Duration, _ *tls.Config) (network.Conn, error) {
+	return d.Dialer.DialConnection("unix", d.path, timeout, nil)
+}
+
+func (d *unixDialer) DialTimeout(_, _ string, timeout time.Duration, _ *tls.Config) (net.Conn, error) {
+	return d.Dialer.DialTimeout("unix", d.path, timeout, nil)
+}
+
+// withUnixSocket makes the client connect to the unix socket at path.
+func withUnixSocket(path string) config.ClientOption {
+	return client.WithDialer(&unixDialer{Dialer: standard.NewDialer(), path: path})
+}
+
+// parseUnixTarget splits a target like "unix:///var/run/app.sock?host=app"
+// into the socket path and the HTTP target "http://app". The host defaults
+// to "localhost".
+func parseUnixTarget(target string) (socket, httpTarget string, ok bool) {
+	if !strings.HasPrefix(target, "unix://") {
+		return "", "", false
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Path == "" {
+		return "", "", false
+	}
+	host := u.Query().Get("host")
+	if host == "" {
+		host = "localhost"
+	}
+	return u.Path, "http://" + host, true
+}
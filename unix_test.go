@@ -0,0 +1,86 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/client"
+	"github.com/cloudwego/hertz/pkg/app/server"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+)
+
+func TestParseUnixTarget(t *testing.T) {
+	for _, tt := range []struct {
+		target, socket, httpTarget string
+		ok                         bool
+	}{
+		{"unix:///var/run/app.sock", "/var/run/app.sock", "http://localhost", true},
+		{"unix:///var/run/app.sock?host=app.local", "/var/run/app.sock", "http://app.local", true},
+		{"unix://", "", "", false},
+		{"http://127.0.0.1:8080", "", "", false},
+	} {
+		socket, httpTarget, ok := parseUnixTarget(tt.target)
+		assert.DeepEqual(t, tt.socket, socket)
+		assert.DeepEqual(t, tt.httpTarget, httpTarget)
+		assert.DeepEqual(t, tt.ok, ok)
+	}
+}
+
+func TestUnixSocketTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reverseproxy")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "app.sock")
+
+	backend := server.New(server.WithNetwork("unix"), server.WithHostPorts(socket))
+	backend.GET("/*path", func(cc context.Context, ctx *app.RequestContext) {
+		ctx.String(200, string(ctx.Request.Host())+string(ctx.Request.URI().Path()))
+	})
+	go backend.Spin()
+
+	proxy, err := NewSingleHostReverseProxy("unix://" + socket + "?host=app.local")
+	assert.Nil(t, err)
+	rt, err := NewRouter([]Route{{Path: "/api/", Target: "unix://" + socket, StripPrefix: true}})
+	assert.Nil(t, err)
+	_, err = NewRouter([]Route{{Path: "/users/:id", Target: "unix://" + socket}})
+	assert.NotNil(t, err)
+
+	r := server.New(server.WithHostPorts("127.0.0.1:10023"))
+	r.GET("/backend", proxy.ServeHTTP)
+	r.Use(rt.ServeHTTP)
+	go r.Spin()
+	time.Sleep(time.Second)
+
+	cli, _ := client.NewClient()
+	for _, tt := range []struct {
+		uri  string
+		want string
+	}{
+		{"/backend", "app.local/backend"},
+		{"/api/users", "localhost/users"},
+	} {
+		status, body, err := cli.Get(context.Background(), nil, "http://127.0.0.1:10023"+tt.uri)
+		assert.Nil(t, err)
+		assert.DeepEqual(t, 200, status)
+		assert.DeepEqual(t, tt.want, string(body))
+	}
+}
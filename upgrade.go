@@ -0,0 +1,137 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/utils"
+	"github.com/cloudwego/hertz/pkg/network"
+	"github.com/cloudwego/hertz/pkg/network/standard"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	reqwriter "github.com/cloudwego/hertz/pkg/protocol/http1/req"
+	respreader "github.com/cloudwego/hertz/pkg/protocol/http1/resp"
+)
+
+// upgradeDialer dials backends of upgrade requests, which bypass the client
+// as their connection is taken over after 101 Switching Protocols.
+var upgradeDialer network.Dialer = standard.NewDialer()
+
+// backendDialer returns the dialer of upgrade requests, resolving hosts
+// with the resolver set by WithResolver or WithHappyEyeballs.
+func (r *ReverseProxy) backendDialer() network.Dialer {
+	if r.resolver == nil {
+		return upgradeDialer
+	}
+	return &resolvingDialer{Dialer: upgradeDialer, resolver: r.resolver, delay: r.happyEyeballsDelay}
+}
+
+// UpgradeOptions configures requests asking for a protocol upgrade, e.g.
+// websockets, see ReverseProxy.SetUpgradeOptions.
+type UpgradeOptions struct {
+	// Disabled forwards upgrade requests as plain requests, without the
+	// Upgrade header.
+	Disabled bool
+	// DialTimeout limits dialing the backend, 0 means consts.DefaultDialTimeout.
+	DialTimeout time.Duration
+	// TLSConfig is used for https targets. Its ServerName defaults to the
+	// target host.
+	TLSConfig *tls.Config
+}
+
+// SetUpgradeOptions configures the handling of upgrade requests, which are
+// sent over a dedicated connection instead of the client.
+func (r *ReverseProxy) SetUpgradeOptions(opts UpgradeOptions) {
+	r.upgrade = &opts
+}
+
+// serverName returns the host of addr without port, brackets or the zone
+// of an IPv6 literal, to verify the certificate of the backend.
+func serverName(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if i := strings.IndexByte(host, '%'); i >= 0 {
+		host = host[:i]
+	}
+	return strings.ToLower(host)
+}
+
+// upgradeType returns the protocol requested by the Upgrade header if the
+// request asks for a connection upgrade, e.g. "websocket" or "spdy/3.1".
+func upgradeType(h *protocol.RequestHeader) string {
+	for v := h.Peek("Connection"); len(v) > 0; {
+		var sf []byte
+		sf, v = nextToken(v)
+		if bytes.EqualFold(sf, []byte("upgrade")) {
+			return string(h.Peek("Upgrade"))
+		}
+	}
+	return ""
+}
+
+// doUpgrade sends an upgrade request over its own connection to the
+// backend. If the backend switches protocols, the returned connection
+// is to be spliced with the one of the client.
+func doUpgrade(req *protocol.Request, resp *protocol.Response, upgrade string, opts *UpgradeOptions, dialer network.Dialer) (network.Conn, error) {
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", upgrade)
+
+	uri := req.URI()
+	isTLS := string(uri.Scheme()) == "https"
+	addr := utils.AddMissingPort(string(unescapeZone(uri.Host())), isTLS)
+	timeout := consts.DefaultDialTimeout
+	var tlsConfig *tls.Config
+	if opts != nil {
+		if opts.DialTimeout > 0 {
+			timeout = opts.DialTimeout
+		}
+		tlsConfig = opts.TLSConfig
+	}
+	if !isTLS {
+		tlsConfig = nil
+	} else if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: serverName(addr)}
+	} else if tlsConfig.ServerName == "" {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = serverName(addr)
+	}
+	backend, err := dialer.DialConnection("tcp", addr, timeout, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	if err = reqwriter.Write(req, backend); err == nil {
+		err = backend.Flush()
+	}
+	if err == nil {
+		err = respreader.Read(resp, backend)
+	}
+	if err == nil && resp.StatusCode() == consts.StatusSwitchingProtocols {
+		if got := string(resp.Header.Peek("Upgrade")); !strings.EqualFold(got, upgrade) {
+			err = fmt.Errorf("backend tried to switch protocol %q when %q was requested", got, upgrade)
+		} else {
+			return backend, nil
+		}
+	}
+	backend.Close()
+	return nil, err
+}
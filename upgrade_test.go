@@ -0,0 +1,95 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/server"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/network"
+)
+
+func TestReverseProxyUpgrade(t *testing.T) {
+	backend := server.New(server.WithHostPorts("127.0.0.1:10026"))
+	backend.GET("/echo", func(cc context.Context, ctx *app.RequestContext) {
+		if string(ctx.Request.Header.Peek("Upgrade")) != "echo" {
+			ctx.String(400, "upgrade required")
+			return
+		}
+		ctx.Response.Header.Set("Connection", "Upgrade")
+		ctx.Response.Header.Set("Upgrade", "echo")
+		ctx.SetStatusCode(http.StatusSwitchingProtocols)
+		ctx.Hijack(func(c network.Conn) {
+			_, _ = io.Copy(c, c)
+		})
+	})
+	go backend.Spin()
+
+	proxy, _ := NewSingleHostReverseProxy("http://127.0.0.1:10026")
+	r := server.New(server.WithHostPorts("127.0.0.1:10027"))
+	r.GET("/echo", proxy.ServeHTTP)
+	go r.Spin()
+	time.Sleep(time.Second)
+
+	conn, err := net.Dial("tcp", "127.0.0.1:10027")
+	assert.Nil(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET /echo HTTP/1.1\r\nHost: 127.0.0.1:10027\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n"))
+	assert.Nil(t, err)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.DeepEqual(t, "echo", resp.Header.Get("Upgrade"))
+	for _, msg := range []string{"ping", "pong"} {
+		_, err = conn.Write([]byte(msg))
+		assert.Nil(t, err)
+		buf := make([]byte, len(msg))
+		_, err = io.ReadFull(br, buf)
+		assert.Nil(t, err)
+		assert.DeepEqual(t, msg, string(buf))
+	}
+
+	// backends refusing the upgrade answer as usual
+	conn2, err := net.Dial("tcp", "127.0.0.1:10027")
+	assert.Nil(t, err)
+	defer conn2.Close()
+	_, err = conn2.Write([]byte("GET /echo HTTP/1.1\r\nHost: 127.0.0.1:10027\r\nConnection: Upgrade\r\nUpgrade: other\r\n\r\n"))
+	assert.Nil(t, err)
+	resp, err = http.ReadResponse(bufio.NewReader(conn2), nil)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, 400, resp.StatusCode)
+}
+
+func TestServerName(t *testing.T) {
+	for addr, want := range map[string]string{
+		"Backend:443":            "backend",
+		"backend":                "backend",
+		"[::1]:443":              "::1",
+		"[fe80::1%eth0]:443":     "fe80::1",
+		"[2001:DB8::1]:8443":     "2001:db8::1",
+		"backend.example.com:80": "backend.example.com",
+	} {
+		assert.DeepEqual(t, want, serverName(addr))
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app/client"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/cloudwego/hertz/pkg/protocol/suite"
+)
+
+// WithIsolatedUpstreams gives each upstream, by scheme and host, its own
+// client, created on its first request with the client options of the
+// proxy, so that a slow backend holding its connections cannot starve the
+// others of a shared client. It is ignored with WithClient and for unix
+// socket targets.
+func WithIsolatedUpstreams() ProxyOption {
+	return func(o *ProxyOptions) {
+		o.IsolatedUpstreams = true
+	}
+}
+
+// WithUpstreamClientOptions adds options to the client of the upstream of
+// target, e.g. its own timeouts, pool size or TLS config, implying
+// WithIsolatedUpstreams. Only the scheme and host of target are used; they
+// must be those of the backend URIs, e.g. "https://api:8443".
+//
+//	reverseproxy.WithUpstreamClientOptions("https://billing:8443",
+//		client.WithTLSConfig(billingTLS), client.WithMaxConnsPerHost(64))
+func WithUpstreamClientOptions(target string, options ...config.ClientOption) ProxyOption {
+	return func(o *ProxyOptions) {
+		o.IsolatedUpstreams = true
+		if o.UpstreamClientOptions == nil {
+			o.UpstreamClientOptions = make(map[string][]config.ClientOption)
+		}
+		o.UpstreamClientOptions[target] = append(o.UpstreamClientOptions[target], options...)
+	}
+}
+
+// upstreamClients is the Doer of WithIsolatedUpstreams, keeping a client per
+// upstream.
+type upstreamClients struct {
+	options []config.ClientOption
+	// upstream are the options of WithUpstreamClientOptions by upstream
+	upstream map[string][]config.ClientOption
+
+	mu      sync.RWMutex
+	clients map[string]*client.Client
+	factory suite.ClientFactory
+}
+
+func newUpstreamClients(options []config.ClientOption, upstream map[string][]config.ClientOption) (*upstreamClients, error) {
+	u := &upstreamClients{
+		options:  options,
+		upstream: make(map[string][]config.ClientOption, len(upstream)),
+		clients:  make(map[string]*client.Client),
+	}
+	for target, opts := range upstream {
+		if _, err := parseTarget(target); err != nil {
+			return nil, err
+		}
+		t, _ := url.Parse(target)
+		key := strings.ToLower(t.Scheme + "://" + t.Host)
+		u.upstream[key] = append(u.upstream[key], opts...)
+	}
+	// invalid options fail here rather than on the first request
+	for key := range u.upstream {
+		if _, err := u.client(key); err != nil {
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+// upstreamKey returns the scheme and host of the URI of req.
+func upstreamKey(req *protocol.Request) string {
+	uri := req.URI()
+	var scratch [64]byte
+	b := append(scratch[:0], bytes.ToLower(uri.Scheme())...)
+	b = append(b, "://"...)
+	b = append(b, bytes.ToLower(uri.Host())...)
+	return string(b)
+}
+
+// client returns the client of upstream, creating it if needed.
+func (u *upstreamClients) client(upstream string) (*client.Client, error) {
+	u.mu.RLock()
+	c := u.clients[upstream]
+	u.mu.RUnlock()
+	if c != nil {
+		return c, nil
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if c = u.clients[upstream]; c != nil {
+		return c, nil
+	}
+	options := u.options
+	if opts := u.upstream[upstream]; len(opts) > 0 {
+		options = append(options[:len(options):len(options)], opts...)
+	}
+	c, err := client.NewClient(options...)
+	if err != nil {
+		return nil, err
+	}
+	if u.factory != nil {
+		c.SetClientFactory(u.factory)
+	}
+	u.clients[upstream] = c
+	return c, nil
+}
+
+func (u *upstreamClients) Do(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+	c, err := u.client(upstreamKey(req))
+	if err != nil {
+		return err
+	}
+	return c.Do(ctx, req, resp)
+}
+
+func (u *upstreamClients) DoTimeout(ctx context.Context, req *protocol.Request, resp *protocol.Response, timeout time.Duration) error {
+	c, err := u.client(upstreamKey(req))
+	if err != nil {
+		return err
+	}
+	return c.DoTimeout(ctx, req, resp, timeout)
+}
+
+func (u *upstreamClients) DoDeadline(ctx context.Context, req *protocol.Request, resp *protocol.Response, deadline time.Time) error {
+	c, err := u.client(upstreamKey(req))
+	if err != nil {
+		return err
+	}
+	return c.DoDeadline(ctx, req, resp, deadline)
+}
+
+func (u *upstreamClients) DoRedirects(ctx context.Context, req *protocol.Request, resp *protocol.Response, maxRedirectsCount int) error {
+	c, err := u.client(upstreamKey(req))
+	if err != nil {
+		return err
+	}
+	return c.DoRedirects(ctx, req, resp, maxRedirectsCount)
+}
+
+// SetClientFactory sets cf to the clients of all upstreams, see
+// ReverseProxy.SetClientFactory.
+func (u *upstreamClients) SetClientFactory(cf suite.ClientFactory) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.factory = cf
+	for _, c := range u.clients {
+		c.SetClientFactory(cf)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/client"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/network"
+	"github.com/cloudwego/hertz/pkg/network/standard"
+)
+
+// recordingDialer records the addresses dialed and fails.
+type recordingDialer struct {
+	network.Dialer
+	mu    sync.Mutex
+	addrs []string
+}
+
+func (d *recordingDialer) DialConnection(n, address string, timeout time.Duration, tlsConfig *tls.Config) (network.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.addrs = append(d.addrs, address)
+	return nil, errors.New("refused")
+}
+
+func (d *recordingDialer) dialed() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.addrs...)
+}
+
+func TestIsolatedUpstreams(t *testing.T) {
+	shared := &recordingDialer{Dialer: standard.NewDialer()}
+	billing := &recordingDialer{Dialer: standard.NewDialer()}
+	proxy, err := NewReverseProxy("http://default.test",
+		WithClientOptions(client.WithDialer(shared)),
+		WithUpstreamClientOptions("HTTP://Billing.test:8080/ignored", client.WithDialer(billing)),
+	)
+	assert.Nil(t, err)
+	serve := func(target string) {
+		ctx := app.NewContext(0)
+		ctx.Request.SetRequestURI("http://localhost/")
+		ctx.Set(ContextKeyTarget, target)
+		proxy.ServeHTTP(context.Background(), ctx)
+		assert.DeepEqual(t, 502, ctx.Response.StatusCode())
+	}
+	serve("http://default.test")
+	serve("http://other.test")
+	serve("http://billing.test:8080")
+	serve("http://default.test")
+
+	assert.DeepEqual(t, []string{"default.test:80", "other.test:80", "default.test:80"}, shared.dialed())
+	assert.DeepEqual(t, []string{"billing.test:8080"}, billing.dialed())
+	u := proxy.Client().(*upstreamClients)
+	assert.DeepEqual(t, 3, len(u.clients))
+
+	_, err = NewReverseProxy("http://default.test", WithUpstreamClientOptions("ftp://billing.test"))
+	assert.NotNil(t, err)
+	// ignored with WithClient
+	proxy, err = NewReverseProxy("http://default.test", WithIsolatedUpstreams(), WithClient(DoerFunc(nil)))
+	assert.Nil(t, err)
+	_, ok := proxy.Client().(*upstreamClients)
+	assert.False(t, ok)
+}
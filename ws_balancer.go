@@ -0,0 +1,148 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"hash/fnv"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+// WithBackends balances sessions across targets together with the target
+// of NewWSReverseProxy, round robin unless WithAffinity pins clients to one
+// of them.
+func WithBackends(targets ...string) Option {
+	return func(o *Options) {
+		o.Backends = append(o.Backends, targets...)
+	}
+}
+
+// WSAffinity makes reconnecting clients return to the backend holding their
+// session state. The first of Cookie, Header and Key that applies to a
+// request chooses its backend.
+type WSAffinity struct {
+	// Cookie is the name of a cookie set on the upgrade response naming the
+	// backend, clients sending it back return to that backend as long as
+	// it is configured.
+	Cookie string
+	// Header is a request header whose value is hashed to a backend, e.g. a
+	// user ID.
+	Header string
+	// Key returns a value hashed to a backend, e.g. the client IP, "" if it
+	// does not apply.
+	Key func(ctx context.Context, c *app.RequestContext) string
+}
+
+// WithAffinity sets how clients are pinned to one of WithBackends. Hashes
+// use rendezvous hashing, so that only the clients of a removed backend
+// move to another one.
+func WithAffinity(a WSAffinity) Option {
+	return func(o *Options) {
+		o.Affinity = &a
+	}
+}
+
+// wsBackends are the targets of a WSReverseProxy.
+type wsBackends struct {
+	targets []string
+	// ids name the targets in affinity cookies without revealing them
+	ids      []string
+	affinity *WSAffinity
+	next     uint32
+}
+
+func newWSBackends(target string, o *Options) *wsBackends {
+	b := &wsBackends{
+		targets:  append([]string{target}, o.Backends...),
+		affinity: o.Affinity,
+	}
+	b.ids = make([]string, len(b.targets))
+	for i, t := range b.targets {
+		b.ids[i] = strconv.FormatUint(hashString(t), 36)
+	}
+	return b
+}
+
+// choose returns the target of the session requested by c and sets the
+// affinity cookie.
+func (b *wsBackends) choose(ctx context.Context, c *app.RequestContext) string {
+	if len(b.targets) == 1 {
+		return b.targets[0]
+	}
+	i := b.pinned(ctx, c)
+	if i < 0 {
+		i = int((atomic.AddUint32(&b.next, 1) - 1) % uint32(len(b.targets)))
+	}
+	if a := b.affinity; a != nil && a.Cookie != "" {
+		cookie := protocol.AcquireCookie()
+		cookie.SetKey(a.Cookie)
+		cookie.SetValue(b.ids[i])
+		cookie.SetPath("/")
+		cookie.SetHTTPOnly(true)
+		c.Response.Header.SetCookie(cookie)
+		protocol.ReleaseCookie(cookie)
+	}
+	return b.targets[i]
+}
+
+// pinned returns the index of the backend the affinity chooses, -1 if none.
+func (b *wsBackends) pinned(ctx context.Context, c *app.RequestContext) int {
+	a := b.affinity
+	if a == nil {
+		return -1
+	}
+	if a.Cookie != "" {
+		if id := string(c.Request.Header.Cookie(a.Cookie)); id != "" {
+			for i := range b.ids {
+				if b.ids[i] == id {
+					return i
+				}
+			}
+		}
+	}
+	if a.Header != "" {
+		if v := c.Request.Header.Peek(a.Header); len(v) > 0 {
+			return b.rendezvous(string(v))
+		}
+	}
+	if a.Key != nil {
+		if key := a.Key(ctx, c); key != "" {
+			return b.rendezvous(key)
+		}
+	}
+	return -1
+}
+
+// rendezvous returns the index of the backend with the highest hash of key
+// and its target.
+func (b *wsBackends) rendezvous(key string) int {
+	best, bestScore := 0, uint64(0)
+	for i, t := range b.targets {
+		if score := hashString(key + "\x00" + t); i == 0 || score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s)) //nolint:errcheck
+	return h.Sum64()
+}
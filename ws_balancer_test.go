@@ -0,0 +1,99 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestWSBackendsRoundRobin(t *testing.T) {
+	w := NewWSReverseProxy("ws://a", WithBackends("ws://b", "ws://c"))
+	var got []string
+	for i := 0; i < 4; i++ {
+		got = append(got, w.backends.choose(context.Background(), app.NewContext(0)))
+	}
+	assert.DeepEqual(t, []string{"ws://a", "ws://b", "ws://c", "ws://a"}, got)
+
+	single := NewWSReverseProxy("ws://a")
+	assert.DeepEqual(t, "ws://a", single.backends.choose(context.Background(), app.NewContext(0)))
+}
+
+func TestWSAffinity(t *testing.T) {
+	w := NewWSReverseProxy("ws://a", WithBackends("ws://b", "ws://c"), WithAffinity(WSAffinity{
+		Cookie: "ws-backend",
+		Header: "X-User",
+		Key: func(ctx context.Context, c *app.RequestContext) string {
+			return string(c.Request.Header.Peek("X-Client"))
+		},
+	}))
+	choose := func(header ...string) (string, *app.RequestContext) {
+		c := app.NewContext(0)
+		for i := 0; i+1 < len(header); i += 2 {
+			c.Request.Header.Set(header[i], header[i+1])
+		}
+		return w.backends.choose(context.Background(), c), c
+	}
+
+	// the same header value always reaches the same backend, values spread
+	seen := map[string]bool{}
+	for i := 0; i < 30; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		first, _ := choose("X-User", user)
+		again, _ := choose("X-User", user)
+		assert.DeepEqual(t, first, again)
+		seen[first] = true
+	}
+	assert.DeepEqual(t, 3, len(seen))
+
+	byKey, _ := choose("X-Client", "10.0.0.1")
+	for i := 0; i < 3; i++ {
+		again, _ := choose("X-Client", "10.0.0.1")
+		assert.DeepEqual(t, byKey, again)
+	}
+
+	// the cookie takes precedence and pins the client to its backend
+	target, c := choose("X-User", "user-1")
+	cookie := protocol.AcquireCookie()
+	cookie.SetKey("ws-backend")
+	assert.True(t, c.Response.Header.Cookie(cookie))
+	assert.DeepEqual(t, "/", string(cookie.Path()))
+	for i := 0; i < 5; i++ {
+		again, _ := choose("Cookie", "ws-backend="+string(cookie.Value()), "X-User", fmt.Sprintf("other-%d", i))
+		assert.DeepEqual(t, target, again)
+	}
+
+	// unknown cookies fall back to round robin
+	rr1, _ := choose("Cookie", "ws-backend=gone")
+	rr2, _ := choose("Cookie", "ws-backend=gone")
+	assert.NotEqual(t, rr1, rr2)
+}
+
+func TestRendezvousStability(t *testing.T) {
+	all := newWSBackends("ws://a", &Options{Backends: []string{"ws://b", "ws://c"}})
+	less := newWSBackends("ws://a", &Options{Backends: []string{"ws://b"}})
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if target := all.targets[all.rendezvous(key)]; target != "ws://c" {
+			// keys of the remaining backends stay where they are
+			assert.DeepEqual(t, target, less.targets[less.rendezvous(key)])
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// WithQueryForwarding makes the proxy forward the query string of the
+// request to the backend, e.g. a token or channel of "/ws?room=1", combined
+// with the query of the target as set by merge. By default the target is
+// dialed as given and the query of the request is dropped.
+func WithQueryForwarding(merge QueryMerge) Option {
+	return func(o *Options) {
+		o.ForwardQuery = true
+		o.QueryMerge = merge
+	}
+}
+
+// WithQueryRewrite makes the proxy forward the query string returned by f
+// for the query of the request, e.g. without an access token meant for the
+// proxy, combined with the query of the target as set by WithQueryForwarding,
+// QueryAppend by default. An empty query is not forwarded.
+func WithQueryRewrite(f func(ctx context.Context, c *app.RequestContext, query string) string) Option {
+	return func(o *Options) {
+		o.ForwardQuery = true
+		o.QueryRewrite = f
+	}
+}
+
+// backendURL returns the URL of target to dial for the request of c.
+func (o *Options) backendURL(ctx context.Context, c *app.RequestContext, target string) string {
+	if !o.ForwardQuery {
+		return target
+	}
+	query := string(c.Request.URI().QueryString())
+	if o.QueryRewrite != nil {
+		query = o.QueryRewrite(ctx, c, query)
+	}
+	base, targetQuery := target, ""
+	if i := strings.IndexByte(target, '?'); i >= 0 {
+		base, targetQuery = target[:i], target[i+1:]
+	}
+	return string(appendMergedQuery([]byte(base), targetQuery, query, o.QueryMerge))
+}
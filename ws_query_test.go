@@ -0,0 +1,70 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+)
+
+func TestWSBackendURL(t *testing.T) {
+	dropToken := func(ctx context.Context, c *app.RequestContext, query string) string {
+		var kept []string
+		for _, param := range strings.Split(query, "&") {
+			if !strings.HasPrefix(param, "token=") {
+				kept = append(kept, param)
+			}
+		}
+		return strings.Join(kept, "&")
+	}
+	for _, tt := range []struct {
+		opts   []Option
+		target string
+		want   string
+	}{
+		{nil, "ws://backend/ws?v=1", "ws://backend/ws?v=1"},
+		{[]Option{WithQueryForwarding(QueryAppend)}, "ws://backend/ws", "ws://backend/ws?room=1&token=t&v=2"},
+		{[]Option{WithQueryForwarding(QueryAppend)}, "ws://backend/ws?v=1", "ws://backend/ws?v=1&room=1&token=t&v=2"},
+		{[]Option{WithQueryForwarding(QueryTargetWins)}, "ws://backend/ws?v=1", "ws://backend/ws?v=1&room=1&token=t"},
+		{[]Option{WithQueryRewrite(dropToken)}, "ws://backend/ws", "ws://backend/ws?room=1&v=2"},
+		{[]Option{WithQueryRewrite(func(ctx context.Context, c *app.RequestContext, query string) string { return "" })}, "ws://backend/ws", "ws://backend/ws"},
+	} {
+		c := app.NewContext(0)
+		c.Request.SetRequestURI("http://localhost/ws?room=1&token=t&v=2")
+		assert.DeepEqual(t, tt.want, newOptions(tt.opts...).backendURL(context.Background(), c, tt.target))
+	}
+}
+
+func TestWSQueryForwarding(t *testing.T) {
+	queries := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries <- r.URL.RawQuery
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer backend.Close()
+
+	proxy := NewWSReverseProxy("ws"+strings.TrimPrefix(backend.URL, "http")+"/ws", WithQueryForwarding(QueryAppend))
+	c := app.NewContext(0)
+	c.Request.SetRequestURI("http://localhost/ws?room=1")
+	proxy.ServeHTTP(context.Background(), c)
+	assert.DeepEqual(t, "room=1", <-queries)
+	assert.DeepEqual(t, http.StatusForbidden, c.Response.StatusCode())
+}
@@ -49,7 +49,6 @@ import (
 	"github.com/bytedance/gopkg/util/gopool"
 
 	"github.com/cloudwego/hertz/pkg/app"
-	"github.com/cloudwego/hertz/pkg/common/hlog"
 	"github.com/cloudwego/hertz/pkg/protocol"
 	"github.com/cloudwego/hertz/pkg/protocol/consts"
 	"github.com/gorilla/websocket"
@@ -57,8 +56,9 @@ import (
 )
 
 type WSReverseProxy struct {
-	target  string
-	options *Options
+	target   string
+	options  *Options
+	backends *wsBackends
 }
 
 // NewWSReverseProxy new a proxy which will provide handler for websocket reverse proxy
@@ -68,8 +68,9 @@ func NewWSReverseProxy(target string, opts ...Option) *WSReverseProxy {
 	}
 	options := newOptions(opts...)
 	wsrp := &WSReverseProxy{
-		target:  target,
-		options: options,
+		target:   target,
+		options:  options,
+		backends: newWSBackends(target, options),
 	}
 	return wsrp
 }
@@ -81,12 +82,14 @@ func (w *WSReverseProxy) ServeHTTP(ctx context.Context, c *app.RequestContext) {
 	if w.options.Director != nil {
 		w.options.Director(ctx, c, forwardHeader)
 	}
-	connBackend, respBackend, err := w.options.Dialer.Dial(w.target, forwardHeader)
+	log := orHlog(w.options.Logger)
+	target := w.options.backendURL(ctx, c, w.backends.choose(ctx, c))
+	connBackend, respBackend, err := w.options.Dialer.Dial(target, forwardHeader)
 	if err != nil {
-		hlog.CtxErrorf(ctx, "can not dial to remote backend(%v): %v", w.target, err)
+		log.Errorf(ctx, "can not dial to remote backend(%v): %v", target, err)
 		if respBackend != nil {
 			if err = wsCopyResponse(&c.Response, respBackend); err != nil {
-				hlog.CtxErrorf(ctx, "can not copy response: %v", err)
+				log.Errorf(ctx, "can not copy response: %v", err)
 			}
 		} else {
 			c.AbortWithMsg(err.Error(), consts.StatusServiceUnavailable)
@@ -95,6 +98,10 @@ func (w *WSReverseProxy) ServeHTTP(ctx context.Context, c *app.RequestContext) {
 	}
 	if err := w.options.Upgrader.Upgrade(c, func(connClient *hzws.Conn) {
 		defer connClient.Close()
+		defer connBackend.Close()
+		session := newWSSession(connClient, connBackend, log)
+		session.monitor(ctx, w.options)
+		defer session.stop()
 
 		var (
 			errClientC  = make(chan error, 1)
@@ -102,7 +109,7 @@ func (w *WSReverseProxy) ServeHTTP(ctx context.Context, c *app.RequestContext) {
 			errMsg      string
 		)
 
-		hlog.CtxDebugf(ctx, "upgrade handler working...")
+		log.Debugf(ctx, "upgrade handler working...")
 
 		//                       replicateWSRespConn
 		//               ┌─────────────────────────────────┐
@@ -121,13 +128,14 @@ func (w *WSReverseProxy) ServeHTTP(ctx context.Context, c *app.RequestContext) {
 		// └──────────┘           └────────────────┘             └──────────┘
 
 		gopool.CtxGo(ctx, func() {
-			replicateWSRespConn(ctx, connClient, connBackend, errClientC)
+			replicateWSRespConn(ctx, connClient, connBackend, errClientC, session)
 		})
 		gopool.CtxGo(ctx, func() {
-			replicateWSReqConn(ctx, connBackend, connClient, errBackendC)
+			replicateWSReqConn(ctx, connBackend, connClient, errBackendC, session)
 		})
 
-		for {
+		// each replication ends with one error, a close error ends the session
+		for i := 0; i < 2; i++ {
 			select {
 			case err = <-errClientC:
 				errMsg = "copy websocket response err: %v"
@@ -138,14 +146,15 @@ func (w *WSReverseProxy) ServeHTTP(ctx context.Context, c *app.RequestContext) {
 			var ce *websocket.CloseError
 			var hzce *hzws.CloseError
 			if !errors.As(err, &ce) && !errors.As(err, &hzce) {
-				hlog.CtxErrorf(ctx, errMsg, err)
+				log.Errorf(ctx, errMsg, err)
 				continue
 			}
 
 			break
 		}
 	}); err != nil {
-		hlog.CtxErrorf(ctx, "can not upgrade to websocket: %v", err)
+		log.Errorf(ctx, "can not upgrade to websocket: %v", err)
+		connBackend.Close()
 	}
 }
 
@@ -175,58 +184,60 @@ func prepareForwardHeader(_ context.Context, c *app.RequestContext) http.Header
 	return forwardHeader
 }
 
-func replicateWSReqConn(ctx context.Context, dst *websocket.Conn, src *hzws.Conn, errC chan error) {
+func replicateWSReqConn(ctx context.Context, dst *websocket.Conn, src *hzws.Conn, errC chan error, s *wsSession) {
 	for {
 		msgType, msg, err := src.ReadMessage()
 		if err != nil {
-			hlog.CtxErrorf(ctx, "read message failed when replicating websocket conn: msgType=%v msg=%v err=%v", msgType, msg, err)
+			s.log.Errorf(ctx, "read message failed when replicating websocket conn: msgType=%v msg=%v err=%v", msgType, msg, err)
 			var ce *hzws.CloseError
 			if errors.As(err, &ce) {
 				msg = hzws.FormatCloseMessage(ce.Code, ce.Text)
 			} else {
-				hlog.CtxErrorf(ctx, "read message failed when replicate websocket conn: err=%v", err)
+				s.log.Errorf(ctx, "read message failed when replicate websocket conn: err=%v", err)
 				msg = hzws.FormatCloseMessage(hzws.CloseAbnormalClosure, err.Error())
 			}
 			errC <- err
 
 			if err = dst.WriteMessage(websocket.CloseMessage, msg); err != nil {
-				hlog.CtxErrorf(ctx, "write message failed when replicate websocket conn: err=%v", err)
+				s.log.Errorf(ctx, "write message failed when replicate websocket conn: err=%v", err)
 			}
 			break
 		}
+		s.touch()
 
 		err = dst.WriteMessage(msgType, msg)
 		if err != nil {
-			hlog.CtxErrorf(ctx, "write message failed when replicating websocket conn: msgType=%v msg=%v err=%v", msgType, msg, err)
+			s.log.Errorf(ctx, "write message failed when replicating websocket conn: msgType=%v msg=%v err=%v", msgType, msg, err)
 			errC <- err
 			break
 		}
 	}
 }
 
-func replicateWSRespConn(ctx context.Context, dst *hzws.Conn, src *websocket.Conn, errC chan error) {
+func replicateWSRespConn(ctx context.Context, dst *hzws.Conn, src *websocket.Conn, errC chan error, s *wsSession) {
 	for {
 		msgType, msg, err := src.ReadMessage()
 		if err != nil {
-			hlog.CtxErrorf(ctx, "read message failed when replicating websocket conn: msgType=%v msg=%v err=%v", msgType, msg, err)
+			s.log.Errorf(ctx, "read message failed when replicating websocket conn: msgType=%v msg=%v err=%v", msgType, msg, err)
 			var ce *websocket.CloseError
 			if errors.As(err, &ce) {
 				msg = websocket.FormatCloseMessage(ce.Code, ce.Text)
 			} else {
-				hlog.CtxErrorf(ctx, "read message failed when replicate websocket conn: err=%v", err)
+				s.log.Errorf(ctx, "read message failed when replicate websocket conn: err=%v", err)
 				msg = websocket.FormatCloseMessage(websocket.CloseAbnormalClosure, err.Error())
 			}
 			errC <- err
 
 			if err = dst.WriteMessage(hzws.CloseMessage, msg); err != nil {
-				hlog.CtxErrorf(ctx, "write message failed when replicate websocket conn: err=%v", err)
+				s.log.Errorf(ctx, "write message failed when replicate websocket conn: err=%v", err)
 			}
 			break
 		}
+		s.touch()
 
 		err = dst.WriteMessage(msgType, msg)
 		if err != nil {
-			hlog.CtxErrorf(ctx, "write message failed when replicating websocket conn: msgType=%v msg=%v err=%v", msgType, msg, err)
+			s.log.Errorf(ctx, "write message failed when replicating websocket conn: msgType=%v msg=%v err=%v", msgType, msg, err)
 			errC <- err
 			break
 		}
@@ -17,6 +17,7 @@ package reverseproxy
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/gorilla/websocket"
@@ -31,6 +32,27 @@ type Options struct {
 	Director Director
 	Dialer   *websocket.Dialer
 	Upgrader *hzws.HertzUpgrader
+
+	// PingInterval and PongTimeout are set by WithHeartbeat
+	PingInterval time.Duration
+	PongTimeout  time.Duration
+	// IdleTimeout is set by WithIdleTimeout
+	IdleTimeout time.Duration
+	// MaxSessionDuration is set by WithMaxSessionDuration
+	MaxSessionDuration time.Duration
+
+	// Backends and Affinity are set by WithBackends and WithAffinity
+	Backends []string
+	Affinity *WSAffinity
+
+	// Logger is set by WithLogger
+	Logger Logger
+
+	// ForwardQuery, QueryMerge and QueryRewrite are set by
+	// WithQueryForwarding and WithQueryRewrite
+	ForwardQuery bool
+	QueryMerge   QueryMerge
+	QueryRewrite func(ctx context.Context, c *app.RequestContext, query string) string
 }
 
 var DefaultOptions = &Options{
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/common/test/assert"
@@ -51,3 +52,12 @@ func TestDefaultOptions(t *testing.T) {
 	assert.DeepEqual(t, DefaultOptions.Dialer, options.Dialer)
 	assert.DeepEqual(t, DefaultOptions.Upgrader, options.Upgrader)
 }
+
+func TestHeartbeatOptions(t *testing.T) {
+	options := newOptions(WithHeartbeat(time.Second, 0))
+	assert.DeepEqual(t, time.Second, options.PingInterval)
+	// without timeout, pongs are awaited for an interval
+	assert.DeepEqual(t, time.Second, options.PongTimeout)
+	options = newOptions(WithHeartbeat(time.Second, 2*time.Second))
+	assert.DeepEqual(t, 2*time.Second, options.PongTimeout)
+}
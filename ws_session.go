@@ -0,0 +1,218 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	hzws "github.com/hertz-contrib/websocket"
+)
+
+// WithHeartbeat makes the proxy ping the client and the backend every
+// interval and close sessions when either of them did not answer within
+// timeout, detecting half-open connections, e.g. behind NATs. A timeout
+// of 0 or less means interval. Pings of the peers are answered by the
+// proxy as before.
+func WithHeartbeat(interval, timeout time.Duration) Option {
+	if timeout <= 0 {
+		timeout = interval
+	}
+	return func(o *Options) {
+		o.PingInterval = interval
+		o.PongTimeout = timeout
+	}
+}
+
+// WithIdleTimeout closes sessions without messages in either direction for
+// longer than d with a close frame, freeing their goroutines and backend
+// connections. Pings and pongs do not count as activity.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.IdleTimeout = d
+	}
+}
+
+// WithMaxSessionDuration closes sessions after d with close code 1012
+// (service restart), which asks clients to reconnect, e.g. so that sessions
+// are rebalanced across backends. Both legs get wsCloseGrace to answer the
+// close frame before their connections are closed.
+func WithMaxSessionDuration(d time.Duration) Option {
+	return func(o *Options) {
+		o.MaxSessionDuration = d
+	}
+}
+
+// wsCloseGrace is how long a session closed gracefully waits for the
+// close frames of its legs.
+const wsCloseGrace = time.Second
+
+// wsSession is a proxied websocket session, watched by its monitor.
+type wsSession struct {
+	client  *hzws.Conn
+	backend *websocket.Conn
+	log     Logger
+
+	// lastClientPong and lastBackendPong are the unix nanoseconds of the
+	// last pong of each leg
+	lastClientPong  int64
+	lastBackendPong int64
+	// lastActivity is the unix nanoseconds of the last message
+	lastActivity int64
+
+	done    chan struct{}
+	stopped sync.WaitGroup
+	once    sync.Once
+}
+
+func newWSSession(client *hzws.Conn, backend *websocket.Conn, log Logger) *wsSession {
+	now := time.Now().UnixNano()
+	return &wsSession{
+		client:          client,
+		backend:         backend,
+		log:             log,
+		lastClientPong:  now,
+		lastBackendPong: now,
+		lastActivity:    now,
+		done:            make(chan struct{}),
+	}
+}
+
+// monitor starts watching the session as set by the options.
+func (s *wsSession) monitor(ctx context.Context, o *Options) {
+	if o.PingInterval <= 0 && o.IdleTimeout <= 0 && o.MaxSessionDuration <= 0 {
+		return
+	}
+	if o.PingInterval > 0 {
+		s.client.SetPongHandler(func(string) error {
+			atomic.StoreInt64(&s.lastClientPong, time.Now().UnixNano())
+			return nil
+		})
+		s.backend.SetPongHandler(func(string) error {
+			atomic.StoreInt64(&s.lastBackendPong, time.Now().UnixNano())
+			return nil
+		})
+	}
+	s.stopped.Add(1)
+	go func() {
+		defer s.stopped.Done()
+		var pings, idle, expired <-chan time.Time
+		if o.PingInterval > 0 {
+			ticker := time.NewTicker(o.PingInterval)
+			defer ticker.Stop()
+			pings = ticker.C
+		}
+		var idleTimer *time.Timer
+		if o.IdleTimeout > 0 {
+			idleTimer = time.NewTimer(o.IdleTimeout)
+			defer idleTimer.Stop()
+			idle = idleTimer.C
+		}
+		if o.MaxSessionDuration > 0 {
+			lifetime := time.NewTimer(o.MaxSessionDuration)
+			defer lifetime.Stop()
+			expired = lifetime.C
+		}
+		for {
+			var reason string
+			select {
+			case <-s.done:
+				return
+			case now := <-pings:
+				reason = s.heartbeat(now, o)
+			case now := <-idle:
+				left := time.Duration(atomic.LoadInt64(&s.lastActivity)-now.UnixNano()) + o.IdleTimeout
+				if left > 0 {
+					idleTimer.Reset(left)
+					continue
+				}
+				reason = "idle timeout"
+			case <-expired:
+				s.log.Debugf(ctx, "HERTZ: Closing websocket session: maximum duration reached")
+				s.close(websocket.CloseServiceRestart, "maximum session duration reached")
+				return
+			}
+			if reason != "" {
+				s.log.Warnf(ctx, "HERTZ: Closing websocket session: %s", reason)
+				s.kill(websocket.CloseGoingAway, reason)
+				return
+			}
+		}
+	}()
+}
+
+// touch records a message of either leg.
+func (s *wsSession) touch() {
+	atomic.StoreInt64(&s.lastActivity, time.Now().UnixNano())
+}
+
+// heartbeat checks the pongs of both legs and pings them again, returning
+// why the session is dead if it is.
+func (s *wsSession) heartbeat(now time.Time, o *Options) string {
+	limit := now.Add(-o.PingInterval - o.PongTimeout).UnixNano()
+	if atomic.LoadInt64(&s.lastClientPong) < limit {
+		return "client heartbeat timeout"
+	}
+	if atomic.LoadInt64(&s.lastBackendPong) < limit {
+		return "backend heartbeat timeout"
+	}
+	deadline := now.Add(o.PongTimeout)
+	if s.client.WriteControl(hzws.PingMessage, nil, deadline) != nil {
+		return "client ping failed"
+	}
+	if s.backend.WriteControl(websocket.PingMessage, nil, deadline) != nil {
+		return "backend ping failed"
+	}
+	return ""
+}
+
+// close sends both legs a close frame and kills the session unless it ended
+// within wsCloseGrace.
+func (s *wsSession) close(code int, reason string) {
+	s.sendClose(code, reason)
+	grace := time.NewTimer(wsCloseGrace)
+	defer grace.Stop()
+	select {
+	case <-s.done:
+	case <-grace.C:
+		s.kill(code, reason)
+	}
+}
+
+// kill sends both legs a close frame and closes them, which ends the
+// replication.
+func (s *wsSession) kill(code int, reason string) {
+	s.once.Do(func() {
+		s.sendClose(code, reason)
+		s.client.Close()
+		s.backend.Close()
+	})
+}
+
+func (s *wsSession) sendClose(code int, reason string) {
+	deadline := time.Now().Add(time.Second)
+	msg := websocket.FormatCloseMessage(code, reason)
+	s.client.WriteControl(hzws.CloseMessage, msg, deadline)       //nolint:errcheck
+	s.backend.WriteControl(websocket.CloseMessage, msg, deadline) //nolint:errcheck
+}
+
+// stop ends the monitor once the replication ended.
+func (s *wsSession) stop() {
+	close(s.done)
+	s.stopped.Wait()
+}
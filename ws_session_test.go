@@ -0,0 +1,166 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/server"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/gorilla/websocket"
+	hzws "github.com/hertz-contrib/websocket"
+)
+
+// startWSProxy serves an echo backend on backendAddr and proxy with opts on
+// proxyAddr. Backend sessions report their end on the returned channel.
+func startWSProxy(t *testing.T, proxyAddr, backendAddr string, opts ...Option) <-chan error {
+	ended := make(chan error, 4)
+	upgrader := &hzws.HertzUpgrader{}
+	bs := server.New(server.WithHostPorts(backendAddr))
+	bs.NoHijackConnPool = true
+	bs.GET("/echo", func(ctx context.Context, c *app.RequestContext) {
+		upgrader.Upgrade(c, func(conn *hzws.Conn) { //nolint:errcheck
+			for {
+				msgType, msg, err := conn.ReadMessage()
+				if err != nil {
+					ended <- err
+					return
+				}
+				conn.WriteMessage(msgType, msg) //nolint:errcheck
+			}
+		})
+	})
+	go bs.Spin()
+
+	proxy := NewWSReverseProxy("ws://"+backendAddr+"/echo", opts...)
+	ps := server.New(server.WithHostPorts(proxyAddr))
+	ps.NoHijackConnPool = true
+	ps.GET("/ws", proxy.ServeHTTP)
+	go ps.Spin()
+	t.Cleanup(func() {
+		bs.Shutdown(context.Background()) //nolint:errcheck
+		ps.Shutdown(context.Background()) //nolint:errcheck
+	})
+	time.Sleep(time.Second)
+	return ended
+}
+
+func TestWSHeartbeat(t *testing.T) {
+	ended := startWSProxy(t, "127.0.0.1:10057", "127.0.0.1:10058", WithHeartbeat(50*time.Millisecond, 50*time.Millisecond))
+
+	// a client reading its messages answers the pings and stays connected
+	alive, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:10057/ws", nil)
+	assert.Nil(t, err)
+	defer alive.Close()
+	echoed := make(chan string, 1)
+	go func() {
+		for {
+			_, msg, err := alive.ReadMessage()
+			if err != nil {
+				return
+			}
+			echoed <- string(msg)
+		}
+	}()
+
+	// a client not reading does not answer the pings, like a half-open connection
+	dead, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:10057/ws", nil)
+	assert.Nil(t, err)
+	defer dead.Close()
+
+	select {
+	case err := <-ended:
+		var ce *hzws.CloseError
+		assert.True(t, errors.As(err, &ce))
+		assert.DeepEqual(t, hzws.CloseGoingAway, ce.Code)
+		assert.DeepEqual(t, "client heartbeat timeout", ce.Text)
+	case <-time.After(2 * time.Second):
+		t.Fatal("session of the dead client not closed")
+	}
+	_, _, err = dead.ReadMessage()
+	var ce *websocket.CloseError
+	assert.True(t, errors.As(err, &ce))
+	assert.DeepEqual(t, websocket.CloseGoingAway, ce.Code)
+
+	assert.Nil(t, alive.WriteMessage(websocket.TextMessage, []byte("still there")))
+	select {
+	case msg := <-echoed:
+		assert.DeepEqual(t, "still there", msg)
+	case <-time.After(time.Second):
+		t.Fatal("session of the live client closed")
+	}
+}
+
+func TestWSIdleTimeout(t *testing.T) {
+	ended := startWSProxy(t, "127.0.0.1:10059", "127.0.0.1:10060", WithIdleTimeout(200*time.Millisecond))
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:10059/ws", nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+	// messages keep the session open beyond the idle timeout
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, conn.WriteMessage(websocket.TextMessage, []byte("ping")))
+		_, msg, err := conn.ReadMessage()
+		assert.Nil(t, err)
+		assert.DeepEqual(t, "ping", string(msg))
+		time.Sleep(80 * time.Millisecond)
+	}
+
+	start := time.Now()
+	_, _, err = conn.ReadMessage()
+	var ce *websocket.CloseError
+	assert.True(t, errors.As(err, &ce))
+	assert.DeepEqual(t, websocket.CloseGoingAway, ce.Code)
+	assert.DeepEqual(t, "idle timeout", ce.Text)
+	assert.True(t, time.Since(start) < 300*time.Millisecond)
+	select {
+	case err := <-ended:
+		assert.NotNil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("backend session not closed")
+	}
+}
+
+func TestWSMaxSessionDuration(t *testing.T) {
+	ended := startWSProxy(t, "127.0.0.1:10061", "127.0.0.1:10062", WithMaxSessionDuration(200*time.Millisecond))
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:10061/ws", nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+	start := time.Now()
+	assert.Nil(t, conn.WriteMessage(websocket.TextMessage, []byte("hello")))
+	_, msg, err := conn.ReadMessage()
+	assert.Nil(t, err)
+	assert.DeepEqual(t, "hello", string(msg))
+
+	_, _, err = conn.ReadMessage()
+	var ce *websocket.CloseError
+	assert.True(t, errors.As(err, &ce))
+	assert.DeepEqual(t, websocket.CloseServiceRestart, ce.Code)
+	elapsed := time.Since(start)
+	assert.True(t, elapsed >= 200*time.Millisecond && elapsed < 500*time.Millisecond)
+	select {
+	case err := <-ended:
+		var hzce *hzws.CloseError
+		assert.True(t, errors.As(err, &hzce))
+		assert.DeepEqual(t, hzws.CloseServiceRestart, hzce.Code)
+	case <-time.After(time.Second):
+		t.Fatal("backend session not closed")
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// XDSSnapshot is the subset of Envoy xDS resources a Router understands:
+// clusters with their endpoints (CDS/EDS) and virtual hosts with prefix
+// and path routes (RDS). XDSClient subscribes to a management server and
+// applies its snapshots; other xDS clients, e.g. an ADS stream of
+// go-control-plane, translate the resources they receive into a snapshot
+// and call Router.ApplyXDS, answering the management server with a NACK
+// if it returns an error.
+type XDSSnapshot struct {
+	Version      string
+	Clusters     []XDSCluster
+	VirtualHosts []XDSVirtualHost
+}
+
+// XDSCluster is a cluster and its endpoints. Requests are spread across the
+// healthy endpoints, or all endpoints if none is healthy, by a
+// LeastTimeBalancer.
+type XDSCluster struct {
+	Name string
+	// TLS is set if the cluster has a TLS transport socket.
+	TLS       bool
+	Endpoints []XDSEndpoint
+}
+
+// XDSEndpoint is an endpoint of a cluster.
+type XDSEndpoint struct {
+	Address   string
+	Port      int
+	Unhealthy bool
+}
+
+// XDSVirtualHost groups the routes of its domains. The domain "*" matches
+// any host, "*.example.com" any subdomain.
+type XDSVirtualHost struct {
+	Name    string
+	Domains []string
+	Routes  []XDSRoute
+}
+
+// XDSRoute matches requests by Prefix or Path and exact header values and
+// forwards them to Cluster. PrefixRewrite replaces the matched prefix, or
+// the path of a Path route.
+type XDSRoute struct {
+	Prefix        string
+	Path          string
+	Headers       map[string]string
+	Cluster       string
+	PrefixRewrite string
+	Timeout       time.Duration
+}
+
+// Routes converts the snapshot into routes for a Router. A prefix not
+// ending in "/" matches the path itself and its subtree, e.g. "/api"
+// matches "/api" and "/api/users" but not "/apis". The routes of clusters
+// with several endpoints get a new balancer; Router.ApplyXDS keeps them
+// across snapshots instead.
+func (s *XDSSnapshot) Routes() ([]Route, error) {
+	targets, err := s.targets()
+	if err != nil {
+		return nil, err
+	}
+	balancers := make(map[string]*LeastTimeBalancer)
+	for name, t := range targets {
+		if len(t) > 1 {
+			if balancers[name], err = NewLeastTimeBalancer(t, LeastTimeOptions{}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s.routes(targets, balancers)
+}
+
+// targets returns the targets of the endpoints of each cluster with
+// endpoints: the healthy ones, or all if none is healthy.
+func (s *XDSSnapshot) targets() (map[string][]string, error) {
+	targets := make(map[string][]string, len(s.Clusters))
+	for _, c := range s.Clusters {
+		scheme := "http://"
+		if c.TLS {
+			scheme = "https://"
+		}
+		var healthy, all []string
+		seen := make(map[string]bool, len(c.Endpoints))
+		for _, e := range c.Endpoints {
+			target := scheme + net.JoinHostPort(e.Address, strconv.Itoa(e.Port))
+			if seen[target] {
+				continue
+			}
+			seen[target] = true
+			if !e.Unhealthy {
+				healthy = append(healthy, target)
+			}
+			all = append(all, target)
+		}
+		if len(healthy) == 0 {
+			healthy = all
+		}
+		if len(healthy) == 0 {
+			continue
+		}
+		if err := validateTargets(healthy); err != nil {
+			return nil, fmt.Errorf("reverseproxy: cluster %q: %w", c.Name, err)
+		}
+		targets[c.Name] = healthy
+	}
+	return targets, nil
+}
+
+// routes converts the snapshot into routes to the first target of each
+// cluster, balanced by balancers if the cluster has one.
+func (s *XDSSnapshot) routes(clusterTargets map[string][]string, balancers map[string]*LeastTimeBalancer) ([]Route, error) {
+	var routes []Route
+	for _, vh := range s.VirtualHosts {
+		domains := vh.Domains
+		if len(domains) == 0 {
+			domains = []string{"*"}
+		}
+		for _, xr := range vh.Routes {
+			targets, ok := clusterTargets[xr.Cluster]
+			if !ok {
+				// clusters without endpoints answer like unmatched requests
+				if !s.hasCluster(xr.Cluster) {
+					return nil, fmt.Errorf("reverseproxy: virtual host %q routes to unknown cluster %q", vh.Name, xr.Cluster)
+				}
+				continue
+			}
+			target := targets[0]
+			var matched []Route
+			switch {
+			case xr.Path != "" && xr.Prefix != "":
+				return nil, fmt.Errorf("reverseproxy: virtual host %q has a route with both prefix and path", vh.Name)
+			case xr.Path != "":
+				matched = append(matched, xdsExactRoute(xr.Path, target, xr))
+			case xr.Prefix == "":
+				return nil, fmt.Errorf("reverseproxy: virtual host %q has a route without prefix or path", vh.Name)
+			default:
+				prefix := xr.Prefix
+				if !strings.HasSuffix(prefix, "/") {
+					matched = append(matched, xdsExactRoute(prefix, target, xr))
+					prefix += "/"
+				}
+				route := Route{Path: prefix, Target: target}
+				if xr.PrefixRewrite != "" {
+					route.StripPrefix = true
+					route.AddPrefix = strings.TrimSuffix(xr.PrefixRewrite, "/")
+				}
+				matched = append(matched, route)
+			}
+			for _, domain := range domains {
+				if domain == "*" {
+					domain = ""
+				} else if strings.Contains(strings.TrimPrefix(domain, "*."), "*") {
+					return nil, fmt.Errorf("reverseproxy: unsupported domain %q of virtual host %q", domain, vh.Name)
+				}
+				for _, route := range matched {
+					route.Host = domain
+					route.Headers = xr.Headers
+					route.Timeout = xr.Timeout
+					if b := balancers[xr.Cluster]; b != nil {
+						route.Balancer = b
+					}
+					routes = append(routes, route)
+				}
+			}
+		}
+	}
+	return routes, nil
+}
+
+func (s *XDSSnapshot) hasCluster(name string) bool {
+	for _, c := range s.Clusters {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// xdsExactRoute matches path exactly, replacing it by the PrefixRewrite of xr if set.
+func xdsExactRoute(path, target string, xr XDSRoute) Route {
+	if xr.PrefixRewrite == "" {
+		return Route{Path: path, Target: target}
+	}
+	return Route{Path: "^" + regexp.QuoteMeta(path) + "$", Target: target + xr.PrefixRewrite}
+}
+
+// ApplyXDS atomically replaces the routes of the Router by those of the
+// snapshot, see ReplaceTable. On error the current routes are kept. The
+// balancer of a cluster is kept while it has several endpoints, so that
+// endpoints keep their latencies when others are added or removed.
+func (rt *Router) ApplyXDS(s XDSSnapshot) error {
+	rt.xdsMu.Lock()
+	defer rt.xdsMu.Unlock()
+	targets, err := s.targets()
+	if err != nil {
+		return err
+	}
+	balancers := make(map[string]*LeastTimeBalancer)
+	for name, t := range targets {
+		if len(t) < 2 {
+			continue
+		}
+		b := rt.xdsBalancers[name]
+		if b == nil {
+			if b, err = NewLeastTimeBalancer(t, LeastTimeOptions{}); err != nil {
+				return err
+			}
+		}
+		balancers[name] = b
+	}
+	routes, err := s.routes(targets, balancers)
+	if err != nil {
+		return err
+	}
+	if err = rt.ReplaceTable(routes); err != nil {
+		return err
+	}
+	for name, b := range balancers {
+		// the targets were validated above
+		_ = b.SetTargets(targets[name])
+	}
+	rt.xdsBalancers = balancers
+	return nil
+}
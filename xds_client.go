@@ -0,0 +1,496 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app/client"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+// The type URLs of the xDS resources XDSClient subscribes to.
+const (
+	XDSClusterType  = "type.googleapis.com/envoy.config.cluster.v3.Cluster"
+	XDSEndpointType = "type.googleapis.com/envoy.config.endpoint.v3.ClusterLoadAssignment"
+	XDSRouteType    = "type.googleapis.com/envoy.config.route.v3.RouteConfiguration"
+)
+
+// xdsInvalidArgument is the gRPC status code of NACKs.
+const xdsInvalidArgument = 3
+
+// DefaultXDSTimeout is the timeout of the discovery requests of an
+// XDSClient without Timeout.
+const DefaultXDSTimeout = 10 * time.Second
+
+// XDSClientOptions configures an XDSClient.
+type XDSClientOptions struct {
+	// NodeID and NodeCluster identify the proxy to the management server,
+	// see the node of Envoy's bootstrap config.
+	NodeID      string
+	NodeCluster string
+	// RouteConfigs are the names of the route configurations to subscribe
+	// to, in the order their virtual hosts are tried. All route
+	// configurations of the server are used if empty.
+	RouteConfigs []string
+	// Client sends the discovery requests, a new client.Client if nil.
+	Client Doer
+	// Timeout limits each discovery request, DefaultXDSTimeout if 0.
+	Timeout time.Duration
+}
+
+// XDSClient subscribes a Router to the clusters, endpoints and route
+// configurations of an xDS management server, e.g. one of go-control-plane,
+// using the REST-JSON polling transport of the xDS protocol:
+//
+//	xc, err := reverseproxy.NewXDSClient("http://xds:18000", rt, reverseproxy.XDSClientOptions{NodeID: "edge-1"})
+//	if err != nil {
+//		...
+//	}
+//	defer xc.Watch(5 * time.Second)()
+//
+// Each poll applies the resources of the server, see XDSSnapshot, and
+// answers them with an ACK, or with a NACK carrying the error if they were
+// rejected, in which case the current routes are kept. Clusters are
+// discovered with their endpoints inline or by EDS; listeners are not
+// discovered, see RouteConfigs.
+type XDSClient struct {
+	server string
+	router *Router
+	opts   XDSClientOptions
+
+	// mu serializes Poll
+	mu        sync.Mutex
+	clusters  xdsSubscription
+	endpoints xdsSubscription
+	routes    xdsSubscription
+}
+
+// xdsSubscription is the state of the subscription to a resource type.
+type xdsSubscription struct {
+	path, typeURL string
+	// version and resources were accepted last, if accepted
+	version   string
+	resources []json.RawMessage
+	accepted  bool
+	// nonce is that of the last response
+	nonce string
+	// nack is sent while the resources of the last response are rejected
+	nack *xdsStatus
+}
+
+// xdsFetch is the result of a discovery request.
+type xdsFetch struct {
+	sub       *xdsSubscription
+	version   string
+	resources []json.RawMessage
+	// updated is false if the server answered "not modified" or with the
+	// accepted version
+	updated bool
+}
+
+// NewXDSClient returns an XDSClient of the management server at server,
+// e.g. "http://xds:18000", updating the routes of rt.
+func NewXDSClient(server string, rt *Router, opts XDSClientOptions) (*XDSClient, error) {
+	if rt == nil {
+		return nil, errors.New("reverseproxy: xDS client needs a router")
+	}
+	if _, err := parseTarget(server); err != nil {
+		return nil, err
+	}
+	if opts.Client == nil {
+		c, err := client.NewClient()
+		if err != nil {
+			return nil, err
+		}
+		opts.Client = c
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultXDSTimeout
+	}
+	return &XDSClient{
+		server:    strings.TrimSuffix(server, "/"),
+		router:    rt,
+		opts:      opts,
+		clusters:  xdsSubscription{path: "/v3/discovery:clusters", typeURL: XDSClusterType},
+		endpoints: xdsSubscription{path: "/v3/discovery:endpoints", typeURL: XDSEndpointType},
+		routes:    xdsSubscription{path: "/v3/discovery:routes", typeURL: XDSRouteType},
+	}, nil
+}
+
+// Poll fetches the resources of the management server and applies them to
+// the Router if any changed. The error of rejected resources is also sent
+// to the server with the next poll.
+func (x *XDSClient) Poll(ctx context.Context) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	cds, err := x.fetch(ctx, &x.clusters, nil)
+	if err != nil {
+		return err
+	}
+	clusters, err := decodeXDSClusters(cds.resources)
+	if err != nil {
+		return rejectXDS(err, cds)
+	}
+	var names []string
+	for _, c := range clusters {
+		if c.Type == "EDS" {
+			names = append(names, c.serviceName())
+		}
+	}
+	eds, err := x.fetch(ctx, &x.endpoints, names)
+	if err != nil {
+		return err
+	}
+	assignments, err := decodeXDSLoadAssignments(eds.resources)
+	if err != nil {
+		return rejectXDS(err, eds)
+	}
+	rds, err := x.fetch(ctx, &x.routes, x.opts.RouteConfigs)
+	if err != nil {
+		return err
+	}
+	vhosts, err := decodeXDSRouteConfigurations(rds.resources, x.opts.RouteConfigs)
+	if err != nil {
+		return rejectXDS(err, rds)
+	}
+	if !cds.updated && !eds.updated && !rds.updated {
+		return nil
+	}
+
+	s := XDSSnapshot{
+		Version:      cds.version + "/" + eds.version + "/" + rds.version,
+		VirtualHosts: vhosts,
+	}
+	for _, c := range clusters {
+		cluster := XDSCluster{Name: c.Name, TLS: c.tls()}
+		la := c.LoadAssignment
+		if c.Type == "EDS" {
+			la = assignments[c.serviceName()]
+		}
+		if la != nil {
+			cluster.Endpoints = la.endpoints()
+		}
+		s.Clusters = append(s.Clusters, cluster)
+	}
+	if err = x.router.ApplyXDS(s); err != nil {
+		return rejectXDS(err, cds, eds, rds)
+	}
+	for _, f := range []*xdsFetch{cds, eds, rds} {
+		if f.updated {
+			f.sub.version, f.sub.resources, f.sub.accepted, f.sub.nack = f.version, f.resources, true, nil
+		}
+	}
+	return nil
+}
+
+// rejectXDS makes the next requests of the updated fetches NACK them with err.
+func rejectXDS(err error, fetches ...*xdsFetch) error {
+	for _, f := range fetches {
+		if f.updated {
+			f.sub.nack = &xdsStatus{Code: xdsInvalidArgument, Message: err.Error()}
+		}
+	}
+	return err
+}
+
+// Watch polls the management server now and then every interval until
+// stop is called. Failed polls are logged with the logger of the Router.
+func (x *XDSClient) Watch(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := x.Poll(context.Background()); err != nil {
+				orHlog(x.router.logger).Errorf(context.Background(), "HERTZ: xDS update from %s failed: %v", x.server, err)
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// fetch sends the discovery request of sub for names, all if empty.
+func (x *XDSClient) fetch(ctx context.Context, sub *xdsSubscription, names []string) (*xdsFetch, error) {
+	body, err := json.Marshal(xdsDiscoveryRequest{
+		VersionInfo:   sub.version,
+		Node:          xdsNode{ID: x.opts.NodeID, Cluster: x.opts.NodeCluster},
+		ResourceNames: names,
+		TypeURL:       sub.typeURL,
+		ResponseNonce: sub.nonce,
+		ErrorDetail:   sub.nack,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, resp := protocol.AcquireRequest(), protocol.AcquireResponse()
+	defer func() {
+		protocol.ReleaseRequest(req)
+		protocol.ReleaseResponse(resp)
+	}()
+	req.SetMethod(consts.MethodPost)
+	req.SetRequestURI(x.server + sub.path)
+	req.Header.SetContentTypeBytes([]byte(consts.MIMEApplicationJSON))
+	req.SetBody(body)
+	if err = doWithTimeout(ctx, x.opts.Client, req, resp, x.opts.Timeout); err != nil {
+		return nil, fmt.Errorf("reverseproxy: xDS request for %s: %w", sub.typeURL, err)
+	}
+	switch resp.StatusCode() {
+	case consts.StatusNotModified:
+		return &xdsFetch{sub: sub, version: sub.version, resources: sub.resources}, nil
+	case consts.StatusOK:
+	default:
+		return nil, fmt.Errorf("reverseproxy: xDS request for %s: status %d", sub.typeURL, resp.StatusCode())
+	}
+	var dr xdsDiscoveryResponse
+	if err = json.Unmarshal(resp.Body(), &dr); err != nil {
+		return nil, fmt.Errorf("reverseproxy: xDS response for %s: %w", sub.typeURL, err)
+	}
+	sub.nonce = dr.Nonce
+	if sub.accepted && dr.VersionInfo == sub.version {
+		// the server went back to the accepted version
+		sub.nack = nil
+		return &xdsFetch{sub: sub, version: sub.version, resources: sub.resources}, nil
+	}
+	return &xdsFetch{sub: sub, version: dr.VersionInfo, resources: dr.Resources, updated: true}, nil
+}
+
+// The messages of the REST-JSON transport, in the JSON mapping of proto3.
+type (
+	xdsDiscoveryRequest struct {
+		VersionInfo   string     `json:"versionInfo,omitempty"`
+		Node          xdsNode    `json:"node"`
+		ResourceNames []string   `json:"resourceNames,omitempty"`
+		TypeURL       string     `json:"typeUrl"`
+		ResponseNonce string     `json:"responseNonce,omitempty"`
+		ErrorDetail   *xdsStatus `json:"errorDetail,omitempty"`
+	}
+	xdsNode struct {
+		ID      string `json:"id,omitempty"`
+		Cluster string `json:"cluster,omitempty"`
+	}
+	xdsStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	xdsDiscoveryResponse struct {
+		VersionInfo string            `json:"versionInfo"`
+		Resources   []json.RawMessage `json:"resources"`
+		Nonce       string            `json:"nonce"`
+	}
+)
+
+// The subset of the xDS resources converted into an XDSSnapshot.
+type (
+	xdsClusterResource struct {
+		Type             string `json:"type"`
+		Name             string `json:"name"`
+		EDSClusterConfig *struct {
+			ServiceName string `json:"serviceName"`
+		} `json:"edsClusterConfig"`
+		LoadAssignment  *xdsLoadAssignment `json:"loadAssignment"`
+		TransportSocket *struct {
+			Name        string `json:"name"`
+			TypedConfig struct {
+				Type string `json:"@type"`
+			} `json:"typedConfig"`
+		} `json:"transportSocket"`
+	}
+	xdsLoadAssignment struct {
+		ClusterName string `json:"clusterName"`
+		Endpoints   []struct {
+			LBEndpoints []struct {
+				Endpoint struct {
+					Address struct {
+						SocketAddress struct {
+							Address   string `json:"address"`
+							PortValue int    `json:"portValue"`
+						} `json:"socketAddress"`
+					} `json:"address"`
+				} `json:"endpoint"`
+				HealthStatus string `json:"healthStatus"`
+			} `json:"lbEndpoints"`
+		} `json:"endpoints"`
+	}
+	xdsRouteConfiguration struct {
+		Name         string `json:"name"`
+		VirtualHosts []struct {
+			Name    string   `json:"name"`
+			Domains []string `json:"domains"`
+			Routes  []struct {
+				Match struct {
+					Prefix  string `json:"prefix"`
+					Path    string `json:"path"`
+					Headers []struct {
+						Name         string `json:"name"`
+						ExactMatch   string `json:"exactMatch"`
+						PresentMatch bool   `json:"presentMatch"`
+						InvertMatch  bool   `json:"invertMatch"`
+						StringMatch  *struct {
+							Exact *string `json:"exact"`
+						} `json:"stringMatch"`
+					} `json:"headers"`
+				} `json:"match"`
+				Route *struct {
+					Cluster       string `json:"cluster"`
+					PrefixRewrite string `json:"prefixRewrite"`
+					Timeout       string `json:"timeout"`
+				} `json:"route"`
+			} `json:"routes"`
+		} `json:"virtualHosts"`
+	}
+)
+
+func (c *xdsClusterResource) serviceName() string {
+	if c.EDSClusterConfig != nil && c.EDSClusterConfig.ServiceName != "" {
+		return c.EDSClusterConfig.ServiceName
+	}
+	return c.Name
+}
+
+func (c *xdsClusterResource) tls() bool {
+	ts := c.TransportSocket
+	return ts != nil && (ts.Name == "envoy.transport_sockets.tls" || strings.HasSuffix(ts.TypedConfig.Type, ".UpstreamTlsContext"))
+}
+
+func (la *xdsLoadAssignment) endpoints() []XDSEndpoint {
+	var endpoints []XDSEndpoint
+	for _, locality := range la.Endpoints {
+		for _, lb := range locality.LBEndpoints {
+			addr := lb.Endpoint.Address.SocketAddress
+			switch lb.HealthStatus {
+			case "UNHEALTHY", "DRAINING", "TIMEOUT":
+				endpoints = append(endpoints, XDSEndpoint{Address: addr.Address, Port: addr.PortValue, Unhealthy: true})
+			default:
+				endpoints = append(endpoints, XDSEndpoint{Address: addr.Address, Port: addr.PortValue})
+			}
+		}
+	}
+	return endpoints
+}
+
+func decodeXDSClusters(resources []json.RawMessage) ([]*xdsClusterResource, error) {
+	clusters := make([]*xdsClusterResource, 0, len(resources))
+	for _, raw := range resources {
+		c := &xdsClusterResource{}
+		if err := json.Unmarshal(raw, c); err != nil {
+			return nil, fmt.Errorf("reverseproxy: xDS cluster: %w", err)
+		}
+		switch c.Type {
+		case "", "STATIC", "STRICT_DNS", "LOGICAL_DNS", "EDS":
+		default:
+			return nil, fmt.Errorf("reverseproxy: unsupported type %q of xDS cluster %q", c.Type, c.Name)
+		}
+		clusters = append(clusters, c)
+	}
+	return clusters, nil
+}
+
+func decodeXDSLoadAssignments(resources []json.RawMessage) (map[string]*xdsLoadAssignment, error) {
+	assignments := make(map[string]*xdsLoadAssignment, len(resources))
+	for _, raw := range resources {
+		la := &xdsLoadAssignment{}
+		if err := json.Unmarshal(raw, la); err != nil {
+			return nil, fmt.Errorf("reverseproxy: xDS cluster load assignment: %w", err)
+		}
+		assignments[la.ClusterName] = la
+	}
+	return assignments, nil
+}
+
+// decodeXDSRouteConfigurations returns the virtual hosts of the route
+// configurations, ordered by names if given. Routes which do not forward
+// to a cluster, e.g. redirects, are skipped.
+func decodeXDSRouteConfigurations(resources []json.RawMessage, names []string) ([]XDSVirtualHost, error) {
+	configs := make([]*xdsRouteConfiguration, 0, len(resources))
+	for _, raw := range resources {
+		rc := &xdsRouteConfiguration{}
+		if err := json.Unmarshal(raw, rc); err != nil {
+			return nil, fmt.Errorf("reverseproxy: xDS route configuration: %w", err)
+		}
+		configs = append(configs, rc)
+	}
+	if len(names) > 0 {
+		rank := make(map[string]int, len(names))
+		for i, name := range names {
+			rank[name] = i
+		}
+		ordered := make([]*xdsRouteConfiguration, 0, len(configs))
+		for _, rc := range configs {
+			if _, ok := rank[rc.Name]; ok {
+				ordered = append(ordered, rc)
+			}
+		}
+		sort.SliceStable(ordered, func(i, j int) bool { return rank[ordered[i].Name] < rank[ordered[j].Name] })
+		configs = ordered
+	}
+
+	var vhosts []XDSVirtualHost
+	for _, rc := range configs {
+		for _, v := range rc.VirtualHosts {
+			vh := XDSVirtualHost{Name: v.Name, Domains: v.Domains}
+			for _, r := range v.Routes {
+				if r.Route == nil || r.Route.Cluster == "" {
+					continue
+				}
+				xr := XDSRoute{
+					Prefix:        r.Match.Prefix,
+					Path:          r.Match.Path,
+					Cluster:       r.Route.Cluster,
+					PrefixRewrite: r.Route.PrefixRewrite,
+				}
+				if r.Route.Timeout != "" {
+					timeout, err := time.ParseDuration(r.Route.Timeout)
+					if err != nil {
+						return nil, fmt.Errorf("reverseproxy: virtual host %q: invalid timeout: %w", v.Name, err)
+					}
+					xr.Timeout = timeout
+				}
+				for _, h := range r.Match.Headers {
+					if xr.Headers == nil {
+						xr.Headers = make(map[string]string, len(r.Match.Headers))
+					}
+					switch {
+					case h.InvertMatch:
+						return nil, fmt.Errorf("reverseproxy: virtual host %q: unsupported inverted match of header %q", v.Name, h.Name)
+					case h.StringMatch != nil && h.StringMatch.Exact != nil:
+						xr.Headers[h.Name] = *h.StringMatch.Exact
+					case h.StringMatch == nil && (h.ExactMatch != "" || h.PresentMatch):
+						xr.Headers[h.Name] = h.ExactMatch
+					default:
+						return nil, fmt.Errorf("reverseproxy: virtual host %q: unsupported match of header %q", v.Name, h.Name)
+					}
+				}
+				vh.Routes = append(vh.Routes, xr)
+			}
+			vhosts = append(vhosts, vh)
+		}
+	}
+	return vhosts, nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func TestXDSClient(t *testing.T) {
+	resources := map[string]string{
+		"/v3/discovery:clusters": `{"versionInfo": "1", "nonce": "c1", "resources": [
+			{"@type": "type.googleapis.com/envoy.config.cluster.v3.Cluster", "name": "api", "type": "EDS", "edsClusterConfig": {"serviceName": "api-eds"}},
+			{"@type": "type.googleapis.com/envoy.config.cluster.v3.Cluster", "name": "auth", "transportSocket": {"name": "envoy.transport_sockets.tls"},
+			 "loadAssignment": {"clusterName": "auth", "endpoints": [{"lbEndpoints": [{"endpoint": {"address": {"socketAddress": {"address": "auth", "portValue": 8443}}}}]}]}}
+		]}`,
+		"/v3/discovery:endpoints": `{"versionInfo": "1", "nonce": "e1", "resources": [
+			{"@type": "type.googleapis.com/envoy.config.endpoint.v3.ClusterLoadAssignment", "clusterName": "api-eds", "endpoints": [{"lbEndpoints": [
+				{"endpoint": {"address": {"socketAddress": {"address": "10.0.0.1", "portValue": 8080}}}, "healthStatus": "UNHEALTHY"},
+				{"endpoint": {"address": {"socketAddress": {"address": "10.0.0.2", "portValue": 8080}}}, "healthStatus": "HEALTHY"}
+			]}]}
+		]}`,
+		"/v3/discovery:routes": `{"versionInfo": "1", "nonce": "r1", "resources": [
+			{"@type": "type.googleapis.com/envoy.config.route.v3.RouteConfiguration", "name": "other", "virtualHosts": [
+				{"name": "other", "domains": ["other.com"], "routes": [{"match": {"prefix": "/"}, "route": {"cluster": "api"}}]}
+			]},
+			{"@type": "type.googleapis.com/envoy.config.route.v3.RouteConfiguration", "name": "local", "virtualHosts": [
+				{"name": "all", "domains": ["*"], "routes": [
+					{"match": {"prefix": "/api/"}, "route": {"cluster": "api", "prefixRewrite": "/v2/", "timeout": "1.5s"}},
+					{"match": {"path": "/login", "headers": [{"name": "X-Canary", "stringMatch": {"exact": "1"}}]}, "route": {"cluster": "auth"}},
+					{"match": {"prefix": "/old"}, "redirect": {"pathRedirect": "/new"}}
+				]}
+			]}
+		]}`,
+	}
+	rt, err := NewRouter(nil)
+	assert.Nil(t, err)
+	var requests []xdsDiscoveryRequest
+	notModified := false
+	x, err := NewXDSClient("http://xds:18000/", rt, XDSClientOptions{
+		NodeID:       "edge-1",
+		RouteConfigs: []string{"local"},
+		Client: DoerFunc(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+			var dr xdsDiscoveryRequest
+			assert.Nil(t, json.Unmarshal(req.Body(), &dr))
+			requests = append(requests, dr)
+			assert.DeepEqual(t, "xds:18000", string(req.Host()))
+			if notModified {
+				resp.SetStatusCode(304)
+				return nil
+			}
+			resp.SetBodyString(resources[string(req.URI().Path())])
+			return nil
+		}),
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, x.Poll(context.Background()))
+	assert.DeepEqual(t, []Route{
+		{Path: "/api/", Target: "http://10.0.0.2:8080", StripPrefix: true, AddPrefix: "/v2", Timeout: 1500 * time.Millisecond},
+		{Path: "/login", Target: "https://auth:8443", Headers: map[string]string{"X-Canary": "1"}},
+	}, rt.Routes())
+	assert.DeepEqual(t, []xdsDiscoveryRequest{
+		{Node: xdsNode{ID: "edge-1"}, TypeURL: XDSClusterType},
+		{Node: xdsNode{ID: "edge-1"}, TypeURL: XDSEndpointType, ResourceNames: []string{"api-eds"}},
+		{Node: xdsNode{ID: "edge-1"}, TypeURL: XDSRouteType, ResourceNames: []string{"local"}},
+	}, requests)
+
+	// the next polls ACK the accepted versions
+	notModified, requests = true, nil
+	assert.Nil(t, x.Poll(context.Background()))
+	assert.DeepEqual(t, "1", requests[0].VersionInfo)
+	assert.DeepEqual(t, "c1", requests[0].ResponseNonce)
+	assert.DeepEqual(t, "r1", requests[2].ResponseNonce)
+	assert.DeepEqual(t, 2, len(rt.Routes()))
+
+	// rejected resources are NACKed, keeping the routes
+	resources["/v3/discovery:routes"] = `{"versionInfo": "2", "nonce": "r2", "resources": [
+		{"@type": "type.googleapis.com/envoy.config.route.v3.RouteConfiguration", "name": "local", "virtualHosts": [
+			{"name": "all", "routes": [{"match": {"prefix": "/"}, "route": {"cluster": "missing"}}]}
+		]}
+	]}`
+	notModified = false
+	assert.NotNil(t, x.Poll(context.Background()))
+	assert.DeepEqual(t, 2, len(rt.Routes()))
+	requests = nil
+	assert.NotNil(t, x.Poll(context.Background()))
+	assert.DeepEqual(t, "1", requests[2].VersionInfo)
+	assert.DeepEqual(t, "r2", requests[2].ResponseNonce)
+	assert.NotNil(t, requests[2].ErrorDetail)
+	assert.Nil(t, requests[0].ErrorDetail)
+
+	_, err = NewXDSClient("xds:18000", rt, XDSClientOptions{})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reverseproxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+)
+
+func TestXDSSnapshotRoutes(t *testing.T) {
+	s := XDSSnapshot{
+		Version: "1",
+		Clusters: []XDSCluster{
+			{Name: "api", Endpoints: []XDSEndpoint{{Address: "10.0.0.1", Port: 8080, Unhealthy: true}, {Address: "10.0.0.2", Port: 8080}}},
+			{Name: "auth", TLS: true, Endpoints: []XDSEndpoint{{Address: "auth", Port: 8443}}},
+			{Name: "empty"},
+		},
+		VirtualHosts: []XDSVirtualHost{
+			{Name: "public", Domains: []string{"example.com", "*.example.com"}, Routes: []XDSRoute{
+				{Prefix: "/api", Cluster: "api", PrefixRewrite: "/v2", Timeout: time.Second},
+			}},
+			{Name: "default", Domains: []string{"*"}, Routes: []XDSRoute{
+				{Path: "/login", Cluster: "auth", Headers: map[string]string{"X-Canary": "1"}},
+				{Path: "/logout", Cluster: "auth", PrefixRewrite: "/session/end"},
+				{Prefix: "/", Cluster: "empty"},
+			}},
+		},
+	}
+	routes, err := s.Routes()
+	assert.Nil(t, err)
+	assert.DeepEqual(t, []Route{
+		{Host: "example.com", Path: `^/api$`, Target: "http://10.0.0.2:8080/v2", Timeout: time.Second},
+		{Host: "example.com", Path: "/api/", Target: "http://10.0.0.2:8080", StripPrefix: true, AddPrefix: "/v2", Timeout: time.Second},
+		{Host: "*.example.com", Path: `^/api$`, Target: "http://10.0.0.2:8080/v2", Timeout: time.Second},
+		{Host: "*.example.com", Path: "/api/", Target: "http://10.0.0.2:8080", StripPrefix: true, AddPrefix: "/v2", Timeout: time.Second},
+		{Path: "/login", Target: "https://auth:8443", Headers: map[string]string{"X-Canary": "1"}},
+		{Path: `^/logout$`, Target: "https://auth:8443/session/end"},
+	}, routes)
+
+	rt, err := NewRouter(nil)
+	assert.Nil(t, err)
+	assert.Nil(t, rt.ApplyXDS(s))
+	assert.DeepEqual(t, 6, len(rt.Routes()))
+
+	for _, vh := range []XDSVirtualHost{
+		{Routes: []XDSRoute{{Prefix: "/", Cluster: "missing"}}},
+		{Routes: []XDSRoute{{Cluster: "api"}}},
+		{Routes: []XDSRoute{{Prefix: "/", Path: "/a", Cluster: "api"}}},
+		{Domains: []string{"api-*"}, Routes: []XDSRoute{{Prefix: "/", Cluster: "api"}}},
+	} {
+		s.VirtualHosts = []XDSVirtualHost{vh}
+		assert.NotNil(t, rt.ApplyXDS(s))
+	}
+	// failed updates keep the current routes
+	assert.DeepEqual(t, 6, len(rt.Routes()))
+}
+
+func TestXDSBalancedClusters(t *testing.T) {
+	s := XDSSnapshot{
+		Clusters: []XDSCluster{
+			{Name: "api", Endpoints: []XDSEndpoint{{Address: "10.0.0.1", Port: 8080}, {Address: "10.0.0.2", Port: 8080}, {Address: "10.0.0.3", Port: 8080, Unhealthy: true}}},
+		},
+		VirtualHosts: []XDSVirtualHost{{Routes: []XDSRoute{{Path: "/users", Cluster: "api"}}}},
+	}
+	routes, err := s.Routes()
+	assert.Nil(t, err)
+	assert.DeepEqual(t, 1, len(routes))
+	assert.DeepEqual(t, "http://10.0.0.1:8080", routes[0].Target)
+	b, ok := routes[0].Balancer.(*LeastTimeBalancer)
+	assert.True(t, ok)
+	assert.DeepEqual(t, []string{"http://10.0.0.1:8080", "http://10.0.0.2:8080"}, b.state.Load().(*leastTimeState).targets)
+
+	rt, err := NewRouter(nil)
+	assert.Nil(t, err)
+	assert.Nil(t, rt.ApplyXDS(s))
+	b = rt.Routes()[0].Balancer.(*LeastTimeBalancer)
+	b.Done("http://10.0.0.2:8080", 200, 50*time.Millisecond)
+
+	// the balancer and the latencies of the remaining endpoints are kept
+	s.Clusters[0].Endpoints = []XDSEndpoint{{Address: "10.0.0.2", Port: 8080}, {Address: "10.0.0.4", Port: 8080}}
+	assert.Nil(t, rt.ApplyXDS(s))
+	assert.True(t, b == rt.Routes()[0].Balancer)
+	assert.DeepEqual(t, []string{"http://10.0.0.2:8080", "http://10.0.0.4:8080"}, b.state.Load().(*leastTimeState).targets)
+	assert.DeepEqual(t, 50*time.Millisecond, b.Latency("http://10.0.0.2:8080"))
+
+	// a single endpoint needs no balancer
+	s.Clusters[0].Endpoints = s.Clusters[0].Endpoints[:1]
+	assert.Nil(t, rt.ApplyXDS(s))
+	assert.Nil(t, rt.Routes()[0].Balancer)
+	assert.DeepEqual(t, "http://10.0.0.2:8080", rt.Routes()[0].Target)
+}